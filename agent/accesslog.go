@@ -0,0 +1,88 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"port-forward-common/accesslog"
+	"port-forward-common/conns"
+)
+
+var (
+	accessLogDir        string
+	accessLogMaxSize    int
+	accessLogMaxBackups int
+)
+
+// initAccessLog 未指定 -access-log-dir 时使用数据目录下的 access-logs
+func initAccessLog() {
+	if accessLogDir == "" {
+		accessLogDir = filepath.Join(dataDir, "access-logs")
+	}
+	if accessLogMaxSize < 1 {
+		accessLogMaxSize = 1
+	}
+}
+
+func newTunnelAccessLog(id string) *accesslog.Writer {
+	return accesslog.NewWriter(accesslog.Path(accessLogDir, id), int64(accessLogMaxSize)<<20, accessLogMaxBackups)
+}
+
+func (t *Tunnel) writeAccessLog(e accesslog.Entry) {
+	if err := t.accessLog.Write(e); err != nil {
+		log.Printf("Failed to write access log for %s: %v", t.ID, err)
+	}
+}
+
+func (t *Tunnel) logConnect(c *conns.Conn) {
+	if t.logAccess.Load() {
+		t.writeAccessLog(accesslog.ConnectEntry(t.ID, c))
+	}
+}
+
+func (t *Tunnel) logClose(c *conns.Conn, reason string, cause error) {
+	if t.logAccess.Load() {
+		t.writeAccessLog(accesslog.CloseEntry(t.ID, c, reason, cause))
+	}
+}
+
+// closeReason 根据连接结束时的错误判断关闭原因
+func (t *Tunnel) closeReason(c *conns.Conn, err error) string {
+	return accesslog.CloseReason(c, t.stopped(), err)
+}
+
+func (t *Tunnel) stopped() bool {
+	select {
+	case <-t.cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+// handleAccessLog 查询访问日志：rule_id、client_ip、event、reason、since（Unix 秒）、limit
+func handleAccessLog(c *gin.Context) {
+	f := accesslog.Filter{
+		RuleID:   c.Query("rule_id"),
+		ClientIP: c.Query("client_ip"),
+		Event:    c.Query("event"),
+		Reason:   c.Query("reason"),
+	}
+	if since, err := strconv.ParseInt(c.Query("since"), 10, 64); err == nil {
+		f.Since = since
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil {
+		f.Limit = limit
+	}
+
+	entries, err := accesslog.Read(accessLogDir, f)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Success: true, Data: entries})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func lookupTunnel(c *gin.Context) *Tunnel {
+	tunnelsMu.RLock()
+	tunnel, exists := tunnels[c.Param("id")]
+	tunnelsMu.RUnlock()
+
+	if !exists {
+		c.JSON(http.StatusNotFound, APIResponse{Success: false, Message: "Tunnel not found"})
+		return nil
+	}
+	return tunnel
+}
+
+func handleGetConnections(c *gin.Context) {
+	tunnel := lookupTunnel(c)
+	if tunnel == nil {
+		return
+	}
+	c.JSON(http.StatusOK, APIResponse{Success: true, Data: tunnel.conns.List()})
+}
+
+func handleCloseConnection(c *gin.Context) {
+	tunnel := lookupTunnel(c)
+	if tunnel == nil {
+		return
+	}
+
+	if err := tunnel.conns.Close(c.Param("conn_id")); err != nil {
+		c.JSON(http.StatusNotFound, APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	log.Printf("✂️ Connection %s on tunnel %s closed by master", c.Param("conn_id"), tunnel.ID)
+	c.JSON(http.StatusOK, APIResponse{Success: true, Data: map[string]int{"closed": 1}})
+}
+
+// handleCloseConnections 断开隧道上来自 source_ip 的所有连接
+func handleCloseConnections(c *gin.Context) {
+	tunnel := lookupTunnel(c)
+	if tunnel == nil {
+		return
+	}
+
+	ip := net.ParseIP(c.Query("source_ip"))
+	if ip == nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Success: false, Message: "source_ip is required"})
+		return
+	}
+
+	closed := tunnel.conns.CloseFrom(ip)
+	log.Printf("✂️ Closed %d connections from %s on tunnel %s", closed, ip, tunnel.ID)
+	c.JSON(http.StatusOK, APIResponse{Success: true, Data: map[string]int{"closed": closed}})
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	psnet "github.com/shirou/gopsutil/v3/net"
+)
+
+// 诊断类型，与主控 models.Diagnostic* 保持一致。只执行这里列出的检查，不调用任何外部命令
+const (
+	diagTCPConnect  = "tcp_connect"
+	diagDNS         = "dns"
+	diagTraceroute  = "traceroute"
+	diagListenCheck = "listen_check"
+	diagConnections = "connections"
+)
+
+const (
+	defaultDiagTimeout = 3 * time.Second
+	maxDiagTimeout     = 10 * time.Second
+	// diagnosticDeadline 单次诊断的总耗时上限，主控的请求超时需大于该值
+	diagnosticDeadline = 60 * time.Second
+
+	defaultConnectCount = 3
+	maxConnectCount     = 10
+	defaultMaxHops      = 30
+	// maxSilentHops 连续无响应的跳数达到该值后提前结束路由探测
+	maxSilentHops = 5
+	// maxListedConnections 返回的连接明细上限，总数仍完整统计
+	maxListedConnections = 500
+	// maxConcurrentDiagnostics 同时运行的诊断上限
+	maxConcurrentDiagnostics = 2
+)
+
+var (
+	hostPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.\-:_]{0,252}$`)
+	diagSem     = make(chan struct{}, maxConcurrentDiagnostics)
+)
+
+type diagnosticRequest struct {
+	Type      string `json:"type"`
+	Target    string `json:"target,omitempty"`
+	Port      int    `json:"port,omitempty"`
+	Protocol  string `json:"protocol,omitempty"`
+	TunnelID  string `json:"tunnel_id,omitempty"`
+	Count     int    `json:"count,omitempty"`
+	TimeoutMs int    `json:"timeout_ms,omitempty"`
+	MaxHops   int    `json:"max_hops,omitempty"`
+}
+
+type diagnosticResult struct {
+	Type       string      `json:"type"`
+	Success    bool        `json:"success"`
+	Error      string      `json:"error,omitempty"`
+	DurationMs float64     `json:"duration_ms"`
+	Data       interface{} `json:"data,omitempty"`
+}
+
+type connectAttempt struct {
+	Success    bool    `json:"success"`
+	LatencyMs  float64 `json:"latency_ms"`
+	LocalAddr  string  `json:"local_addr,omitempty"`
+	RemoteAddr string  `json:"remote_addr,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+type connectResult struct {
+	Target    string           `json:"target"`
+	Attempts  []connectAttempt `json:"attempts"`
+	Succeeded int              `json:"succeeded"`
+	MinMs     float64          `json:"min_ms"`
+	AvgMs     float64          `json:"avg_ms"`
+	MaxMs     float64          `json:"max_ms"`
+}
+
+type dnsResult struct {
+	Host      string   `json:"host"`
+	Addresses []string `json:"addresses,omitempty"`
+	CNAME     string   `json:"cname,omitempty"`
+	Names     []string `json:"names,omitempty"`
+}
+
+type traceHop struct {
+	TTL     int     `json:"ttl"`
+	Addr    string  `json:"addr,omitempty"`
+	RTTMs   float64 `json:"rtt_ms,omitempty"`
+	Reached bool    `json:"reached,omitempty"`
+	Timeout bool    `json:"timeout,omitempty"`
+	// Unreachable 表示中间路由返回了目标不可达
+	Unreachable bool `json:"unreachable,omitempty"`
+}
+
+type traceResult struct {
+	Target  string     `json:"target"`
+	Addr    string     `json:"addr"`
+	Hops    []traceHop `json:"hops"`
+	Reached bool       `json:"reached"`
+}
+
+type socketInfo struct {
+	Local  string `json:"local"`
+	Remote string `json:"remote,omitempty"`
+	Status string `json:"status,omitempty"`
+	PID    int32  `json:"pid,omitempty"`
+}
+
+type listenResult struct {
+	Port          int          `json:"port"`
+	Protocol      string       `json:"protocol"`
+	Listening     bool         `json:"listening"`
+	Listeners     []socketInfo `json:"listeners"`
+	TunnelID      string       `json:"tunnel_id,omitempty"`
+	TunnelRunning bool         `json:"tunnel_running"`
+	LocalConnect  *bool        `json:"local_connect,omitempty"`
+	ConnectError  string       `json:"connect_error,omitempty"`
+}
+
+type connectionsResult struct {
+	TunnelID      string         `json:"tunnel_id"`
+	Protocol      string         `json:"protocol"`
+	InboundTotal  int            `json:"inbound_total"`
+	OutboundTotal int            `json:"outbound_total"`
+	States        map[string]int `json:"states"`
+	Inbound       []socketInfo   `json:"inbound"`
+	Outbound      []socketInfo   `json:"outbound"`
+}
+
+var diagnostics = map[string]func(context.Context, diagnosticRequest) (interface{}, error){
+	diagTCPConnect:  diagnoseTCPConnect,
+	diagDNS:         diagnoseDNS,
+	diagTraceroute:  diagnoseTraceroute,
+	diagListenCheck: diagnoseListen,
+	diagConnections: diagnoseConnections,
+}
+
+// handleDiagnostics 执行白名单内的诊断，诊断本身失败时仍返回 200，错误写在结果中
+func handleDiagnostics(c *gin.Context) {
+	var req diagnosticRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Success: false, Message: "Invalid request"})
+		return
+	}
+	run, ok := diagnostics[req.Type]
+	if !ok {
+		c.JSON(http.StatusBadRequest, APIResponse{Success: false, Message: fmt.Sprintf("Unsupported diagnostic %q", req.Type)})
+		return
+	}
+	if err := resolveDiagTarget(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	select {
+	case diagSem <- struct{}{}:
+		defer func() { <-diagSem }()
+	default:
+		c.JSON(http.StatusTooManyRequests, APIResponse{Success: false, Message: "Too many diagnostics running"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), diagnosticDeadline)
+	defer cancel()
+
+	start := time.Now()
+	data, err := run(ctx, req)
+	result := diagnosticResult{
+		Type:       req.Type,
+		Success:    err == nil,
+		DurationMs: millis(time.Since(start)),
+		Data:       data,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	c.JSON(http.StatusOK, APIResponse{Success: true, Data: result})
+}
+
+// resolveDiagTarget 指定隧道时用隧道的目标或本地端口补全请求，并校验参数
+func resolveDiagTarget(req *diagnosticRequest) error {
+	if req.TunnelID != "" {
+		tunnelsMu.RLock()
+		t, exists := tunnels[req.TunnelID]
+		tunnelsMu.RUnlock()
+		if !exists {
+			return fmt.Errorf("tunnel %s not found", req.TunnelID)
+		}
+
+		if req.Protocol == "" {
+			req.Protocol = t.Protocol
+		}
+		if req.Type == diagListenCheck {
+			if req.Port == 0 {
+				req.Port = t.LocalPort
+			}
+		} else if req.Target == "" {
+			req.Target = t.TargetIP
+			if req.Port == 0 {
+				req.Port = t.TargetPort
+			}
+		}
+	}
+
+	if req.Protocol == "" {
+		req.Protocol = "tcp"
+	}
+	if req.Protocol != "tcp" && req.Protocol != "udp" {
+		return fmt.Errorf("invalid protocol %q", req.Protocol)
+	}
+
+	switch req.Type {
+	case diagConnections:
+		if req.TunnelID == "" {
+			return errors.New("tunnel_id is required")
+		}
+		return nil
+	case diagListenCheck:
+		// 只需要端口
+	default:
+		if !hostPattern.MatchString(req.Target) {
+			return errors.New("invalid target host")
+		}
+	}
+
+	needsPort := req.Type == diagTCPConnect || req.Type == diagListenCheck
+	if (needsPort || req.Port != 0) && (req.Port < 1 || req.Port > 65535) {
+		return errors.New("invalid port")
+	}
+	return nil
+}
+
+func diagTimeout(req diagnosticRequest) time.Duration {
+	timeout := time.Duration(req.TimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		return defaultDiagTimeout
+	}
+	if timeout > maxDiagTimeout {
+		return maxDiagTimeout
+	}
+	return timeout
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func diagnoseTCPConnect(ctx context.Context, req diagnosticRequest) (interface{}, error) {
+	count := req.Count
+	if count <= 0 {
+		count = defaultConnectCount
+	}
+	if count > maxConnectCount {
+		count = maxConnectCount
+	}
+
+	target := net.JoinHostPort(req.Target, strconv.Itoa(req.Port))
+	result := connectResult{Target: target}
+	dialer := net.Dialer{Timeout: diagTimeout(req)}
+
+	var total float64
+	for i := 0; i < count && ctx.Err() == nil; i++ {
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", target)
+		attempt := connectAttempt{LatencyMs: millis(time.Since(start))}
+		if err != nil {
+			attempt.Error = err.Error()
+		} else {
+			attempt.Success = true
+			attempt.LocalAddr = conn.LocalAddr().String()
+			attempt.RemoteAddr = conn.RemoteAddr().String()
+			conn.Close()
+
+			if result.Succeeded == 0 || attempt.LatencyMs < result.MinMs {
+				result.MinMs = attempt.LatencyMs
+			}
+			if attempt.LatencyMs > result.MaxMs {
+				result.MaxMs = attempt.LatencyMs
+			}
+			total += attempt.LatencyMs
+			result.Succeeded++
+		}
+		result.Attempts = append(result.Attempts, attempt)
+	}
+
+	if result.Succeeded == 0 {
+		return result, fmt.Errorf("all %d connection attempts to %s failed", len(result.Attempts), target)
+	}
+	result.AvgMs = total / float64(result.Succeeded)
+	return result, nil
+}
+
+func diagnoseDNS(ctx context.Context, req diagnosticRequest) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, diagTimeout(req))
+	defer cancel()
+
+	result := dnsResult{Host: req.Target}
+
+	// IP 地址做反向解析
+	if net.ParseIP(req.Target) != nil {
+		names, err := net.DefaultResolver.LookupAddr(ctx, req.Target)
+		result.Names = names
+		return result, err
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, req.Target)
+	if err != nil {
+		return result, err
+	}
+	for _, a := range addrs {
+		result.Addresses = append(result.Addresses, a.String())
+	}
+	if cname, err := net.DefaultResolver.LookupCNAME(ctx, req.Target); err == nil && cname != req.Target+"." {
+		result.CNAME = cname
+	}
+	return result, nil
+}
+
+func diagnoseTraceroute(ctx context.Context, req diagnosticRequest) (interface{}, error) {
+	maxHops := req.MaxHops
+	if maxHops <= 0 || maxHops > defaultMaxHops {
+		maxHops = defaultMaxHops
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, diagTimeout(req))
+	addrs, err := net.DefaultResolver.LookupIP(lookupCtx, "ip4", req.Target)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	dst := addrs[0]
+
+	result := traceResult{Target: req.Target, Addr: dst.String(), Hops: []traceHop{}}
+	timeout := diagTimeout(req)
+	silent := 0
+	for ttl := 1; ttl <= maxHops && ctx.Err() == nil; ttl++ {
+		// 单跳等待不超过整体截止时间
+		wait := timeout
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			wait = time.Until(deadline)
+		}
+		hop, err := probeHop(dst, ttl, wait)
+		if err != nil {
+			return result, err
+		}
+		result.Hops = append(result.Hops, hop)
+
+		if hop.Reached {
+			result.Reached = true
+			break
+		}
+		if hop.Unreachable {
+			return result, fmt.Errorf("%s is unreachable from %s", req.Target, hop.Addr)
+		}
+		if hop.Timeout {
+			if silent++; silent >= maxSilentHops {
+				break
+			}
+		} else {
+			silent = 0
+		}
+	}
+	return result, nil
+}
+
+func diagnoseListen(ctx context.Context, req diagnosticRequest) (interface{}, error) {
+	result := listenResult{Port: req.Port, Protocol: req.Protocol, Listeners: []socketInfo{}}
+
+	tunnelsMu.RLock()
+	for _, t := range tunnels {
+		protocol := t.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		if t.LocalPort == req.Port && protocol == req.Protocol {
+			result.TunnelID = t.ID
+			result.TunnelRunning = t.running.Load()
+		}
+	}
+	tunnelsMu.RUnlock()
+
+	conns, err := psnet.ConnectionsWithContext(ctx, req.Protocol)
+	if err != nil {
+		return result, err
+	}
+	for _, c := range conns {
+		if int(c.Laddr.Port) != req.Port {
+			continue
+		}
+		// UDP 没有监听状态，绑定了该端口且没有对端地址即视为监听
+		if (req.Protocol == "tcp" && c.Status == "LISTEN") || (req.Protocol == "udp" && c.Raddr.IP == "") {
+			result.Listeners = append(result.Listeners, socketInfo{
+				Local:  net.JoinHostPort(c.Laddr.IP, strconv.Itoa(int(c.Laddr.Port))),
+				Status: c.Status,
+				PID:    c.Pid,
+			})
+		}
+	}
+	result.Listening = len(result.Listeners) > 0
+
+	if req.Protocol == "tcp" {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(req.Port)), diagTimeout(req))
+		ok := err == nil
+		result.LocalConnect = &ok
+		if err != nil {
+			result.ConnectError = err.Error()
+		} else {
+			conn.Close()
+		}
+	}
+
+	if !result.Listening {
+		return result, fmt.Errorf("nothing is listening on %s port %d", req.Protocol, req.Port)
+	}
+	return result, nil
+}
+
+// diagnoseConnections 从系统连接表中找出隧道的入站连接（本地端口）和出站连接（目标地址）
+func diagnoseConnections(ctx context.Context, req diagnosticRequest) (interface{}, error) {
+	tunnelsMu.RLock()
+	t, exists := tunnels[req.TunnelID]
+	tunnelsMu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("tunnel %s not found", req.TunnelID)
+	}
+
+	result := connectionsResult{
+		TunnelID: t.ID,
+		Protocol: req.Protocol,
+		States:   make(map[string]int),
+		Inbound:  []socketInfo{},
+		Outbound: []socketInfo{},
+	}
+
+	targets := map[string]bool{t.TargetIP: true}
+	lookupCtx, cancel := context.WithTimeout(ctx, diagTimeout(req))
+	if ips, err := net.DefaultResolver.LookupIP(lookupCtx, "ip", t.TargetIP); err == nil {
+		for _, ip := range ips {
+			targets[ip.String()] = true
+		}
+	}
+	cancel()
+
+	conns, err := psnet.ConnectionsWithContext(ctx, req.Protocol)
+	if err != nil {
+		return result, err
+	}
+	for _, c := range conns {
+		if c.Raddr.IP == "" || c.Status == "LISTEN" {
+			continue
+		}
+		info := socketInfo{
+			Local:  net.JoinHostPort(c.Laddr.IP, strconv.Itoa(int(c.Laddr.Port))),
+			Remote: net.JoinHostPort(c.Raddr.IP, strconv.Itoa(int(c.Raddr.Port))),
+			Status: c.Status,
+		}
+
+		switch {
+		case int(c.Laddr.Port) == t.LocalPort:
+			result.InboundTotal++
+			if len(result.Inbound) < maxListedConnections {
+				result.Inbound = append(result.Inbound, info)
+			}
+		case int(c.Raddr.Port) == t.TargetPort && targets[c.Raddr.IP]:
+			result.OutboundTotal++
+			if len(result.Outbound) < maxListedConnections {
+				result.Outbound = append(result.Outbound, info)
+			}
+		default:
+			continue
+		}
+		if c.Status != "" {
+			result.States[c.Status]++
+		}
+	}
+	return result, nil
+}
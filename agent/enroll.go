@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"port-forward-common/signing"
+)
+
+const credentialsFile = "credentials.json"
+
+// credentials 是通过注册令牌从主控领取的永久身份
+type credentials struct {
+	NodeID     string `json:"node_id"`
+	Name       string `json:"name"`
+	Key        string `json:"key"`
+	Master     string `json:"master"`
+	EnrolledAt int64  `json:"enrolled_at"`
+
+	// RetiredKeyIDs 是已被轮换掉的密钥指纹
+	RetiredKeyIDs []string `json:"retired_key_ids,omitempty"`
+
+	// PreviousKey 是轮换前的密钥，宽限期内重启后仍然有效
+	PreviousKey          string `json:"previous_key,omitempty"`
+	PreviousKeyExpiresAt int64  `json:"previous_key_expires_at,omitempty"`
+}
+
+func credentialsPath() string {
+	return filepath.Join(dataDir, credentialsFile)
+}
+
+func loadCredentials() (*credentials, error) {
+	data, err := os.ReadFile(credentialsPath())
+	if err != nil {
+		return nil, err
+	}
+	var creds credentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, err
+	}
+	return &creds, nil
+}
+
+// setupCredentials 确定节点密钥：-key 优先，其次是已保存的凭据，都没有时用 -join 令牌注册
+func setupCredentials(joinMaster, joinToken string) error {
+	if nodeKey != "" {
+		// -key 指定的密钥已被轮换时改用凭据文件中的新密钥
+		if creds, err := loadCredentials(); err == nil {
+			if creds.Key != nodeKey {
+				for _, id := range creds.RetiredKeyIDs {
+					if id == signing.KeyID(nodeKey) {
+						log.Printf("Key from -key has been rotated, using key %s from credentials", signing.KeyID(creds.Key))
+						nodeKey = creds.Key
+						break
+					}
+				}
+			}
+			if creds.Key == nodeKey {
+				restorePreviousKey(creds)
+			}
+		}
+		return nil
+	}
+
+	if creds, err := loadCredentials(); err == nil {
+		if joinMaster != "" {
+			log.Printf("Already enrolled as node %s, ignoring -join", creds.NodeID)
+		}
+		nodeKey = creds.Key
+		restorePreviousKey(creds)
+		if masterURL == "" {
+			masterURL = creds.Master
+		}
+		if creds.Name != "" && !flagPassed("name") {
+			nodeName = creds.Name
+		}
+		return nil
+	}
+
+	if joinMaster == "" {
+		return nil
+	}
+	if joinToken == "" {
+		return fmt.Errorf("usage: -join <master> <token>")
+	}
+	return enroll(strings.TrimRight(joinMaster, "/"), joinToken)
+}
+
+func enroll(master, token string) error {
+	certKey, csr, err := newCSR()
+	if err != nil {
+		return err
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"token": token,
+		"name":  nodeName,
+		"port":  listenPort,
+		"csr":   csr,
+	})
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Post(master+"/api/nodes/enroll", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("enrollment request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+		Data    struct {
+			NodeID string `json:"node_id"`
+			Name   string `json:"name"`
+			Key    string `json:"key"`
+			Cert   string `json:"cert"`
+			CACert string `json:"ca_cert"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid enrollment response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || !result.Success {
+		return fmt.Errorf("enrollment rejected (%d): %s", resp.StatusCode, result.Message)
+	}
+
+	creds := credentials{
+		NodeID:     result.Data.NodeID,
+		Name:       result.Data.Name,
+		Key:        result.Data.Key,
+		Master:     master,
+		EnrolledAt: time.Now().Unix(),
+	}
+	if err := writeFileAtomic(credentialsPath(), creds); err != nil {
+		return fmt.Errorf("failed to save credentials: %v", err)
+	}
+
+	// 主控签发了证书时，控制 API 改用 mTLS
+	if result.Data.Cert != "" && result.Data.CACert != "" {
+		if _, err := installCert(certKey, result.Data.Cert); err != nil {
+			return fmt.Errorf("failed to install certificate: %v", err)
+		}
+		if err := writeBytesAtomic(filepath.Join(dataDir, caCertFile), []byte(result.Data.CACert)); err != nil {
+			return fmt.Errorf("failed to save CA certificate: %v", err)
+		}
+	}
+
+	nodeKey = creds.Key
+	if result.Data.Name != "" {
+		nodeName = result.Data.Name
+	}
+	if masterURL == "" {
+		masterURL = master
+	}
+	log.Printf("🎫 Enrolled as node %s (%s)", nodeName, creds.NodeID)
+	return nil
+}
+
+func flagPassed(name string) bool {
+	passed := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	return passed
+}
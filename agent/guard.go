@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxRequestBody 控制 API 请求体上限
+	maxRequestBody = 1 << 20
+	// maxAuthFailures 窗口内允许的认证失败次数，超过后锁定来源 IP
+	maxAuthFailures   = 5
+	authFailureWindow = 10 * time.Minute
+	lockoutDuration   = 15 * time.Minute
+	// maxTrackedIPs 记录失败来源 IP 的上限，防止被刷爆内存
+	maxTrackedIPs = 4096
+	// masterRefresh 重新解析主控地址的间隔
+	masterRefresh = 5 * time.Minute
+)
+
+var (
+	bindAddr  string
+	allowList string
+)
+
+// allowlist 是允许访问控制 API 的来源地址：本机回环、主控地址和 -allow 指定的地址，
+// -allow 为 * 时不限制来源
+type allowlist struct {
+	nets []*net.IPNet
+	any  bool
+}
+
+var (
+	currentAllowlist atomic.Pointer[allowlist]
+	// lockoutExempt 中的地址认证失败时不会被锁定，即不含 * 的白名单
+	lockoutExempt atomic.Pointer[allowlist]
+)
+
+// 控制 API 拒绝的请求数，按原因统计，用于 /metrics
+var (
+	rejectedACL    atomic.Int64
+	rejectedLocked atomic.Int64
+	rejectedAuth   atomic.Int64
+)
+
+func parseAllowEntry(entry string) (*net.IPNet, error) {
+	if strings.Contains(entry, "/") {
+		_, n, err := net.ParseCIDR(entry)
+		return n, err
+	}
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %q", entry)
+	}
+	bits := 128
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// buildAllowlist 根据主控地址和 -allow 生成白名单和锁定豁免列表
+func buildAllowlist(master []string) (list, exempt *allowlist, err error) {
+	entries := append([]string{"127.0.0.0/8", "::1"}, master...)
+	any := false
+	for _, e := range strings.Split(allowList, ",") {
+		switch e = strings.TrimSpace(e); e {
+		case "":
+		case "*":
+			any = true
+		default:
+			entries = append(entries, e)
+		}
+	}
+
+	exempt, err = newAllowlist(entries)
+	if err != nil {
+		return nil, nil, err
+	}
+	if any {
+		return &allowlist{any: true}, exempt, nil
+	}
+	return exempt, exempt, nil
+}
+
+func newAllowlist(entries []string) (*allowlist, error) {
+	list := &allowlist{}
+	for _, e := range entries {
+		n, err := parseAllowEntry(e)
+		if err != nil {
+			return nil, err
+		}
+		list.nets = append(list.nets, n)
+	}
+	return list, nil
+}
+
+// resolveMaster 解析主控地址，失败时沿用上一次的结果
+func resolveMaster(previous []string) []string {
+	if masterURL == "" {
+		return nil
+	}
+	ips, err := masterIPs()
+	if err != nil {
+		log.Printf("Failed to resolve master address for the control API allowlist: %v", err)
+		return previous
+	}
+	return ips
+}
+
+func (l *allowlist) String() string {
+	if l.any {
+		return "any address"
+	}
+	parts := make([]string, len(l.nets))
+	for i, n := range l.nets {
+		parts[i] = n.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+func masterIPs() ([]string, error) {
+	u, err := url.Parse(masterURL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{host}, nil
+	}
+	return net.LookupHost(host)
+}
+
+func (l *allowlist) allows(ip net.IP) bool {
+	if l.any {
+		return true
+	}
+	for _, n := range l.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// initAllowlist 加载白名单并记录生效的列表，之后定期重新解析主控地址，跟随 DNS 变化
+func initAllowlist() error {
+	master := resolveMaster(nil)
+	list, exempt, err := buildAllowlist(master)
+	if err != nil {
+		return err
+	}
+	currentAllowlist.Store(list)
+	lockoutExempt.Store(exempt)
+
+	switch {
+	case list.any:
+		log.Printf("⚠️ Control API accepts requests from any address (-allow *)")
+	case masterURL == "" && allowList == "":
+		log.Printf("⚠️ Master address unknown, control API only accepts loopback, use -allow to add the master")
+	default:
+		log.Printf("🛡️ Control API allowlist: %s", list)
+	}
+
+	if masterURL != "" {
+		go func() {
+			for range time.Tick(masterRefresh) {
+				master = resolveMaster(master)
+				// -allow 在启动时已校验，这里不会出错
+				if list, exempt, err := buildAllowlist(master); err == nil {
+					currentAllowlist.Store(list)
+					lockoutExempt.Store(exempt)
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// authLockout 按来源 IP 统计认证失败，超过阈值后在一段时间内拒绝该 IP
+type authLockout struct {
+	entries map[string]*lockoutEntry
+	mu      sync.Mutex
+}
+
+type lockoutEntry struct {
+	failures    int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+var lockout = &authLockout{entries: make(map[string]*lockoutEntry)}
+
+func (l *authLockout) locked(ip string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.entries[ip]
+	return ok && now.Before(e.lockedUntil)
+}
+
+func (l *authLockout) fail(ip string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.entries[ip]
+	if !ok {
+		if len(l.entries) >= maxTrackedIPs {
+			l.prune(now)
+			if len(l.entries) >= maxTrackedIPs {
+				return
+			}
+		}
+		e = &lockoutEntry{windowStart: now}
+		l.entries[ip] = e
+	}
+	if now.Sub(e.windowStart) > authFailureWindow {
+		e.failures = 0
+		e.windowStart = now
+	}
+	e.failures++
+	if e.failures >= maxAuthFailures {
+		e.lockedUntil = now.Add(lockoutDuration)
+		log.Printf("🚫 Locked out %s for %s after %d failed auth attempts", ip, lockoutDuration, e.failures)
+	}
+}
+
+func (l *authLockout) succeed(ip string) {
+	l.mu.Lock()
+	delete(l.entries, ip)
+	l.mu.Unlock()
+}
+
+// prune 删除已过期的记录，调用方需持有锁
+func (l *authLockout) prune(now time.Time) {
+	for ip, e := range l.entries {
+		if now.After(e.lockedUntil) && now.Sub(e.windowStart) > authFailureWindow {
+			delete(l.entries, ip)
+		}
+	}
+}
+
+// guardMiddleware 依次检查来源白名单、锁定状态和节点密钥，并限制请求体大小。
+// 来源 IP 取 TCP 连接地址，不信任 X-Forwarded-For；豁免地址不参与锁定
+func guardMiddleware(c *gin.Context) {
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil || !currentAllowlist.Load().allows(ip) {
+		rejectedACL.Add(1)
+		c.AbortWithStatusJSON(http.StatusForbidden, APIResponse{Success: false, Message: "Forbidden"})
+		return
+	}
+
+	now := time.Now()
+	source := ip.String()
+	exempt := lockoutExempt.Load().allows(ip)
+	if !exempt && lockout.locked(source, now) {
+		rejectedLocked.Add(1)
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, APIResponse{Success: false, Message: "Too many failed attempts"})
+		return
+	}
+
+	if !validKey(c.GetHeader("X-Node-Key")) {
+		rejectedAuth.Add(1)
+		if !exempt {
+			lockout.fail(source, now)
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, APIResponse{Success: false, Message: "Invalid node key"})
+		return
+	}
+	lockout.succeed(source)
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxRequestBody)
+	c.Next()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBuildAllowlist(t *testing.T) {
+	master := []string{"198.51.100.1"}
+	tests := []struct {
+		allow      string
+		ip         string
+		want       bool
+		wantExempt bool
+		wantErr    bool
+	}{
+		// 未指定 -allow 时只接受本机回环和主控地址
+		{"", "203.0.113.7", false, false, false},
+		{"", "198.51.100.1", true, true, false},
+		{"", "127.0.0.1", true, true, false},
+		{"", "::1", true, true, false},
+		// * 放开来源限制，但不豁免锁定
+		{"*", "203.0.113.7", true, false, false},
+		{"*", "198.51.100.1", true, true, false},
+		{"10.0.0.0/8", "10.1.2.3", true, true, false},
+		{"10.0.0.0/8", "203.0.113.7", false, false, false},
+		{"10.0.0.0/8", "198.51.100.1", true, true, false},
+		{" 192.0.2.1 , 2001:db8::/32", "2001:db8::5", true, true, false},
+		{"192.0.2.1,2001:db8::/32", "192.0.2.2", false, false, false},
+		{"not-an-ip", "", false, false, true},
+	}
+	saved := allowList
+	defer func() { allowList = saved }()
+
+	for _, tt := range tests {
+		t.Run(tt.allow+"/"+tt.ip, func(t *testing.T) {
+			allowList = tt.allow
+			list, exempt, err := buildAllowlist(master)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildAllowlist() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			ip := net.ParseIP(tt.ip)
+			if got := list.allows(ip); got != tt.want {
+				t.Errorf("allows(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+			if got := exempt.allows(ip); got != tt.wantExempt {
+				t.Errorf("exempt allows(%s) = %v, want %v", tt.ip, got, tt.wantExempt)
+			}
+		})
+	}
+}
+
+func TestGuardLockoutExempt(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	savedKey, savedAllow, savedMaster := nodeKey, allowList, masterURL
+	savedLockout := lockout
+	defer func() {
+		nodeKey, allowList, masterURL = savedKey, savedAllow, savedMaster
+		lockout = savedLockout
+	}()
+	nodeKey = "correct-node-key"
+
+	tests := []struct {
+		name       string
+		allow      string
+		master     string
+		remote     string
+		wantLocked bool
+	}{
+		{"stranger locked out", "*", "", "203.0.113.7", true},
+		{"master address exempt", "*", "http://198.51.100.1:8080", "198.51.100.1", false},
+		{"allowlisted address exempt", "203.0.113.0/24", "", "203.0.113.7", false},
+		{"loopback exempt", "", "", "127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowList, masterURL = tt.allow, tt.master
+			lockout = &authLockout{entries: make(map[string]*lockoutEntry)}
+			if err := initAllowlist(); err != nil {
+				t.Fatal(err)
+			}
+
+			router := gin.New()
+			router.Use(guardMiddleware)
+			router.GET("/status", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			request := func(key string) int {
+				req := httptest.NewRequest(http.MethodGet, "/status", nil)
+				req.RemoteAddr = net.JoinHostPort(tt.remote, "40000")
+				req.Header.Set("X-Node-Key", key)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				return w.Code
+			}
+
+			for i := 0; i < maxAuthFailures; i++ {
+				if code := request("wrong"); code != http.StatusUnauthorized {
+					t.Fatalf("attempt %d: status = %d, want 401", i, code)
+				}
+			}
+			want := http.StatusOK
+			if tt.wantLocked {
+				want = http.StatusTooManyRequests
+			}
+			if code := request(nodeKey); code != want {
+				t.Fatalf("request with valid key: status = %d, want %d", code, want)
+			}
+		})
+	}
+}
+
+func TestGuardDefaultAllowsOnlyMaster(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	savedKey, savedAllow, savedMaster := nodeKey, allowList, masterURL
+	defer func() { nodeKey, allowList, masterURL = savedKey, savedAllow, savedMaster }()
+	nodeKey, allowList, masterURL = "correct-node-key", "", "http://198.51.100.1:8080"
+	if err := initAllowlist(); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(guardMiddleware)
+	router.GET("/status", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		remote string
+		want   int
+	}{
+		{"198.51.100.1", http.StatusOK},
+		{"127.0.0.1", http.StatusOK},
+		{"203.0.113.7", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/status", nil)
+		req.RemoteAddr = net.JoinHostPort(tt.remote, "40000")
+		req.Header.Set("X-Node-Key", nodeKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("request from %s: status = %d, want %d", tt.remote, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"port-forward-common/signing"
+)
+
+const maxKeyGrace = 24 * time.Hour
+
+// 轮换后的旧密钥在宽限期内继续有效，避免主控切换期间的请求失败
+var (
+	keyMu             sync.RWMutex
+	previousKey       string
+	previousKeyExpiry time.Time
+)
+
+func currentKey() string {
+	keyMu.RLock()
+	defer keyMu.RUnlock()
+	return nodeKey
+}
+
+// validKey 以常量时间比较请求携带的密钥
+func validKey(key string) bool {
+	keyMu.RLock()
+	defer keyMu.RUnlock()
+
+	if subtle.ConstantTimeCompare([]byte(key), []byte(nodeKey)) == 1 {
+		return true
+	}
+	return previousKey != "" && time.Now().Before(previousKeyExpiry) &&
+		subtle.ConstantTimeCompare([]byte(key), []byte(previousKey)) == 1
+}
+
+func handleRotateKey(c *gin.Context) {
+	var req struct {
+		Key          string `json:"key"`
+		GraceSeconds int64  `json:"grace_seconds"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Key) < 16 {
+		c.JSON(http.StatusBadRequest, APIResponse{Success: false, Message: "Invalid request"})
+		return
+	}
+
+	grace := time.Duration(req.GraceSeconds) * time.Second
+	if grace > maxKeyGrace {
+		grace = maxKeyGrace
+	}
+
+	keyMu.Lock()
+	oldKey := nodeKey
+	expiry := time.Now().Add(grace)
+	if err := persistKey(req.Key, oldKey, expiry); err != nil {
+		keyMu.Unlock()
+		c.JSON(http.StatusInternalServerError, APIResponse{Success: false, Message: "Failed to persist key: " + err.Error()})
+		return
+	}
+	nodeKey = req.Key
+	previousKey = oldKey
+	previousKeyExpiry = expiry
+	keyMu.Unlock()
+
+	log.Printf("🔑 Node key rotated (%s -> %s), old key valid for %s", signing.KeyID(oldKey), signing.KeyID(req.Key), grace)
+	c.JSON(http.StatusOK, APIResponse{Success: true, Message: "Key rotated"})
+}
+
+// persistKey 把新密钥写入凭据文件，并记下被替换的密钥及其宽限期，
+// 这样仍带着旧 -key 参数重启时也会使用新密钥，宽限期内旧密钥依然有效。调用方需持有 keyMu
+func persistKey(newKey, oldKey string, previousExpiry time.Time) error {
+	creds, err := loadCredentials()
+	if err != nil {
+		creds = &credentials{Master: masterURL, Name: nodeName}
+	}
+	creds.Key = newKey
+	creds.PreviousKey = oldKey
+	creds.PreviousKeyExpiresAt = previousExpiry.Unix()
+	creds.RetiredKeyIDs = append(creds.RetiredKeyIDs, signing.KeyID(oldKey))
+	if len(creds.RetiredKeyIDs) > 20 {
+		creds.RetiredKeyIDs = creds.RetiredKeyIDs[len(creds.RetiredKeyIDs)-20:]
+	}
+	return writeFileAtomic(credentialsPath(), creds)
+}
+
+// restorePreviousKey 启动时恢复仍在宽限期内的旧密钥
+func restorePreviousKey(creds *credentials) {
+	if creds.PreviousKey == "" || time.Now().Unix() >= creds.PreviousKeyExpiresAt {
+		return
+	}
+	keyMu.Lock()
+	previousKey = creds.PreviousKey
+	previousKeyExpiry = time.Unix(creds.PreviousKeyExpiresAt, 0)
+	keyMu.Unlock()
+}
@@ -3,14 +3,16 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
+	"runtime"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -19,7 +21,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/mem"
-	psnet "github.com/shirou/gopsutil/v3/net"
+
+	"port-forward-common/accesslog"
+	"port-forward-common/conns"
+	"port-forward-common/probe"
+	"port-forward-common/timings"
 )
 
 var (
@@ -27,6 +33,8 @@ var (
 	nodeKey    string
 	nodeName   string
 	listenPort int
+	heartbeat  int
+	dataDir    string
 	tunnels    = make(map[string]*Tunnel)
 	tunnelsMu  sync.RWMutex
 	startTime  = time.Now()
@@ -41,9 +49,17 @@ type Tunnel struct {
 
 	listener   net.Listener
 	udpConn    *net.UDPConn
+	conns      *conns.Registry
+	accessLog  *accesslog.Writer
+	logAccess  atomic.Bool
+	enabled    atomic.Bool
 	running    atomic.Bool
 	bytesIn    atomic.Int64
 	bytesOut   atomic.Int64
+	dialErrors atomic.Int64
+	timings    timings.Recorder
+	check      atomic.Pointer[probe.HealthCheck]
+	probe      probeState
 	rateIn     float64
 	rateOut    float64
 	lastIn     int64
@@ -54,30 +70,51 @@ type Tunnel struct {
 }
 
 type NodeStatus struct {
-	NodeKey     string         `json:"node_key"`
 	NodeName    string         `json:"node_name"`
 	Online      bool           `json:"online"`
 	CPUPercent  float64        `json:"cpu_percent"`
 	MemPercent  float64        `json:"mem_percent"`
-	NetRateIn   float64        `json:"net_rate_in"`
-	NetRateOut  float64        `json:"net_rate_out"`
 	Uptime      int64          `json:"uptime"`
 	TunnelCount int            `json:"tunnel_count"`
 	Tunnels     []TunnelStatus `json:"tunnels"`
+
+	systemStats
+	Interfaces []interfaceStats `json:"interfaces,omitempty"`
+
+	HeartbeatInterval int   `json:"heartbeat_interval"`
+	StateRevision     int64 `json:"state_revision"`
+
+	Version string        `json:"version"`
+	OS      string        `json:"os"`
+	Arch    string        `json:"arch"`
+	Update  *UpdateStatus `json:"update,omitempty"`
+
+	Mesh *meshStatus `json:"mesh,omitempty"`
 }
 
 type TunnelStatus struct {
-	ID         string  `json:"id"`
-	LocalPort  int     `json:"local_port"`
-	TargetIP   string  `json:"target_ip"`
-	TargetPort int     `json:"target_port"`
-	Protocol   string  `json:"protocol"`
-	Running    bool    `json:"running"`
-	BytesIn    int64   `json:"bytes_in"`
-	BytesOut   int64   `json:"bytes_out"`
-	RateIn     float64 `json:"rate_in"`
-	RateOut    float64 `json:"rate_out"`
-	Latency    int64   `json:"latency"`
+	ID          string  `json:"id"`
+	LocalPort   int     `json:"local_port"`
+	TargetIP    string  `json:"target_ip"`
+	TargetPort  int     `json:"target_port"`
+	Protocol    string  `json:"protocol"`
+	Enabled     bool    `json:"enabled"`
+	Running     bool    `json:"running"`
+	AccessLog   bool    `json:"access_log"`
+	BytesIn     int64   `json:"bytes_in"`
+	BytesOut    int64   `json:"bytes_out"`
+	RateIn      float64 `json:"rate_in"`
+	RateOut     float64 `json:"rate_out"`
+	Latency     int64   `json:"latency"`
+	Connections int     `json:"connections"`
+
+	HealthCheck *probe.HealthCheck `json:"health_check,omitempty"`
+	ProbeError  string             `json:"probe_error,omitempty"`
+	// LastProbe 是最近一次健康检查的时间（Unix 秒），0 表示尚未检查
+	LastProbe int64 `json:"last_probe"`
+	probe.Stats
+
+	Timings *timings.ConnTimings `json:"timings,omitempty"`
 }
 
 type APIResponse struct {
@@ -91,48 +128,147 @@ func main() {
 	flag.StringVar(&nodeKey, "key", "", "Node authentication key")
 	flag.StringVar(&nodeName, "name", "Node", "Node display name")
 	flag.IntVar(&listenPort, "port", 9090, "Agent API listen port")
+	flag.StringVar(&bindAddr, "bind", "0.0.0.0", "Control API bind address")
+	flag.StringVar(&allowList, "allow", "", "Comma-separated IPs/CIDRs allowed to call the control API in addition to loopback and the master, * allows any address")
+	flag.IntVar(&heartbeat, "heartbeat", 10, "Heartbeat interval in seconds")
+	flag.IntVar(&probeInterval, "probe-interval", 5, "Tunnel health check interval in seconds")
+	flag.IntVar(&probeConcurrency, "probe-concurrency", 16, "Maximum number of health checks running at the same time")
+	flag.StringVar(&netInterfaces, "net-iface", "", "Comma-separated network interfaces (wildcards allowed) counted in node rates (default: all except loopback and container bridges)")
+	flag.StringVar(&diskPath, "disk-path", "/", "Path whose filesystem usage is reported")
+	flag.StringVar(&dataDir, "data-dir", defaultDataDir(), "Directory for persisted agent state")
+	flag.StringVar(&accessLogDir, "access-log-dir", "", "Directory for per-tunnel access logs (default: <data-dir>/access-logs)")
+	flag.IntVar(&accessLogMaxSize, "access-log-max-size", 10, "Rotate an access log after it reaches this size in MB")
+	flag.IntVar(&accessLogMaxBackups, "access-log-backups", 3, "Number of rotated access log files to keep")
+	flag.StringVar(&metricsToken, "metrics-token", "", "Bearer token for /metrics (separate from the node key)")
+	flag.StringVar(&metricsAllow, "metrics-allow", "", "Comma-separated IPs/CIDRs allowed to scrape /metrics without a token")
+	flag.StringVar(&metricsListen, "metrics-listen", "", "Serve /metrics over plain HTTP on this address (e.g. :9100) instead of the control port")
+	flag.StringVar(&updatePubKeyArg, "update-pubkey", "", "Base64 ed25519 public key for verifying agent updates")
+	showVersion := flag.Bool("version", false, "Print version and exit")
+	joinMaster := flag.String("join", "", "Enroll with a one-time token: -join <master> <token>")
 	flag.Parse()
 
+	// -join 后跟两个参数，令牌之后的参数继续按 flag 解析
+	var joinToken string
+	if *joinMaster != "" && flag.NArg() > 0 {
+		joinToken = flag.Arg(0)
+		flag.CommandLine.Parse(flag.Args()[1:])
+	}
+
+	if *showVersion {
+		fmt.Println(version)
+		return
+	}
+
+	if heartbeat < 1 {
+		heartbeat = 1
+	}
+	if probeInterval < 1 {
+		probeInterval = 1
+	}
+	if probeConcurrency < 1 {
+		probeConcurrency = 1
+	}
+
+	if err := setupCredentials(*joinMaster, joinToken); err != nil {
+		log.Fatalf("Failed to enroll: %v", err)
+	}
 	if nodeKey == "" {
-		log.Fatal("Node key is required. Use -key flag")
+		log.Fatal("Node key is required. Use -key or -join <master> <token>")
 	}
 
-	log.Printf("🚀 Port Forward Agent Starting...")
+	log.Printf("🚀 Port Forward Agent %s Starting...", version)
 	log.Printf("   Node Name: %s", nodeName)
 	log.Printf("   Node Key: %s", nodeKey[:8]+"...")
 	log.Printf("   Listen Port: %d", listenPort)
 
+	initAccessLog()
+	if err := restoreState(); err != nil {
+		log.Printf("Failed to restore state: %v", err)
+	}
+	initUpdater()
+	if err := initAllowlist(); err != nil {
+		log.Fatalf("Invalid control API allowlist: %v", err)
+	}
+
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
 	router.Use(gin.Recovery())
 
-	router.Use(func(c *gin.Context) {
-		key := c.GetHeader("X-Node-Key")
-		if key != nodeKey {
-			c.JSON(http.StatusUnauthorized, APIResponse{Success: false, Message: "Invalid node key"})
-			c.Abort()
-			return
+	// /metrics 使用独立的令牌或地址白名单，需在 guardMiddleware 之前注册；
+	// 指定 -metrics-listen 时改由单独的明文端口提供
+	metricsRouter := router
+	if metricsListen != "" {
+		metricsRouter = gin.New()
+		metricsRouter.Use(gin.Recovery())
+	}
+	metricsEnabled, err := setupMetrics(metricsRouter)
+	if err != nil {
+		log.Fatalf("Invalid metrics allowlist: %v", err)
+	}
+	if metricsListen != "" {
+		if metricsEnabled {
+			go serveMetrics(metricsRouter)
+		} else {
+			log.Printf("⚠️ -metrics-listen ignored: set -metrics-token or -metrics-allow to enable /metrics")
 		}
-		c.Next()
-	})
+	}
+
+	router.Use(guardMiddleware)
 
 	router.GET("/status", handleStatus)
 	router.POST("/tunnels", handleCreateTunnel)
+	router.PUT("/tunnels", handleSyncTunnels)
+	router.PUT("/mesh", handleSetMesh)
 	router.DELETE("/tunnels/:id", handleDeleteTunnel)
 	router.POST("/tunnels/:id/start", handleStartTunnel)
 	router.POST("/tunnels/:id/stop", handleStopTunnel)
+	router.GET("/tunnels/:id/connections", handleGetConnections)
+	router.DELETE("/tunnels/:id/connections", handleCloseConnections)
+	router.DELETE("/tunnels/:id/connections/:conn_id", handleCloseConnection)
+	router.POST("/update", handleUpdate)
+	router.POST("/key", handleRotateKey)
+	router.POST("/cert/csr", handleCertCSR)
+	router.PUT("/cert", handleInstallCert)
+	router.POST("/diagnostics", handleDiagnostics)
+	router.GET("/access-log", handleAccessLog)
 	router.POST("/uninstall", handleUninstall)
 
 	go updateRatesLoop()
+	go networkLoop()
+	go probeLoop()
+	go meshLoop()
 
 	if masterURL != "" {
 		go registerToMaster()
 	}
 
+	tlsConfig, err := loadTLSConfig()
+	if err != nil {
+		log.Fatalf("Failed to load TLS certificate: %v", err)
+	}
+	if tlsConfig != nil && metricsEnabled && metricsListen == "" {
+		log.Printf("⚠️ The control port requires the master's client certificate, use -metrics-listen to let Prometheus scrape /metrics")
+	}
+
 	go func() {
-		addr := fmt.Sprintf("0.0.0.0:%d", listenPort)
-		log.Printf("✅ Agent running on %s", addr)
-		if err := router.Run(addr); err != nil {
+		srv := &http.Server{
+			Addr:              net.JoinHostPort(bindAddr, strconv.Itoa(listenPort)),
+			Handler:           router,
+			TLSConfig:         tlsConfig,
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			ErrorLog:          log.New(handshakeFilter{}, "", log.LstdFlags),
+		}
+
+		var err error
+		if tlsConfig != nil {
+			log.Printf("✅ Agent running on %s (mTLS)", srv.Addr)
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("✅ Agent running on %s", srv.Addr)
+			err = srv.ListenAndServe()
+		}
+		if err != nil {
 			log.Fatalf("Failed to start agent: %v", err)
 		}
 	}()
@@ -158,6 +294,9 @@ func handleCreateTunnel(c *gin.Context) {
 		TargetPort int    `json:"target_port"`
 		Protocol   string `json:"protocol"`
 		AutoStart  bool   `json:"auto_start"`
+		AccessLog  bool   `json:"access_log"`
+
+		HealthCheck *probe.HealthCheck `json:"health_check"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -168,22 +307,26 @@ func handleCreateTunnel(c *gin.Context) {
 	tunnelsMu.Lock()
 	if _, exists := tunnels[req.ID]; exists {
 		tunnelsMu.Unlock()
-		c.JSON(http.StatusBadRequest, APIResponse{Success: false, Message: "Tunnel already exists"})
+		c.JSON(http.StatusConflict, APIResponse{Success: false, Message: "Tunnel already exists"})
 		return
 	}
 
-	tunnel := &Tunnel{
+	tunnel := newTunnel(tunnelSpec{
 		ID:         req.ID,
 		LocalPort:  req.LocalPort,
 		TargetIP:   req.TargetIP,
 		TargetPort: req.TargetPort,
 		Protocol:   req.Protocol,
-		cancel:     make(chan struct{}),
-		lastUpdate: time.Now(),
-	}
+		Enabled:    req.AutoStart,
+		AccessLog:  req.AccessLog,
+
+		HealthCheck: req.HealthCheck,
+	})
 	tunnels[req.ID] = tunnel
 	tunnelsMu.Unlock()
 
+	revision := saveState()
+
 	if req.AutoStart {
 		if err := startTunnel(tunnel); err != nil {
 			c.JSON(http.StatusInternalServerError, APIResponse{Success: false, Message: err.Error()})
@@ -192,7 +335,7 @@ func handleCreateTunnel(c *gin.Context) {
 	}
 
 	log.Printf("✅ Tunnel created: %s (:%d -> %s:%d)", req.ID, req.LocalPort, req.TargetIP, req.TargetPort)
-	c.JSON(http.StatusOK, APIResponse{Success: true, Message: "Tunnel created"})
+	c.JSON(http.StatusOK, APIResponse{Success: true, Message: "Tunnel created", Data: revisionData(revision)})
 }
 
 func handleDeleteTunnel(c *gin.Context) {
@@ -210,8 +353,10 @@ func handleDeleteTunnel(c *gin.Context) {
 	delete(tunnels, id)
 	tunnelsMu.Unlock()
 
+	revision := saveState()
+
 	log.Printf("🗑️ Tunnel deleted: %s", id)
-	c.JSON(http.StatusOK, APIResponse{Success: true, Message: "Tunnel deleted"})
+	c.JSON(http.StatusOK, APIResponse{Success: true, Message: "Tunnel deleted", Data: revisionData(revision)})
 }
 
 func handleStartTunnel(c *gin.Context) {
@@ -226,12 +371,15 @@ func handleStartTunnel(c *gin.Context) {
 		return
 	}
 
+	tunnel.enabled.Store(true)
+	revision := saveState()
+
 	if err := startTunnel(tunnel); err != nil {
 		c.JSON(http.StatusInternalServerError, APIResponse{Success: false, Message: err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, APIResponse{Success: true, Message: "Tunnel started"})
+	c.JSON(http.StatusOK, APIResponse{Success: true, Message: "Tunnel started", Data: revisionData(revision)})
 }
 
 func handleStopTunnel(c *gin.Context) {
@@ -246,8 +394,48 @@ func handleStopTunnel(c *gin.Context) {
 		return
 	}
 
+	tunnel.enabled.Store(false)
 	stopTunnel(tunnel)
-	c.JSON(http.StatusOK, APIResponse{Success: true, Message: "Tunnel stopped"})
+	revision := saveState()
+
+	c.JSON(http.StatusOK, APIResponse{Success: true, Message: "Tunnel stopped", Data: revisionData(revision)})
+}
+
+func newTunnel(spec tunnelSpec) *Tunnel {
+	t := &Tunnel{
+		ID:         spec.ID,
+		LocalPort:  spec.LocalPort,
+		TargetIP:   spec.TargetIP,
+		TargetPort: spec.TargetPort,
+		Protocol:   spec.Protocol,
+		conns:      conns.NewRegistry(),
+		accessLog:  newTunnelAccessLog(spec.ID),
+		cancel:     make(chan struct{}),
+		lastUpdate: time.Now(),
+	}
+	t.enabled.Store(spec.Enabled)
+	t.logAccess.Store(spec.AccessLog)
+	t.check.Store(spec.HealthCheck)
+	t.probe.schedule(probeEvery())
+	return t
+}
+
+func (t *Tunnel) spec() tunnelSpec {
+	return tunnelSpec{
+		ID:         t.ID,
+		LocalPort:  t.LocalPort,
+		TargetIP:   t.TargetIP,
+		TargetPort: t.TargetPort,
+		Protocol:   t.Protocol,
+		Enabled:    t.enabled.Load(),
+		AccessLog:  t.logAccess.Load(),
+
+		HealthCheck: t.check.Load(),
+	}
+}
+
+func revisionData(revision int64) map[string]int64 {
+	return map[string]int64{"revision": revision}
 }
 
 func startTunnel(t *Tunnel) error {
@@ -312,49 +500,78 @@ func (t *Tunnel) startTCP() error {
 func (t *Tunnel) handleTCPConn(clientConn net.Conn) {
 	defer clientConn.Close()
 
-	targetAddr := fmt.Sprintf("%s:%d", t.TargetIP, t.TargetPort)
+	targetAddr := net.JoinHostPort(t.TargetIP, strconv.Itoa(t.TargetPort))
+	tracked := t.conns.Add("tcp", clientConn.RemoteAddr(), targetAddr, clientConn)
+	t.logConnect(tracked)
+
+	reason, cause := accesslog.ReasonEOF, error(nil)
+	defer func() {
+		t.conns.Remove(tracked.ID)
+		t.logClose(tracked, reason, cause)
+	}()
+
+	dialStart := time.Now()
 	targetConn, err := net.DialTimeout("tcp", targetAddr, 10*time.Second)
 	if err != nil {
+		t.dialErrors.Add(1)
+		t.timings.DialFailed(err)
+		reason, cause = accesslog.ReasonDialError, err
 		return
 	}
 	defer targetConn.Close()
+	connected := time.Now()
+	t.timings.Dial.Observe(connected.Sub(dialStart))
+
+	if !tracked.Attach(targetConn.RemoteAddr().String(), targetConn) {
+		reason = accesslog.ReasonClosed
+		return
+	}
 
-	var wg sync.WaitGroup
-	wg.Add(2)
+	errs := make(chan error, 2)
 
 	go func() {
-		defer wg.Done()
-		t.copyWithStats(targetConn, clientConn, &t.bytesOut)
+		errs <- t.copyWithStats(targetConn, clientConn, &t.bytesOut, &tracked.BytesOut, nil)
 	}()
 
 	go func() {
-		defer wg.Done()
-		t.copyWithStats(clientConn, targetConn, &t.bytesIn)
+		errs <- t.copyWithStats(clientConn, targetConn, &t.bytesIn, &tracked.BytesIn, func() {
+			t.timings.FirstByte.Observe(time.Since(connected))
+		})
 	}()
 
-	wg.Wait()
+	// 以先结束的方向作为关闭原因
+	cause = <-errs
+	<-errs
+	reason = t.closeReason(tracked, cause)
 }
 
-func (t *Tunnel) copyWithStats(dst, src net.Conn, counter *atomic.Int64) {
+// copyWithStats 转发单个方向的数据，返回结束时的错误，隧道停止时返回 nil。
+// firstRead 不为空时在读到第一个字节时调用
+func (t *Tunnel) copyWithStats(dst, src net.Conn, counter, connCounter *atomic.Int64, firstRead func()) error {
 	buf := make([]byte, 32*1024)
 	for {
 		select {
 		case <-t.cancel:
-			return
+			return nil
 		default:
 		}
 
 		src.SetReadDeadline(time.Now().Add(30 * time.Second))
 		n, err := src.Read(buf)
 		if n > 0 {
+			if firstRead != nil {
+				firstRead()
+				firstRead = nil
+			}
 			counter.Add(int64(n))
+			connCounter.Add(int64(n))
 			dst.SetWriteDeadline(time.Now().Add(30 * time.Second))
 			if _, werr := dst.Write(buf[:n]); werr != nil {
-				return
+				return werr
 			}
 		}
 		if err != nil {
-			return
+			return err
 		}
 	}
 }
@@ -373,10 +590,10 @@ func (t *Tunnel) startUDP() error {
 
 func (t *Tunnel) handleUDP() {
 	buf := make([]byte, 65535)
-	clients := make(map[string]*net.UDPConn)
+	clients := make(map[string]*udpSession)
 	var clientsMu sync.RWMutex
 
-	targetAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", t.TargetIP, t.TargetPort))
+	targetAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(t.TargetIP, strconv.Itoa(t.TargetPort)))
 	if err != nil {
 		log.Printf("Failed to resolve target: %v", err)
 		return
@@ -386,8 +603,8 @@ func (t *Tunnel) handleUDP() {
 		select {
 		case <-t.cancel:
 			clientsMu.Lock()
-			for _, c := range clients {
-				c.Close()
+			for _, session := range clients {
+				session.conn.Close()
 			}
 			clientsMu.Unlock()
 			return
@@ -412,21 +629,42 @@ func (t *Tunnel) handleUDP() {
 
 		clientKey := clientAddr.String()
 		clientsMu.RLock()
-		targetConn, exists := clients[clientKey]
+		session, exists := clients[clientKey]
 		clientsMu.RUnlock()
 
 		if !exists {
-			targetConn, err = net.DialUDP("udp", nil, targetAddr)
+			targetConn, err := net.DialUDP("udp", nil, targetAddr)
 			if err != nil {
+				t.dialErrors.Add(1)
+				t.timings.DialFailed(err)
 				continue
 			}
 
+			session = &udpSession{
+				conn:    targetConn,
+				tracked: t.conns.Add("udp", clientAddr, targetAddr.String(), targetConn),
+			}
+			t.logConnect(session.tracked)
 			clientsMu.Lock()
-			clients[clientKey] = targetConn
+			clients[clientKey] = session
 			clientsMu.Unlock()
 
-			go func(tc *net.UDPConn, ca *net.UDPAddr, key string) {
+			// 会话超时或被强制断开时清理
+			go func(s *udpSession, ca *net.UDPAddr, key string, started time.Time) {
+				var cause error
+				defer func() {
+					clientsMu.Lock()
+					if clients[key] == s {
+						delete(clients, key)
+					}
+					clientsMu.Unlock()
+					s.conn.Close()
+					t.conns.Remove(s.tracked.ID)
+					t.logClose(s.tracked, t.closeReason(s.tracked, cause), cause)
+				}()
+
 				rbuf := make([]byte, 65535)
+				first := true
 				for {
 					select {
 					case <-t.cancel:
@@ -434,29 +672,42 @@ func (t *Tunnel) handleUDP() {
 					default:
 					}
 
-					tc.SetReadDeadline(time.Now().Add(30 * time.Second))
-					rn, err := tc.Read(rbuf)
+					s.conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+					rn, err := s.conn.Read(rbuf)
 					if err != nil {
 						if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-							clientsMu.Lock()
-							delete(clients, key)
-							clientsMu.Unlock()
-							tc.Close()
+							cause = err
+							return
+						}
+						if errors.Is(err, net.ErrClosed) {
+							cause = err
 							return
 						}
 						continue
 					}
 
+					if first {
+						t.timings.FirstByte.Observe(time.Since(started))
+						first = false
+					}
 					t.bytesIn.Add(int64(rn))
+					s.tracked.BytesIn.Add(int64(rn))
 					t.udpConn.WriteToUDP(rbuf[:rn], ca)
 				}
-			}(targetConn, clientAddr, clientKey)
+			}(session, clientAddr, clientKey, time.Now())
 		}
 
-		targetConn.Write(buf[:n])
+		session.tracked.BytesOut.Add(int64(n))
+		session.conn.Write(buf[:n])
 	}
 }
 
+// udpSession 是一个 UDP 客户端对应的目标连接
+type udpSession struct {
+	conn    *net.UDPConn
+	tracked *conns.Conn
+}
+
 func stopTunnel(t *Tunnel) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -477,6 +728,8 @@ func stopTunnel(t *Tunnel) {
 		t.udpConn = nil
 	}
 
+	t.accessLog.Close()
+
 	t.running.Store(false)
 	log.Printf("⏹️ Tunnel stopped: %s", t.ID)
 }
@@ -492,10 +745,18 @@ func stopAllTunnels() {
 
 func getNodeStatus() NodeStatus {
 	status := NodeStatus{
-		NodeKey:  nodeKey,
 		NodeName: nodeName,
 		Online:   true,
 		Uptime:   int64(time.Since(startTime).Seconds()),
+
+		HeartbeatInterval: heartbeat,
+		StateRevision:     currentRevision(),
+
+		Version: version,
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+		Update:  getUpdateStatus(),
+		Mesh:    getMeshStatus(),
 	}
 
 	if cpuPercent, err := cpu.Percent(0, false); err == nil && len(cpuPercent) > 0 {
@@ -506,10 +767,7 @@ func getNodeStatus() NodeStatus {
 		status.MemPercent = memInfo.UsedPercent
 	}
 
-	if counters, err := psnet.IOCounters(false); err == nil && len(counters) > 0 {
-		status.NetRateIn = float64(counters[0].BytesRecv)
-		status.NetRateOut = float64(counters[0].BytesSent)
-	}
+	status.systemStats, status.Interfaces = getSystemStats()
 
 	tunnelsMu.RLock()
 	defer tunnelsMu.RUnlock()
@@ -518,35 +776,32 @@ func getNodeStatus() NodeStatus {
 	status.Tunnels = make([]TunnelStatus, 0, len(tunnels))
 
 	for _, t := range tunnels {
+		active, _ := t.conns.Counts()
 		ts := TunnelStatus{
-			ID:         t.ID,
-			LocalPort:  t.LocalPort,
-			TargetIP:   t.TargetIP,
-			TargetPort: t.TargetPort,
-			Protocol:   t.Protocol,
-			Running:    t.running.Load(),
-			BytesIn:    t.bytesIn.Load(),
-			BytesOut:   t.bytesOut.Load(),
-			RateIn:     t.rateIn,
-			RateOut:    t.rateOut,
-			Latency:    checkLatency(t.TargetIP, t.TargetPort),
+			ID:          t.ID,
+			LocalPort:   t.LocalPort,
+			TargetIP:    t.TargetIP,
+			TargetPort:  t.TargetPort,
+			Protocol:    t.Protocol,
+			Enabled:     t.enabled.Load(),
+			Running:     t.running.Load(),
+			AccessLog:   t.logAccess.Load(),
+			BytesIn:     t.bytesIn.Load(),
+			BytesOut:    t.bytesOut.Load(),
+			RateIn:      t.rateIn,
+			RateOut:     t.rateOut,
+			Connections: active,
+			HealthCheck: t.check.Load(),
 		}
+		ts.Latency, ts.ProbeError, ts.LastProbe, ts.Stats = t.probe.result()
+		snapshot := t.timings.Snapshot()
+		ts.Timings = &snapshot
 		status.Tunnels = append(status.Tunnels, ts)
 	}
 
 	return status
 }
 
-func checkLatency(ip string, port int) int64 {
-	start := time.Now()
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", ip, port), 5*time.Second)
-	if err != nil {
-		return -1
-	}
-	conn.Close()
-	return time.Since(start).Milliseconds()
-}
-
 func updateRatesLoop() {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
@@ -571,57 +826,37 @@ func updateRatesLoop() {
 }
 
 func registerToMaster() {
-	ticker := time.NewTicker(10 * time.Second)
+	client := &http.Client{Timeout: 5 * time.Second}
+	ticker := time.NewTicker(time.Duration(heartbeat) * time.Second)
 	defer ticker.Stop()
 
+	// 启动后立即上报一次，主控无需等待第一个心跳周期
 	for {
+		sendHeartbeat(client)
 		<-ticker.C
-		status := getNodeStatus()
-		data, _ := json.Marshal(status)
-
-		req, _ := http.NewRequest("POST", masterURL+"/api/nodes/heartbeat", bytes.NewReader(data))
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("X-Node-Key", nodeKey)
-
-		client := &http.Client{Timeout: 5 * time.Second}
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Printf("Failed to send heartbeat: %v", err)
-			continue
-		}
-		resp.Body.Close()
 	}
 }
 
-func handleUninstall(c *gin.Context) {
-	log.Println("🛑 Received uninstall command from master panel")
-
-	// 先返回成功响应
-	c.JSON(http.StatusOK, APIResponse{Success: true, Message: "Uninstalling..."})
-
-	// 异步执行卸载
-	go func() {
-		time.Sleep(500 * time.Millisecond)
-
-		// 停止所有隧道
-		stopAllTunnels()
-
-		log.Println("🗑️ Stopping and disabling service...")
-
-		// 停止并禁用 systemd 服务
-		exec.Command("systemctl", "stop", "port-forward-agent").Run()
-		exec.Command("systemctl", "disable", "port-forward-agent").Run()
-
-		// 删除服务文件
-		os.Remove("/etc/systemd/system/port-forward-agent.service")
-		exec.Command("systemctl", "daemon-reload").Run()
+func sendHeartbeat(client *http.Client) {
+	status := getNodeStatus()
+	data, _ := json.Marshal(status)
 
-		// 删除安装目录
-		os.RemoveAll("/opt/port-forward-agent")
+	req, _ := http.NewRequest("POST", masterURL+"/api/nodes/heartbeat", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	signRequest(req, currentKey(), data)
 
-		log.Println("✅ Uninstall completed, exiting...")
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("Failed to send heartbeat: %v", err)
+		return
+	}
+	defer resp.Body.Close()
 
-		// 退出进程
-		os.Exit(0)
-	}()
+	if resp.StatusCode != http.StatusOK {
+		var result APIResponse
+		json.NewDecoder(resp.Body).Decode(&result)
+		log.Printf("Heartbeat rejected by master (%d): %s", resp.StatusCode, result.Message)
+		return
+	}
+	lastHeartbeatOK.Store(time.Now().UnixNano())
 }
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"port-forward-common/probe"
+)
+
+// meshPeer 是主控下发的一个延迟探测对象：其他节点的 Agent 端口或关键目标
+type meshPeer struct {
+	ID   string `json:"id"`
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+// meshSchedule 是主控下发的探测计划，Version 为空表示关闭探测
+type meshSchedule struct {
+	Version  string     `json:"version"`
+	Interval int        `json:"interval"`
+	Timeout  int        `json:"timeout"`
+	Peers    []meshPeer `json:"peers"`
+}
+
+// meshResult 与主控 models.MeshResult 相同
+type meshResult struct {
+	Peer      string `json:"peer"`
+	Latency   int64  `json:"latency"`
+	Error     string `json:"error,omitempty"`
+	LastProbe int64  `json:"last_probe"`
+	probe.Stats
+}
+
+type meshStatus struct {
+	Version string       `json:"version"`
+	Results []meshResult `json:"results"`
+}
+
+// meshTarget 是一个探测对象及其结果，结果的缓存和调度与隧道健康检查相同
+type meshTarget struct {
+	peer  meshPeer
+	probe probeState
+}
+
+var (
+	meshMu       sync.Mutex
+	meshCurrent  meshSchedule
+	meshTargets  []*meshTarget
+	meshInterval time.Duration
+)
+
+// handleSetMesh 替换探测计划，地址未变的探测对象保留已有结果
+func handleSetMesh(c *gin.Context) {
+	var schedule meshSchedule
+	if err := c.ShouldBindJSON(&schedule); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Success: false, Message: "Invalid request"})
+		return
+	}
+
+	setMeshSchedule(schedule)
+	c.JSON(http.StatusOK, APIResponse{Success: true, Message: "Mesh schedule applied"})
+}
+
+func setMeshSchedule(schedule meshSchedule) {
+	meshMu.Lock()
+	defer meshMu.Unlock()
+
+	existing := make(map[meshPeer]*meshTarget, len(meshTargets))
+	for _, t := range meshTargets {
+		existing[t.peer] = t
+	}
+
+	interval := time.Duration(schedule.Interval) * time.Second
+	targets := make([]*meshTarget, 0, len(schedule.Peers))
+	if schedule.Version != "" && interval > 0 {
+		for _, peer := range schedule.Peers {
+			t, ok := existing[peer]
+			if !ok {
+				t = &meshTarget{peer: peer}
+				t.probe.schedule(interval)
+			}
+			targets = append(targets, t)
+		}
+	}
+
+	meshCurrent, meshTargets, meshInterval = schedule, targets, interval
+	if len(targets) == 0 {
+		log.Printf("🛰️ Mesh probing disabled")
+		return
+	}
+	log.Printf("🛰️ Mesh schedule %s applied: %d peers every %ds", schedule.Version, len(targets), schedule.Interval)
+}
+
+// getMeshStatus 返回当前探测计划的版本和结果，未收到过计划时返回 nil
+func getMeshStatus() *meshStatus {
+	meshMu.Lock()
+	defer meshMu.Unlock()
+
+	if meshCurrent.Version == "" {
+		return nil
+	}
+	status := &meshStatus{Version: meshCurrent.Version, Results: make([]meshResult, 0, len(meshTargets))}
+	for _, t := range meshTargets {
+		r := meshResult{Peer: t.peer.ID}
+		r.Latency, r.Error, r.LastProbe, r.Stats = t.probe.result()
+		status.Results = append(status.Results, r)
+	}
+	return status
+}
+
+// meshLoop 按计划以 TCP 连接探测各对象，同时进行的探测数不超过 probeConcurrency
+func meshLoop() {
+	sem := make(chan struct{}, probeConcurrency)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		meshMu.Lock()
+		check := &probe.HealthCheck{Type: probe.CheckTCP, Timeout: meshCurrent.Timeout}
+		interval := meshInterval
+		var due []*meshTarget
+		for _, t := range meshTargets {
+			if t.probe.due(now) {
+				due = append(due, t)
+			}
+		}
+		meshMu.Unlock()
+
+		for _, t := range due {
+			sem <- struct{}{}
+			go func(t *meshTarget) {
+				defer func() { <-sem }()
+				latency, reason := int64(-1), ""
+				elapsed, err := probe.Run(check, "tcp", t.peer.Host, t.peer.Port)
+				if err != nil {
+					reason = err.Error()
+				} else {
+					latency = elapsed.Milliseconds()
+				}
+				t.probe.finish(latency, reason, interval)
+			}(t)
+		}
+	}
+}
+
+// handshakeFilter 丢弃只建立 TCP 连接就关闭产生的 TLS 握手日志，
+// 其他节点的延迟探测会定期连接控制端口
+type handshakeFilter struct{}
+
+func (handshakeFilter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("TLS handshake error")) && bytes.HasSuffix(bytes.TrimSpace(p), []byte(": EOF")) {
+		return len(p), nil
+	}
+	return log.Writer().Write(p)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Prometheus 文本格式，与主控 metrics 包的输出保持一致
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	metricsToken  string
+	metricsAllow  string
+	metricsListen string
+)
+
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *metricsWriter) header(name, typ, help string) {
+	fmt.Fprintf(&w.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample 写入一个样本，labels 为成对的标签名和值
+func (w *metricsWriter) sample(name string, value float64, labels ...string) {
+	w.buf.WriteString(name)
+	if len(labels) > 0 {
+		w.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.buf.WriteString(labels[i])
+			w.buf.WriteString(`="`)
+			w.buf.WriteString(labelEscaper.Replace(labels[i+1]))
+			w.buf.WriteByte('"')
+		}
+		w.buf.WriteByte('}')
+	}
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.buf.WriteByte('\n')
+}
+
+func (w *metricsWriter) single(name, typ, help string, value float64, labels ...string) {
+	w.header(name, typ, help)
+	w.sample(name, value, labels...)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// setupMetrics 在指定了 -metrics-token 或 -metrics-allow 时注册 /metrics，返回是否已注册。
+// 这里的认证与节点密钥无关，Prometheus 不需要持有节点密钥
+func setupMetrics(router *gin.Engine) (bool, error) {
+	var allow []*net.IPNet
+	for _, e := range strings.Split(metricsAllow, ",") {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+		n, err := parseAllowEntry(e)
+		if err != nil {
+			return false, err
+		}
+		allow = append(allow, n)
+	}
+	if metricsToken == "" && len(allow) == 0 {
+		return false, nil
+	}
+
+	router.GET("/metrics", func(c *gin.Context) {
+		if !metricsAuthorized(c, allow) {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		handleMetrics(c)
+	})
+	return true, nil
+}
+
+// serveMetrics 在 -metrics-listen 指定的地址上以明文 HTTP 单独提供 /metrics。
+// 使用证书的节点控制端口要求主控的客户端证书，Prometheus 无法在那里抓取
+func serveMetrics(handler http.Handler) {
+	srv := &http.Server{
+		Addr:              metricsListen,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("📈 Metrics available on %s/metrics", metricsListen)
+	if err := srv.ListenAndServe(); err != nil {
+		log.Fatalf("Failed to start metrics listener: %v", err)
+	}
+}
+
+func metricsAuthorized(c *gin.Context, allow []*net.IPNet) bool {
+	if metricsToken != "" {
+		if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok &&
+			subtle.ConstantTimeCompare([]byte(bearer), []byte(metricsToken)) == 1 {
+			return true
+		}
+	}
+	if ip := net.ParseIP(c.RemoteIP()); ip != nil {
+		for _, n := range allow {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tunnelMetrics 是一条隧道的指标快照
+type tunnelMetrics struct {
+	labels     []string
+	running    bool
+	bytesIn    int64
+	bytesOut   int64
+	rateIn     float64
+	rateOut    float64
+	active     int
+	total      uint64
+	dialErrors int64
+}
+
+func handleMetrics(c *gin.Context) {
+	tunnelsMu.RLock()
+	snapshot := make([]tunnelMetrics, 0, len(tunnels))
+	for _, t := range tunnels {
+		active, total := t.conns.Counts()
+		snapshot = append(snapshot, tunnelMetrics{
+			labels:     []string{"tunnel_id", t.ID, "protocol", t.Protocol, "local_port", strconv.Itoa(t.LocalPort)},
+			running:    t.running.Load(),
+			bytesIn:    t.bytesIn.Load(),
+			bytesOut:   t.bytesOut.Load(),
+			rateIn:     t.rateIn,
+			rateOut:    t.rateOut,
+			active:     active,
+			total:      total,
+			dialErrors: t.dialErrors.Load(),
+		})
+	}
+	tunnelsMu.RUnlock()
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].labels[1] < snapshot[j].labels[1] })
+
+	w := &metricsWriter{}
+	w.single("portforward_agent_info", "gauge", "Agent build information.", 1, "version", version, "node", nodeName, "os", runtime.GOOS, "arch", runtime.GOARCH)
+	w.single("portforward_agent_tunnels", "gauge", "Number of tunnels configured on the agent.", float64(len(snapshot)))
+
+	// 计数器在隧道重建或 Agent 重启后从零开始，Prometheus 的 rate/increase 会自动处理
+	series := []struct {
+		name, typ, help string
+		value           func(m tunnelMetrics) float64
+	}{
+		{"portforward_agent_tunnel_running", "gauge", "Whether the tunnel is running.", func(m tunnelMetrics) float64 { return boolValue(m.running) }},
+		{"portforward_agent_tunnel_received_bytes_total", "counter", "Bytes received from the target and sent back to clients.", func(m tunnelMetrics) float64 { return float64(m.bytesIn) }},
+		{"portforward_agent_tunnel_sent_bytes_total", "counter", "Bytes received from clients and sent to the target.", func(m tunnelMetrics) float64 { return float64(m.bytesOut) }},
+		{"portforward_agent_tunnel_receive_rate_bytes", "gauge", "Current inbound rate in bytes per second.", func(m tunnelMetrics) float64 { return m.rateIn }},
+		{"portforward_agent_tunnel_send_rate_bytes", "gauge", "Current outbound rate in bytes per second.", func(m tunnelMetrics) float64 { return m.rateOut }},
+		{"portforward_agent_tunnel_connections", "gauge", "Number of active connections (UDP: client sessions).", func(m tunnelMetrics) float64 { return float64(m.active) }},
+		{"portforward_agent_tunnel_connections_total", "counter", "Connections accepted since the tunnel was created.", func(m tunnelMetrics) float64 { return float64(m.total) }},
+		{"portforward_agent_tunnel_dial_errors_total", "counter", "Failed attempts to connect to the target.", func(m tunnelMetrics) float64 { return float64(m.dialErrors) }},
+	}
+	for _, s := range series {
+		w.header(s.name, s.typ, s.help)
+		for _, m := range snapshot {
+			w.sample(s.name, s.value(m), m.labels...)
+		}
+	}
+
+	w.header("portforward_agent_control_rejected_total", "counter", "Control API requests rejected by the source allowlist (acl), an auth lockout (locked) or an invalid node key (auth).")
+	w.sample("portforward_agent_control_rejected_total", float64(rejectedACL.Load()), "reason", "acl")
+	w.sample("portforward_agent_control_rejected_total", float64(rejectedLocked.Load()), "reason", "locked")
+	w.sample("portforward_agent_control_rejected_total", float64(rejectedAuth.Load()), "reason", "auth")
+
+	writeRuntimeMetrics(w)
+
+	c.Data(http.StatusOK, metricsContentType, w.buf.Bytes())
+}
+
+func writeRuntimeMetrics(w *metricsWriter) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	threads, _ := runtime.ThreadCreateProfile(nil)
+
+	w.single("go_goroutines", "gauge", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	w.single("go_threads", "gauge", "Number of OS threads created.", float64(threads))
+	w.single("go_memstats_alloc_bytes", "gauge", "Number of bytes allocated and still in use.", float64(ms.Alloc))
+	w.single("go_memstats_sys_bytes", "gauge", "Number of bytes obtained from system.", float64(ms.Sys))
+	w.single("go_memstats_heap_inuse_bytes", "gauge", "Number of heap bytes that are in use.", float64(ms.HeapInuse))
+	w.single("go_memstats_heap_objects", "gauge", "Number of allocated objects.", float64(ms.HeapObjects))
+	w.single("go_gc_cycles_total", "counter", "Number of completed GC cycles.", float64(ms.NumGC))
+	w.single("go_gc_pause_seconds_total", "counter", "Total GC stop-the-world pause time in seconds.", float64(ms.PauseTotalNs)/1e9)
+	w.single("go_info", "gauge", "Information about the Go environment.", 1, "version", runtime.Version())
+	w.single("process_start_time_seconds", "gauge", "Start time of the process since unix epoch in seconds.", float64(startTime.Unix()))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"port-forward-common/probe"
+)
+
+var (
+	probeInterval    int
+	probeConcurrency int
+)
+
+// probeState 缓存隧道最近一次健康检查的结果，/status 直接读取，不在请求路径上探测
+type probeState struct {
+	mu      sync.Mutex
+	latency int64
+	err     string
+	last    time.Time
+	next    time.Time
+	active  bool
+	window  probe.Window
+}
+
+// result 返回最近一次检查的延迟、失败原因、检查时间（Unix 秒，未检查过为 0）和窗口统计
+func (p *probeState) result() (int64, string, int64, probe.Stats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.last.IsZero() {
+		return 0, "", 0, p.window.Stats()
+	}
+	return p.latency, p.err, p.last.Unix(), p.window.Stats()
+}
+
+// schedule 在 [0, d) 内随机安排下一次检查，新隧道和重启后的隧道不会同时探测
+func (p *probeState) schedule(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.next = time.Now().Add(time.Duration(rand.Int63n(int64(d) + 1)))
+}
+
+// reset 丢弃旧结果并尽快重新检查，用于健康检查配置变化后
+func (p *probeState) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.latency, p.err, p.last, p.next = 0, "", time.Time{}, time.Time{}
+	p.window.Reset()
+}
+
+// due 判断是否到了检查时间，是则标记为进行中
+func (p *probeState) due(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.active || now.Before(p.next) {
+		return false
+	}
+	p.active = true
+	return true
+}
+
+// finish 记录检查结果，下一次检查在间隔基础上加减 10% 的随机抖动
+func (p *probeState) finish(latency int64, err string, interval time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	p.latency, p.err, p.last = latency, err, now
+	p.window.Add(latency)
+	p.next = now.Add(interval*9/10 + time.Duration(rand.Int63n(int64(interval)/5+1)))
+	p.active = false
+}
+
+func probeEvery() time.Duration {
+	return time.Duration(probeInterval) * time.Second
+}
+
+// probeLoop 定期检查运行中的隧道，同时进行的检查数不超过 probeConcurrency
+func probeLoop() {
+	sem := make(chan struct{}, probeConcurrency)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		tunnelsMu.RLock()
+		var due []*Tunnel
+		for _, t := range tunnels {
+			if t.running.Load() && probe.Effective(t.check.Load(), t.Protocol) != nil && t.probe.due(now) {
+				due = append(due, t)
+			}
+		}
+		tunnelsMu.RUnlock()
+
+		for _, t := range due {
+			sem <- struct{}{}
+			go func(t *Tunnel) {
+				defer func() { <-sem }()
+				latency, err := probeTunnel(t)
+				t.probe.finish(latency, err, probeEvery())
+			}(t)
+		}
+	}
+}
+
+// probeTunnel 对隧道目标执行一次健康检查，返回延迟（ms，失败为 -1）和失败原因；未探测时返回 0
+func probeTunnel(t *Tunnel) (int64, string) {
+	check := probe.Effective(t.check.Load(), t.Protocol)
+	if check == nil {
+		return 0, ""
+	}
+	elapsed, err := probe.Run(check, t.Protocol, t.TargetIP, t.TargetPort)
+	if err != nil {
+		return -1, err.Error()
+	}
+	return elapsed.Milliseconds(), ""
+}
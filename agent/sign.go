@@ -0,0 +1,24 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"port-forward-common/signing"
+)
+
+// signRequest 为发往主控的请求附加签名头，Key 本身不会出现在请求中
+func signRequest(req *http.Request, key string, body []byte) {
+	nonceBytes := make([]byte, 16)
+	rand.Read(nonceBytes)
+	nonce := hex.EncodeToString(nonceBytes)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set(signing.HeaderKeyID, signing.KeyID(key))
+	req.Header.Set(signing.HeaderTimestamp, timestamp)
+	req.Header.Set(signing.HeaderNonce, nonce)
+	req.Header.Set(signing.HeaderSignature, signing.SignHeartbeat(key, timestamp, nonce, body))
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"port-forward-common/probe"
+)
+
+const stateFileName = "state.json"
+
+// tunnelSpec 是持久化到状态文件中的隧道定义
+type tunnelSpec struct {
+	ID         string `json:"id"`
+	LocalPort  int    `json:"local_port"`
+	TargetIP   string `json:"target_ip"`
+	TargetPort int    `json:"target_port"`
+	Protocol   string `json:"protocol"`
+	Enabled    bool   `json:"enabled"`
+	AccessLog  bool   `json:"access_log"`
+
+	HealthCheck *probe.HealthCheck `json:"health_check,omitempty"`
+}
+
+// agentState 是 Agent 的本地状态，Revision 每次变更递增，主控据此判断状态是否落后
+type agentState struct {
+	Revision  int64        `json:"revision"`
+	UpdatedAt int64        `json:"updated_at"`
+	Tunnels   []tunnelSpec `json:"tunnels"`
+}
+
+var (
+	stateRevision int64
+	stateMu       sync.Mutex
+)
+
+func statePath() string {
+	return filepath.Join(dataDir, stateFileName)
+}
+
+// defaultDataDir 默认使用可执行文件所在目录，即安装目录
+func defaultDataDir() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return "."
+	}
+	return filepath.Dir(exe)
+}
+
+func currentRevision() int64 {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	return stateRevision
+}
+
+// saveState 递增版本号并把当前隧道集合原子写入状态文件，返回新的版本号
+func saveState() int64 {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	tunnelsMu.RLock()
+	specs := make([]tunnelSpec, 0, len(tunnels))
+	for _, t := range tunnels {
+		specs = append(specs, t.spec())
+	}
+	tunnelsMu.RUnlock()
+
+	sort.Slice(specs, func(i, j int) bool { return specs[i].ID < specs[j].ID })
+
+	stateRevision++
+	state := agentState{
+		Revision:  stateRevision,
+		UpdatedAt: time.Now().Unix(),
+		Tunnels:   specs,
+	}
+
+	if err := writeFileAtomic(statePath(), state); err != nil {
+		log.Printf("Failed to save state: %v", err)
+	}
+	return stateRevision
+}
+
+// writeFileAtomic 先写临时文件并 fsync，再 rename 覆盖目标文件
+func writeFileAtomic(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeBytesAtomic(path, data)
+}
+
+// writeBytesAtomic 以 0600 权限原子写入任意内容
+func writeBytesAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, ".tmp-"+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, 0600); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// restoreState 启动时从状态文件恢复隧道，不依赖主控是否可达
+func restoreState() error {
+	data, err := os.ReadFile(statePath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state agentState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("invalid state file: %v", err)
+	}
+
+	stateMu.Lock()
+	stateRevision = state.Revision
+	stateMu.Unlock()
+
+	for _, spec := range state.Tunnels {
+		t := newTunnel(spec)
+
+		tunnelsMu.Lock()
+		tunnels[spec.ID] = t
+		tunnelsMu.Unlock()
+
+		if spec.Enabled {
+			if err := startTunnel(t); err != nil {
+				log.Printf("Failed to restore tunnel %s: %v", spec.ID, err)
+			}
+		}
+	}
+
+	log.Printf("📂 Restored %d tunnels from state (revision %d)", len(state.Tunnels), state.Revision)
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 批量同步中单条隧道执行的动作
+const (
+	actionCreated   = "created"
+	actionUpdated   = "updated"
+	actionStarted   = "started"
+	actionStopped   = "stopped"
+	actionDeleted   = "deleted"
+	actionUnchanged = "unchanged"
+)
+
+type tunnelSyncResult struct {
+	ID      string `json:"id"`
+	Action  string `json:"action"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+type syncResponse struct {
+	Revision int64              `json:"revision"`
+	Results  []tunnelSyncResult `json:"results"`
+}
+
+// handleSyncTunnels 接收完整的期望隧道集合，在一次加锁内应用差异并只写一次状态文件
+func handleSyncTunnels(c *gin.Context) {
+	var req struct {
+		Tunnels []tunnelSpec `json:"tunnels"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Success: false, Message: "Invalid request"})
+		return
+	}
+
+	seen := make(map[string]bool, len(req.Tunnels))
+	for _, spec := range req.Tunnels {
+		if spec.ID == "" || seen[spec.ID] {
+			c.JSON(http.StatusBadRequest, APIResponse{Success: false, Message: "Duplicate or empty tunnel id"})
+			return
+		}
+		seen[spec.ID] = true
+	}
+
+	results := applyTunnelSet(req.Tunnels)
+	revision := saveState()
+
+	c.JSON(http.StatusOK, APIResponse{Success: true, Data: syncResponse{Revision: revision, Results: results}})
+}
+
+func applyTunnelSet(desired []tunnelSpec) []tunnelSyncResult {
+	tunnelsMu.Lock()
+	defer tunnelsMu.Unlock()
+
+	results := make([]tunnelSyncResult, 0, len(desired)+len(tunnels))
+	wanted := make(map[string]bool, len(desired))
+
+	// 先删除多余的隧道，释放端口给新隧道使用
+	for _, spec := range desired {
+		wanted[spec.ID] = true
+	}
+	for id, t := range tunnels {
+		if !wanted[id] {
+			stopTunnel(t)
+			delete(tunnels, id)
+			results = append(results, tunnelSyncResult{ID: id, Action: actionDeleted, Success: true})
+		}
+	}
+
+	// 规格变化的隧道也要先停掉，避免端口互换时冲突
+	for _, spec := range desired {
+		if t, exists := tunnels[spec.ID]; exists && t.spec().differs(spec) {
+			stopTunnel(t)
+		}
+	}
+
+	for _, spec := range desired {
+		result := tunnelSyncResult{ID: spec.ID, Success: true}
+		t, exists := tunnels[spec.ID]
+
+		switch {
+		case !exists:
+			t = newTunnel(spec)
+			tunnels[spec.ID] = t
+			result.Action = actionCreated
+		case t.spec().differs(spec):
+			t = newTunnel(spec)
+			tunnels[spec.ID] = t
+			result.Action = actionUpdated
+		case spec.Enabled && (!t.running.Load() || !t.enabled.Load()):
+			result.Action = actionStarted
+		case !spec.Enabled && (t.running.Load() || t.enabled.Load()):
+			result.Action = actionStopped
+		case spec.AccessLog != t.logAccess.Load() || !reflect.DeepEqual(spec.HealthCheck, t.check.Load()):
+			result.Action = actionUpdated
+		default:
+			result.Action = actionUnchanged
+		}
+
+		t.enabled.Store(spec.Enabled)
+		t.logAccess.Store(spec.AccessLog)
+		if !reflect.DeepEqual(spec.HealthCheck, t.check.Load()) {
+			t.check.Store(spec.HealthCheck)
+			t.probe.reset()
+		}
+		if spec.Enabled {
+			if err := startTunnel(t); err != nil {
+				result.Success = false
+				result.Error = err.Error()
+			}
+		} else {
+			stopTunnel(t)
+		}
+
+		results = append(results, result)
+	}
+
+	log.Printf("🔄 Synced %d tunnels from master", len(desired))
+	return results
+}
+
+// differs 判断隧道的转发规格是否变化（不比较启用状态）
+func (s tunnelSpec) differs(o tunnelSpec) bool {
+	return s.LocalPort != o.LocalPort ||
+		s.TargetIP != o.TargetIP ||
+		s.TargetPort != o.TargetPort ||
+		s.Protocol != o.Protocol
+}
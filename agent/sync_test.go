@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// freePort 返回一个当前无人监听的本机端口
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// withTestTunnels 在临时目录中运行，结束后停止测试中创建的隧道
+func withTestTunnels(t *testing.T) {
+	t.Helper()
+	savedDataDir, savedLogDir, savedTunnels, savedRevision := dataDir, accessLogDir, tunnels, stateRevision
+	dataDir = t.TempDir()
+	accessLogDir = filepath.Join(dataDir, "access-logs")
+	tunnels = make(map[string]*Tunnel)
+	stateRevision = 0
+
+	t.Cleanup(func() {
+		for _, tunnel := range tunnels {
+			stopTunnel(tunnel)
+		}
+		dataDir, accessLogDir, tunnels, stateRevision = savedDataDir, savedLogDir, savedTunnels, savedRevision
+	})
+}
+
+func postSync(t *testing.T, specs []tunnelSpec) (int, syncResponse) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PUT("/tunnels", handleSyncTunnels)
+
+	body, _ := json.Marshal(map[string]interface{}{"tunnels": specs})
+	req := httptest.NewRequest(http.MethodPut, "/tunnels", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp struct {
+		Data syncResponse `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp.Data
+}
+
+func resultsByID(results []tunnelSyncResult) map[string]tunnelSyncResult {
+	byID := make(map[string]tunnelSyncResult, len(results))
+	for _, r := range results {
+		byID[r.ID] = r
+	}
+	return byID
+}
+
+func TestSyncTunnelsAppliesDiff(t *testing.T) {
+	withTestTunnels(t)
+
+	// 占用一个端口，让对应的隧道启动失败
+	busy, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	busyPort := busy.Addr().(*net.TCPAddr).Port
+
+	a := tunnelSpec{ID: "a", LocalPort: freePort(t), TargetIP: "127.0.0.1", TargetPort: 1, Protocol: "tcp", Enabled: true}
+	b := tunnelSpec{ID: "b", LocalPort: busyPort, TargetIP: "127.0.0.1", TargetPort: 1, Protocol: "tcp", Enabled: true}
+	c := tunnelSpec{ID: "c", LocalPort: freePort(t), TargetIP: "127.0.0.1", TargetPort: 1, Protocol: "tcp"}
+
+	code, resp := postSync(t, []tunnelSpec{a, b, c})
+	if code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	got := resultsByID(resp.Results)
+	if len(got) != 3 || !got["a"].Success || got["a"].Action != actionCreated || got["c"].Action != actionCreated {
+		t.Errorf("first sync results = %+v", resp.Results)
+	}
+	if r := got["b"]; r.Success || r.Action != actionCreated || !strings.Contains(r.Error, "failed to listen") {
+		t.Errorf("busy port result = %+v, want a listen error", r)
+	}
+	if !tunnels["a"].running.Load() || tunnels["b"].running.Load() || tunnels["c"].running.Load() {
+		t.Error("running state does not match the synced specs")
+	}
+	if resp.Revision != 1 {
+		t.Errorf("revision = %d, want 1", resp.Revision)
+	}
+
+	// 第二次同步：a 换目标，c 启用，b 被删除，d 新建且不启用
+	a.TargetPort = 2
+	c.Enabled = true
+	d := tunnelSpec{ID: "d", LocalPort: freePort(t), TargetIP: "127.0.0.1", TargetPort: 1, Protocol: "udp"}
+	code, resp = postSync(t, []tunnelSpec{a, c, d})
+	if code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	want := map[string]string{"a": actionUpdated, "b": actionDeleted, "c": actionStarted, "d": actionCreated}
+	got = resultsByID(resp.Results)
+	if len(got) != len(want) {
+		t.Errorf("second sync results = %+v", resp.Results)
+	}
+	for id, action := range want {
+		if r := got[id]; r.Action != action || !r.Success {
+			t.Errorf("result for %s = %+v, want successful %s", id, r, action)
+		}
+	}
+	if _, exists := tunnels["b"]; exists {
+		t.Error("tunnel b still exists after being dropped from the desired set")
+	}
+	if tunnels["a"].TargetPort != 2 || !tunnels["a"].running.Load() || !tunnels["c"].running.Load() || tunnels["d"].running.Load() {
+		t.Error("tunnels do not match the second sync")
+	}
+
+	// 再次下发相同集合不做任何改动
+	_, resp = postSync(t, []tunnelSpec{a, c, d})
+	for _, r := range resp.Results {
+		if r.Action != actionUnchanged {
+			t.Errorf("repeated sync result = %+v, want unchanged", r)
+		}
+	}
+
+	// 每次同步只写一次状态文件，内容为最新的隧道集合
+	data, err := os.ReadFile(statePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state agentState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Revision != 3 || len(state.Tunnels) != 3 || state.Tunnels[0].ID != "a" || !state.Tunnels[1].Enabled {
+		t.Errorf("state file = %+v", state)
+	}
+}
+
+func TestSyncTunnelsRejectsInvalidSet(t *testing.T) {
+	withTestTunnels(t)
+
+	tests := []struct {
+		name  string
+		specs []tunnelSpec
+	}{
+		{"duplicate id", []tunnelSpec{{ID: "a", LocalPort: 1}, {ID: "a", LocalPort: 2}}},
+		{"empty id", []tunnelSpec{{LocalPort: 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _ := postSync(t, tt.specs); code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", code)
+			}
+			if len(tunnels) != 0 || currentRevision() != 0 {
+				t.Error("invalid sync changed the tunnel set")
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	psnet "github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+var (
+	netInterfaces string
+	diskPath      string
+)
+
+// excludedInterfaces 是未指定 -net-iface 时排除的虚拟网卡，它们的流量会与物理网卡重复计算
+var excludedInterfaces = []string{"docker*", "br-*", "veth*", "virbr*", "cni*", "flannel*", "cali*", "kube-*", "podman*", "lxcbr*", "lxdbr*"}
+
+// systemStats 与主控 models.NodeSystem 相同
+type systemStats struct {
+	NetRateIn   float64 `json:"net_rate_in"`
+	NetRateOut  float64 `json:"net_rate_out"`
+	DiskPercent float64 `json:"disk_percent"`
+	DiskUsed    uint64  `json:"disk_used"`
+	DiskTotal   uint64  `json:"disk_total"`
+	Load1       float64 `json:"load1"`
+	Load5       float64 `json:"load5"`
+	Load15      float64 `json:"load15"`
+	OpenFDs     int64   `json:"open_fds"`
+	MaxFDs      int64   `json:"max_fds"`
+}
+
+type interfaceStats struct {
+	Name     string  `json:"name"`
+	BytesIn  uint64  `json:"bytes_in"`
+	BytesOut uint64  `json:"bytes_out"`
+	RateIn   float64 `json:"rate_in"`
+	RateOut  float64 `json:"rate_out"`
+}
+
+// netSampler 每秒采样所选网卡的累计字节数并计算速率
+type netSampler struct {
+	mu    sync.Mutex
+	last  map[string]psnet.IOCountersStat
+	at    time.Time
+	stats []interfaceStats
+}
+
+var network = &netSampler{}
+
+// selectInterface 判断网卡是否计入：指定了 -net-iface 时只按其匹配（支持 * 通配），
+// 否则排除回环和容器网桥
+func selectInterface(name string, loopback map[string]bool) bool {
+	if netInterfaces != "" {
+		for _, pattern := range strings.Split(netInterfaces, ",") {
+			if ok, _ := path.Match(strings.TrimSpace(pattern), name); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if loopback[name] {
+		return false
+	}
+	for _, pattern := range excludedInterfaces {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	return true
+}
+
+func loopbackInterfaces() map[string]bool {
+	result := make(map[string]bool)
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			result[iface.Name] = true
+		}
+	}
+	return result
+}
+
+func (s *netSampler) sample() {
+	counters, err := psnet.IOCounters(true)
+	if err != nil {
+		return
+	}
+	loopback := loopbackInterfaces()
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elapsed := now.Sub(s.at).Seconds()
+	current := make(map[string]psnet.IOCountersStat, len(counters))
+	stats := make([]interfaceStats, 0, len(counters))
+	for _, c := range counters {
+		if !selectInterface(c.Name, loopback) {
+			continue
+		}
+		current[c.Name] = c
+		st := interfaceStats{Name: c.Name, BytesIn: c.BytesRecv, BytesOut: c.BytesSent}
+		// 网卡重建或计数回绕时本次不计算速率
+		if prev, ok := s.last[c.Name]; ok && elapsed > 0 && c.BytesRecv >= prev.BytesRecv && c.BytesSent >= prev.BytesSent {
+			st.RateIn = float64(c.BytesRecv-prev.BytesRecv) / elapsed
+			st.RateOut = float64(c.BytesSent-prev.BytesSent) / elapsed
+		}
+		stats = append(stats, st)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+
+	s.last, s.at, s.stats = current, now, stats
+}
+
+// snapshot 返回各网卡的最近一次采样及速率之和
+func (s *netSampler) snapshot() ([]interfaceStats, float64, float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rateIn, rateOut float64
+	for _, st := range s.stats {
+		rateIn += st.RateIn
+		rateOut += st.RateOut
+	}
+	return append([]interfaceStats(nil), s.stats...), rateIn, rateOut
+}
+
+func networkLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	network.sample()
+	for range ticker.C {
+		network.sample()
+	}
+}
+
+var self, _ = process.NewProcess(int32(os.Getpid()))
+
+// getSystemStats 汇总网络速率、磁盘、负载和本进程的文件描述符，不支持的项保持为 0
+func getSystemStats() (systemStats, []interfaceStats) {
+	var stats systemStats
+	ifaces, rateIn, rateOut := network.snapshot()
+	stats.NetRateIn, stats.NetRateOut = rateIn, rateOut
+
+	if usage, err := disk.Usage(diskPath); err == nil {
+		stats.DiskPercent, stats.DiskUsed, stats.DiskTotal = usage.UsedPercent, usage.Used, usage.Total
+	}
+	if avg, err := load.Avg(); err == nil {
+		stats.Load1, stats.Load5, stats.Load15 = avg.Load1, avg.Load5, avg.Load15
+	}
+	if self != nil {
+		if fds, err := self.NumFDs(); err == nil {
+			stats.OpenFDs = int64(fds)
+		}
+		if limits, err := self.Rlimit(); err == nil {
+			for _, l := range limits {
+				if l.Resource == process.RLIMIT_NOFILE {
+					stats.MaxFDs = int64(l.Soft)
+				}
+			}
+		}
+	}
+	return stats, ifaces
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 注册时由主控 CA 签发的证书，存在时控制 API 改用 mTLS
+const (
+	tlsKeyFile  = "tls.key"
+	tlsCertFile = "tls.crt"
+	caCertFile  = "ca.crt"
+
+	// masterCommonName 是主控客户端证书的 CN
+	masterCommonName = "port-forward-master"
+)
+
+var (
+	agentCert atomic.Pointer[tls.Certificate]
+
+	// pendingCertKey 是续签时新生成、等待主控签发证书的私钥
+	pendingCertKey *ecdsa.PrivateKey
+	pendingMu      sync.Mutex
+)
+
+// newCSR 生成新的私钥和证书请求，证书身份由主控决定，这里只提供公钥
+func newCSR() (*ecdsa.PrivateKey, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, "", err
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, key)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})), nil
+}
+
+// installCert 校验证书与私钥匹配后写入数据目录并热替换
+func installCert(key *ecdsa.PrivateKey, certPEM string) (*x509.Certificate, error) {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	pair, err := tls.X509KeyPair([]byte(certPEM), keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeBytesAtomic(filepath.Join(dataDir, tlsKeyFile), keyPEM); err != nil {
+		return nil, err
+	}
+	if err := writeBytesAtomic(filepath.Join(dataDir, tlsCertFile), []byte(certPEM)); err != nil {
+		return nil, err
+	}
+
+	agentCert.Store(&pair)
+	return leaf, nil
+}
+
+// loadTLSConfig 加载证书和 CA，未注册证书时返回 nil，控制 API 保持明文
+func loadTLSConfig() (*tls.Config, error) {
+	caPEM, err := os.ReadFile(filepath.Join(dataDir, caCertFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pair, err := tls.LoadX509KeyPair(filepath.Join(dataDir, tlsCertFile), filepath.Join(dataDir, tlsKeyFile))
+	if err != nil {
+		return nil, err
+	}
+	agentCert.Store(&pair)
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("invalid CA certificate in %s", caCertFile)
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return agentCert.Load(), nil
+		},
+		// 同一 CA 也为其他节点签发证书，只接受主控身份的客户端证书
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 || cs.PeerCertificates[0].Subject.CommonName != masterCommonName {
+				return errors.New("client certificate is not the master's")
+			}
+			return nil
+		},
+	}, nil
+}
+
+// handleCertCSR 为续签生成新私钥并返回 CSR，私钥在证书下发前只保存在内存中
+func handleCertCSR(c *gin.Context) {
+	key, csr, err := newCSR()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	pendingMu.Lock()
+	pendingCertKey = key
+	pendingMu.Unlock()
+
+	c.JSON(http.StatusOK, APIResponse{Success: true, Data: map[string]string{"csr": csr}})
+}
+
+func handleInstallCert(c *gin.Context) {
+	var req struct {
+		Cert string `json:"cert"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Cert == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Success: false, Message: "Invalid request"})
+		return
+	}
+
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+
+	if pendingCertKey == nil {
+		c.JSON(http.StatusConflict, APIResponse{Success: false, Message: "No pending certificate request"})
+		return
+	}
+
+	leaf, err := installCert(pendingCertKey, req.Cert)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	pendingCertKey = nil
+
+	log.Printf("🔐 Certificate renewed, valid until %s", leaf.NotAfter.Format(time.RFC3339))
+	c.JSON(http.StatusOK, APIResponse{Success: true, Message: "Certificate installed"})
+}
@@ -0,0 +1,85 @@
+//go:build linux
+
+package main
+
+import (
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	// traceBasePort 是经典 traceroute 使用的 UDP 目标端口起点
+	traceBasePort = 33434
+	// soEEOriginICMP 对应 SO_EE_ORIGIN_ICMP，表示错误来自 ICMP 报文
+	soEEOriginICMP      = 2
+	icmpDestUnreachable = 3
+)
+
+// probeHop 发送一个限定 TTL 的 UDP 探测包，通过 IP_RECVERR 读取路由器返回的 ICMP 错误。
+// 与 tracepath 相同，不需要 raw socket 权限
+func probeHop(dst net.IP, ttl int, timeout time.Duration) (traceHop, error) {
+	hop := traceHop{TTL: ttl}
+
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return hop, err
+	}
+	defer syscall.Close(fd)
+
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_TTL, ttl); err != nil {
+		return hop, err
+	}
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_RECVERR, 1); err != nil {
+		return hop, err
+	}
+
+	sa := &syscall.SockaddrInet4{Port: traceBasePort + ttl}
+	copy(sa.Addr[:], dst.To4())
+	if err := syscall.Connect(fd, sa); err != nil {
+		return hop, err
+	}
+
+	start := time.Now()
+	if _, err := syscall.Write(fd, []byte("port-forward-probe")); err != nil {
+		return hop, err
+	}
+
+	buf := make([]byte, 512)
+	oob := make([]byte, 512)
+	for time.Since(start) < timeout {
+		_, oobn, _, _, err := syscall.Recvmsg(fd, buf, oob, syscall.MSG_ERRQUEUE)
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			time.Sleep(5 * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			return hop, err
+		}
+		rtt := time.Since(start)
+
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			return hop, err
+		}
+		for _, m := range msgs {
+			// sock_extended_err 占 16 字节，后面紧跟出错报文来源的 sockaddr_in
+			if m.Header.Level != syscall.IPPROTO_IP || m.Header.Type != syscall.IP_RECVERR || len(m.Data) < 24 {
+				continue
+			}
+			origin, icmpType := m.Data[4], m.Data[5]
+			offender := net.IP(m.Data[20:24])
+			hop.Addr = offender.String()
+			hop.RTTMs = millis(rtt)
+			// 目标主机对探测端口返回不可达说明已经到达，中间路由返回不可达说明路径不通
+			if origin == soEEOriginICMP && icmpType == icmpDestUnreachable {
+				hop.Reached = offender.Equal(dst)
+				hop.Unreachable = !hop.Reached
+			}
+			return hop, nil
+		}
+	}
+
+	hop.Timeout = true
+	return hop, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+func probeHop(dst net.IP, ttl int, timeout time.Duration) (traceHop, error) {
+	return traceHop{TTL: ttl}, errors.New("traceroute is only supported on linux")
+}
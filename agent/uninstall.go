@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"port-forward-common/signing"
+)
+
+const (
+	installDir  = "/opt/port-forward-agent"
+	serviceName = "port-forward-agent"
+	serviceFile = "/etc/systemd/system/port-forward-agent.service"
+
+	// commandUninstall 与主控 models.CommandUninstall 保持一致
+	commandUninstall = "uninstall"
+	// commandClockSkew 校验指令有效期时允许的时钟偏差
+	commandClockSkew = 30 * time.Second
+)
+
+// signedCommand 与主控 models.SignedCommand 保持一致
+type signedCommand struct {
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+type uninstallCommand struct {
+	Action    string `json:"action"`
+	NodeID    string `json:"node_id"`
+	KeyID     string `json:"key_id"`
+	Nonce     string `json:"nonce"`
+	IssuedAt  int64  `json:"issued_at"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+type uninstallReport struct {
+	Nonce   string `json:"nonce"`
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
+}
+
+var (
+	uninstalling atomic.Bool
+
+	// usedCommands 记录有效期内已执行过的指令 nonce，拒绝重放
+	usedCommands   = make(map[string]int64)
+	usedCommandsMu sync.Mutex
+)
+
+// verifyUninstallCommand 校验指令由主控发布密钥签名、发给本节点当前密钥且仍在有效期内
+func verifyUninstallCommand(signed signedCommand) (*uninstallCommand, error) {
+	if updatePubKey == nil {
+		return nil, errors.New("no master public key pinned, signed commands are disabled")
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(signed.Payload)
+	if err != nil {
+		return nil, errors.New("invalid command payload")
+	}
+	if !verifySignature(signing.PurposeCommand, payload, signed.Signature) {
+		return nil, errors.New("invalid command signature")
+	}
+
+	var cmd uninstallCommand
+	if err := json.Unmarshal(payload, &cmd); err != nil {
+		return nil, errors.New("invalid command payload")
+	}
+	if cmd.Action != commandUninstall {
+		return nil, fmt.Errorf("unexpected command %q", cmd.Action)
+	}
+	if cmd.KeyID != signing.KeyID(currentKey()) {
+		return nil, errors.New("command was issued for another node")
+	}
+
+	now := time.Now()
+	if now.Add(commandClockSkew).Unix() < cmd.IssuedAt || now.Add(-commandClockSkew).Unix() > cmd.ExpiresAt {
+		return nil, errors.New("command expired")
+	}
+
+	usedCommandsMu.Lock()
+	defer usedCommandsMu.Unlock()
+	for nonce, expires := range usedCommands {
+		if now.Add(-commandClockSkew).Unix() > expires {
+			delete(usedCommands, nonce)
+		}
+	}
+	if _, used := usedCommands[cmd.Nonce]; used || cmd.Nonce == "" {
+		return nil, errors.New("command already used")
+	}
+	usedCommands[cmd.Nonce] = cmd.ExpiresAt
+
+	return &cmd, nil
+}
+
+// handleUninstall 只执行主控签名的限时卸载指令，节点密钥本身不足以卸载节点
+func handleUninstall(c *gin.Context) {
+	var signed signedCommand
+	if err := c.ShouldBindJSON(&signed); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Success: false, Message: "Invalid request"})
+		return
+	}
+
+	cmd, err := verifyUninstallCommand(signed)
+	if err != nil {
+		log.Printf("Rejected uninstall command from %s: %v", c.RemoteIP(), err)
+		c.JSON(http.StatusForbidden, APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	if !uninstalling.CompareAndSwap(false, true) {
+		c.JSON(http.StatusConflict, APIResponse{Success: false, Message: "Uninstall already in progress"})
+		return
+	}
+
+	log.Println("🛑 Received signed uninstall command from master panel")
+	c.JSON(http.StatusOK, APIResponse{Success: true, Message: "Uninstalling..."})
+
+	go runUninstall(cmd.Nonce)
+}
+
+// runUninstall 清理服务和安装目录，向主控回报结果后停止服务。
+// systemctl stop 会结束当前进程，因此放在最后
+func runUninstall(nonce string) {
+	time.Sleep(500 * time.Millisecond)
+
+	stopAllTunnels()
+
+	var failures []string
+	step := func(name string, err error) {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+
+	log.Println("🗑️ Disabling service and removing files...")
+	step("disable service", exec.Command("systemctl", "disable", serviceName).Run())
+	if err := os.Remove(serviceFile); err != nil && !os.IsNotExist(err) {
+		step("remove service file", err)
+	}
+	step("reload systemd", exec.Command("systemctl", "daemon-reload").Run())
+	step("remove install dir", os.RemoveAll(installDir))
+
+	report := uninstallReport{
+		Nonce:   nonce,
+		Success: len(failures) == 0,
+		Message: strings.Join(failures, "; "),
+	}
+	if err := sendUninstallReport(report); err != nil {
+		log.Printf("Failed to report uninstall result: %v", err)
+	}
+
+	if report.Success {
+		log.Println("✅ Uninstall completed, exiting...")
+	} else {
+		log.Printf("⚠️ Uninstall finished with errors: %s", report.Message)
+	}
+
+	exec.Command("systemctl", "stop", serviceName).Run()
+	os.Exit(0)
+}
+
+func sendUninstallReport(report uninstallReport) error {
+	if masterURL == "" {
+		return errors.New("no master URL configured")
+	}
+
+	data, _ := json.Marshal(report)
+	req, err := http.NewRequest("POST", masterURL+"/api/nodes/uninstall-report", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signRequest(req, currentKey(), data)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var result APIResponse
+		json.NewDecoder(resp.Body).Decode(&result)
+		return fmt.Errorf("master rejected report (%d): %s", resp.StatusCode, result.Message)
+	}
+	return nil
+}
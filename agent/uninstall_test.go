@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"port-forward-common/signing"
+)
+
+const testNodeKey = "node-key"
+
+// withCommandKeys 固定主控公钥和节点密钥，返回主控签名私钥
+func withCommandKeys(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	savedPub, savedKey, savedUsed := updatePubKey, currentKey(), usedCommands
+	updatePubKey = pub
+	keyMu.Lock()
+	nodeKey = testNodeKey
+	keyMu.Unlock()
+	usedCommands = make(map[string]int64)
+
+	t.Cleanup(func() {
+		updatePubKey, usedCommands = savedPub, savedUsed
+		keyMu.Lock()
+		nodeKey = savedKey
+		keyMu.Unlock()
+	})
+	return priv
+}
+
+func validUninstallCommand() uninstallCommand {
+	now := time.Now().Unix()
+	return uninstallCommand{
+		Action:    commandUninstall,
+		NodeID:    "n1",
+		KeyID:     signing.KeyID(testNodeKey),
+		Nonce:     "nonce-1",
+		IssuedAt:  now,
+		ExpiresAt: now + 60,
+	}
+}
+
+func signCommand(key ed25519.PrivateKey, purpose string, cmd uninstallCommand) signedCommand {
+	payload, _ := json.Marshal(cmd)
+	return signedCommand{
+		Payload:   base64.StdEncoding.EncodeToString(payload),
+		Signature: signing.Sign(key, purpose, payload),
+	}
+}
+
+func TestVerifyUninstallCommand(t *testing.T) {
+	priv := withCommandKeys(t)
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	tampered := signCommand(priv, signing.PurposeCommand, validUninstallCommand())
+	changed := validUninstallCommand()
+	changed.Nonce = "nonce-2"
+	changedPayload, _ := json.Marshal(changed)
+	tampered.Payload = base64.StdEncoding.EncodeToString(changedPayload)
+
+	tests := []struct {
+		name    string
+		modify  func(cmd *uninstallCommand)
+		signed  func(cmd uninstallCommand) signedCommand
+		wantErr string
+	}{
+		{"valid", nil, nil, ""},
+		{"replayed nonce", nil, nil, "command already used"},
+		{"empty nonce", func(cmd *uninstallCommand) { cmd.Nonce = "" }, nil, "command already used"},
+		{"expired", func(cmd *uninstallCommand) {
+			cmd.Nonce = "expired"
+			cmd.IssuedAt -= 600
+			cmd.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+		}, nil, "command expired"},
+		{"issued in the future", func(cmd *uninstallCommand) {
+			cmd.Nonce = "future"
+			cmd.IssuedAt = time.Now().Add(time.Hour).Unix()
+			cmd.ExpiresAt = cmd.IssuedAt + 60
+		}, nil, "command expired"},
+		{"other node", func(cmd *uninstallCommand) {
+			cmd.Nonce = "other-node"
+			cmd.KeyID = signing.KeyID("another-key")
+		}, nil, "issued for another node"},
+		{"unexpected action", func(cmd *uninstallCommand) {
+			cmd.Nonce = "action"
+			cmd.Action = "update"
+		}, nil, "unexpected command"},
+		{"tampered payload", nil, func(uninstallCommand) signedCommand { return tampered }, "invalid command signature"},
+		{"wrong signer", func(cmd *uninstallCommand) { cmd.Nonce = "signer" }, func(cmd uninstallCommand) signedCommand {
+			return signCommand(otherPriv, signing.PurposeCommand, cmd)
+		}, "invalid command signature"},
+		{"update signature", func(cmd *uninstallCommand) { cmd.Nonce = "purpose" }, func(cmd uninstallCommand) signedCommand {
+			return signCommand(priv, signing.PurposeUpdate, cmd)
+		}, "invalid command signature"},
+		{"bad payload", nil, func(uninstallCommand) signedCommand {
+			return signedCommand{Payload: "%%%", Signature: tampered.Signature}
+		}, "invalid command payload"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := validUninstallCommand()
+			if tt.modify != nil {
+				tt.modify(&cmd)
+			}
+			signed := signCommand(priv, signing.PurposeCommand, cmd)
+			if tt.signed != nil {
+				signed = tt.signed(cmd)
+			}
+
+			got, err := verifyUninstallCommand(signed)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got.Nonce != cmd.Nonce {
+					t.Errorf("nonce = %q, want %q", got.Nonce, cmd.Nonce)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyUninstallCommandWithoutPinnedKey(t *testing.T) {
+	priv := withCommandKeys(t)
+	updatePubKey = nil
+
+	_, err := verifyUninstallCommand(signCommand(priv, signing.PurposeCommand, validUninstallCommand()))
+	if err == nil || !strings.Contains(err.Error(), "no master public key") {
+		t.Errorf("error = %v, want a missing key error", err)
+	}
+}
+
+// 有效指令会真正卸载本机，这里只验证被拒绝的指令不会进入卸载流程
+func TestHandleUninstallRejects(t *testing.T) {
+	priv := withCommandKeys(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/uninstall", handleUninstall)
+
+	post := func(body interface{}) int {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/uninstall", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	expired := validUninstallCommand()
+	expired.ExpiresAt = time.Now().Add(-time.Hour).Unix()
+	if code := post(signCommand(priv, signing.PurposeCommand, expired)); code != http.StatusForbidden {
+		t.Errorf("expired command status = %d, want 403", code)
+	}
+
+	tampered := signCommand(priv, signing.PurposeCommand, validUninstallCommand())
+	tampered.Signature = signing.Sign(priv, signing.PurposeCommand, []byte("other"))
+	if code := post(tampered); code != http.StatusForbidden {
+		t.Errorf("tampered command status = %d, want 403", code)
+	}
+	if uninstalling.Load() {
+		t.Fatal("rejected command started the uninstall")
+	}
+
+	// 已在卸载中时，有效指令也不会再次启动卸载
+	uninstalling.Store(true)
+	defer uninstalling.Store(false)
+	if code := post(signCommand(priv, signing.PurposeCommand, validUninstallCommand())); code != http.StatusConflict {
+		t.Errorf("concurrent command status = %d, want 409", code)
+	}
+}
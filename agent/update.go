@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"port-forward-common/signing"
+)
+
+// version 在构建时通过 -ldflags "-X main.version=..." 注入
+var version = "dev"
+
+const (
+	updateMarkerFile  = "update.json"
+	updatePubKeyFile  = "update.pub"
+	updateTrialWindow = 2 * time.Minute
+	maxUpdateSize     = 200 << 20
+)
+
+// 自更新状态，与主控 models.Update* 保持一致
+const (
+	updateTrial      = "trial"
+	updateCompleted  = "completed"
+	updateRolledBack = "rolled_back"
+	updateFailed     = "failed"
+)
+
+// updateMarker 持久化在数据目录中，新版本启动后据此决定转正还是回滚
+type updateMarker struct {
+	State           string `json:"state"`
+	Version         string `json:"version"`
+	PreviousVersion string `json:"previous_version"`
+	StablePath      string `json:"stable_path,omitempty"`
+	NewPath         string `json:"new_path,omitempty"`
+	Deadline        int64  `json:"deadline,omitempty"`
+	Message         string `json:"message,omitempty"`
+	UpdatedAt       int64  `json:"updated_at"`
+}
+
+type UpdateStatus struct {
+	State     string `json:"state"`
+	Version   string `json:"version"`
+	Message   string `json:"message,omitempty"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+var (
+	updatePubKey    ed25519.PublicKey
+	updatePubKeyArg string
+	updating        atomic.Bool
+	lastUpdate      *updateMarker
+	lastUpdateMu    sync.Mutex
+	// lastHeartbeatOK 是最近一次被主控接受的心跳时间（UnixNano）
+	lastHeartbeatOK atomic.Int64
+)
+
+// initUpdater 加载更新签名公钥：优先使用 -update-pubkey，其次是安装脚本固定的公钥文件。
+// 公钥不从主控在线获取，都没有时自更新和签名指令不可用
+func initUpdater() {
+	keyPath := filepath.Join(dataDir, updatePubKeyFile)
+
+	encoded := updatePubKeyArg
+	if encoded == "" {
+		if data, err := os.ReadFile(keyPath); err == nil {
+			encoded = strings.TrimSpace(string(data))
+		}
+	}
+	if encoded == "" {
+		log.Printf("No update public key, self-update and signed commands disabled")
+	} else {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			log.Printf("Invalid update public key, self-update disabled")
+		} else {
+			updatePubKey = key
+		}
+	}
+
+	resumeUpdate()
+}
+
+// verifySignature 用固定的主控公钥校验某一用途的签名
+func verifySignature(purpose string, data []byte, signature string) bool {
+	return updatePubKey != nil && signing.Verify(updatePubKey, purpose, data, signature)
+}
+
+// verifyUpdate 校验更新清单是为本机平台签发的，且不会降级到更旧的版本
+func verifyUpdate(newVersion, checksum, signature string) error {
+	if !verifySignature(signing.PurposeUpdate, signing.UpdateManifest(newVersion, runtime.GOOS, runtime.GOARCH, checksum), signature) {
+		return fmt.Errorf("signature verification failed")
+	}
+	// 无法比较时拒绝更新，否则被截获的旧签名可以把 Agent 降级或重放到任意版本。
+	// 构建时用 agent/version.sh 生成版本号
+	current, ok := parseVersion(version)
+	if !ok {
+		return fmt.Errorf("cannot compare running version %s with %s, reinstall the agent from a versioned build", version, newVersion)
+	}
+	next, ok := parseVersion(newVersion)
+	if !ok {
+		return fmt.Errorf("cannot compare version %q with running version %s", newVersion, version)
+	}
+	if compareVersions(next, current) < 0 {
+		return fmt.Errorf("refusing to downgrade from %s to %s", version, newVersion)
+	}
+	return nil
+}
+
+// parseVersion 解析 git describe 形式的版本号，如 v1.2.3 或 v1.2.3-4-gabcdef，
+// 提交数作为第四段参与比较
+func parseVersion(v string) ([]int, bool) {
+	v = strings.TrimPrefix(v, "v")
+	base, rest, _ := strings.Cut(v, "-")
+	parts := strings.Split(base, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return nil, false
+	}
+	nums := make([]int, 4)
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		nums[i] = n
+	}
+	if rest != "" {
+		count, hash, ok := strings.Cut(rest, "-")
+		n, err := strconv.Atoi(count)
+		if !ok || err != nil || n < 0 || !strings.HasPrefix(hash, "g") {
+			return nil, false
+		}
+		nums[3] = n
+	}
+	return nums, true
+}
+
+func compareVersions(a, b []int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func markerPath() string {
+	return filepath.Join(dataDir, updateMarkerFile)
+}
+
+func saveMarker(m *updateMarker) {
+	m.UpdatedAt = time.Now().Unix()
+
+	lastUpdateMu.Lock()
+	lastUpdate = m
+	lastUpdateMu.Unlock()
+
+	if err := writeFileAtomic(markerPath(), m); err != nil {
+		log.Printf("Failed to save update marker: %v", err)
+	}
+}
+
+func getUpdateStatus() *UpdateStatus {
+	lastUpdateMu.Lock()
+	defer lastUpdateMu.Unlock()
+
+	if lastUpdate == nil {
+		return nil
+	}
+	return &UpdateStatus{
+		State:     lastUpdate.State,
+		Version:   lastUpdate.Version,
+		Message:   lastUpdate.Message,
+		UpdatedAt: lastUpdate.UpdatedAt,
+	}
+}
+
+func currentExecutable() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		return resolved
+	}
+	return exe
+}
+
+// resumeUpdate 启动时检查未完成的更新
+func resumeUpdate() {
+	data, err := os.ReadFile(markerPath())
+	if err != nil {
+		return
+	}
+	var m updateMarker
+	if err := json.Unmarshal(data, &m); err != nil {
+		return
+	}
+
+	lastUpdateMu.Lock()
+	lastUpdate = &m
+	lastUpdateMu.Unlock()
+
+	if m.State != updateTrial {
+		return
+	}
+
+	if currentExecutable() == m.NewPath {
+		log.Printf("🧪 Running updated agent %s, waiting for heartbeat confirmation", version)
+		go awaitUpdateConfirmation(&m)
+		return
+	}
+
+	// 运行的是旧版本：说明新版本在确认前就退出了，由 systemd 拉起了旧版本
+	os.Remove(m.NewPath)
+	m.State = updateRolledBack
+	m.Message = "new version exited before confirming a heartbeat"
+	saveMarker(&m)
+	log.Printf("↩️ Update to %s rolled back: %s", m.Version, m.Message)
+}
+
+// awaitUpdateConfirmation 在窗口期内等待一次成功心跳，成功则转正，否则回滚到旧版本
+func awaitUpdateConfirmation(m *updateMarker) {
+	started := time.Now().UnixNano()
+	deadline := time.Unix(m.Deadline, 0)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if lastHeartbeatOK.Load() > started {
+			if err := os.Rename(m.NewPath, m.StablePath); err != nil {
+				m.State = updateFailed
+				m.Message = fmt.Sprintf("failed to promote new binary: %v", err)
+				saveMarker(m)
+				return
+			}
+			m.State = updateCompleted
+			m.Message = ""
+			saveMarker(m)
+			log.Printf("✅ Update to %s confirmed", m.Version)
+			return
+		}
+
+		if time.Now().After(deadline) {
+			m.State = updateRolledBack
+			m.Message = "no successful heartbeat within the confirmation window"
+			saveMarker(m)
+			os.Remove(m.NewPath)
+			log.Printf("↩️ Update to %s rolled back: %s", m.Version, m.Message)
+			restartInto(m.StablePath)
+			return
+		}
+	}
+}
+
+func handleUpdate(c *gin.Context) {
+	var req struct {
+		Version   string `json:"version"`
+		URL       string `json:"url"`
+		SHA256    string `json:"sha256"`
+		Signature string `json:"signature"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.URL == "" || req.SHA256 == "" || req.Signature == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Success: false, Message: "Invalid request"})
+		return
+	}
+	if updatePubKey == nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Success: false, Message: "Self-update disabled: no update public key"})
+		return
+	}
+	if masterURL == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{Success: false, Message: "Self-update requires -master for heartbeat confirmation"})
+		return
+	}
+	if err := verifyUpdate(req.Version, req.SHA256, req.Signature); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	if !updating.CompareAndSwap(false, true) {
+		c.JSON(http.StatusConflict, APIResponse{Success: false, Message: "Update already in progress"})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{Success: true, Message: "Update started"})
+
+	go func() {
+		defer updating.Store(false)
+		if err := performUpdate(req.Version, req.URL, req.SHA256); err != nil {
+			log.Printf("❌ Update to %s failed: %v", req.Version, err)
+			saveMarker(&updateMarker{
+				State:           updateFailed,
+				Version:         req.Version,
+				PreviousVersion: version,
+				Message:         err.Error(),
+			})
+		}
+	}()
+}
+
+// performUpdate 下载并替换二进制，checksum 已由 verifyUpdate 随清单校验过签名
+func performUpdate(newVersion, url, checksum string) error {
+	if strings.HasPrefix(url, "/") {
+		url = masterURL + url
+	}
+
+	log.Printf("⬇️ Downloading agent %s", newVersion)
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("download failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxUpdateSize+1))
+	if err != nil {
+		return fmt.Errorf("download failed: %v", err)
+	}
+	if len(data) > maxUpdateSize {
+		return fmt.Errorf("binary exceeds %d bytes", maxUpdateSize)
+	}
+
+	sum := sha256.Sum256(data)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), checksum) {
+		return fmt.Errorf("checksum mismatch")
+	}
+
+	stablePath := currentExecutable()
+	if stablePath == "" {
+		return fmt.Errorf("cannot locate current executable")
+	}
+	newPath := stablePath + ".new"
+
+	tmpPath := newPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, newPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// 替换前先确认新二进制能在本机运行
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	out, err := exec.CommandContext(ctx, newPath, "-version").Output()
+	cancel()
+	if err != nil {
+		os.Remove(newPath)
+		return fmt.Errorf("new binary failed to run: %v", err)
+	}
+	log.Printf("🔍 New binary reports version %s", bytes.TrimSpace(out))
+
+	saveMarker(&updateMarker{
+		State:           updateTrial,
+		Version:         newVersion,
+		PreviousVersion: version,
+		StablePath:      stablePath,
+		NewPath:         newPath,
+		Deadline:        time.Now().Add(updateTrialWindow).Unix(),
+	})
+
+	log.Printf("🔁 Restarting into agent %s", newVersion)
+	restartInto(newPath)
+	return fmt.Errorf("failed to start new binary")
+}
+
+// restartInto 用指定二进制替换当前进程，监听的端口会随 exec 一起关闭
+func restartInto(path string) {
+	args := append([]string{path}, os.Args[1:]...)
+	if err := syscall.Exec(path, args, os.Environ()); err != nil {
+		log.Printf("Failed to exec %s: %v", path, err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"runtime"
+	"strings"
+	"testing"
+
+	"port-forward-common/signing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   []int
+		wantOK bool
+	}{
+		{"v1.2.3", []int{1, 2, 3, 0}, true},
+		{"1.2", []int{1, 2, 0, 0}, true},
+		{"v1.2.3-4-gabcdef0", []int{1, 2, 3, 4}, true},
+		{"v0.0.0-57-g1a2b3c4", []int{0, 0, 0, 57}, true},
+		{"dev", nil, false},
+		{"1a2b3c4", nil, false},
+		{"v1.2.3-rc1", nil, false},
+		{"v1.2.3.4", nil, false},
+		{"v1.-2.3", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok := parseVersion(tt.in)
+			if ok != tt.wantOK {
+				t.Fatalf("parseVersion(%q) ok = %v, want %v", tt.in, ok, tt.wantOK)
+			}
+			if ok && compareVersions(got, tt.want) != 0 {
+				t.Fatalf("parseVersion(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyUpdate(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	const checksum = "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7"
+
+	sign := signing.Sign
+	manifest := signing.UpdateManifest
+
+	tests := []struct {
+		name       string
+		running    string
+		newVersion string
+		checksum   string
+		signature  string
+		wantErr    string
+	}{
+		{"upgrade", "v1.2.0", "v1.3.0", checksum,
+			sign(priv, signing.PurposeUpdate, manifest("v1.3.0", runtime.GOOS, runtime.GOARCH, checksum)), ""},
+		{"same version", "v1.2.0", "v1.2.0", checksum,
+			sign(priv, signing.PurposeUpdate, manifest("v1.2.0", runtime.GOOS, runtime.GOARCH, checksum)), ""},
+		{"upper case checksum", "v1.2.0", "v1.3.0", strings.ToUpper(checksum),
+			sign(priv, signing.PurposeUpdate, manifest("v1.3.0", runtime.GOOS, runtime.GOARCH, checksum)), ""},
+		{"commits since tag", "v1.2.0-3-gaaaaaaa", "v1.2.0-5-gbbbbbbb", checksum,
+			sign(priv, signing.PurposeUpdate, manifest("v1.2.0-5-gbbbbbbb", runtime.GOOS, runtime.GOARCH, checksum)), ""},
+		{"downgrade", "v1.2.0", "v1.1.9", checksum,
+			sign(priv, signing.PurposeUpdate, manifest("v1.1.9", runtime.GOOS, runtime.GOARCH, checksum)), "downgrade"},
+		{"dev build", "dev", "v0.1.0", checksum,
+			sign(priv, signing.PurposeUpdate, manifest("v0.1.0", runtime.GOOS, runtime.GOARCH, checksum)), "cannot compare running version"},
+		{"dirty build", "v1.2.0-dirty", "v1.3.0", checksum,
+			sign(priv, signing.PurposeUpdate, manifest("v1.3.0", runtime.GOOS, runtime.GOARCH, checksum)), "cannot compare running version"},
+		{"untagged builds", "v0.0.0-41-g1a2b3c4", "v0.0.0-57-gdeadbee", checksum,
+			sign(priv, signing.PurposeUpdate, manifest("v0.0.0-57-gdeadbee", runtime.GOOS, runtime.GOARCH, checksum)), ""},
+		{"unorderable new version", "v1.2.0", "abcdef0", checksum,
+			sign(priv, signing.PurposeUpdate, manifest("abcdef0", runtime.GOOS, runtime.GOARCH, checksum)), "cannot compare"},
+		{"version swapped", "v1.2.0", "v1.3.0", checksum,
+			sign(priv, signing.PurposeUpdate, manifest("v1.1.0", runtime.GOOS, runtime.GOARCH, checksum)), "signature"},
+		{"other platform", "v1.2.0", "v1.3.0", checksum,
+			sign(priv, signing.PurposeUpdate, manifest("v1.3.0", runtime.GOOS, "other", checksum)), "signature"},
+		{"other checksum", "v1.2.0", "v1.3.0", checksum,
+			sign(priv, signing.PurposeUpdate, manifest("v1.3.0", runtime.GOOS, runtime.GOARCH, strings.Repeat("0", 64))), "signature"},
+		{"command signature", "v1.2.0", "v1.3.0", checksum,
+			sign(priv, signing.PurposeCommand, manifest("v1.3.0", runtime.GOOS, runtime.GOARCH, checksum)), "signature"},
+		{"other key", "v1.2.0", "v1.3.0", checksum,
+			sign(otherPriv, signing.PurposeUpdate, manifest("v1.3.0", runtime.GOOS, runtime.GOARCH, checksum)), "signature"},
+		{"malformed signature", "v1.2.0", "v1.3.0", checksum, "!!", "signature"},
+	}
+
+	savedKey, savedVersion := updatePubKey, version
+	defer func() { updatePubKey, version = savedKey, savedVersion }()
+	updatePubKey = pub
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version = tt.running
+			err := verifyUpdate(tt.newVersion, tt.checksum, tt.signature)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("verifyUpdate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("verifyUpdate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyUpdateWithoutKey(t *testing.T) {
+	saved := updatePubKey
+	defer func() { updatePubKey = saved }()
+	updatePubKey = nil
+
+	if err := verifyUpdate("v1.0.0", "00", "AAAA"); err == nil {
+		t.Fatal("verifyUpdate() succeeded without a pinned public key")
+	}
+}
@@ -0,0 +1,6 @@
+#!/bin/sh
+# 输出 Agent 的版本号，Agent 自更新时据此拒绝降级，格式需能被 parseVersion 解析：
+# 最近的 vX.Y.Z tag，其后有提交时为 vX.Y.Z-N-gHASH；没有 tag 时为 v0.0.0-<提交数>-g<短哈希>。
+# 不带 -dirty 后缀，未提交的改动不影响版本号
+git describe --tags --match 'v[0-9]*' 2>/dev/null || \
+    echo "v0.0.0-$(git rev-list --count HEAD 2>/dev/null || echo 0)-g$(git rev-parse --short HEAD 2>/dev/null || echo unknown)"
@@ -8,6 +8,7 @@ require (
 	github.com/google/uuid v1.5.0
 	github.com/gorilla/websocket v1.5.1
 	github.com/shirou/gopsutil/v3 v3.23.12
+	port-forward-common v0.0.0
 )
 
 require (
@@ -43,3 +44,6 @@ require (
 	google.golang.org/protobuf v1.30.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+// 主控和 Agent 共用的代码
+replace port-forward-common => ../common
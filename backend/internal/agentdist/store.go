@@ -0,0 +1,179 @@
+package agentdist
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"port-forward-common/signing"
+	"port-forward-dashboard/internal/models"
+)
+
+// BinaryPrefix 是发布目录中 Agent 二进制的文件名前缀，完整文件名为 <prefix>-<os>-<arch>
+const BinaryPrefix = "port-forward-agent"
+
+// versionFile 记录发布目录中二进制对应的版本号
+const versionFile = "VERSION"
+
+var platformPattern = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// Store 管理主控旁边的 Agent 发布目录，为每个平台的二进制计算校验和并签名
+type Store struct {
+	dir        string
+	privateKey ed25519.PrivateKey
+	cache      map[string]*cachedArtifact
+	mu         sync.Mutex
+}
+
+type cachedArtifact struct {
+	artifact models.AgentArtifact
+	modTime  time.Time
+	size     int64
+}
+
+// NewStore 创建发布仓库。签名密钥种子保存在 keyPath（权限 0600），文件不存在时使用旧配置中的
+// legacySeed（base64）迁移，两者都没有时生成新密钥
+func NewStore(dir, keyPath, legacySeed string) (*Store, error) {
+	key, err := loadSigningKey(keyPath, legacySeed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		dir:        dir,
+		privateKey: key,
+		cache:      make(map[string]*cachedArtifact),
+	}, nil
+}
+
+func loadSigningKey(path, legacySeed string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return decodeSeed(strings.TrimSpace(string(data)))
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read agent signing key: %v", err)
+	}
+
+	var key ed25519.PrivateKey
+	if legacySeed != "" {
+		if key, err = decodeSeed(legacySeed); err != nil {
+			return nil, err
+		}
+	} else if _, key, err = ed25519.GenerateKey(rand.Reader); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(key.Seed())
+	if err := os.WriteFile(path, []byte(encoded+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to save agent signing key: %v", err)
+	}
+	return key, nil
+}
+
+func decodeSeed(encoded string) (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid agent signing key")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// PublicKey 返回 base64 编码的签名公钥，Agent 用它校验更新包
+func (s *Store) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.privateKey.Public().(ed25519.PublicKey))
+}
+
+// Sign 用发布密钥按用途（signing.Purpose*）签名，返回 base64 编码的签名
+func (s *Store) Sign(purpose string, data []byte) string {
+	return signing.Sign(s.privateKey, purpose, data)
+}
+
+// Version 返回发布目录中 Agent 的版本号
+func (s *Store) Version() string {
+	data, err := os.ReadFile(filepath.Join(s.dir, versionFile))
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// BinaryPath 返回指定平台二进制的路径，平台名不合法时返回错误
+func (s *Store) BinaryPath(goos, goarch string) (string, error) {
+	if !platformPattern.MatchString(goos) || !platformPattern.MatchString(goarch) {
+		return "", fmt.Errorf("invalid platform %s/%s", goos, goarch)
+	}
+	return filepath.Join(s.dir, fmt.Sprintf("%s-%s-%s", BinaryPrefix, goos, goarch)), nil
+}
+
+// Artifact 返回指定平台二进制的元数据，文件变化后自动重新计算校验和与签名
+func (s *Store) Artifact(goos, goarch string) (*models.AgentArtifact, error) {
+	path, err := s.BinaryPath(goos, goarch)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("no agent binary for %s/%s", goos, goarch)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := goos + "/" + goarch
+	if c, ok := s.cache[key]; ok && c.modTime.Equal(stat.ModTime()) && c.size == stat.Size() {
+		a := c.artifact
+		return &a, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	version := s.Version()
+	checksum := hex.EncodeToString(sum[:])
+
+	artifact := models.AgentArtifact{
+		OS:        goos,
+		Arch:      goarch,
+		Version:   version,
+		Size:      stat.Size(),
+		SHA256:    checksum,
+		Signature: s.Sign(signing.PurposeUpdate, signing.UpdateManifest(version, goos, goarch, checksum)),
+	}
+	s.cache[key] = &cachedArtifact{artifact: artifact, modTime: stat.ModTime(), size: stat.Size()}
+	return &artifact, nil
+}
+
+// List 返回发布目录中所有平台的二进制
+func (s *Store) List() []models.AgentArtifact {
+	matches, _ := filepath.Glob(filepath.Join(s.dir, BinaryPrefix+"-*-*"))
+	sort.Strings(matches)
+
+	result := make([]models.AgentArtifact, 0, len(matches))
+	for _, path := range matches {
+		parts := strings.Split(strings.TrimPrefix(filepath.Base(path), BinaryPrefix+"-"), "-")
+		if len(parts) != 2 {
+			continue
+		}
+		if a, err := s.Artifact(parts[0], parts[1]); err == nil {
+			result = append(result, *a)
+		}
+	}
+	return result
+}
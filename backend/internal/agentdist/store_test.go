@@ -0,0 +1,134 @@
+package agentdist
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"port-forward-common/signing"
+)
+
+func TestNewStoreKeyFile(t *testing.T) {
+	_, legacy, _ := ed25519.GenerateKey(rand.Reader)
+	legacySeed := base64.StdEncoding.EncodeToString(legacy.Seed())
+
+	tests := []struct {
+		name       string
+		legacySeed string
+		wantKey    ed25519.PrivateKey
+	}{
+		{"generated", "", nil},
+		{"migrated from config", legacySeed, legacy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data", "agent-signing.key")
+			s, err := NewStore(t.TempDir(), path, tt.legacySeed)
+			if err != nil {
+				t.Fatalf("NewStore() error = %v", err)
+			}
+			if tt.wantKey != nil && !s.privateKey.Equal(tt.wantKey) {
+				t.Fatal("legacy seed was not used")
+			}
+
+			stat, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("key file not written: %v", err)
+			}
+			if mode := stat.Mode().Perm(); mode != 0600 {
+				t.Fatalf("key file mode = %o, want 600", mode)
+			}
+
+			// 重新打开时以密钥文件为准，忽略旧配置
+			reopened, err := NewStore(t.TempDir(), path, "")
+			if err != nil {
+				t.Fatalf("reopen error = %v", err)
+			}
+			if reopened.PublicKey() != s.PublicKey() {
+				t.Fatal("reopened store uses a different key")
+			}
+		})
+	}
+}
+
+func TestNewStoreInvalidKey(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent-signing.key")
+	if err := os.WriteFile(path, []byte("not-a-seed\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewStore(dir, path, ""); err == nil {
+		t.Fatal("NewStore() accepted a corrupt key file")
+	}
+	if _, err := NewStore(dir, filepath.Join(dir, "other.key"), "bad"); err == nil {
+		t.Fatal("NewStore() accepted a corrupt legacy seed")
+	}
+}
+
+func TestSignPurposes(t *testing.T) {
+	s, err := NewStore(t.TempDir(), filepath.Join(t.TempDir(), "k"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _ := base64.StdEncoding.DecodeString(s.PublicKey())
+	data := []byte(`{"action":"uninstall"}`)
+	sig := s.Sign(signing.PurposeCommand, data)
+
+	tests := []struct {
+		name    string
+		purpose string
+		want    bool
+	}{
+		{"same purpose", signing.PurposeCommand, true},
+		{"other purpose", signing.PurposeUpdate, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signing.Verify(pub, tt.purpose, data, sig); got != tt.want {
+				t.Fatalf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	// 签名覆盖用途前缀，原始数据本身无法通过校验
+	raw, _ := base64.StdEncoding.DecodeString(sig)
+	if ed25519.Verify(pub, data, raw) {
+		t.Fatal("signature verifies without the purpose prefix")
+	}
+}
+
+func TestArtifactSignsManifest(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore(dir, filepath.Join(t.TempDir(), "k"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, versionFile), []byte("v1.2.0\n"), 0644)
+	os.WriteFile(filepath.Join(dir, BinaryPrefix+"-linux-amd64"), []byte("binary"), 0755)
+
+	a, err := s.Artifact("linux", "amd64")
+	if err != nil {
+		t.Fatalf("Artifact() error = %v", err)
+	}
+	pub, _ := base64.StdEncoding.DecodeString(s.PublicKey())
+
+	tests := []struct {
+		name     string
+		manifest []byte
+		want     bool
+	}{
+		{"matching manifest", signing.UpdateManifest("v1.2.0", "linux", "amd64", a.SHA256), true},
+		{"other version", signing.UpdateManifest("v1.1.0", "linux", "amd64", a.SHA256), false},
+		{"other arch", signing.UpdateManifest("v1.2.0", "linux", "arm64", a.SHA256), false},
+		{"other checksum", signing.UpdateManifest("v1.2.0", "linux", "amd64", "00"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signing.Verify(pub, signing.PurposeUpdate, tt.manifest, a.Signature); got != tt.want {
+				t.Fatalf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,658 @@
+package alert
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"port-forward-dashboard/internal/models"
+)
+
+const (
+	// evalInterval 告警条件的评估间隔
+	evalInterval = 10 * time.Second
+	// maxHistory 内存中保留的已恢复告警数量
+	maxHistory = 500
+
+	// spikeWindow 流量基线（指数滑动平均）的时间常数
+	spikeWindow = time.Hour
+	// spikeWarmup 基线至少积累这么久才参与 traffic_spike 判断
+	spikeWarmup = 10 * time.Minute
+	// spikeMinRate 低于该速率（字节/秒）的流量不视为突增，避免空闲规则的少量流量触发告警
+	spikeMinRate = 64 * 1024
+)
+
+// Snapshot 是一次评估使用的节点和规则状态
+type Snapshot struct {
+	Nodes      []models.NodeWithStatus
+	NodeRules  []models.NodeRule
+	LocalRules []models.TunnelStatus
+}
+
+// Engine 定期评估告警规则，在条件持续满足后触发通知，条件消失后发送恢复通知。
+// 同一规则对同一对象只保留一个活动告警，触发后不重复通知
+type Engine struct {
+	mu       sync.Mutex
+	rules    []models.AlertRule
+	channels []models.AlertChannel
+	silences []models.AlertSilence
+
+	// pending 记录条件首次满足的时间，active 是已触发的告警，均以 规则ID/对象ID 为键
+	pending map[string]time.Time
+	active  map[string]*models.Alert
+	history []models.Alert
+
+	// baselines 是各规则的流量基线，以规则ID为键
+	baselines map[string]*trafficBaseline
+}
+
+// trafficBaseline 是规则双向速率的指数滑动平均
+type trafficBaseline struct {
+	rate    float64
+	since   time.Time
+	updated time.Time
+}
+
+// ready 判断基线是否已积累足够的样本
+func (b *trafficBaseline) ready(now time.Time) bool {
+	return b != nil && now.Sub(b.since) >= spikeWarmup
+}
+
+func (b *trafficBaseline) observe(rate float64, now time.Time) {
+	alpha := 1 - math.Exp(-now.Sub(b.updated).Seconds()/spikeWindow.Seconds())
+	b.rate += alpha * (rate - b.rate)
+	b.updated = now
+}
+
+func NewEngine(rules []models.AlertRule, channels []models.AlertChannel, silences []models.AlertSilence) *Engine {
+	return &Engine{
+		rules:    append([]models.AlertRule(nil), rules...),
+		channels: append([]models.AlertChannel(nil), channels...),
+		silences: append([]models.AlertSilence(nil), silences...),
+		pending:  make(map[string]time.Time),
+		active:   make(map[string]*models.Alert),
+
+		baselines: make(map[string]*trafficBaseline),
+	}
+}
+
+// Run 按固定间隔评估，snapshot 提供当前的节点和规则状态
+func (e *Engine) Run(snapshot func() Snapshot) {
+	ticker := time.NewTicker(evalInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		e.Evaluate(snapshot(), now)
+	}
+}
+
+// notification 是一条待发送的通知，渠道在加锁时复制，发送时不再访问引擎状态
+type notification struct {
+	alert    models.Alert
+	channels []models.AlertChannel
+}
+
+// Evaluate 用一次状态快照更新告警，并异步发送通知
+func (e *Engine) Evaluate(snap Snapshot, now time.Time) {
+	e.mu.Lock()
+
+	var notes []notification
+	seen := make(map[string]bool)
+	for _, rule := range e.rules {
+		if !rule.Enabled {
+			continue
+		}
+		for _, obs := range check(rule, snap, e.baselines, now) {
+			key := rule.ID + "/" + obs.subject
+			seen[key] = true
+
+			if a, ok := e.active[key]; ok {
+				a.Value = obs.value
+				a.Message = obs.message
+				// 静默结束时告警仍在持续，补发触发通知
+				if !a.Notified && !e.silenced(rule.ID, obs, now) {
+					a.Notified, a.Silenced = true, false
+					notes = append(notes, e.notification(rule, *a))
+				}
+				continue
+			}
+
+			since, ok := e.pending[key]
+			if !ok {
+				since = now
+				if !obs.since.IsZero() && obs.since.Before(now) {
+					since = obs.since
+				}
+				e.pending[key] = since
+			}
+			if now.Sub(since) < time.Duration(rule.Duration)*time.Second {
+				continue
+			}
+			delete(e.pending, key)
+
+			a := &models.Alert{
+				ID:          uuid.New().String()[:8],
+				RuleID:      rule.ID,
+				RuleName:    rule.Name,
+				Type:        rule.Type,
+				Subject:     obs.subject,
+				SubjectName: obs.subjectName,
+				NodeID:      obs.nodeID,
+				State:       models.AlertFiring,
+				Value:       obs.value,
+				Threshold:   rule.Threshold,
+				Message:     obs.message,
+				StartsAt:    since.Unix(),
+			}
+			a.Silenced = e.silenced(rule.ID, obs, now)
+			a.Notified = !a.Silenced
+			e.active[key] = a
+			log.Printf("🔔 Alert firing: %s (%s)", a.Message, rule.Name)
+			if a.Notified {
+				notes = append(notes, e.notification(rule, *a))
+			}
+		}
+	}
+
+	for key := range e.pending {
+		if !seen[key] {
+			delete(e.pending, key)
+		}
+	}
+	e.updateBaselines(snap, now)
+
+	// 条件不再满足（或规则被停用、删除）的告警恢复
+	for key, a := range e.active {
+		if seen[key] {
+			continue
+		}
+		delete(e.active, key)
+		a.State = models.AlertResolved
+		a.ResolvedAt = now.Unix()
+		e.history = append(e.history, *a)
+		if len(e.history) > maxHistory {
+			e.history = e.history[len(e.history)-maxHistory:]
+		}
+		log.Printf("✅ Alert resolved: %s (%s)", a.Message, a.RuleName)
+
+		if !a.Notified {
+			continue
+		}
+		if rule, ok := e.findRule(a.RuleID); ok {
+			notes = append(notes, e.notification(rule, *a))
+		}
+	}
+
+	e.mu.Unlock()
+
+	for _, n := range notes {
+		go dispatch(n)
+	}
+}
+
+// updateBaselines 用本次速率更新流量基线，在判断之后更新以便与之前的基线比较。
+// 未运行的规则不更新，重新出现时基线重新积累
+func (e *Engine) updateBaselines(snap Snapshot, now time.Time) {
+	seen := make(map[string]bool)
+	for _, r := range ruleViews(snap) {
+		if !r.enabled || !r.reported || !r.running {
+			continue
+		}
+		seen[r.id] = true
+		if b, ok := e.baselines[r.id]; ok {
+			b.observe(r.rate, now)
+		} else {
+			e.baselines[r.id] = &trafficBaseline{rate: r.rate, since: now, updated: now}
+		}
+	}
+	for id := range e.baselines {
+		if !seen[id] {
+			delete(e.baselines, id)
+		}
+	}
+}
+
+func (e *Engine) notification(rule models.AlertRule, a models.Alert) notification {
+	n := notification{alert: a}
+	for _, id := range rule.Channels {
+		if ch, ok := e.findChannel(id); ok && ch.Enabled {
+			n.channels = append(n.channels, ch)
+		}
+	}
+	return n
+}
+
+func dispatch(n notification) {
+	for _, ch := range n.channels {
+		if err := Send(ch, n.alert); err != nil {
+			log.Printf("Failed to send alert to channel %s (%s): %v", ch.Name, ch.Type, err)
+		}
+	}
+}
+
+// silenced 判断告警是否处于静默窗口，调用方需持有锁
+func (e *Engine) silenced(ruleID string, obs observation, now time.Time) bool {
+	ts := now.Unix()
+	for _, s := range e.silences {
+		if ts < s.StartAt || ts >= s.EndAt {
+			continue
+		}
+		if s.RuleID != "" && s.RuleID != ruleID {
+			continue
+		}
+		if s.Target != "" && s.Target != obs.subject && s.Target != obs.nodeID {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// observation 是一个满足告警条件的对象
+type observation struct {
+	subject     string
+	subjectName string
+	nodeID      string
+	value       float64
+	message     string
+	// since 是条件实际开始的时间（如节点最后在线时间），为零时以首次观察到的时间为准
+	since time.Time
+}
+
+// ruleView 把本地规则和节点规则统一为评估所需的字段
+type ruleView struct {
+	id, name, nodeID string
+	enabled          bool
+	// reported 为 false 表示规则所在节点离线，此时不评估规则类条件
+	reported bool
+	running  bool
+	latency  int64
+	rate     float64
+}
+
+func ruleViews(snap Snapshot) []ruleView {
+	var views []ruleView
+	for _, st := range snap.LocalRules {
+		views = append(views, ruleView{
+			id:       st.Rule.ID,
+			name:     st.Rule.Name,
+			enabled:  st.Rule.Enabled,
+			reported: true,
+			running:  st.Running,
+			latency:  st.Latency.Latency,
+			rate:     st.Traffic.BytesInRate + st.Traffic.BytesOutRate,
+		})
+	}
+
+	online := make(map[string]bool)
+	tunnels := make(map[string]models.NodeTunnelStatus)
+	for _, n := range snap.Nodes {
+		if !n.Online {
+			continue
+		}
+		online[n.ID] = true
+		for _, t := range n.Tunnels {
+			tunnels[t.ID] = t
+		}
+	}
+	for _, r := range snap.NodeRules {
+		v := ruleView{id: r.ID, name: r.Name, nodeID: r.NodeID, enabled: r.Enabled, latency: -1}
+		if online[r.NodeID] {
+			v.reported = true
+			if t, ok := tunnels[r.ID]; ok {
+				v.running = t.Running
+				v.latency = t.Latency
+				v.rate = t.RateIn + t.RateOut
+			}
+		}
+		views = append(views, v)
+	}
+	return views
+}
+
+// check 返回满足告警条件的对象，baselines 是 traffic_spike 使用的流量基线
+func check(rule models.AlertRule, snap Snapshot, baselines map[string]*trafficBaseline, now time.Time) []observation {
+	var result []observation
+
+	switch rule.Type {
+	case models.AlertNodeOffline, models.AlertCPUHigh, models.AlertMemHigh:
+		for _, n := range snap.Nodes {
+			if rule.Target != "" && rule.Target != n.ID {
+				continue
+			}
+			obs := observation{subject: n.ID, subjectName: n.Name, nodeID: n.ID}
+			switch {
+			case rule.Type == models.AlertNodeOffline && !n.Online:
+				if n.LastSeen > 0 {
+					obs.since = time.Unix(n.LastSeen, 0)
+					obs.value = now.Sub(obs.since).Seconds()
+				}
+				obs.message = fmt.Sprintf("Node %s is offline", n.Name)
+			case rule.Type == models.AlertCPUHigh && n.Online && n.CPUPercent > rule.Threshold:
+				obs.value = n.CPUPercent
+				obs.message = fmt.Sprintf("Node %s CPU %.1f%% > %.1f%%", n.Name, n.CPUPercent, rule.Threshold)
+			case rule.Type == models.AlertMemHigh && n.Online && n.MemPercent > rule.Threshold:
+				obs.value = n.MemPercent
+				obs.message = fmt.Sprintf("Node %s memory %.1f%% > %.1f%%", n.Name, n.MemPercent, rule.Threshold)
+			default:
+				continue
+			}
+			result = append(result, obs)
+		}
+
+	case models.AlertTunnelDown, models.AlertLatencyHigh, models.AlertTrafficSpike:
+		for _, r := range ruleViews(snap) {
+			if rule.Target != "" && rule.Target != r.id && rule.Target != r.nodeID {
+				continue
+			}
+			// 节点离线由 node_offline 负责，这里不重复告警
+			if !r.enabled || !r.reported {
+				continue
+			}
+			obs := observation{subject: r.id, subjectName: r.name, nodeID: r.nodeID}
+			switch {
+			case rule.Type == models.AlertTunnelDown && !r.running:
+				obs.message = fmt.Sprintf("Rule %s is enabled but its tunnel is not running", r.name)
+			case rule.Type == models.AlertLatencyHigh && r.running && r.latency < 0:
+				obs.value = -1
+				obs.message = fmt.Sprintf("Rule %s target is unreachable", r.name)
+			case rule.Type == models.AlertLatencyHigh && r.running && float64(r.latency) > rule.Threshold:
+				obs.value = float64(r.latency)
+				obs.message = fmt.Sprintf("Rule %s latency %dms > %.0fms", r.name, r.latency, rule.Threshold)
+			case rule.Type == models.AlertTrafficSpike && r.running && isSpike(r.rate, baselines[r.id], rule.Threshold, now):
+				base := baselines[r.id].rate
+				obs.value = r.rate
+				obs.message = fmt.Sprintf("Rule %s traffic %s/s is %.1fx its baseline %s/s",
+					r.name, formatBytes(r.rate), r.rate/math.Max(base, 1), formatBytes(base))
+			default:
+				continue
+			}
+			result = append(result, obs)
+		}
+	}
+	return result
+}
+
+// isSpike 判断速率是否超过基线的 factor 倍
+func isSpike(rate float64, b *trafficBaseline, factor float64, now time.Time) bool {
+	if !b.ready(now) || rate < spikeMinRate {
+		return false
+	}
+	return rate > b.rate*factor
+}
+
+func formatBytes(b float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for b >= 1024 && i < len(units)-1 {
+		b /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", b, units[i])
+}
+
+// Alerts 返回活动告警（按开始时间倒序）和最近恢复的告警（新的在前）
+func (e *Engine) Alerts() (active, history []models.Alert) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	active = make([]models.Alert, 0, len(e.active))
+	for _, a := range e.active {
+		active = append(active, *a)
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].StartsAt > active[j].StartsAt })
+
+	history = make([]models.Alert, 0, len(e.history))
+	for i := len(e.history) - 1; i >= 0; i-- {
+		history = append(history, e.history[i])
+	}
+	return active, history
+}
+
+func (e *Engine) findRule(id string) (models.AlertRule, bool) {
+	for _, r := range e.rules {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return models.AlertRule{}, false
+}
+
+func (e *Engine) findChannel(id string) (models.AlertChannel, bool) {
+	for _, ch := range e.channels {
+		if ch.ID == id {
+			return ch, true
+		}
+	}
+	return models.AlertChannel{}, false
+}
+
+// Rules 返回告警规则
+func (e *Engine) Rules() []models.AlertRule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]models.AlertRule{}, e.rules...)
+}
+
+func (e *Engine) validateRule(r models.AlertRule) error {
+	switch r.Type {
+	case models.AlertNodeOffline, models.AlertTunnelDown:
+	case models.AlertLatencyHigh, models.AlertCPUHigh, models.AlertMemHigh:
+		if r.Threshold <= 0 {
+			return fmt.Errorf("threshold is required for %s", r.Type)
+		}
+	case models.AlertTrafficSpike:
+		if r.Threshold <= 1 {
+			return fmt.Errorf("threshold for %s is a multiple of the baseline and must be greater than 1", r.Type)
+		}
+	default:
+		return fmt.Errorf("unsupported alert type %q", r.Type)
+	}
+	if r.Duration < 0 {
+		return fmt.Errorf("duration must not be negative")
+	}
+	for _, id := range r.Channels {
+		if _, ok := e.findChannel(id); !ok {
+			return fmt.Errorf("channel %s not found", id)
+		}
+	}
+	return nil
+}
+
+func (e *Engine) AddRule(r models.AlertRule) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.validateRule(r); err != nil {
+		return err
+	}
+	e.rules = append(e.rules, r)
+	return nil
+}
+
+// UpdateRule 更新规则，条件变化后的告警在下一次评估时按新条件恢复或保持
+func (e *Engine) UpdateRule(r models.AlertRule) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i := range e.rules {
+		if e.rules[i].ID != r.ID {
+			continue
+		}
+		if err := e.validateRule(r); err != nil {
+			return err
+		}
+		e.rules[i] = r
+		return nil
+	}
+	return fmt.Errorf("alert rule %s not found", r.ID)
+}
+
+func (e *Engine) DeleteRule(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i := range e.rules {
+		if e.rules[i].ID == id {
+			e.rules = append(e.rules[:i], e.rules[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("alert rule %s not found", id)
+}
+
+// Channels 返回通知渠道（包含密钥，仅用于保存配置）
+func (e *Engine) Channels() []models.AlertChannel {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]models.AlertChannel{}, e.channels...)
+}
+
+// secretMask 是接口返回的渠道中密钥的占位符，更新时原样提交表示保持不变
+const secretMask = "******"
+
+// MaskSecrets 隐藏渠道中的 Bot Token 和 SMTP 密码
+func MaskSecrets(ch models.AlertChannel) models.AlertChannel {
+	if ch.BotToken != "" {
+		ch.BotToken = secretMask
+	}
+	if ch.SMTPPassword != "" {
+		ch.SMTPPassword = secretMask
+	}
+	return ch
+}
+
+func validateChannel(ch models.AlertChannel) error {
+	switch ch.Type {
+	case models.ChannelWebhook:
+		if !strings.HasPrefix(ch.URL, "http://") && !strings.HasPrefix(ch.URL, "https://") {
+			return fmt.Errorf("webhook url must start with http:// or https://")
+		}
+	case models.ChannelTelegram:
+		if ch.BotToken == "" || ch.ChatID == "" {
+			return fmt.Errorf("bot_token and chat_id are required")
+		}
+	case models.ChannelEmail:
+		if ch.SMTPHost == "" || ch.From == "" || len(ch.To) == 0 {
+			return fmt.Errorf("smtp_host, from and to are required")
+		}
+	default:
+		return fmt.Errorf("unsupported channel type %q", ch.Type)
+	}
+	return nil
+}
+
+func (e *Engine) AddChannel(ch models.AlertChannel) error {
+	if err := validateChannel(ch); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.channels = append(e.channels, ch)
+	return nil
+}
+
+func (e *Engine) UpdateChannel(ch models.AlertChannel) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i := range e.channels {
+		if e.channels[i].ID != ch.ID {
+			continue
+		}
+		if ch.BotToken == secretMask {
+			ch.BotToken = e.channels[i].BotToken
+		}
+		if ch.SMTPPassword == secretMask {
+			ch.SMTPPassword = e.channels[i].SMTPPassword
+		}
+		if err := validateChannel(ch); err != nil {
+			return err
+		}
+		e.channels[i] = ch
+		return nil
+	}
+	return fmt.Errorf("channel %s not found", ch.ID)
+}
+
+// DeleteChannel 删除渠道，并从引用它的告警规则中移除
+func (e *Engine) DeleteChannel(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i := range e.channels {
+		if e.channels[i].ID != id {
+			continue
+		}
+		e.channels = append(e.channels[:i], e.channels[i+1:]...)
+		for j := range e.rules {
+			var kept []string
+			for _, c := range e.rules[j].Channels {
+				if c != id {
+					kept = append(kept, c)
+				}
+			}
+			e.rules[j].Channels = kept
+		}
+		return nil
+	}
+	return fmt.Errorf("channel %s not found", id)
+}
+
+// GetChannel 返回渠道（包含密钥），用于发送测试通知
+func (e *Engine) GetChannel(id string) (models.AlertChannel, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if ch, ok := e.findChannel(id); ok {
+		return ch, nil
+	}
+	return models.AlertChannel{}, fmt.Errorf("channel %s not found", id)
+}
+
+// Silences 返回静默窗口
+func (e *Engine) Silences() []models.AlertSilence {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]models.AlertSilence{}, e.silences...)
+}
+
+// AddSilence 添加静默窗口，同时清理已结束的窗口
+func (e *Engine) AddSilence(s models.AlertSilence) error {
+	if s.EndAt <= s.StartAt {
+		return fmt.Errorf("end_at must be after start_at")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now().Unix()
+	kept := e.silences[:0]
+	for _, existing := range e.silences {
+		if existing.EndAt > now {
+			kept = append(kept, existing)
+		}
+	}
+	e.silences = append(kept, s)
+	return nil
+}
+
+func (e *Engine) DeleteSilence(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i := range e.silences {
+		if e.silences[i].ID == id {
+			e.silences = append(e.silences[:i], e.silences[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("silence %s not found", id)
+}
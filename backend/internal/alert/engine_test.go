@@ -0,0 +1,256 @@
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"port-forward-dashboard/internal/models"
+)
+
+// webhookRecorder 启动一个 webhook 渠道，收到的通知按顺序写入 received
+func webhookRecorder(t *testing.T) (models.AlertChannel, chan models.Alert) {
+	received := make(chan models.Alert, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a models.Alert
+		json.NewDecoder(r.Body).Decode(&a)
+		received <- a
+	}))
+	t.Cleanup(srv.Close)
+	return models.AlertChannel{ID: "c1", Name: "hook", Type: models.ChannelWebhook, Enabled: true, URL: srv.URL}, received
+}
+
+func expectNotification(t *testing.T, received chan models.Alert, state string) models.Alert {
+	t.Helper()
+	select {
+	case a := <-received:
+		if a.State != state {
+			t.Fatalf("notification state = %s, want %s", a.State, state)
+		}
+		return a
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no %s notification", state)
+		return models.Alert{}
+	}
+}
+
+func expectNoNotification(t *testing.T, received chan models.Alert) {
+	t.Helper()
+	select {
+	case a := <-received:
+		t.Fatalf("unexpected %s notification: %s", a.State, a.Message)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func cpuSnapshot(percent float64) Snapshot {
+	return Snapshot{Nodes: []models.NodeWithStatus{{Node: models.Node{ID: "n1", Name: "node-1", Online: true, CPUPercent: percent}}}}
+}
+
+func cpuRule(duration int) models.AlertRule {
+	return models.AlertRule{ID: "r1", Name: "cpu", Type: models.AlertCPUHigh, Enabled: true, Threshold: 90, Duration: duration, Channels: []string{"c1"}}
+}
+
+func TestEvaluateDuration(t *testing.T) {
+	tests := []struct {
+		name      string
+		duration  int
+		cpu       []float64 // 每 10 秒一次评估
+		wantFired []bool
+	}{
+		{"fires immediately without duration", 0, []float64{95}, []bool{true}},
+		{"waits for duration", 30, []float64{95, 95, 95, 95}, []bool{false, false, false, true}},
+		{"dip resets the pending timer", 20, []float64{95, 95, 50, 95, 95, 95}, []bool{false, false, false, false, false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEngine([]models.AlertRule{cpuRule(tt.duration)}, nil, nil)
+			start := time.Unix(1_700_000_000, 0)
+			for i, cpu := range tt.cpu {
+				e.Evaluate(cpuSnapshot(cpu), start.Add(time.Duration(i)*10*time.Second))
+				active, _ := e.Alerts()
+				if fired := len(active) == 1; fired != tt.wantFired[i] {
+					t.Fatalf("step %d: fired = %v, want %v", i, fired, tt.wantFired[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateDedupAndRecovery(t *testing.T) {
+	ch, received := webhookRecorder(t)
+	e := NewEngine([]models.AlertRule{cpuRule(0)}, []models.AlertChannel{ch}, nil)
+	now := time.Unix(1_700_000_000, 0)
+
+	e.Evaluate(cpuSnapshot(95), now)
+	fired := expectNotification(t, received, models.AlertFiring)
+	if fired.Subject != "n1" || fired.Value != 95 {
+		t.Errorf("firing alert = %+v", fired)
+	}
+
+	// 条件持续时只更新告警，不重复通知
+	e.Evaluate(cpuSnapshot(97), now.Add(10*time.Second))
+	expectNoNotification(t, received)
+	active, _ := e.Alerts()
+	if len(active) != 1 || active[0].Value != 97 || active[0].ID != fired.ID {
+		t.Fatalf("active = %+v, want the same alert with value 97", active)
+	}
+
+	e.Evaluate(cpuSnapshot(50), now.Add(20*time.Second))
+	resolved := expectNotification(t, received, models.AlertResolved)
+	if resolved.ID != fired.ID || resolved.ResolvedAt != now.Add(20*time.Second).Unix() {
+		t.Errorf("resolved alert = %+v", resolved)
+	}
+	active, history := e.Alerts()
+	if len(active) != 0 || len(history) != 1 {
+		t.Fatalf("active = %d, history = %d, want 0 and 1", len(active), len(history))
+	}
+}
+
+func TestEvaluateSilence(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	tests := []struct {
+		name    string
+		silence models.AlertSilence
+		silent  bool
+	}{
+		{"matching rule", models.AlertSilence{ID: "s1", RuleID: "r1"}, true},
+		{"matching node", models.AlertSilence{ID: "s1", Target: "n1"}, true},
+		{"other rule", models.AlertSilence{ID: "s1", RuleID: "r2"}, false},
+		{"other node", models.AlertSilence{ID: "s1", Target: "n2"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, received := webhookRecorder(t)
+			s := tt.silence
+			s.StartAt, s.EndAt = now.Unix(), now.Add(15*time.Second).Unix()
+			e := NewEngine([]models.AlertRule{cpuRule(0)}, []models.AlertChannel{ch}, []models.AlertSilence{s})
+
+			e.Evaluate(cpuSnapshot(95), now)
+			active, _ := e.Alerts()
+			if len(active) != 1 || active[0].Silenced != tt.silent {
+				t.Fatalf("active = %+v, want one alert with silenced=%v", active, tt.silent)
+			}
+			if !tt.silent {
+				expectNotification(t, received, models.AlertFiring)
+				return
+			}
+			expectNoNotification(t, received)
+
+			// 静默结束时告警仍在持续，补发触发通知
+			e.Evaluate(cpuSnapshot(95), now.Add(20*time.Second))
+			expectNotification(t, received, models.AlertFiring)
+		})
+	}
+}
+
+func TestEvaluateSilencedAlertResolvesQuietly(t *testing.T) {
+	ch, received := webhookRecorder(t)
+	now := time.Unix(1_700_000_000, 0)
+	silence := models.AlertSilence{ID: "s1", StartAt: now.Unix(), EndAt: now.Add(time.Hour).Unix()}
+	e := NewEngine([]models.AlertRule{cpuRule(0)}, []models.AlertChannel{ch}, []models.AlertSilence{silence})
+
+	e.Evaluate(cpuSnapshot(95), now)
+	e.Evaluate(cpuSnapshot(50), now.Add(10*time.Second))
+	// 触发通知未发送过，恢复时也不通知
+	expectNoNotification(t, received)
+	if _, history := e.Alerts(); len(history) != 1 {
+		t.Fatalf("history = %d, want 1", len(history))
+	}
+}
+
+func TestEvaluateNodeOffline(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	rule := models.AlertRule{ID: "r1", Name: "offline", Type: models.AlertNodeOffline, Enabled: true, Duration: 60}
+	e := NewEngine([]models.AlertRule{rule}, nil, nil)
+
+	// 最后在线时间早于 duration，首次评估即触发，开始时间取最后在线时间
+	lastSeen := now.Add(-2 * time.Minute).Unix()
+	snap := Snapshot{Nodes: []models.NodeWithStatus{{Node: models.Node{ID: "n1", Name: "node-1", LastSeen: lastSeen}}}}
+	e.Evaluate(snap, now)
+	active, _ := e.Alerts()
+	if len(active) != 1 || active[0].StartsAt != lastSeen {
+		t.Fatalf("active = %+v, want one alert starting at %d", active, lastSeen)
+	}
+}
+
+// rateSnapshot 是一条本地规则以 rate 字节/秒运行的快照
+func rateSnapshot(rate float64) Snapshot {
+	st := models.TunnelStatus{Rule: models.Rule{ID: "t1", Name: "web", Enabled: true}, Running: true}
+	st.Traffic.BytesInRate = rate
+	return Snapshot{LocalRules: []models.TunnelStatus{st}}
+}
+
+func TestEvaluateTrafficSpike(t *testing.T) {
+	const mb = 1024 * 1024
+	tests := []struct {
+		name      string
+		baseline  float64
+		warmup    time.Duration
+		rate      float64
+		wantFired bool
+	}{
+		{"above baseline multiple", 1 * mb, spikeWarmup, 4 * mb, true},
+		{"below baseline multiple", 1 * mb, spikeWarmup, 2.5 * mb, false},
+		{"baseline still warming up", 1 * mb, spikeWarmup - evalInterval, 4 * mb, false},
+		{"idle rule below minimum rate", 1024, spikeWarmup, 32 * 1024, false},
+		{"idle rule above minimum rate", 1024, spikeWarmup, 1 * mb, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := models.AlertRule{ID: "r1", Name: "spike", Type: models.AlertTrafficSpike, Enabled: true, Threshold: 3}
+			e := NewEngine([]models.AlertRule{rule}, nil, nil)
+			start := time.Unix(1_700_000_000, 0)
+			var now time.Time
+			for d := time.Duration(0); d < tt.warmup; d += evalInterval {
+				now = start.Add(d)
+				e.Evaluate(rateSnapshot(tt.baseline), now)
+			}
+			e.Evaluate(rateSnapshot(tt.rate), now.Add(evalInterval))
+			active, _ := e.Alerts()
+			if fired := len(active) == 1; fired != tt.wantFired {
+				t.Fatalf("fired = %v, want %v (active %+v)", fired, tt.wantFired, active)
+			}
+		})
+	}
+}
+
+func TestTrafficBaselineFollowsRate(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	b := &trafficBaseline{rate: 100, since: start, updated: start}
+	b.observe(200, start.Add(spikeWindow))
+	// 经过一个时间常数，基线向新速率移动 1-1/e
+	if b.rate < 163 || b.rate > 164 {
+		t.Errorf("baseline = %.2f, want about 163.2", b.rate)
+	}
+	b.observe(200, start.Add(spikeWindow))
+	if b.rate < 163 || b.rate > 164 {
+		t.Errorf("baseline changed without elapsed time: %.2f", b.rate)
+	}
+}
+
+func TestValidateRule(t *testing.T) {
+	e := NewEngine(nil, []models.AlertChannel{{ID: "c1", Type: models.ChannelWebhook, URL: "http://x"}}, nil)
+	tests := []struct {
+		name    string
+		rule    models.AlertRule
+		wantErr bool
+	}{
+		{"node offline", models.AlertRule{Type: models.AlertNodeOffline}, false},
+		{"cpu without threshold", models.AlertRule{Type: models.AlertCPUHigh}, true},
+		{"spike multiple", models.AlertRule{Type: models.AlertTrafficSpike, Threshold: 3}, false},
+		{"spike multiple not above 1", models.AlertRule{Type: models.AlertTrafficSpike, Threshold: 1}, true},
+		{"negative duration", models.AlertRule{Type: models.AlertNodeOffline, Duration: -1}, true},
+		{"unknown channel", models.AlertRule{Type: models.AlertNodeOffline, Channels: []string{"c2"}}, true},
+		{"unknown type", models.AlertRule{Type: "disk_full"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := e.validateRule(tt.rule); (err != nil) != tt.wantErr {
+				t.Errorf("validateRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
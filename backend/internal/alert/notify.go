@@ -0,0 +1,197 @@
+package alert
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"port-forward-dashboard/internal/models"
+)
+
+const (
+	// notifyTimeout 单次通知的超时时间
+	notifyTimeout = 10 * time.Second
+	// defaultTelegramAPI Telegram Bot API 地址，测试时可通过渠道的 api_base 指向本地服务
+	defaultTelegramAPI = "https://api.telegram.org"
+	defaultSMTPPort    = 25
+)
+
+var httpClient = &http.Client{Timeout: notifyTimeout}
+
+// Send 通过渠道发送一条告警通知
+func Send(ch models.AlertChannel, a models.Alert) error {
+	switch ch.Type {
+	case models.ChannelWebhook:
+		return sendWebhook(ch, a)
+	case models.ChannelTelegram:
+		return sendTelegram(ch, a)
+	case models.ChannelEmail:
+		return sendEmail(ch, a)
+	default:
+		return fmt.Errorf("unsupported channel type %q", ch.Type)
+	}
+}
+
+// TestAlert 是发送测试通知时使用的告警
+func TestAlert() models.Alert {
+	return models.Alert{
+		ID:       "test",
+		RuleName: "Test notification",
+		Type:     "test",
+		State:    models.AlertFiring,
+		Message:  "This is a test notification from Port Forward Dashboard",
+		StartsAt: time.Now().Unix(),
+	}
+}
+
+func subject(a models.Alert) string {
+	return fmt.Sprintf("[%s] %s: %s", strings.ToUpper(a.State), a.RuleName, a.Message)
+}
+
+// formatText 生成 Telegram 和邮件使用的纯文本内容
+func formatText(a models.Alert) string {
+	var b strings.Builder
+	b.WriteString(subject(a))
+	b.WriteByte('\n')
+	if a.SubjectName != "" {
+		fmt.Fprintf(&b, "Object: %s (%s)\n", a.SubjectName, a.Subject)
+	}
+	fmt.Fprintf(&b, "Started: %s\n", time.Unix(a.StartsAt, 0).Format(time.RFC3339))
+	if a.State == models.AlertResolved {
+		fmt.Fprintf(&b, "Resolved: %s (lasted %s)\n",
+			time.Unix(a.ResolvedAt, 0).Format(time.RFC3339),
+			time.Duration(a.ResolvedAt-a.StartsAt)*time.Second)
+	}
+	return b.String()
+}
+
+// sendWebhook 以 JSON POST 告警事件，state 字段区分触发和恢复
+func sendWebhook(ch models.AlertChannel, a models.Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return post(ch.URL, body)
+}
+
+func sendTelegram(ch models.AlertChannel, a models.Alert) error {
+	base := ch.APIBase
+	if base == "" {
+		base = defaultTelegramAPI
+	}
+	body, err := json.Marshal(map[string]string{
+		"chat_id": ch.ChatID,
+		"text":    formatText(a),
+	})
+	if err != nil {
+		return err
+	}
+	return post(strings.TrimRight(base, "/")+"/bot"+ch.BotToken+"/sendMessage", body)
+}
+
+func post(target string, body []byte) error {
+	resp, err := httpClient.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// 错误信息中的 URL 可能包含 Bot Token，只保留底层错误
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// sendEmail 通过 SMTP 发送邮件：465 端口使用隐式 TLS，其他端口在服务器支持时升级 STARTTLS，
+// 配置了用户名而连接未加密时拒绝发送
+func sendEmail(ch models.AlertChannel, a models.Alert) error {
+	port := ch.SMTPPort
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	addr := net.JoinHostPort(ch.SMTPHost, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: ch.SMTPHost}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: notifyTimeout}
+	if port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(notifyTimeout))
+
+	c, err := smtp.NewClient(conn, ch.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	encrypted := port == 465
+	if ok, _ := c.Extension("STARTTLS"); ok && !encrypted {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+		encrypted = true
+	}
+	if ch.SMTPUsername != "" {
+		// 不在明文连接上发送密码（PlainAuth 对本机地址不做此限制）
+		if !encrypted {
+			return fmt.Errorf("smtp server %s does not support STARTTLS, refusing to send credentials in plaintext", addr)
+		}
+		if err := c.Auth(smtp.PlainAuth("", ch.SMTPUsername, ch.SMTPPassword, ch.SMTPHost)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(ch.From); err != nil {
+		return err
+	}
+	for _, to := range ch.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", ch.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(ch.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject(a)))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(formatText(a), "\n", "\r\n"))
+
+	if _, err := w.Write([]byte(msg.String())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,241 @@
+package alert
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"port-forward-dashboard/internal/models"
+)
+
+func testAlert() models.Alert {
+	a := TestAlert()
+	a.RuleID, a.Subject, a.SubjectName = "r1", "t1", "tunnel-1"
+	return a
+}
+
+func TestSendWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{"accepted", http.StatusOK, false},
+		{"no content", http.StatusNoContent, false},
+		{"server error", http.StatusInternalServerError, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got models.Alert
+			var contentType string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentType = r.Header.Get("Content-Type")
+				json.NewDecoder(r.Body).Decode(&got)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			a := testAlert()
+			err := Send(models.AlertChannel{Type: models.ChannelWebhook, URL: srv.URL + "/hook"}, a)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if contentType != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", contentType)
+			}
+			if got.State != a.State || got.RuleID != a.RuleID || got.Message != a.Message {
+				t.Errorf("webhook received %+v, want %+v", got, a)
+			}
+		})
+	}
+}
+
+func TestSendTelegram(t *testing.T) {
+	var path string
+	var body map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	a := testAlert()
+	ch := models.AlertChannel{Type: models.ChannelTelegram, BotToken: "123:secret", ChatID: "42", APIBase: srv.URL + "/"}
+	if err := Send(ch, a); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/bot123:secret/sendMessage" {
+		t.Errorf("path = %q, want /bot123:secret/sendMessage", path)
+	}
+	if body["chat_id"] != "42" {
+		t.Errorf("chat_id = %q, want 42", body["chat_id"])
+	}
+	if !strings.Contains(body["text"], a.Message) || !strings.Contains(body["text"], "tunnel-1 (t1)") {
+		t.Errorf("text = %q, want message and object", body["text"])
+	}
+}
+
+func TestSendTelegramErrorHidesToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	base := srv.URL
+	srv.Close()
+
+	ch := models.AlertChannel{Type: models.ChannelTelegram, BotToken: "123:secret", ChatID: "42", APIBase: base}
+	err := Send(ch, testAlert())
+	if err == nil {
+		t.Fatal("Send() to a closed server succeeded")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("error %q leaks the bot token", err)
+	}
+}
+
+// smtpStub 是只支持发送流程的 SMTP 服务器，记录收到的命令和邮件内容
+type smtpStub struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	cmds []string
+	data string
+	done chan struct{}
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStub{ln: ln, done: make(chan struct{})}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *smtpStub) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStub) serve() {
+	defer close(s.done)
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 stub ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		s.mu.Lock()
+		s.cmds = append(s.cmds, verb)
+		s.mu.Unlock()
+
+		switch verb {
+		case "EHLO":
+			reply("250-stub")
+			reply("250 AUTH PLAIN")
+		case "MAIL", "RCPT", "RSET", "NOOP":
+			reply("250 OK")
+		case "AUTH":
+			reply("235 OK")
+		case "DATA":
+			reply("354 go ahead")
+			var msg strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				msg.WriteString(l)
+			}
+			s.mu.Lock()
+			s.data = msg.String()
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+// result 等待连接结束后返回收到的命令和邮件内容
+func (s *smtpStub) result() ([]string, string) {
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cmds, s.data
+}
+
+func TestSendEmail(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		wantErr  string
+		wantCmds []string
+	}{
+		{
+			name:     "no auth",
+			wantCmds: []string{"EHLO", "MAIL", "RCPT", "RCPT", "DATA", "QUIT"},
+		},
+		{
+			// 服务器未提供 STARTTLS，不能在明文连接上发送 PlainAuth 凭据
+			name:     "auth without starttls",
+			username: "user",
+			wantErr:  "does not support STARTTLS",
+			wantCmds: []string{"EHLO"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newSMTPStub(t)
+			ch := models.AlertChannel{
+				Type:         models.ChannelEmail,
+				SMTPHost:     "127.0.0.1",
+				SMTPPort:     stub.port(),
+				SMTPUsername: tt.username,
+				SMTPPassword: "password",
+				From:         "alerts@example.com",
+				To:           []string{"a@example.com", "b@example.com"},
+			}
+			err := Send(ch, testAlert())
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Send() error = %v, want %q", err, tt.wantErr)
+			}
+
+			cmds, data := stub.result()
+			if strings.Join(cmds, " ") != strings.Join(tt.wantCmds, " ") {
+				t.Errorf("commands = %v, want %v", cmds, tt.wantCmds)
+			}
+			if tt.wantErr != "" {
+				return
+			}
+			for _, want := range []string{"From: alerts@example.com", "To: a@example.com, b@example.com", "Subject: ", "Object: tunnel-1 (t1)"} {
+				if !strings.Contains(data, want) {
+					t.Errorf("message missing %q:\n%s", want, data)
+				}
+			}
+		})
+	}
+}
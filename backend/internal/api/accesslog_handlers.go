@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"port-forward-common/accesslog"
+	"port-forward-dashboard/internal/models"
+)
+
+// defaultAccessLogLimit 查询访问日志时默认返回的条数
+const defaultAccessLogLimit = 200
+
+// accessLogFilter 从查询参数解析过滤条件：rule_id、client_ip、event、reason、since（Unix 秒）、limit
+func accessLogFilter(c *gin.Context) accesslog.Filter {
+	f := accesslog.Filter{
+		RuleID:   c.Query("rule_id"),
+		ClientIP: c.Query("client_ip"),
+		Event:    c.Query("event"),
+		Reason:   c.Query("reason"),
+		Limit:    defaultAccessLogLimit,
+	}
+	if since, err := strconv.ParseInt(c.Query("since"), 10, 64); err == nil {
+		f.Since = since
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 {
+		f.Limit = limit
+	}
+	return f
+}
+
+func (s *Server) handleGetRuleAccessLog(c *gin.Context) {
+	entries, err := s.fm.ReadAccessLog(c.Param("id"), accessLogFilter(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: entries})
+}
+
+// handleGetNodeAccessLog 代理到节点 Agent 查询访问日志
+func (s *Server) handleGetNodeAccessLog(c *gin.Context) {
+	entries, err := s.nm.ReadAccessLog(c.Param("id"), accessLogFilter(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: entries})
+}
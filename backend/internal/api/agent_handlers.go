@@ -0,0 +1,63 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+
+	"port-forward-dashboard/internal/models"
+)
+
+func (s *Server) handleAgentDownload(c *gin.Context) {
+	goos := c.DefaultQuery("os", "linux")
+	goarch := c.DefaultQuery("arch", "amd64")
+
+	artifact, err := s.agents.Artifact(goos, goarch)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	path, _ := s.agents.BinaryPath(goos, goarch)
+
+	c.Header("X-Agent-Version", artifact.Version)
+	c.Header("X-Checksum-SHA256", artifact.SHA256)
+	c.Header("X-Signature", artifact.Signature)
+	c.FileAttachment(path, fmt.Sprintf("port-forward-agent-%s-%s", goos, goarch))
+}
+
+func (s *Server) handleAgentReleases(c *gin.Context) {
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: s.agents.List()})
+}
+
+func (s *Server) handleUpdateNodeAgent(c *gin.Context) {
+	id := c.Param("id")
+
+	goos, goarch, err := s.nm.UpdateTarget(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	artifact, err := s.agents.Artifact(goos, goarch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	query := url.Values{"os": {goos}, "arch": {goarch}}
+	update := models.AgentUpdate{
+		Version:   artifact.Version,
+		URL:       "/api/agent/download?" + query.Encode(),
+		SHA256:    artifact.SHA256,
+		Signature: artifact.Signature,
+	}
+
+	if err := s.nm.UpdateAgent(id, update); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: update})
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"port-forward-dashboard/internal/alert"
+	"port-forward-dashboard/internal/models"
+)
+
+// alertSnapshot 提供告警评估所需的节点和规则状态
+func (s *Server) alertSnapshot() alert.Snapshot {
+	return alert.Snapshot{
+		Nodes:      s.nm.GetAllNodes(),
+		NodeRules:  s.nm.GetAllRules(),
+		LocalRules: s.fm.GetAllStatus(),
+	}
+}
+
+func (s *Server) saveAlertConfig() {
+	s.cfg.AlertRules = s.alerts.Rules()
+	s.cfg.AlertChannels = s.alerts.Channels()
+	s.cfg.AlertSilences = s.alerts.Silences()
+	s.cfg.Save()
+}
+
+func (s *Server) handleGetAlerts(c *gin.Context) {
+	active, history := s.alerts.Alerts()
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: models.AlertOverview{Active: active, History: history}})
+}
+
+func (s *Server) handleGetAlertRules(c *gin.Context) {
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: s.alerts.Rules()})
+}
+
+func (s *Server) handleCreateAlertRule(c *gin.Context) {
+	var rule models.AlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: "Invalid request"})
+		return
+	}
+
+	rule.ID = generateID()
+	if err := s.alerts.AddRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	s.saveAlertConfig()
+
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: rule})
+}
+
+func (s *Server) handleUpdateAlertRule(c *gin.Context) {
+	var rule models.AlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: "Invalid request"})
+		return
+	}
+
+	rule.ID = c.Param("id")
+	if err := s.alerts.UpdateRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	s.saveAlertConfig()
+
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: rule})
+}
+
+func (s *Server) handleDeleteAlertRule(c *gin.Context) {
+	if err := s.alerts.DeleteRule(c.Param("id")); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	s.saveAlertConfig()
+
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Message: "Alert rule deleted"})
+}
+
+// handleGetAlertChannels 返回的渠道隐藏了 Bot Token 和 SMTP 密码
+func (s *Server) handleGetAlertChannels(c *gin.Context) {
+	channels := s.alerts.Channels()
+	for i := range channels {
+		channels[i] = alert.MaskSecrets(channels[i])
+	}
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: channels})
+}
+
+func (s *Server) handleCreateAlertChannel(c *gin.Context) {
+	var ch models.AlertChannel
+	if err := c.ShouldBindJSON(&ch); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: "Invalid request"})
+		return
+	}
+
+	ch.ID = generateID()
+	if err := s.alerts.AddChannel(ch); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	s.saveAlertConfig()
+
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: alert.MaskSecrets(ch)})
+}
+
+// handleUpdateAlertChannel 密钥字段提交占位符时保持原值
+func (s *Server) handleUpdateAlertChannel(c *gin.Context) {
+	var ch models.AlertChannel
+	if err := c.ShouldBindJSON(&ch); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: "Invalid request"})
+		return
+	}
+
+	ch.ID = c.Param("id")
+	if err := s.alerts.UpdateChannel(ch); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	s.saveAlertConfig()
+
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: alert.MaskSecrets(ch)})
+}
+
+func (s *Server) handleDeleteAlertChannel(c *gin.Context) {
+	if err := s.alerts.DeleteChannel(c.Param("id")); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	s.saveAlertConfig()
+
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Message: "Channel deleted"})
+}
+
+// handleTestAlertChannel 同步发送一条测试通知，返回发送结果
+func (s *Server) handleTestAlertChannel(c *gin.Context) {
+	ch, err := s.alerts.GetChannel(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	if err := alert.Send(ch, alert.TestAlert()); err != nil {
+		c.JSON(http.StatusBadGateway, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Message: "Test notification sent"})
+}
+
+func (s *Server) handleGetAlertSilences(c *gin.Context) {
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: s.alerts.Silences()})
+}
+
+// handleCreateAlertSilence 未指定 start_at 时从现在开始；可用 duration（秒）代替 end_at
+func (s *Server) handleCreateAlertSilence(c *gin.Context) {
+	var req struct {
+		models.AlertSilence
+		Duration int64 `json:"duration"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: "Invalid request"})
+		return
+	}
+
+	silence := req.AlertSilence
+	silence.ID = generateID()
+	silence.Creator = c.GetString("username")
+	if silence.StartAt == 0 {
+		silence.StartAt = time.Now().Unix()
+	}
+	if silence.EndAt == 0 && req.Duration > 0 {
+		silence.EndAt = silence.StartAt + req.Duration
+	}
+
+	if err := s.alerts.AddSilence(silence); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	s.saveAlertConfig()
+
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: silence})
+}
+
+func (s *Server) handleDeleteAlertSilence(c *gin.Context) {
+	if err := s.alerts.DeleteSilence(c.Param("id")); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	s.saveAlertConfig()
+
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Message: "Silence deleted"})
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"port-forward-dashboard/internal/audit"
+	"port-forward-dashboard/internal/models"
+)
+
+// 审计事件类型
+const (
+	auditNodeDelete       = "node.delete"
+	auditUninstallRequest = "node.uninstall.request"
+	auditUninstallConfirm = "node.uninstall.confirm"
+	auditUninstallReport  = "node.uninstall.report"
+	auditNodeDiagnostics  = "node.diagnostics"
+
+	auditRuleConnClose     = "rule.connection.close"
+	auditNodeRuleConnClose = "node_rule.connection.close"
+)
+
+// defaultAuditLimit 查询审计日志时默认返回的条数
+const defaultAuditLimit = 200
+
+// recordAudit 记录操作人和来源后写入审计日志
+func (s *Server) recordAudit(c *gin.Context, e audit.Entry) {
+	if e.Actor == "" {
+		e.Actor = c.GetString("username")
+	}
+	e.IP = c.ClientIP()
+	s.audit.Record(e)
+}
+
+func (s *Server) handleGetAuditLog(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultAuditLimit)))
+	if err != nil || limit <= 0 {
+		limit = defaultAuditLimit
+	}
+
+	entries, err := s.audit.List(limit, c.Query("action"), c.Query("target"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: entries})
+}
+
+func auditResult(err error) string {
+	if err != nil {
+		return audit.ResultFailure
+	}
+	return audit.ResultSuccess
+}
+
+func agentActor(nodeID string) string {
+	return fmt.Sprintf("agent:%s", nodeID)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"port-forward-common/conns"
+	"port-forward-dashboard/internal/audit"
+	"port-forward-dashboard/internal/models"
+	"port-forward-dashboard/internal/node"
+)
+
+// connectionSource 由本地转发管理器和节点管理器实现
+type connectionSource interface {
+	GetConnections(id string) ([]models.ConnectionInfo, error)
+	CloseConnection(id, connID string) error
+	CloseConnectionsFrom(id string, ip net.IP) (int, error)
+}
+
+func (s *Server) handleGetRuleConnections(c *gin.Context) {
+	s.listConnections(c, s.fm)
+}
+
+func (s *Server) handleCloseRuleConnection(c *gin.Context) {
+	s.closeConnection(c, s.fm, auditRuleConnClose)
+}
+
+func (s *Server) handleCloseRuleConnections(c *gin.Context) {
+	s.closeConnectionsFrom(c, s.fm, auditRuleConnClose)
+}
+
+func (s *Server) handleGetNodeRuleConnections(c *gin.Context) {
+	s.listConnections(c, s.nm)
+}
+
+func (s *Server) handleCloseNodeRuleConnection(c *gin.Context) {
+	s.closeConnection(c, s.nm, auditNodeRuleConnClose)
+}
+
+func (s *Server) handleCloseNodeRuleConnections(c *gin.Context) {
+	s.closeConnectionsFrom(c, s.nm, auditNodeRuleConnClose)
+}
+
+// timingsSource 由本地转发管理器和节点管理器实现
+type timingsSource interface {
+	GetTimings(id string) (models.ConnTimings, error)
+}
+
+func (s *Server) handleGetRuleTimings(c *gin.Context) {
+	s.getTimings(c, s.fm)
+}
+
+func (s *Server) handleGetNodeRuleTimings(c *gin.Context) {
+	s.getTimings(c, s.nm)
+}
+
+// getTimings 返回规则的连接目标耗时、首字节耗时直方图和按原因分类的连接失败次数
+func (s *Server) getTimings(c *gin.Context, src timingsSource) {
+	timings, err := src.GetTimings(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: timings})
+}
+
+func (s *Server) listConnections(c *gin.Context, src connectionSource) {
+	conns, err := src.GetConnections(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: conns})
+}
+
+func (s *Server) closeConnection(c *gin.Context, src connectionSource, action string) {
+	id, connID := c.Param("id"), c.Param("conn_id")
+
+	err := src.CloseConnection(id, connID)
+	detail := "conn=" + connID
+	if err != nil {
+		detail += ": " + err.Error()
+	}
+	s.recordAudit(c, audit.Entry{Action: action, Target: id, Result: auditResult(err), Detail: detail})
+
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, conns.ErrNotFound) || errors.Is(err, node.ErrConnectionNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: models.ConnectionCloseResult{Closed: 1}})
+}
+
+// closeConnectionsFrom 断开规则上来自 source_ip 的所有连接
+func (s *Server) closeConnectionsFrom(c *gin.Context, src connectionSource, action string) {
+	id := c.Param("id")
+
+	ip := net.ParseIP(c.Query("source_ip"))
+	if ip == nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: "source_ip is required"})
+		return
+	}
+
+	closed, err := src.CloseConnectionsFrom(id, ip)
+	detail := fmt.Sprintf("source_ip=%s closed=%d", ip, closed)
+	if err != nil {
+		detail = fmt.Sprintf("source_ip=%s: %v", ip, err)
+	}
+	s.recordAudit(c, audit.Entry{Action: action, Target: id, Result: auditResult(err), Detail: detail})
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: models.ConnectionCloseResult{Closed: closed}})
+}
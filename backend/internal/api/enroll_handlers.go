@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"port-forward-dashboard/internal/models"
+	"port-forward-dashboard/internal/node"
+)
+
+func (s *Server) handleCreateEnrollToken(c *gin.Context) {
+	var req struct {
+		Name       string `json:"name"`
+		Port       int    `json:"port"`
+		TTLSeconds int    `json:"ttl_seconds"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: "Invalid request"})
+			return
+		}
+	}
+
+	token, err := s.nm.CreateEnrollToken(req.Name, req.Port, time.Duration(req.TTLSeconds)*time.Second)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	s.saveNodeConfig()
+
+	masterURL := requestMasterURL(c)
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data: gin.H{
+			"token":   token,
+			"command": fmt.Sprintf(`curl -fsSL %s/api/install.sh | bash -s -- --token "%s"`, masterURL, token.Token),
+			"join":    fmt.Sprintf(`port-forward-agent -join %s %s`, masterURL, token.Token),
+		},
+	})
+}
+
+func (s *Server) handleListEnrollTokens(c *gin.Context) {
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: s.nm.ListEnrollTokens()})
+}
+
+func (s *Server) handleRevokeEnrollToken(c *gin.Context) {
+	if err := s.nm.RevokeEnrollToken(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	s.saveNodeConfig()
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Message: "Token revoked"})
+}
+
+// handleEnrollNode 供 Agent 凭一次性令牌加入，节点地址取自 TCP 连接的来源地址，
+// 不采信 X-Forwarded-For 等可伪造的请求头
+func (s *Server) handleEnrollNode(c *gin.Context) {
+	var req models.EnrollRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: "Invalid request"})
+		return
+	}
+
+	if req.Name == "" {
+		req.Name = "Node"
+	}
+	if req.Port <= 0 || req.Port > 65535 {
+		req.Port = 9090
+	}
+
+	enrolled, cert, err := s.nm.Enroll(req.Token, models.Node{
+		ID:   generateID(),
+		Name: req.Name,
+		Host: c.RemoteIP(),
+		Port: req.Port,
+	}, req.CSR)
+	if err != nil {
+		if errors.Is(err, node.ErrInvalidEnrollToken) {
+			log.Printf("Rejected node enrollment from %s: %v", c.RemoteIP(), err)
+			c.JSON(http.StatusUnauthorized, models.APIResponse{Success: false, Message: err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	s.saveNodeConfig()
+	log.Printf("Node %s (%s) enrolled from %s", enrolled.Name, enrolled.ID, enrolled.Host)
+
+	result := models.EnrollResult{
+		NodeID: enrolled.ID,
+		Name:   enrolled.Name,
+		Key:    enrolled.Key,
+	}
+	if cert != "" {
+		result.Cert = cert
+		result.CACert = s.nm.CACertPEM()
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: result})
+}
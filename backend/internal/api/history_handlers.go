@@ -0,0 +1,174 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"port-forward-dashboard/internal/history"
+	"port-forward-dashboard/internal/models"
+)
+
+// historyInterval 流量历史的采样间隔
+const historyInterval = 10 * time.Second
+
+// defaultHistoryRange 未指定 range 和 from 时查询的时间范围
+const defaultHistoryRange = 24 * time.Hour
+
+// meshSeenTTL 延迟探测结果的有效期（秒），超过最大探测间隔的两倍仍未更新的结果不再写入历史
+const meshSeenTTL = 2 * maxMeshInterval
+
+// historyLoop 定期把本地规则、节点规则和节点的流量写入历史存储
+func (s *Server) historyLoop() {
+	ticker := time.NewTicker(historyInterval)
+	defer ticker.Stop()
+
+	// meshSeen 记录每个延迟序列已写入的最近一次探测时间，同一次探测结果会随多次心跳重复上报
+	meshSeen := make(map[string]int64)
+
+	for now := range ticker.C {
+		for _, status := range s.fm.GetAllStatus() {
+			s.history.Record(history.RuleKey(status.Rule.ID), now, status.Traffic)
+		}
+
+		rules, nodes := s.nm.TrafficSnapshot()
+		for id, stats := range rules {
+			s.history.Record(history.RuleKey(id), now, stats)
+		}
+		for id, stats := range nodes {
+			s.history.Record(history.NodeKey(id), now, stats)
+		}
+
+		for source, results := range s.nm.MeshResults() {
+			for _, r := range results {
+				key := history.MeshKey(source, r.Peer)
+				if r.LastProbe <= now.Unix()-meshSeenTTL || r.LastProbe <= meshSeen[key] {
+					continue
+				}
+				meshSeen[key] = r.LastProbe
+				s.meshHistory.Record(key, time.Unix(r.LastProbe, 0), r.Latency)
+			}
+		}
+		// 过期的探测结果不再写入，对应记录可以清理，删除的节点和目标不会一直残留
+		for key, last := range meshSeen {
+			if last <= now.Unix()-meshSeenTTL {
+				delete(meshSeen, key)
+			}
+		}
+	}
+}
+
+func (s *Server) handleGetRuleHistory(c *gin.Context) {
+	s.queryHistory(c, history.RuleKey(c.Param("id")))
+}
+
+func (s *Server) handleGetNodeHistory(c *gin.Context) {
+	s.queryHistory(c, history.NodeKey(c.Param("id")))
+}
+
+// queryHistory 支持的查询参数：
+//   - range: 最近一段时间，如 30m、6h、7d，默认 24h
+//   - from / to: Unix 秒，指定 from 时忽略 range，to 默认为当前时间
+//   - resolution: minute / hour / day，未指定时按时间范围自动选择
+func (s *Server) queryHistory(c *gin.Context, key string) {
+	from, to, resolution, ok := historyQuery(c)
+	if !ok {
+		return
+	}
+
+	points, err := s.history.Query(key, resolution, from, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: models.HistoryResult{
+		Resolution: resolution,
+		From:       from.Unix(),
+		To:         to.Unix(),
+		Points:     points,
+	}})
+}
+
+// historyQuery 解析历史查询的时间范围和粒度，参数错误时已写入响应
+func historyQuery(c *gin.Context) (from, to time.Time, resolution string, ok bool) {
+	to = time.Now()
+	if v := c.Query("to"); v != "" {
+		ts, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: "invalid to"})
+			return from, to, "", false
+		}
+		to = time.Unix(ts, 0)
+	}
+
+	if v := c.Query("from"); v != "" {
+		ts, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: "invalid from"})
+			return from, to, "", false
+		}
+		from = time.Unix(ts, 0)
+	} else {
+		span := defaultHistoryRange
+		if v := c.Query("range"); v != "" {
+			d, err := parseHistoryRange(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+				return from, to, "", false
+			}
+			span = d
+		}
+		from = to.Add(-span)
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: "from must be before to"})
+		return from, to, "", false
+	}
+
+	resolution = c.Query("resolution")
+	if resolution == "" {
+		resolution = autoResolution(to.Sub(from))
+	}
+	return from, to, resolution, true
+}
+
+// parseHistoryRange 在 time.ParseDuration 的基础上支持以天为单位，如 7d
+func parseHistoryRange(v string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(v)
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid range %q", v)
+	}
+	return d, nil
+}
+
+// autoResolution 按查询范围选择能覆盖该范围的最细粒度
+func autoResolution(span time.Duration) string {
+	switch {
+	case span <= 24*time.Hour:
+		return history.ResolutionMinute
+	case span <= 30*24*time.Hour:
+		return history.ResolutionHour
+	default:
+		return history.ResolutionDay
+	}
+}
+
+// deleteHistory 删除规则或节点时清理其历史数据
+func (s *Server) deleteHistory(keys ...string) {
+	for _, key := range keys {
+		s.history.Delete(key)
+	}
+}
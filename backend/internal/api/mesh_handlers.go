@@ -0,0 +1,132 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"port-forward-dashboard/internal/history"
+	"port-forward-dashboard/internal/models"
+)
+
+const (
+	// minMeshInterval / maxMeshInterval 探测间隔（秒）的范围
+	minMeshInterval = 5
+	maxMeshInterval = 3600
+	// maxMeshTimeout 单次探测超时（毫秒）的上限
+	maxMeshTimeout = 30000
+)
+
+// meshTargetIDPattern 目标 ID 会成为延迟历史的序列名和文件名，并以 "-" 分隔源和目标
+var meshTargetIDPattern = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+func (s *Server) handleGetMeshMatrix(c *gin.Context) {
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: s.nm.GetMeshMatrix()})
+}
+
+func (s *Server) handleGetMeshSettings(c *gin.Context) {
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: s.nm.GetMeshSettings()})
+}
+
+// handleUpdateMeshSettings 替换探测配置，未填 ID 的目标视为新增。被移除目标的历史一并删除
+func (s *Server) handleUpdateMeshSettings(c *gin.Context) {
+	var settings models.MeshSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: "Invalid request"})
+		return
+	}
+
+	if err := validateMeshSettings(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	kept := make(map[string]bool, len(settings.Targets))
+	for _, target := range settings.Targets {
+		kept[target.ID] = true
+	}
+	for _, target := range s.nm.GetMeshSettings().Targets {
+		if !kept[target.ID] {
+			s.deleteMeshHistory(target.ID)
+		}
+	}
+
+	s.nm.SetMeshSettings(settings)
+	s.cfg.Mesh = settings
+	s.cfg.Save()
+
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: settings})
+}
+
+func validateMeshSettings(settings *models.MeshSettings) error {
+	if settings.Interval != 0 && (settings.Interval < minMeshInterval || settings.Interval > maxMeshInterval) {
+		return fmt.Errorf("interval must be 0 (disabled) or between %d and %d seconds", minMeshInterval, maxMeshInterval)
+	}
+	if settings.Timeout < 0 || settings.Timeout > maxMeshTimeout {
+		return fmt.Errorf("timeout must be between 0 and %d ms", maxMeshTimeout)
+	}
+	if settings.Targets == nil {
+		settings.Targets = []models.MeshProbeTarget{}
+	}
+
+	seen := make(map[string]bool, len(settings.Targets))
+	for i := range settings.Targets {
+		target := &settings.Targets[i]
+		if target.Host == "" || target.Port < 1 || target.Port > 65535 {
+			return fmt.Errorf("target %d requires host and a valid port", i+1)
+		}
+		if target.ID == "" {
+			target.ID = generateID()
+		} else if !meshTargetIDPattern.MatchString(target.ID) {
+			return fmt.Errorf("target %d id must contain only letters and digits", i+1)
+		}
+		if seen[target.ID] {
+			return fmt.Errorf("duplicate target id %s", target.ID)
+		}
+		seen[target.ID] = true
+		if target.Name == "" {
+			target.Name = net.JoinHostPort(target.Host, strconv.Itoa(target.Port))
+		}
+	}
+	return nil
+}
+
+// handleGetMeshHistory 返回 source 节点到 target（节点或目标 ID）的延迟历史，时间参数与流量历史相同
+func (s *Server) handleGetMeshHistory(c *gin.Context) {
+	source, target := c.Query("source"), c.Query("target")
+	if source == "" || target == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: "source and target are required"})
+		return
+	}
+
+	from, to, resolution, ok := historyQuery(c)
+	if !ok {
+		return
+	}
+
+	points, err := s.meshHistory.Query(history.MeshKey(source, target), resolution, from, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: models.MeshHistoryResult{
+		Source:     source,
+		Target:     target,
+		Resolution: resolution,
+		From:       from.Unix(),
+		To:         to.Unix(),
+		Points:     points,
+	}})
+}
+
+// deleteMeshHistory 删除节点或目标时清理以它为源或目标的延迟历史
+func (s *Server) deleteMeshHistory(id string) {
+	s.meshHistory.DeleteMatching(func(key string) bool {
+		return history.MeshKeyInvolves(key, id)
+	})
+}
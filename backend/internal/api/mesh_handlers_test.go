@@ -0,0 +1,45 @@
+package api
+
+import (
+	"testing"
+
+	"port-forward-dashboard/internal/models"
+)
+
+func TestValidateMeshSettings(t *testing.T) {
+	target := func(id string) models.MeshProbeTarget {
+		return models.MeshProbeTarget{ID: id, Host: "example.com", Port: 443}
+	}
+	tests := []struct {
+		name     string
+		settings models.MeshSettings
+		wantErr  bool
+	}{
+		{"disabled", models.MeshSettings{}, false},
+		{"interval too short", models.MeshSettings{Interval: 1}, true},
+		{"timeout too long", models.MeshSettings{Interval: 10, Timeout: maxMeshTimeout + 1}, true},
+		{"valid target", models.MeshSettings{Interval: 10, Targets: []models.MeshProbeTarget{target("dns1")}}, false},
+		{"generated id", models.MeshSettings{Interval: 10, Targets: []models.MeshProbeTarget{target("")}}, false},
+		{"missing port", models.MeshSettings{Interval: 10, Targets: []models.MeshProbeTarget{{ID: "a", Host: "example.com"}}}, true},
+		{"duplicate id", models.MeshSettings{Interval: 10, Targets: []models.MeshProbeTarget{target("a"), target("a")}}, true},
+		{"path traversal", models.MeshSettings{Interval: 10, Targets: []models.MeshProbeTarget{target("../x")}}, true},
+		{"dash", models.MeshSettings{Interval: 10, Targets: []models.MeshProbeTarget{target("a-b")}}, true},
+		{"non ascii", models.MeshSettings{Interval: 10, Targets: []models.MeshProbeTarget{target("目标")}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateMeshSettings(&tt.settings)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateMeshSettings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			for _, target := range tt.settings.Targets {
+				if !meshTargetIDPattern.MatchString(target.ID) || target.Name == "" {
+					t.Errorf("target not normalized: %+v", target)
+				}
+			}
+		})
+	}
+}
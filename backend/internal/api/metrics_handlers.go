@@ -0,0 +1,244 @@
+package api
+
+import (
+	"crypto/subtle"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"port-forward-dashboard/internal/metrics"
+	"port-forward-dashboard/internal/models"
+)
+
+// metricsAuth 校验 /metrics 的访问权限，与面板登录的 JWT 相互独立：
+// Bearer 令牌等于 metrics_token，或来源地址在 metrics_allow 内
+func metricsAuth(token string, allow []*net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token != "" {
+			if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok &&
+				subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1 {
+				c.Next()
+				return
+			}
+		}
+		if ip := net.ParseIP(c.RemoteIP()); ip != nil {
+			for _, n := range allow {
+				if n.Contains(ip) {
+					c.Next()
+					return
+				}
+			}
+		}
+		c.AbortWithStatus(http.StatusUnauthorized)
+	}
+}
+
+// setupMetrics 在配置了令牌或地址白名单时注册 /metrics
+func (s *Server) setupMetrics() {
+	allow, err := metrics.ParseAllowList(s.cfg.MetricsAllow)
+	if err != nil {
+		log.Printf("Invalid metrics_allow, /metrics disabled: %v", err)
+		return
+	}
+	if s.cfg.MetricsToken == "" && len(allow) == 0 {
+		return
+	}
+	s.router.GET("/metrics", metricsAuth(s.cfg.MetricsToken, allow), s.handleMetrics)
+}
+
+func (s *Server) handleMetrics(c *gin.Context) {
+	w := &metrics.Writer{}
+
+	localStatus := s.fm.GetAllStatus()
+	nodeRules := s.nm.GetAllRules()
+	nodes := s.nm.GetAllNodes()
+
+	w.Header("portforward_rules", metrics.Gauge, "Number of configured forwarding rules.")
+	w.Sample("portforward_rules", float64(len(localStatus)), "type", "local")
+	w.Sample("portforward_rules", float64(len(nodeRules)), "type", "node")
+
+	online := 0
+	for _, n := range nodes {
+		if n.Online {
+			online++
+		}
+	}
+	w.Single("portforward_nodes", metrics.Gauge, "Number of registered nodes.", float64(len(nodes)))
+	w.Single("portforward_nodes_online", metrics.Gauge, "Number of nodes currently online.", float64(online))
+
+	writeNodeMetrics(w, nodes)
+	localTimings := make(map[string]models.ConnTimings, len(localStatus))
+	for _, st := range localStatus {
+		if t, err := s.fm.GetTimings(st.Rule.ID); err == nil {
+			localTimings[st.Rule.ID] = t
+		}
+	}
+	writeRuleMetrics(w, localStatus, localTimings, nodeRules, nodes, s.nm.GetRuleTotals())
+	metrics.WriteRuntime(w)
+
+	c.Data(http.StatusOK, metrics.ContentType, w.Bytes())
+}
+
+func writeNodeMetrics(w *metrics.Writer, nodes []models.NodeWithStatus) {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	// 离线节点只输出在线状态和距上次心跳的时间，其余数值是最后一次上报的旧值
+	gauges := []struct {
+		name, help string
+		onlineOnly bool
+		value      func(n models.NodeWithStatus) float64
+	}{
+		{"portforward_node_online", "Whether the node is online (1) or offline (0).", false, func(n models.NodeWithStatus) float64 { return metrics.Bool(n.Online) }},
+		{"portforward_node_last_heartbeat_age_seconds", "Seconds since the last heartbeat, -1 if none was received.", false, func(n models.NodeWithStatus) float64 { return float64(n.LastHeartbeatAge) }},
+		{"portforward_node_cpu_percent", "CPU usage reported by the node agent.", true, func(n models.NodeWithStatus) float64 { return n.CPUPercent }},
+		{"portforward_node_memory_percent", "Memory usage reported by the node agent.", true, func(n models.NodeWithStatus) float64 { return n.MemPercent }},
+		{"portforward_node_network_receive_bytes_per_second", "Inbound rate of the selected network interfaces on the node.", true, func(n models.NodeWithStatus) float64 { return n.NetRateIn }},
+		{"portforward_node_network_transmit_bytes_per_second", "Outbound rate of the selected network interfaces on the node.", true, func(n models.NodeWithStatus) float64 { return n.NetRateOut }},
+		{"portforward_node_disk_percent", "Disk usage of the filesystem monitored by the node agent.", true, func(n models.NodeWithStatus) float64 { return n.DiskPercent }},
+		{"portforward_node_load1", "1-minute load average of the node.", true, func(n models.NodeWithStatus) float64 { return n.Load1 }},
+		{"portforward_node_load5", "5-minute load average of the node.", true, func(n models.NodeWithStatus) float64 { return n.Load5 }},
+		{"portforward_node_load15", "15-minute load average of the node.", true, func(n models.NodeWithStatus) float64 { return n.Load15 }},
+		{"portforward_node_agent_open_fds", "Open file descriptors of the node agent process.", true, func(n models.NodeWithStatus) float64 { return float64(n.OpenFDs) }},
+		{"portforward_node_agent_max_fds", "File descriptor limit of the node agent process.", true, func(n models.NodeWithStatus) float64 { return float64(n.MaxFDs) }},
+		{"portforward_node_active_tunnels", "Number of running tunnels on the node.", true, func(n models.NodeWithStatus) float64 { return float64(n.ActiveTunnels) }},
+	}
+	for _, g := range gauges {
+		w.Header(g.name, metrics.Gauge, g.help)
+		for _, n := range nodes {
+			if g.onlineOnly && !n.Online {
+				continue
+			}
+			w.Sample(g.name, g.value(n), "node_id", n.ID, "node", n.Name)
+		}
+	}
+}
+
+// ruleSample 是一条规则的指标，本地规则的 node_id 为空
+type ruleSample struct {
+	labels      []string
+	running     bool
+	bytesIn     int64
+	bytesOut    int64
+	rateIn      float64
+	rateOut     float64
+	connections int
+	latency     int64
+	timings     *models.ConnTimings
+}
+
+func writeRuleMetrics(w *metrics.Writer, local []models.TunnelStatus, localTimings map[string]models.ConnTimings, nodeRules []models.NodeRule, nodes []models.NodeWithStatus, totals map[string]models.TrafficStats) {
+	var samples []ruleSample
+	sort.Slice(local, func(i, j int) bool { return local[i].Rule.ID < local[j].Rule.ID })
+	for _, st := range local {
+		var timings *models.ConnTimings
+		if t, ok := localTimings[st.Rule.ID]; ok {
+			timings = &t
+		}
+		samples = append(samples, ruleSample{
+			labels:      []string{"rule_id", st.Rule.ID, "rule", st.Rule.Name, "type", "local", "node_id", ""},
+			running:     st.Running,
+			bytesIn:     st.Traffic.TotalIn,
+			bytesOut:    st.Traffic.TotalOut,
+			rateIn:      st.Traffic.BytesInRate,
+			rateOut:     st.Traffic.BytesOutRate,
+			connections: int(st.Traffic.ConnCount),
+			latency:     st.Latency.Latency,
+			timings:     timings,
+		})
+	}
+
+	// 节点规则的实时数据来自在线节点最近一次上报；累计字节数取主控维护的单调计数，
+	// 节点离线时保持不变，避免 Prometheus 误判为计数器重置
+	tunnels := make(map[string]models.NodeTunnelStatus)
+	for _, n := range nodes {
+		if !n.Online {
+			continue
+		}
+		for _, t := range n.Tunnels {
+			tunnels[t.ID] = t
+		}
+	}
+	sort.Slice(nodeRules, func(i, j int) bool { return nodeRules[i].ID < nodeRules[j].ID })
+	for _, rule := range nodeRules {
+		sample := ruleSample{
+			labels:   []string{"rule_id", rule.ID, "rule", rule.Name, "type", "node", "node_id", rule.NodeID},
+			bytesIn:  totals[rule.ID].TotalIn,
+			bytesOut: totals[rule.ID].TotalOut,
+			latency:  -1,
+		}
+		if t, ok := tunnels[rule.ID]; ok {
+			sample.running = t.Running
+			sample.rateIn, sample.rateOut = t.RateIn, t.RateOut
+			sample.connections = t.Connections
+			sample.latency = t.Latency
+			sample.timings = t.Timings
+		}
+		samples = append(samples, sample)
+	}
+
+	series := []struct {
+		name, typ, help string
+		value           func(r ruleSample) float64
+	}{
+		{"portforward_rule_running", metrics.Gauge, "Whether the rule's tunnel is running.", func(r ruleSample) float64 { return metrics.Bool(r.running) }},
+		{"portforward_rule_received_bytes_total", metrics.Counter, "Bytes received from targets and sent back to clients.", func(r ruleSample) float64 { return float64(r.bytesIn) }},
+		{"portforward_rule_sent_bytes_total", metrics.Counter, "Bytes received from clients and sent to targets.", func(r ruleSample) float64 { return float64(r.bytesOut) }},
+		{"portforward_rule_receive_rate_bytes", metrics.Gauge, "Current inbound rate in bytes per second.", func(r ruleSample) float64 { return r.rateIn }},
+		{"portforward_rule_send_rate_bytes", metrics.Gauge, "Current outbound rate in bytes per second.", func(r ruleSample) float64 { return r.rateOut }},
+		{"portforward_rule_connections", metrics.Gauge, "Number of active connections.", func(r ruleSample) float64 { return float64(r.connections) }},
+		{"portforward_rule_latency_milliseconds", metrics.Gauge, "Health check latency to the target, -1 if the check failed.", func(r ruleSample) float64 { return float64(r.latency) }},
+	}
+	for _, m := range series {
+		w.Header(m.name, m.typ, m.help)
+		for _, r := range samples {
+			w.Sample(m.name, m.value(r), r.labels...)
+		}
+	}
+
+	writeTimingMetrics(w, samples)
+}
+
+// writeTimingMetrics 输出连接耗时直方图和按原因分类的连接失败次数，离线节点上的规则不输出
+func writeTimingMetrics(w *metrics.Writer, samples []ruleSample) {
+	histograms := []struct {
+		name, help string
+		value      func(t *models.ConnTimings) models.Histogram
+	}{
+		{"portforward_rule_dial_duration_seconds", "Time taken to connect to the target for each client connection.", func(t *models.ConnTimings) models.Histogram { return t.Dial }},
+		{"portforward_rule_first_byte_seconds", "Time from connecting to the target to its first byte.", func(t *models.ConnTimings) models.Histogram { return t.FirstByte }},
+	}
+	for _, m := range histograms {
+		w.Header(m.name, metrics.Histogram, m.help)
+		for _, r := range samples {
+			if r.timings == nil {
+				continue
+			}
+			h := m.value(r.timings)
+			bounds := make([]float64, len(h.Bounds))
+			for i, b := range h.Bounds {
+				bounds[i] = b / 1000
+			}
+			w.Buckets(m.name, bounds, h.Counts, h.Sum/1000, r.labels...)
+		}
+	}
+
+	const dialErrors = "portforward_rule_dial_errors_total"
+	w.Header(dialErrors, metrics.Counter, "Failed attempts to connect to the target by cause.")
+	for _, r := range samples {
+		if r.timings == nil {
+			continue
+		}
+		classes := make([]string, 0, len(r.timings.DialErrors))
+		for class := range r.timings.DialErrors {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			w.Sample(dialErrors, float64(r.timings.DialErrors[class]), append(r.labels[:len(r.labels):len(r.labels)], "class", class)...)
+		}
+	}
+}
@@ -1,14 +1,24 @@
 package api
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"port-forward-common/signing"
+	"port-forward-dashboard/internal/audit"
+	"port-forward-dashboard/internal/history"
 	"port-forward-dashboard/internal/models"
+	"port-forward-dashboard/internal/node"
 )
 
+// maxHeartbeatSize 心跳请求体的大小上限
+const maxHeartbeatSize = 1 << 20
+
 func (s *Server) handleGetNodes(c *gin.Context) {
 	nodes := s.nm.GetAllNodes()
 	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: nodes})
@@ -58,26 +68,86 @@ func (s *Server) handleUpdateNode(c *gin.Context) {
 func (s *Server) handleDeleteNode(c *gin.Context) {
 	id := c.Param("id")
 
+	// 节点删除时其规则一并删除，先记下规则以清理历史数据
+	keys := []string{history.NodeKey(id)}
+	for _, rule := range s.nm.GetRulesByNode(id) {
+		keys = append(keys, history.RuleKey(rule.ID))
+	}
+
 	if err := s.nm.DeleteNode(id); err != nil {
 		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
 		return
 	}
+	s.deleteHistory(keys...)
+	s.deleteMeshHistory(id)
 
 	s.saveNodeConfig()
+	s.recordAudit(c, audit.Entry{Action: auditNodeDelete, Target: id, Result: audit.ResultSuccess})
 
 	c.JSON(http.StatusOK, models.APIResponse{Success: true, Message: "Node deleted"})
 }
 
-func (s *Server) handleGetNodeRules(c *gin.Context) {
-	nodeID := c.Query("node_id")
-	var rules []models.NodeRule
+func (s *Server) handleResyncNode(c *gin.Context) {
+	id := c.Param("id")
 
-	if nodeID != "" {
-		rules = s.nm.GetRulesByNode(nodeID)
-	} else {
-		rules = s.nm.GetAllRules()
+	result, err := s.nm.ResyncNode(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
 	}
 
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: result})
+}
+
+func (s *Server) handleRotateNodeKey(c *gin.Context) {
+	id := c.Param("id")
+
+	var req struct {
+		GraceSeconds int `json:"grace_seconds"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: "Invalid request"})
+			return
+		}
+	}
+
+	node, err := s.nm.RotateKey(id, time.Duration(req.GraceSeconds)*time.Second)
+	if err != nil {
+		// 失败时新密钥可能仍处于待确认状态，同样需要保存
+		s.saveNodeConfig()
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	s.saveNodeConfig()
+
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Message: "Key rotated", Data: node})
+}
+
+func (s *Server) handleRenewNodeCert(c *gin.Context) {
+	node, err := s.nm.RenewCert(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	s.saveNodeConfig()
+
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Message: "Certificate renewed", Data: node})
+}
+
+func (s *Server) handleGetNodeKeyHistory(c *gin.Context) {
+	history, err := s.nm.GetKeyHistory(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: history})
+}
+
+func (s *Server) handleGetNodeRules(c *gin.Context) {
+	rules := s.nm.GetRulesWithSync(c.Query("node_id"))
 	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: rules})
 }
 
@@ -128,6 +198,7 @@ func (s *Server) handleDeleteNodeRule(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
 		return
 	}
+	s.deleteHistory(history.RuleKey(id))
 
 	s.saveNodeConfig()
 
@@ -155,22 +226,98 @@ func (s *Server) handleToggleNodeRule(c *gin.Context) {
 	c.JSON(http.StatusOK, models.APIResponse{Success: true})
 }
 
+// handleNodeDiagnostics 代理到节点 Agent 执行诊断，只允许内置的诊断类型
+func (s *Server) handleNodeDiagnostics(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.DiagnosticRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: "Invalid request"})
+		return
+	}
+
+	result, err := s.nm.RunDiagnostic(id, req)
+	s.recordAudit(c, audit.Entry{
+		Action: auditNodeDiagnostics,
+		Target: id,
+		Result: auditResult(err),
+		Detail: diagnosticDetail(req, err),
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: result})
+}
+
+func diagnosticDetail(req models.DiagnosticRequest, err error) string {
+	detail := req.Type
+	if req.TunnelID != "" {
+		detail += " tunnel=" + req.TunnelID
+	}
+	if req.Target != "" {
+		detail += " target=" + req.Target
+	}
+	if req.Port != 0 {
+		detail += " port=" + strconv.Itoa(req.Port)
+	}
+	if err != nil {
+		detail += ": " + err.Error()
+	}
+	return detail
+}
+
 func (s *Server) handleNodeHeartbeat(c *gin.Context) {
-	var status models.NodeStatus
-	if err := c.ShouldBindJSON(&status); err != nil {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxHeartbeatSize))
+	if err != nil {
 		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: "Invalid request"})
 		return
 	}
 
-	s.nm.HandleHeartbeat(status)
+	keyRotated, err := s.nm.HandleHeartbeat(heartbeatAuth(c), body)
+	if err != nil {
+		status := http.StatusBadRequest
+		if isSignatureError(err) {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	if keyRotated {
+		s.saveNodeConfig()
+	}
 
 	c.JSON(http.StatusOK, models.APIResponse{Success: true})
 }
 
+// heartbeatAuth 从请求头读取 Agent 的签名信息
+func heartbeatAuth(c *gin.Context) node.HeartbeatAuth {
+	return node.HeartbeatAuth{
+		KeyID:      c.GetHeader(signing.HeaderKeyID),
+		Timestamp:  c.GetHeader(signing.HeaderTimestamp),
+		Nonce:      c.GetHeader(signing.HeaderNonce),
+		Signature:  c.GetHeader(signing.HeaderSignature),
+		RemoteAddr: c.ClientIP(),
+	}
+}
+
+// isSignatureError 判断是否是 Agent 请求签名校验失败
+func isSignatureError(err error) bool {
+	return errors.Is(err, node.ErrMissingAuth) || errors.Is(err, node.ErrUnknownKey) ||
+		errors.Is(err, node.ErrBadSignature) || errors.Is(err, node.ErrStaleTimestamp) ||
+		errors.Is(err, node.ErrReplay)
+}
+
+func (s *Server) handleHeartbeatAuthStats(c *gin.Context) {
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: s.nm.GetHeartbeatAuthStats()})
+}
+
 func (s *Server) saveNodeConfig() {
 	nodes := s.nm.GetNodesForSave()
 	rules := s.nm.GetAllRules()
 	s.cfg.Nodes = nodes
 	s.cfg.NodeRules = rules
+	s.cfg.EnrollTokens = s.nm.GetEnrollTokensForSave()
 	s.cfg.Save()
 }
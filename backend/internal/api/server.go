@@ -9,8 +9,12 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/websocket"
 
+	"port-forward-dashboard/internal/agentdist"
+	"port-forward-dashboard/internal/alert"
+	"port-forward-dashboard/internal/audit"
 	"port-forward-dashboard/internal/config"
 	"port-forward-dashboard/internal/forwarder"
+	"port-forward-dashboard/internal/history"
 	"port-forward-dashboard/internal/models"
 	"port-forward-dashboard/internal/monitor"
 	"port-forward-dashboard/internal/node"
@@ -20,26 +24,42 @@ type Server struct {
 	cfg     *config.Config
 	fm      *forwarder.Manager
 	nm      *node.Manager
+	agents  *agentdist.Store
+	audit   *audit.Log
+	history *history.Store
+	alerts  *alert.Engine
 	router  *gin.Engine
 	monitor *monitor.SystemMonitor
 	hub     *WSHub
+
+	// meshHistory 是节点间延迟探测的历史
+	meshHistory *history.LatencyStore
 }
 
-func NewServer(cfg *config.Config, fm *forwarder.Manager, nm *node.Manager) *Server {
+func NewServer(cfg *config.Config, fm *forwarder.Manager, nm *node.Manager, agents *agentdist.Store, auditLog *audit.Log, historyStore *history.Store, meshHistory *history.LatencyStore, alerts *alert.Engine) *Server {
 	gin.SetMode(gin.ReleaseMode)
 
 	s := &Server{
 		cfg:     cfg,
 		fm:      fm,
 		nm:      nm,
+		agents:  agents,
+		audit:   auditLog,
+		history: historyStore,
+		alerts:  alerts,
 		router:  gin.New(),
 		monitor: monitor.NewSystemMonitor(),
 		hub:     NewWSHub(),
+
+		meshHistory: meshHistory,
 	}
 
 	s.setupRoutes()
+	s.setupMetrics()
 	go s.hub.Run()
 	go s.broadcastLoop()
+	go s.historyLoop()
+	go s.alerts.Run(s.alertSnapshot)
 
 	return s
 }
@@ -68,6 +88,12 @@ func (s *Server) setupRoutes() {
 			auth.PUT("/rules/:id", s.handleUpdateRule)
 			auth.DELETE("/rules/:id", s.handleDeleteRule)
 			auth.POST("/rules/:id/toggle", s.handleToggleRule)
+			auth.GET("/rules/:id/connections", s.handleGetRuleConnections)
+			auth.DELETE("/rules/:id/connections", s.handleCloseRuleConnections)
+			auth.DELETE("/rules/:id/connections/:conn_id", s.handleCloseRuleConnection)
+			auth.GET("/rules/:id/timings", s.handleGetRuleTimings)
+			auth.GET("/rules/:id/access-log", s.handleGetRuleAccessLog)
+			auth.GET("/rules/:id/history", s.handleGetRuleHistory)
 			auth.GET("/system", s.handleSystemStats)
 
 			// 节点管理
@@ -75,6 +101,24 @@ func (s *Server) setupRoutes() {
 			auth.POST("/nodes", s.handleCreateNode)
 			auth.PUT("/nodes/:id", s.handleUpdateNode)
 			auth.DELETE("/nodes/:id", s.handleDeleteNode)
+			auth.GET("/nodes/auth-failures", s.handleHeartbeatAuthStats)
+			auth.POST("/nodes/:id/resync", s.handleResyncNode)
+			auth.POST("/nodes/:id/update", s.handleUpdateNodeAgent)
+			auth.POST("/nodes/:id/rotate-key", s.handleRotateNodeKey)
+			auth.GET("/nodes/:id/key-history", s.handleGetNodeKeyHistory)
+			auth.POST("/nodes/:id/renew-cert", s.handleRenewNodeCert)
+			auth.POST("/nodes/:id/diagnostics", s.handleNodeDiagnostics)
+			auth.GET("/nodes/:id/access-log", s.handleGetNodeAccessLog)
+			auth.GET("/nodes/:id/history", s.handleGetNodeHistory)
+			auth.GET("/nodes/:id/usage", s.handleGetNodeUsage)
+			auth.POST("/nodes/:id/uninstall", s.handleRequestUninstall)
+			auth.POST("/nodes/:id/uninstall/confirm", s.handleConfirmUninstall)
+			auth.GET("/agent/releases", s.handleAgentReleases)
+
+			// 节点注册令牌
+			auth.GET("/nodes/enroll-tokens", s.handleListEnrollTokens)
+			auth.POST("/nodes/enroll-tokens", s.handleCreateEnrollToken)
+			auth.DELETE("/nodes/enroll-tokens/:id", s.handleRevokeEnrollToken)
 
 			// 节点规则管理
 			auth.GET("/node-rules", s.handleGetNodeRules)
@@ -82,6 +126,35 @@ func (s *Server) setupRoutes() {
 			auth.PUT("/node-rules/:id", s.handleUpdateNodeRule)
 			auth.DELETE("/node-rules/:id", s.handleDeleteNodeRule)
 			auth.POST("/node-rules/:id/toggle", s.handleToggleNodeRule)
+			auth.GET("/node-rules/:id/usage", s.handleGetNodeRuleUsage)
+			auth.GET("/node-rules/:id/timings", s.handleGetNodeRuleTimings)
+			auth.GET("/node-rules/:id/connections", s.handleGetNodeRuleConnections)
+			auth.DELETE("/node-rules/:id/connections", s.handleCloseNodeRuleConnections)
+			auth.DELETE("/node-rules/:id/connections/:conn_id", s.handleCloseNodeRuleConnection)
+
+			// 告警
+			auth.GET("/alerts", s.handleGetAlerts)
+			auth.GET("/alerts/rules", s.handleGetAlertRules)
+			auth.POST("/alerts/rules", s.handleCreateAlertRule)
+			auth.PUT("/alerts/rules/:id", s.handleUpdateAlertRule)
+			auth.DELETE("/alerts/rules/:id", s.handleDeleteAlertRule)
+			auth.GET("/alerts/channels", s.handleGetAlertChannels)
+			auth.POST("/alerts/channels", s.handleCreateAlertChannel)
+			auth.PUT("/alerts/channels/:id", s.handleUpdateAlertChannel)
+			auth.DELETE("/alerts/channels/:id", s.handleDeleteAlertChannel)
+			auth.POST("/alerts/channels/:id/test", s.handleTestAlertChannel)
+			auth.GET("/alerts/silences", s.handleGetAlertSilences)
+			auth.POST("/alerts/silences", s.handleCreateAlertSilence)
+			auth.DELETE("/alerts/silences/:id", s.handleDeleteAlertSilence)
+
+			// 节点间延迟矩阵
+			auth.GET("/mesh", s.handleGetMeshMatrix)
+			auth.GET("/mesh/settings", s.handleGetMeshSettings)
+			auth.PUT("/mesh/settings", s.handleUpdateMeshSettings)
+			auth.GET("/mesh/history", s.handleGetMeshHistory)
+
+			// 审计日志
+			auth.GET("/audit", s.handleGetAuditLog)
 
 			// 修改密码
 			auth.POST("/change-password", s.handleChangePassword)
@@ -90,6 +163,12 @@ func (s *Server) setupRoutes() {
 		// 节点心跳（不需要JWT认证，使用节点Key认证）
 		api.POST("/nodes/heartbeat", s.handleNodeHeartbeat)
 
+		// Agent 卸载结果回报（与心跳相同的签名认证）
+		api.POST("/nodes/uninstall-report", s.handleUninstallReport)
+
+		// 节点注册（使用一次性注册令牌认证）
+		api.POST("/nodes/enroll", s.handleEnrollNode)
+
 		// WebSocket（自己验证token）
 		api.GET("/ws", s.handleWebSocket)
 
@@ -99,6 +178,10 @@ func (s *Server) setupRoutes() {
 
 	// 公开的安装脚本下载（不需要认证）
 	s.router.GET("/api/install.sh", s.handleDownloadAgent)
+
+	// Agent 二进制与校验和（不需要认证，完整性由校验和与签名保证）
+	s.router.GET("/api/agent/download", s.handleAgentDownload)
+	s.router.GET("/api/agent/checksums", s.handleAgentChecksums)
 }
 
 func (s *Server) Run() error {
@@ -209,6 +292,7 @@ func (s *Server) handleDeleteRule(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
 		return
 	}
+	s.deleteHistory(history.RuleKey(id))
 
 	config.Save(s.cfg, s.fm.GetAllRules())
 
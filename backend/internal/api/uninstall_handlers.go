@@ -0,0 +1,101 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"port-forward-common/signing"
+	"port-forward-dashboard/internal/audit"
+	"port-forward-dashboard/internal/models"
+	"port-forward-dashboard/internal/node"
+)
+
+// maxUninstallReportSize 卸载回报请求体的大小上限
+const maxUninstallReportSize = 64 << 10
+
+// handleRequestUninstall 是卸载的第一步，返回需要在有效期内提交的确认令牌
+func (s *Server) handleRequestUninstall(c *gin.Context) {
+	id := c.Param("id")
+
+	confirmation, err := s.nm.RequestUninstall(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	s.recordAudit(c, audit.Entry{Action: auditUninstallRequest, Target: id, Result: audit.ResultPending})
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: confirmation})
+}
+
+// handleConfirmUninstall 校验确认令牌后向节点下发签名的卸载指令，执行结果由 Agent 回报
+func (s *Server) handleConfirmUninstall(c *gin.Context) {
+	id := c.Param("id")
+
+	var req struct {
+		ConfirmToken string `json:"confirm_token"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.ConfirmToken == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: "Invalid request"})
+		return
+	}
+
+	sign := func(data []byte) string { return s.agents.Sign(signing.PurposeCommand, data) }
+	if err := s.nm.ConfirmUninstall(id, req.ConfirmToken, sign); err != nil {
+		s.recordAudit(c, audit.Entry{Action: auditUninstallConfirm, Target: id, Result: audit.ResultFailure, Detail: err.Error()})
+		status := http.StatusBadGateway
+		if errors.Is(err, node.ErrInvalidConfirmation) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	s.recordAudit(c, audit.Entry{Action: auditUninstallConfirm, Target: id, Result: audit.ResultSuccess, Detail: "uninstall command accepted by agent"})
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Message: "Uninstall command sent"})
+}
+
+// handleUninstallReport 接收 Agent 卸载后的结果回报
+func (s *Server) handleUninstallReport(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxUninstallReportSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Message: "Invalid request"})
+		return
+	}
+
+	reporter, report, err := s.nm.HandleUninstallReport(heartbeatAuth(c), body)
+	if err != nil {
+		if isSignatureError(err) {
+			c.JSON(http.StatusUnauthorized, models.APIResponse{Success: false, Message: err.Error()})
+			return
+		}
+		// 签名有效但没有对应的卸载指令，同样留下记录
+		s.recordAudit(c, audit.Entry{
+			Actor:  agentActor(reporter.ID),
+			Action: auditUninstallReport,
+			Target: reporter.ID,
+			Result: audit.ResultFailure,
+			Detail: err.Error(),
+		})
+		c.JSON(http.StatusConflict, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	result := audit.ResultSuccess
+	if !report.Success {
+		result = audit.ResultFailure
+	}
+	s.recordAudit(c, audit.Entry{
+		Actor:  agentActor(reporter.ID),
+		Action: auditUninstallReport,
+		Target: reporter.ID,
+		Result: result,
+		Detail: report.Message,
+	})
+	log.Printf("Node %s (%s) reported uninstall result: success=%v %s", reporter.Name, reporter.ID, report.Success, report.Message)
+
+	c.JSON(http.StatusOK, models.APIResponse{Success: true})
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"port-forward-common/signing"
+	"port-forward-dashboard/internal/agentdist"
+	"port-forward-dashboard/internal/audit"
+	"port-forward-dashboard/internal/models"
+	"port-forward-dashboard/internal/node"
+	"port-forward-dashboard/internal/pki"
+)
+
+const uninstallNodeKey = "node-key"
+
+// uninstallAgent 模拟 Agent 的 /uninstall，校验主控签名并记下收到的指令
+type uninstallAgent struct {
+	pub    ed25519.PublicKey
+	reject string
+	cmds   []models.UninstallCommand
+}
+
+func (a *uninstallAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var signed models.SignedCommand
+	json.NewDecoder(r.Body).Decode(&signed)
+	payload, _ := base64.StdEncoding.DecodeString(signed.Payload)
+
+	message := a.reject
+	if !signing.Verify(a.pub, signing.PurposeCommand, payload, signed.Signature) {
+		message = "invalid command signature"
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(models.APIResponse{Success: false, Message: message})
+		return
+	}
+
+	var cmd models.UninstallCommand
+	json.Unmarshal(payload, &cmd)
+	a.cmds = append(a.cmds, cmd)
+	json.NewEncoder(w).Encode(models.APIResponse{Success: true})
+}
+
+func newUninstallServer(t *testing.T, agent *uninstallAgent) (*Server, *gin.Engine) {
+	t.Helper()
+	dir := t.TempDir()
+
+	ca, err := pki.Load("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nm, err := node.NewManager(ca, filepath.Join(dir, "counters.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	agents, err := agentdist.NewStore(dir, filepath.Join(dir, "signing.key"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog, err := audit.Open(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, _ := base64.StdEncoding.DecodeString(agents.PublicKey())
+	agent.pub = pub
+	srv := httptest.NewServer(agent)
+	t.Cleanup(srv.Close)
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	if err := nm.AddNode(models.Node{ID: "n1", Name: "edge", Host: host, Port: portNum, Key: uninstallNodeKey}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{nm: nm, agents: agents, audit: auditLog}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	admin := router.Group("/api", func(c *gin.Context) { c.Set("username", "admin") })
+	admin.POST("/nodes/:id/uninstall", s.handleRequestUninstall)
+	admin.POST("/nodes/:id/uninstall/confirm", s.handleConfirmUninstall)
+	router.POST("/api/nodes/uninstall-report", s.handleUninstallReport)
+	return s, router
+}
+
+func serveJSON(router *gin.Engine, path string, body interface{}, header http.Header) (int, models.APIResponse) {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp models.APIResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func requestUninstallToken(t *testing.T, router *gin.Engine) string {
+	t.Helper()
+	confirmation := models.UninstallConfirmation{}
+	code, resp := serveJSON(router, "/api/nodes/n1/uninstall", nil, nil)
+	data, _ := json.Marshal(resp.Data)
+	json.Unmarshal(data, &confirmation)
+	if code != http.StatusOK || confirmation.ConfirmToken == "" {
+		t.Fatalf("request uninstall: status = %d, %+v", code, resp)
+	}
+	return confirmation.ConfirmToken
+}
+
+// signedReport 按 Agent 的方式对卸载回报签名
+func signedReport(key string, report models.UninstallReport) (models.UninstallReport, http.Header) {
+	body, _ := json.Marshal(report)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := "report-" + report.Nonce
+	header := http.Header{}
+	header.Set(signing.HeaderKeyID, signing.KeyID(key))
+	header.Set(signing.HeaderTimestamp, ts)
+	header.Set(signing.HeaderNonce, nonce)
+	header.Set(signing.HeaderSignature, signing.SignHeartbeat(key, ts, nonce, body))
+	return report, header
+}
+
+type auditWant struct {
+	actor, action, result, detail string
+}
+
+func assertAudit(t *testing.T, log *audit.Log, want []auditWant) {
+	t.Helper()
+	entries, err := log.List(0, "", "n1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("audit entries = %+v, want %d", entries, len(want))
+	}
+	// List 按时间倒序返回
+	for i, w := range want {
+		e := entries[len(entries)-1-i]
+		if e.Actor != w.actor || e.Action != w.action || e.Result != w.result || !strings.Contains(e.Detail, w.detail) {
+			t.Errorf("audit entry %d = %+v, want %+v", i, e, w)
+		}
+	}
+}
+
+func TestUninstallAuditTrail(t *testing.T) {
+	agent := &uninstallAgent{}
+	s, router := newUninstallServer(t, agent)
+
+	// 没有申请确认令牌或令牌错误时不会下发指令
+	if code, _ := serveJSON(router, "/api/nodes/n1/uninstall/confirm", map[string]string{"confirm_token": "guess"}, nil); code != http.StatusForbidden {
+		t.Errorf("confirm without request: status = %d, want 403", code)
+	}
+	requestUninstallToken(t, router)
+	if code, _ := serveJSON(router, "/api/nodes/n1/uninstall/confirm", map[string]string{"confirm_token": "wrong"}, nil); code != http.StatusForbidden {
+		t.Errorf("confirm with wrong token: status = %d, want 403", code)
+	}
+	if len(agent.cmds) != 0 {
+		t.Fatal("command sent without a valid confirmation")
+	}
+
+	token := requestUninstallToken(t, router)
+	if code, resp := serveJSON(router, "/api/nodes/n1/uninstall/confirm", map[string]string{"confirm_token": token}, nil); code != http.StatusOK {
+		t.Fatalf("confirm: status = %d, %+v", code, resp)
+	}
+	if len(agent.cmds) != 1 {
+		t.Fatalf("agent received %d commands, want 1", len(agent.cmds))
+	}
+	cmd := agent.cmds[0]
+	if cmd.Action != models.CommandUninstall || cmd.NodeID != "n1" || cmd.KeyID != signing.KeyID(uninstallNodeKey) || cmd.ExpiresAt <= cmd.IssuedAt {
+		t.Errorf("command = %+v", cmd)
+	}
+
+	// 其他 nonce 的回报不会被当作本次卸载的结果
+	report, header := signedReport(uninstallNodeKey, models.UninstallReport{Nonce: "other", Success: true})
+	if code, _ := serveJSON(router, "/api/nodes/uninstall-report", report, header); code != http.StatusConflict {
+		t.Errorf("unexpected report: status = %d, want 409", code)
+	}
+	// 签名无效的回报直接拒绝，不写审计
+	report, header = signedReport("wrong-key", models.UninstallReport{Nonce: cmd.Nonce, Success: true})
+	if code, _ := serveJSON(router, "/api/nodes/uninstall-report", report, header); code != http.StatusUnauthorized {
+		t.Errorf("forged report: status = %d, want 401", code)
+	}
+	report, header = signedReport(uninstallNodeKey, models.UninstallReport{Nonce: cmd.Nonce, Success: true, Message: "removed"})
+	if code, resp := serveJSON(router, "/api/nodes/uninstall-report", report, header); code != http.StatusOK {
+		t.Errorf("report: status = %d, %+v", code, resp)
+	}
+
+	assertAudit(t, s.audit, []auditWant{
+		{"admin", auditUninstallConfirm, audit.ResultFailure, node.ErrInvalidConfirmation.Error()},
+		{"admin", auditUninstallRequest, audit.ResultPending, ""},
+		{"admin", auditUninstallConfirm, audit.ResultFailure, node.ErrInvalidConfirmation.Error()},
+		{"admin", auditUninstallRequest, audit.ResultPending, ""},
+		{"admin", auditUninstallConfirm, audit.ResultSuccess, "accepted"},
+		{"agent:n1", auditUninstallReport, audit.ResultFailure, node.ErrUnexpectedReport.Error()},
+		{"agent:n1", auditUninstallReport, audit.ResultSuccess, "removed"},
+	})
+}
+
+func TestUninstallRejectedByAgent(t *testing.T) {
+	agent := &uninstallAgent{reject: "command expired"}
+	s, router := newUninstallServer(t, agent)
+
+	token := requestUninstallToken(t, router)
+	if code, _ := serveJSON(router, "/api/nodes/n1/uninstall/confirm", map[string]string{"confirm_token": token}, nil); code != http.StatusBadGateway {
+		t.Errorf("confirm: status = %d, want 502", code)
+	}
+
+	assertAudit(t, s.audit, []auditWant{
+		{"admin", auditUninstallRequest, audit.ResultPending, ""},
+		{"admin", auditUninstallConfirm, audit.ResultFailure, "command expired"},
+	})
+
+	info, _ := s.nm.GetNode("n1")
+	if info == nil || info.Uninstall == nil || info.Uninstall.State != models.UninstallFailed {
+		t.Errorf("uninstall status = %+v, want failed", info)
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"port-forward-dashboard/internal/models"
+)
+
+// 流量统计默认返回最近 31 天和 12 个月
+const (
+	defaultUsageDays   = 31
+	defaultUsageMonths = 12
+)
+
+// usagePeriods 解析 days、months 查询参数
+func usagePeriods(c *gin.Context) (days, months int) {
+	days, months = defaultUsageDays, defaultUsageMonths
+	if v, err := strconv.Atoi(c.Query("days")); err == nil && v > 0 {
+		days = v
+	}
+	if v, err := strconv.Atoi(c.Query("months")); err == nil && v > 0 {
+		months = v
+	}
+	return days, months
+}
+
+func (s *Server) handleGetNodeRuleUsage(c *gin.Context) {
+	days, months := usagePeriods(c)
+	report, err := s.nm.GetRuleUsage(c.Param("id"), days, months)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: report})
+}
+
+func (s *Server) handleGetNodeUsage(c *gin.Context) {
+	days, months := usagePeriods(c)
+	report, err := s.nm.GetNodeUsage(c.Param("id"), days, months)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.APIResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: report})
+}
@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 审计事件的处理结果
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultPending = "pending"
+)
+
+// Entry 是一条审计记录，按 JSON Lines 追加写入审计文件
+type Entry struct {
+	Time   int64  `json:"time"`
+	Actor  string `json:"actor"`
+	IP     string `json:"ip,omitempty"`
+	Action string `json:"action"`
+	Target string `json:"target,omitempty"`
+	Result string `json:"result"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Log 是只追加的审计日志
+type Log struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Open 打开审计日志，目录或文件不存在时创建
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return &Log{path: path}, nil
+}
+
+// Record 追加一条记录，未设置时间时使用当前时间。写入失败只记日志，不影响业务操作
+func (l *Log) Record(e Entry) {
+	if e.Time == 0 {
+		e.Time = time.Now().Unix()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Failed to encode audit entry: %v", err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
+
+// List 返回最新的 limit 条记录（新的在前），action/target 不为空时按其过滤
+func (l *Log) List(limit int, action, target string) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var e Entry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		if (action != "" && e.Action != action) || (target != "" && e.Target != target) {
+			continue
+		}
+		entries = append(entries, e)
+		if limit > 0 && len(entries) > limit {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if entries == nil {
+		entries = []Entry{}
+	}
+	return entries, nil
+}
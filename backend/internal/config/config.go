@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 	"sync"
@@ -17,12 +18,38 @@ type Config struct {
 	Rules     []models.Rule     `json:"rules"`
 	Nodes     []models.Node     `json:"nodes"`
 	NodeRules []models.NodeRule `json:"node_rules"`
-	mu        sync.RWMutex
+
+	// EnrollTokens 是尚未使用的注册令牌，键为令牌的 SHA256，不保存明文
+	EnrollTokens map[string]models.EnrollToken `json:"enroll_tokens,omitempty"`
+
+	// AgentSigningKey 是旧版本保存在配置中的签名种子，仅用于迁移到 data/agent-signing.key
+	AgentSigningKey string `json:"agent_signing_key,omitempty"`
+
+	// CACert/CAKey 是旧版本保存在配置中的内置 CA，仅用于迁移到 data/ca.crt 和 data/ca.key
+	CACert string `json:"ca_cert,omitempty"`
+	CAKey  string `json:"ca_key,omitempty"`
+
+	// MetricsToken / MetricsAllow 控制 /metrics 的访问：Bearer 令牌匹配或来源地址在 IP/CIDR 列表内即可访问，
+	// 两者都未设置时不提供 /metrics
+	MetricsToken string   `json:"metrics_token,omitempty"`
+	MetricsAllow []string `json:"metrics_allow,omitempty"`
+
+	// 告警规则、通知渠道和静默窗口
+	AlertRules    []models.AlertRule    `json:"alert_rules,omitempty"`
+	AlertChannels []models.AlertChannel `json:"alert_channels,omitempty"`
+	AlertSilences []models.AlertSilence `json:"alert_silences,omitempty"`
+
+	// Mesh 是节点间延迟探测的配置
+	Mesh models.MeshSettings `json:"mesh"`
+
+	mu sync.RWMutex
 }
 
 const configFile = "config.json"
 
-func Load() *Config {
+// Load 读取配置文件，文件不存在时使用默认配置。文件存在但无法解析时返回错误，
+// 避免以默认配置启动后保存覆盖掉原有的节点和规则
+func Load() (*Config, error) {
 	cfg := &Config{
 		Port:      8080,
 		Username:  "admin",
@@ -34,17 +61,19 @@ func Load() *Config {
 	}
 
 	data, err := os.ReadFile(configFile)
-	if err != nil {
+	if os.IsNotExist(err) {
 		log.Println("No config file found, using defaults")
-		return cfg
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", configFile, err)
 	}
 
 	if err := json.Unmarshal(data, cfg); err != nil {
-		log.Printf("Failed to parse config: %v", err)
-		return cfg
+		return nil, fmt.Errorf("failed to parse %s: %v", configFile, err)
 	}
 
-	return cfg
+	return cfg, nil
 }
 
 func Save(cfg *Config, rules []models.Rule) {
@@ -52,28 +81,34 @@ func Save(cfg *Config, rules []models.Rule) {
 	defer cfg.mu.Unlock()
 
 	cfg.Rules = rules
-	data, err := json.MarshalIndent(cfg, "", "  ")
-	if err != nil {
-		log.Printf("Failed to marshal config: %v", err)
-		return
-	}
-
-	if err := os.WriteFile(configFile, data, 0644); err != nil {
-		log.Printf("Failed to save config: %v", err)
-	}
+	cfg.write()
 }
 
 func (cfg *Config) Save() {
 	cfg.mu.Lock()
 	defer cfg.mu.Unlock()
 
+	cfg.write()
+}
+
+// write 以 0600 权限写入配置文件（其中包含密码、JWT 密钥和节点密钥），先写临时文件再替换，调用方需持有锁
+func (cfg *Config) write() {
 	data, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
 		log.Printf("Failed to marshal config: %v", err)
 		return
 	}
 
-	if err := os.WriteFile(configFile, data, 0644); err != nil {
+	tmp := configFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
 		log.Printf("Failed to save config: %v", err)
+		return
+	}
+	// docker-compose 以单文件挂载 config.json，挂载点不能被替换（EBUSY），此时退回原地写入
+	if err := os.Rename(tmp, configFile); err != nil {
+		os.Remove(tmp)
+		if err := os.WriteFile(configFile, data, 0600); err != nil {
+			log.Printf("Failed to save config: %v", err)
+		}
 	}
 }
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+// inTempDir 在临时目录中运行，configFile 是相对路径
+func inTempDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  *string
+		wantErr  bool
+		wantPort int
+	}{
+		{"missing file uses defaults", nil, false, 8080},
+		{"valid file", strPtr(`{"port": 9000, "nodes": []}`), false, 9000},
+		{"truncated file", strPtr(`{"port": 9000, "nodes": [`), true, 0},
+		{"wrong type", strPtr(`{"port": "9000"}`), true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t)
+			if tt.content != nil {
+				if err := os.WriteFile(configFile, []byte(*tt.content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cfg, err := Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.Port != tt.wantPort {
+				t.Fatalf("Load() port = %d, want %d", cfg.Port, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestSaveRestrictsPermissions(t *testing.T) {
+	inTempDir(t)
+	// 旧版本写出的配置是 0644
+	if err := os.WriteFile(configFile, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.JWTSecret = "secret"
+	cfg.Save()
+
+	stat, err := os.Stat(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := stat.Mode().Perm(); mode != 0600 {
+		t.Fatalf("config mode = %o, want 600", mode)
+	}
+	reloaded, err := Load()
+	if err != nil || reloaded.JWTSecret != "secret" {
+		t.Fatalf("reloaded config = %+v, err = %v", reloaded, err)
+	}
+}
+
+func strPtr(s string) *string { return &s }
@@ -0,0 +1,31 @@
+package forwarder
+
+import (
+	"log"
+
+	"port-forward-common/accesslog"
+	"port-forward-common/conns"
+)
+
+func (t *Tunnel) writeAccessLog(e accesslog.Entry) {
+	if err := t.accessLog.Write(e); err != nil {
+		log.Printf("Failed to write access log for %s: %v", t.id, err)
+	}
+}
+
+func (t *Tunnel) logConnect(c *conns.Conn) {
+	if t.logAccess.Load() {
+		t.writeAccessLog(accesslog.ConnectEntry(t.id, c))
+	}
+}
+
+func (t *Tunnel) logClose(c *conns.Conn, reason string, cause error) {
+	if t.logAccess.Load() {
+		t.writeAccessLog(accesslog.CloseEntry(t.id, c, reason, cause))
+	}
+}
+
+// closeReason 根据连接结束时的错误判断关闭原因
+func (t *Tunnel) closeReason(c *conns.Conn, err error) string {
+	return accesslog.CloseReason(c, t.ctx.Err() != nil, err)
+}
@@ -3,26 +3,36 @@ package forwarder
 import (
 	"fmt"
 	"log"
+	"net"
 	"sync"
 	"time"
 
+	"port-forward-common/accesslog"
+	"port-forward-common/probe"
 	"port-forward-dashboard/internal/models"
 )
 
 type Manager struct {
-	tunnels   map[string]*Tunnel
-	mu        sync.RWMutex
-	startTime time.Time
+	tunnels      map[string]*Tunnel
+	mu           sync.RWMutex
+	startTime    time.Time
+	accessLogDir string
 }
 
-func NewManager() *Manager {
+// NewManager 创建转发管理器，开启访问日志的规则写入 accessLogDir/<规则ID>.log
+func NewManager(accessLogDir string) *Manager {
 	return &Manager{
-		tunnels:   make(map[string]*Tunnel),
-		startTime: time.Now(),
+		tunnels:      make(map[string]*Tunnel),
+		startTime:    time.Now(),
+		accessLogDir: accessLogDir,
 	}
 }
 
 func (m *Manager) AddRule(rule models.Rule) error {
+	if err := probe.Validate(rule.HealthCheck); err != nil {
+		return err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -30,7 +40,7 @@ func (m *Manager) AddRule(rule models.Rule) error {
 		return fmt.Errorf("rule %s already exists", rule.ID)
 	}
 
-	tunnel := NewTunnel(rule)
+	tunnel := NewTunnel(rule, m.accessLogDir)
 	m.tunnels[rule.ID] = tunnel
 
 	if rule.Enabled {
@@ -43,6 +53,10 @@ func (m *Manager) AddRule(rule models.Rule) error {
 }
 
 func (m *Manager) UpdateRule(rule models.Rule) error {
+	if err := probe.Validate(rule.HealthCheck); err != nil {
+		return err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -109,6 +123,59 @@ func (m *Manager) GetTunnelStatus(id string) (*models.TunnelStatus, error) {
 	return tunnel.GetStatus(), nil
 }
 
+func (m *Manager) getTunnel(id string) (*Tunnel, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tunnel, exists := m.tunnels[id]
+	if !exists {
+		return nil, fmt.Errorf("rule %s not found", id)
+	}
+	return tunnel, nil
+}
+
+func (m *Manager) GetConnections(id string) ([]models.ConnectionInfo, error) {
+	tunnel, err := m.getTunnel(id)
+	if err != nil {
+		return nil, err
+	}
+	return tunnel.Connections(), nil
+}
+
+// GetTimings 返回规则上客户端连接的耗时统计
+func (m *Manager) GetTimings(id string) (models.ConnTimings, error) {
+	tunnel, err := m.getTunnel(id)
+	if err != nil {
+		return models.ConnTimings{}, err
+	}
+	return tunnel.Timings(), nil
+}
+
+func (m *Manager) CloseConnection(id, connID string) error {
+	tunnel, err := m.getTunnel(id)
+	if err != nil {
+		return err
+	}
+	return tunnel.CloseConnection(connID)
+}
+
+func (m *Manager) CloseConnectionsFrom(id string, ip net.IP) (int, error) {
+	tunnel, err := m.getTunnel(id)
+	if err != nil {
+		return 0, err
+	}
+	return tunnel.CloseConnectionsFrom(ip), nil
+}
+
+// ReadAccessLog 查询规则最近的访问日志
+func (m *Manager) ReadAccessLog(id string, f accesslog.Filter) ([]accesslog.Entry, error) {
+	if _, err := m.getTunnel(id); err != nil {
+		return nil, err
+	}
+	f.RuleID = id
+	return accesslog.Read(m.accessLogDir, f)
+}
+
 func (m *Manager) GetAllStatus() []models.TunnelStatus {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
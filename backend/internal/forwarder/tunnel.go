@@ -2,21 +2,35 @@ package forwarder
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"port-forward-common/accesslog"
+	"port-forward-common/conns"
+	"port-forward-common/probe"
+	"port-forward-common/timings"
 	"port-forward-dashboard/internal/models"
 )
 
 type Tunnel struct {
+	id           string
 	rule         models.Rule
 	stats        *models.TrafficStats
+	bytesIn      atomic.Int64
+	bytesOut     atomic.Int64
+	connections  atomic.Int32
+	conns        *conns.Registry
+	accessLog    *accesslog.Writer
+	logAccess    atomic.Bool
 	latency      *models.LatencyInfo
+	probes       probe.Window
+	timings      timings.Recorder
 	running      atomic.Bool
 	listener     net.Listener
 	udpConn      *net.UDPConn
@@ -28,13 +42,20 @@ type Tunnel struct {
 	lastUpdate   time.Time
 }
 
-func NewTunnel(rule models.Rule) *Tunnel {
-	return &Tunnel{
+// NewTunnel 创建隧道，accessLogDir 为空时不记录访问日志
+func NewTunnel(rule models.Rule, accessLogDir string) *Tunnel {
+	t := &Tunnel{
+		id:         rule.ID,
 		rule:       rule,
 		stats:      &models.TrafficStats{},
-		latency:    &models.LatencyInfo{Status: "unknown"},
+		conns:      conns.NewRegistry(),
+		latency:    &models.LatencyInfo{Status: probe.StatusUnknown},
 		lastUpdate: time.Now(),
 	}
+	if accessLogDir != "" {
+		t.accessLog = accesslog.NewWriter(accesslog.Path(accessLogDir, rule.ID), accesslog.DefaultMaxSize, accesslog.DefaultMaxBackups)
+	}
+	return t
 }
 
 func (t *Tunnel) Start() error {
@@ -63,6 +84,7 @@ func (t *Tunnel) Start() error {
 
 	t.running.Store(true)
 	t.rule.Enabled = true
+	t.logAccess.Store(t.rule.AccessLog && t.accessLog != nil)
 
 	// 启动延迟检测
 	go t.latencyProbe()
@@ -104,7 +126,7 @@ func (t *Tunnel) acceptTCP() {
 			}
 		}
 
-		t.stats.Connections.Add(1)
+		t.connections.Add(1)
 		go t.handleTCPConn(conn)
 	}
 }
@@ -112,62 +134,84 @@ func (t *Tunnel) acceptTCP() {
 func (t *Tunnel) handleTCPConn(clientConn net.Conn) {
 	defer func() {
 		clientConn.Close()
-		t.stats.Connections.Add(-1)
+		t.connections.Add(-1)
+	}()
+
+	targetAddr := net.JoinHostPort(t.rule.TargetIP, strconv.Itoa(t.rule.TargetPort))
+	tracked := t.conns.Add("tcp", clientConn.RemoteAddr(), targetAddr, clientConn)
+	t.logConnect(tracked)
+
+	reason, cause := accesslog.ReasonEOF, error(nil)
+	defer func() {
+		t.conns.Remove(tracked.ID)
+		t.logClose(tracked, reason, cause)
 	}()
 
-	targetAddr := fmt.Sprintf("%s:%d", t.rule.TargetIP, t.rule.TargetPort)
+	dialStart := time.Now()
 	targetConn, err := net.DialTimeout("tcp", targetAddr, 10*time.Second)
 	if err != nil {
 		log.Printf("Failed to connect to target %s: %v", targetAddr, err)
+		t.timings.DialFailed(err)
+		reason, cause = accesslog.ReasonDialError, err
 		return
 	}
 	defer targetConn.Close()
+	connected := time.Now()
+	t.timings.Dial.Observe(connected.Sub(dialStart))
 
-	var wg sync.WaitGroup
-	wg.Add(2)
+	if !tracked.Attach(targetConn.RemoteAddr().String(), targetConn) {
+		reason = accesslog.ReasonClosed
+		return
+	}
+
+	errs := make(chan error, 2)
 
 	// Client -> Target (上行)
 	go func() {
-		defer wg.Done()
-		t.copyWithStats(targetConn, clientConn, &t.stats.BytesOut)
+		errs <- t.copyWithStats(targetConn, clientConn, &t.bytesOut, &tracked.BytesOut, nil)
 	}()
 
 	// Target -> Client (下行)
 	go func() {
-		defer wg.Done()
-		t.copyWithStats(clientConn, targetConn, &t.stats.BytesIn)
+		errs <- t.copyWithStats(clientConn, targetConn, &t.bytesIn, &tracked.BytesIn, func() {
+			t.timings.FirstByte.Observe(time.Since(connected))
+		})
 	}()
 
-	wg.Wait()
+	// 以先结束的方向作为关闭原因
+	cause = <-errs
+	<-errs
+	reason = t.closeReason(tracked, cause)
 }
 
-func (t *Tunnel) copyWithStats(dst, src net.Conn, counter *atomic.Int64) {
+// copyWithStats 转发单个方向的数据，返回结束时的错误，隧道停止时返回 nil。
+// firstRead 不为空时在读到第一个字节时调用
+func (t *Tunnel) copyWithStats(dst, src net.Conn, counter, connCounter *atomic.Int64, firstRead func()) error {
 	buf := make([]byte, 32*1024)
 	for {
 		select {
 		case <-t.ctx.Done():
-			return
+			return nil
 		default:
 		}
 
 		src.SetReadDeadline(time.Now().Add(30 * time.Second))
 		n, err := src.Read(buf)
 		if n > 0 {
+			if firstRead != nil {
+				firstRead()
+				firstRead = nil
+			}
 			counter.Add(int64(n))
+			connCounter.Add(int64(n))
 			dst.SetWriteDeadline(time.Now().Add(30 * time.Second))
 			_, werr := dst.Write(buf[:n])
 			if werr != nil {
-				return
+				return werr
 			}
 		}
 		if err != nil {
-			if err != io.EOF {
-				select {
-				case <-t.ctx.Done():
-				default:
-				}
-			}
-			return
+			return err
 		}
 	}
 }
@@ -186,10 +230,10 @@ func (t *Tunnel) startUDP() error {
 
 func (t *Tunnel) handleUDP() {
 	buf := make([]byte, 65535)
-	clients := make(map[string]*net.UDPConn)
+	clients := make(map[string]*udpSession)
 	var clientsMu sync.RWMutex
 
-	targetAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", t.rule.TargetIP, t.rule.TargetPort))
+	targetAddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(t.rule.TargetIP, strconv.Itoa(t.rule.TargetPort)))
 	if err != nil {
 		log.Printf("Failed to resolve target: %v", err)
 		return
@@ -199,8 +243,8 @@ func (t *Tunnel) handleUDP() {
 		select {
 		case <-t.ctx.Done():
 			clientsMu.Lock()
-			for _, c := range clients {
-				c.Close()
+			for _, session := range clients {
+				session.conn.Close()
 			}
 			clientsMu.Unlock()
 			return
@@ -221,27 +265,46 @@ func (t *Tunnel) handleUDP() {
 			}
 		}
 
-		t.stats.BytesOut.Add(int64(n))
+		t.bytesOut.Add(int64(n))
 
 		clientKey := clientAddr.String()
 		clientsMu.RLock()
-		targetConn, exists := clients[clientKey]
+		session, exists := clients[clientKey]
 		clientsMu.RUnlock()
 
 		if !exists {
-			targetConn, err = net.DialUDP("udp", nil, targetAddr)
+			targetConn, err := net.DialUDP("udp", nil, targetAddr)
 			if err != nil {
 				log.Printf("Failed to dial target: %v", err)
+				t.timings.DialFailed(err)
 				continue
 			}
 
+			session = &udpSession{
+				conn:    targetConn,
+				tracked: t.conns.Add("udp", clientAddr, targetAddr.String(), targetConn),
+			}
+			t.logConnect(session.tracked)
 			clientsMu.Lock()
-			clients[clientKey] = targetConn
+			clients[clientKey] = session
 			clientsMu.Unlock()
 
-			// 启动反向转发
-			go func(tc *net.UDPConn, ca *net.UDPAddr, key string) {
+			// 启动反向转发，会话超时或被强制断开时清理
+			go func(s *udpSession, ca *net.UDPAddr, key string, started time.Time) {
+				var cause error
+				defer func() {
+					clientsMu.Lock()
+					if clients[key] == s {
+						delete(clients, key)
+					}
+					clientsMu.Unlock()
+					s.conn.Close()
+					t.conns.Remove(s.tracked.ID)
+					t.logClose(s.tracked, t.closeReason(s.tracked, cause), cause)
+				}()
+
 				rbuf := make([]byte, 65535)
+				first := true
 				for {
 					select {
 					case <-t.ctx.Done():
@@ -249,29 +312,42 @@ func (t *Tunnel) handleUDP() {
 					default:
 					}
 
-					tc.SetReadDeadline(time.Now().Add(30 * time.Second))
-					rn, err := tc.Read(rbuf)
+					s.conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+					rn, err := s.conn.Read(rbuf)
 					if err != nil {
 						if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-							clientsMu.Lock()
-							delete(clients, key)
-							clientsMu.Unlock()
-							tc.Close()
+							cause = err
+							return
+						}
+						if errors.Is(err, net.ErrClosed) {
+							cause = err
 							return
 						}
 						continue
 					}
 
-					t.stats.BytesIn.Add(int64(rn))
+					if first {
+						t.timings.FirstByte.Observe(time.Since(started))
+						first = false
+					}
+					t.bytesIn.Add(int64(rn))
+					s.tracked.BytesIn.Add(int64(rn))
 					t.udpConn.WriteToUDP(rbuf[:rn], ca)
 				}
-			}(targetConn, clientAddr, clientKey)
+			}(session, clientAddr, clientKey, time.Now())
 		}
 
-		targetConn.Write(buf[:n])
+		session.tracked.BytesOut.Add(int64(n))
+		session.conn.Write(buf[:n])
 	}
 }
 
+// udpSession 是一个 UDP 客户端对应的目标连接
+type udpSession struct {
+	conn    *net.UDPConn
+	tracked *conns.Conn
+}
+
 func (t *Tunnel) latencyProbe() {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
@@ -286,33 +362,31 @@ func (t *Tunnel) latencyProbe() {
 	}
 }
 
+// checkLatency 按规则配置的健康检查探测目标，未配置探测的 UDP 规则状态为 unknown
 func (t *Tunnel) checkLatency() {
-	targetAddr := fmt.Sprintf("%s:%d", t.rule.TargetIP, t.rule.TargetPort)
-	start := time.Now()
-
-	conn, err := net.DialTimeout("tcp", targetAddr, 5*time.Second)
-	latency := time.Since(start).Milliseconds()
+	rule := t.GetRule()
+	check := probe.Effective(rule.HealthCheck, string(rule.Protocol))
+
+	info := models.LatencyInfo{Status: probe.StatusUnknown}
+	if check != nil {
+		elapsed, err := probe.Run(check, string(rule.Protocol), rule.TargetIP, rule.TargetPort)
+		info.Check = check.Type
+		info.Latency = elapsed.Milliseconds()
+		if err != nil {
+			info.Latency = -1
+			info.Error = err.Error()
+		}
+		info.Status = probe.Status(check, info.Latency)
+	}
+	info.LastCheck = time.Now().Unix()
 
 	t.mu.Lock()
 	defer t.mu.Unlock()
-
-	t.latency.LastCheck = time.Now().Unix()
-
-	if err != nil {
-		t.latency.Latency = -1
-		t.latency.Status = "error"
-		return
-	}
-	conn.Close()
-
-	t.latency.Latency = latency
-	if latency < 100 {
-		t.latency.Status = "normal"
-	} else if latency < 300 {
-		t.latency.Status = "warning"
-	} else {
-		t.latency.Status = "error"
+	if check != nil {
+		t.probes.Add(info.Latency)
 	}
+	info.LatencyStats = t.probes.Stats()
+	*t.latency = info
 }
 
 func (t *Tunnel) Stop() {
@@ -337,16 +411,22 @@ func (t *Tunnel) Stop() {
 		t.udpConn = nil
 	}
 
+	if t.accessLog != nil {
+		t.accessLog.Close()
+	}
+
 	t.running.Store(false)
 	t.rule.Enabled = false
 
 	log.Printf("🛑 Tunnel %s stopped", t.rule.Name)
 }
 
+// UpdateRule 更新规则，目标或健康检查可能已变化，延迟统计重新开始
 func (t *Tunnel) UpdateRule(rule models.Rule) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	t.rule = rule
+	t.probes.Reset()
 }
 
 func (t *Tunnel) GetRule() models.Rule {
@@ -359,6 +439,21 @@ func (t *Tunnel) IsRunning() bool {
 	return t.running.Load()
 }
 
+// Connections 返回隧道当前的活动连接
+func (t *Tunnel) Connections() []models.ConnectionInfo {
+	return t.conns.List()
+}
+
+// CloseConnection 强制断开一条连接
+func (t *Tunnel) CloseConnection(connID string) error {
+	return t.conns.Close(connID)
+}
+
+// CloseConnectionsFrom 强制断开来自指定源 IP 的所有连接
+func (t *Tunnel) CloseConnectionsFrom(ip net.IP) int {
+	return t.conns.CloseFrom(ip)
+}
+
 func (t *Tunnel) UpdateRates() {
 	now := time.Now()
 	duration := now.Sub(t.lastUpdate).Seconds()
@@ -366,14 +461,14 @@ func (t *Tunnel) UpdateRates() {
 		return
 	}
 
-	currentIn := t.stats.BytesIn.Load()
-	currentOut := t.stats.BytesOut.Load()
+	currentIn := t.bytesIn.Load()
+	currentOut := t.bytesOut.Load()
 
 	t.stats.BytesInRate = float64(currentIn-t.lastBytesIn) / duration
 	t.stats.BytesOutRate = float64(currentOut-t.lastBytesOut) / duration
 	t.stats.TotalIn = currentIn
 	t.stats.TotalOut = currentOut
-	t.stats.ConnCount = t.stats.Connections.Load()
+	t.stats.ConnCount = t.connections.Load()
 
 	t.lastBytesIn = currentIn
 	t.lastBytesOut = currentOut
@@ -384,12 +479,17 @@ func (t *Tunnel) GetTrafficStats() models.TrafficStats {
 	return models.TrafficStats{
 		BytesInRate:  t.stats.BytesInRate,
 		BytesOutRate: t.stats.BytesOutRate,
-		TotalIn:      t.stats.BytesIn.Load(),
-		TotalOut:     t.stats.BytesOut.Load(),
-		ConnCount:    t.stats.Connections.Load(),
+		TotalIn:      t.bytesIn.Load(),
+		TotalOut:     t.bytesOut.Load(),
+		ConnCount:    t.connections.Load(),
 	}
 }
 
+// Timings 返回隧道上客户端连接的耗时统计
+func (t *Tunnel) Timings() models.ConnTimings {
+	return t.timings.Snapshot()
+}
+
 func (t *Tunnel) GetStatus() *models.TunnelStatus {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
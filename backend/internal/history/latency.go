@@ -0,0 +1,70 @@
+package history
+
+import (
+	"strings"
+	"time"
+
+	"port-forward-dashboard/internal/models"
+)
+
+// MeshKey 生成节点 source 到探测对象 target 的延迟序列名
+func MeshKey(source, target string) string { return "mesh-" + source + "-" + target }
+
+// MeshKeyInvolves 判断延迟序列的源或目标是否为 id
+func MeshKeyInvolves(key, id string) bool {
+	return strings.HasPrefix(key, "mesh-"+id+"-") || strings.HasSuffix(key, "-"+id)
+}
+
+// LatencyStore 是延迟历史存储，粒度和保留期限与流量历史相同
+type LatencyStore struct {
+	*tsdb[models.LatencyHistory]
+}
+
+// OpenLatency 打开延迟历史目录并加载已有数据
+func OpenLatency(dir string) (*LatencyStore, error) {
+	db := &tsdb[models.LatencyHistory]{
+		timestamp: func(p models.LatencyHistory) int64 { return p.Timestamp },
+		empty:     func(ts int64) models.LatencyHistory { return models.LatencyHistory{Timestamp: ts} },
+		merge:     mergeLatency,
+	}
+	if err := db.open(dir); err != nil {
+		return nil, err
+	}
+	return &LatencyStore{db}, nil
+}
+
+// Record 记录一次探测结果，latency < 0 表示探测失败
+func (s *LatencyStore) Record(key string, t time.Time, latency int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := models.LatencyHistory{Timestamp: t.Unix(), Samples: 1}
+	if latency < 0 {
+		p.Failures = 1
+		p.Loss = 100
+	} else {
+		p.Avg, p.Min, p.Max = float64(latency), latency, latency
+	}
+	s.add(key, t, p)
+}
+
+// mergeLatency 把 p 并入 dst：平均延迟按成功次数加权，最小/最大值只统计成功的探测
+func mergeLatency(dst *models.LatencyHistory, p models.LatencyHistory) {
+	n := dst.Samples + p.Samples
+	if n == 0 {
+		return
+	}
+	ok, pOK := dst.Samples-dst.Failures, p.Samples-p.Failures
+	if pOK > 0 {
+		if ok == 0 || p.Min < dst.Min {
+			dst.Min = p.Min
+		}
+		if p.Max > dst.Max {
+			dst.Max = p.Max
+		}
+		dst.Avg = (dst.Avg*float64(ok) + p.Avg*float64(pOK)) / float64(ok+pOK)
+	}
+	dst.Samples = n
+	dst.Failures += p.Failures
+	dst.Loss = float64(dst.Failures) * 100 / float64(n)
+}
@@ -0,0 +1,395 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"port-forward-dashboard/internal/models"
+)
+
+// 汇总粒度
+const (
+	ResolutionMinute = "minute"
+	ResolutionHour   = "hour"
+	ResolutionDay    = "day"
+)
+
+type level struct {
+	name      string
+	retention time.Duration
+	truncate  func(time.Time) time.Time
+}
+
+// levels 从细到粗排列，每一级的开放桶只包含已关闭的下一级数据
+var levels = []level{
+	{ResolutionMinute, 24 * time.Hour, func(t time.Time) time.Time { return t.Truncate(time.Minute) }},
+	{ResolutionHour, 30 * 24 * time.Hour, func(t time.Time) time.Time { return t.Truncate(time.Hour) }},
+	{ResolutionDay, 365 * 24 * time.Hour, startOfDay},
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func levelIndex(resolution string) (int, bool) {
+	for i, l := range levels {
+		if l.name == resolution {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// RuleKey 和 NodeKey 生成规则、节点的序列名
+func RuleKey(id string) string { return "rule-" + id }
+func NodeKey(id string) string { return "node-" + id }
+
+// series 是一个序列，每个粒度保存已关闭的桶和当前的开放桶
+type series[P any] struct {
+	points [3][]P
+	open   [3]*P
+	lines  [3]int
+}
+
+// tsdb 是嵌入式的时序存储，P 是桶的类型。已关闭的桶按粒度追加到 JSON Lines 文件，
+// 启动时由细粒度数据重建粗粒度的开放桶
+type tsdb[P any] struct {
+	dir    string
+	mu     sync.Mutex
+	series map[string]*series[P]
+
+	// timestamp 返回桶的开始时间，empty 创建从 ts 开始的空桶，merge 把时间更晚的 p 并入 dst
+	timestamp func(P) int64
+	empty     func(ts int64) P
+	merge     func(dst *P, p P)
+}
+
+// Store 是流量历史存储
+type Store struct {
+	*tsdb[models.TrafficHistory]
+}
+
+// Open 打开流量历史目录并加载已有数据
+func Open(dir string) (*Store, error) {
+	db := &tsdb[models.TrafficHistory]{
+		timestamp: func(p models.TrafficHistory) int64 { return p.Timestamp },
+		empty:     func(ts int64) models.TrafficHistory { return models.TrafficHistory{Timestamp: ts} },
+		merge:     mergeTraffic,
+	}
+	if err := db.open(dir); err != nil {
+		return nil, err
+	}
+	return &Store{db}, nil
+}
+
+// open 打开存储目录并加载已有数据
+func (s *tsdb[P]) open(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	s.dir = dir
+	s.series = make(map[string]*series[P])
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		key, l, ok := parseFileName(file.Name())
+		if !ok {
+			continue
+		}
+		points, err := s.readPoints(filepath.Join(dir, file.Name()))
+		if err != nil {
+			log.Printf("Failed to load history %s: %v", file.Name(), err)
+			continue
+		}
+		sr := s.getSeries(key)
+		sr.points[l] = points
+		sr.lines[l] = len(points)
+	}
+
+	now := time.Now()
+	for key, sr := range s.series {
+		for l := range levels {
+			if trimmed := s.trim(sr.points[l], l, now); len(trimmed) != len(sr.points[l]) {
+				sr.points[l] = trimmed
+				s.rewrite(key, sr, l)
+			}
+		}
+		s.recover(key, sr)
+	}
+	return nil
+}
+
+func parseFileName(name string) (key string, l int, ok bool) {
+	base := strings.TrimSuffix(name, ".jsonl")
+	if base == name {
+		return "", 0, false
+	}
+	dot := strings.LastIndex(base, ".")
+	if dot <= 0 {
+		return "", 0, false
+	}
+	l, ok = levelIndex(base[dot+1:])
+	return base[:dot], l, ok
+}
+
+func (s *tsdb[P]) path(key string, l int) string {
+	return filepath.Join(s.dir, key+"."+levels[l].name+".jsonl")
+}
+
+func (s *tsdb[P]) getSeries(key string) *series[P] {
+	sr, ok := s.series[key]
+	if !ok {
+		sr = &series[P]{}
+		s.series[key] = sr
+	}
+	return sr
+}
+
+// Record 记录一次采样
+func (s *Store) Record(key string, t time.Time, stats models.TrafficStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.add(key, t, models.TrafficHistory{
+		Timestamp:  t.Unix(),
+		RateIn:     stats.BytesInRate,
+		RateOut:    stats.BytesOutRate,
+		MaxRateIn:  stats.BytesInRate,
+		MaxRateOut: stats.BytesOutRate,
+		TotalIn:    stats.TotalIn,
+		TotalOut:   stats.TotalOut,
+		Samples:    1,
+	})
+}
+
+// add 把一个采样并入最细粒度的开放桶，调用方需持有锁
+func (s *tsdb[P]) add(key string, t time.Time, p P) {
+	sr := s.getSeries(key)
+	s.rollover(key, sr, t)
+	s.mergeOpen(sr, 0, p)
+}
+
+// rollover 关闭不属于 t 所在周期的开放桶，并把它并入上一级
+func (s *tsdb[P]) rollover(key string, sr *series[P], t time.Time) {
+	for l := range levels {
+		open := sr.open[l]
+		if open == nil || s.timestamp(*open) == levels[l].truncate(t).Unix() {
+			continue
+		}
+		closed := *open
+		sr.open[l] = nil
+		s.appendPoint(key, sr, l, closed)
+		if l+1 < len(levels) {
+			s.mergeOpen(sr, l+1, closed)
+		}
+	}
+}
+
+func (s *tsdb[P]) mergeOpen(sr *series[P], l int, p P) {
+	if sr.open[l] == nil {
+		start := s.empty(levels[l].truncate(time.Unix(s.timestamp(p), 0)).Unix())
+		sr.open[l] = &start
+	}
+	s.merge(sr.open[l], p)
+}
+
+// mergeTraffic 把时间更晚的 p 并入 dst：平均速率按样本数加权，累计字节取最新值
+func mergeTraffic(dst *models.TrafficHistory, p models.TrafficHistory) {
+	n := dst.Samples + p.Samples
+	if n == 0 {
+		return
+	}
+	dst.RateIn = (dst.RateIn*float64(dst.Samples) + p.RateIn*float64(p.Samples)) / float64(n)
+	dst.RateOut = (dst.RateOut*float64(dst.Samples) + p.RateOut*float64(p.Samples)) / float64(n)
+	if p.MaxRateIn > dst.MaxRateIn {
+		dst.MaxRateIn = p.MaxRateIn
+	}
+	if p.MaxRateOut > dst.MaxRateOut {
+		dst.MaxRateOut = p.MaxRateOut
+	}
+	dst.TotalIn = p.TotalIn
+	dst.TotalOut = p.TotalOut
+	dst.Samples = n
+}
+
+// recover 启动时用已关闭的细粒度桶重建粗粒度的开放桶（只重放上一级最后一个桶之后的数据）
+func (s *tsdb[P]) recover(key string, sr *series[P]) {
+	for l := 1; l < len(levels); l++ {
+		last := int64(-1)
+		if n := len(sr.points[l]); n > 0 {
+			last = s.timestamp(sr.points[l][n-1])
+		}
+		for _, p := range sr.points[l-1] {
+			start := levels[l].truncate(time.Unix(s.timestamp(p), 0)).Unix()
+			if start <= last {
+				continue
+			}
+			if open := sr.open[l]; open != nil && s.timestamp(*open) != start {
+				s.appendPoint(key, sr, l, *open)
+				sr.open[l] = nil
+			}
+			s.mergeOpen(sr, l, p)
+		}
+	}
+}
+
+func (s *tsdb[P]) appendPoint(key string, sr *series[P], l int, p P) {
+	sr.points[l] = s.trim(append(sr.points[l], p), l, time.Unix(s.timestamp(p), 0))
+
+	// 文件中过期的行超过保留的行数时整体重写
+	if sr.lines[l] >= 2*len(sr.points[l])+16 {
+		s.rewrite(key, sr, l)
+		return
+	}
+
+	f, err := os.OpenFile(s.path(key, l), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("Failed to write history %s: %v", key, err)
+		return
+	}
+	defer f.Close()
+
+	data, _ := json.Marshal(p)
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Printf("Failed to write history %s: %v", key, err)
+		return
+	}
+	sr.lines[l]++
+}
+
+// rewrite 用内存中的桶原子地重写一个粒度的文件
+func (s *tsdb[P]) rewrite(key string, sr *series[P], l int) {
+	var buf strings.Builder
+	for _, p := range sr.points[l] {
+		data, _ := json.Marshal(p)
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	path := s.path(key, l)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(buf.String()), 0600); err != nil {
+		log.Printf("Failed to compact history %s: %v", key, err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		log.Printf("Failed to compact history %s: %v", key, err)
+		return
+	}
+	sr.lines[l] = len(sr.points[l])
+}
+
+// trim 丢弃超出保留期限的桶
+func (s *tsdb[P]) trim(points []P, l int, now time.Time) []P {
+	cutoff := now.Add(-levels[l].retention).Unix()
+	i := sort.Search(len(points), func(i int) bool { return s.timestamp(points[i]) >= cutoff })
+	if i == 0 {
+		return points
+	}
+	return append([]P(nil), points[i:]...)
+}
+
+func (s *tsdb[P]) readPoints(path string) ([]P, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var points []P
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var p P
+		if json.Unmarshal(scanner.Bytes(), &p) != nil {
+			continue
+		}
+		// 追加写入保证有序，这里只防御异常数据
+		if n := len(points); n > 0 && s.timestamp(p) <= s.timestamp(points[n-1]) {
+			continue
+		}
+		points = append(points, p)
+	}
+	return points, scanner.Err()
+}
+
+// Query 返回 [from, to] 内指定粒度的桶，最后一个桶可能是尚未结束的当前周期
+func (s *tsdb[P]) Query(key, resolution string, from, to time.Time) ([]P, error) {
+	l, ok := levelIndex(resolution)
+	if !ok {
+		return nil, fmt.Errorf("unsupported resolution %q", resolution)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := []P{}
+	sr, ok := s.series[key]
+	if !ok {
+		return result, nil
+	}
+
+	fromTs, toTs := levels[l].truncate(from).Unix(), to.Unix()
+	for _, p := range sr.points[l] {
+		if ts := s.timestamp(p); ts >= fromTs && ts <= toTs {
+			result = append(result, p)
+		}
+	}
+
+	// 当前周期 = 本级开放桶 + 所有更细粒度的开放桶
+	var partial *P
+	for i := l; i >= 0; i-- {
+		open := sr.open[i]
+		if open == nil {
+			continue
+		}
+		if partial == nil {
+			start := s.empty(levels[l].truncate(time.Unix(s.timestamp(*open), 0)).Unix())
+			partial = &start
+		}
+		s.merge(partial, *open)
+	}
+	if partial != nil && s.timestamp(*partial) >= fromTs && s.timestamp(*partial) <= toTs {
+		result = append(result, *partial)
+	}
+	return result, nil
+}
+
+// Delete 删除序列及其文件
+func (s *tsdb[P]) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.series, key)
+	for l := range levels {
+		os.Remove(s.path(key, l))
+	}
+}
+
+// DeleteMatching 删除键满足 match 的所有序列及其文件
+func (s *tsdb[P]) DeleteMatching(match func(key string) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.series {
+		if !match(key) {
+			continue
+		}
+		delete(s.series, key)
+		for l := range levels {
+			os.Remove(s.path(key, l))
+		}
+	}
+}
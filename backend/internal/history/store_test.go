@@ -0,0 +1,170 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"port-forward-dashboard/internal/models"
+)
+
+// testBase 返回数小时前的整点，之后 3 小时内不跨天，且都在分钟级的保留期限内
+func testBase() time.Time {
+	base := time.Now().Add(-20 * time.Hour).Truncate(time.Hour)
+	if day := startOfDay(base.Add(3 * time.Hour)); day.After(base) {
+		base = day
+	}
+	return base
+}
+
+func rate(in float64) models.TrafficStats {
+	return models.TrafficStats{BytesInRate: in, TotalIn: int64(in)}
+}
+
+func TestStoreRollup(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := testBase()
+	samples := []struct {
+		offset time.Duration
+		rate   float64
+	}{
+		{0, 10},
+		{10 * time.Second, 30},
+		{70 * time.Second, 60},
+		{time.Hour + 5*time.Second, 100},
+	}
+	for _, sample := range samples {
+		s.Record("rule-r1", base.Add(sample.offset), rate(sample.rate))
+	}
+
+	tests := []struct {
+		resolution string
+		want       []models.TrafficHistory
+	}{
+		{ResolutionMinute, []models.TrafficHistory{
+			{Timestamp: base.Unix(), RateIn: 20, MaxRateIn: 30, TotalIn: 30, Samples: 2},
+			{Timestamp: base.Add(time.Minute).Unix(), RateIn: 60, MaxRateIn: 60, TotalIn: 60, Samples: 1},
+			{Timestamp: base.Add(time.Hour).Unix(), RateIn: 100, MaxRateIn: 100, TotalIn: 100, Samples: 1},
+		}},
+		// 小时桶按样本数加权平均，累计值取最新
+		{ResolutionHour, []models.TrafficHistory{
+			{Timestamp: base.Unix(), RateIn: 100.0 / 3, MaxRateIn: 60, TotalIn: 60, Samples: 3},
+			{Timestamp: base.Add(time.Hour).Unix(), RateIn: 100, MaxRateIn: 100, TotalIn: 100, Samples: 1},
+		}},
+		{ResolutionDay, []models.TrafficHistory{
+			{Timestamp: startOfDay(base).Unix(), RateIn: 50, MaxRateIn: 100, TotalIn: 100, Samples: 4},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.resolution, func(t *testing.T) {
+			got, err := s.Query("rule-r1", tt.resolution, base.Add(-time.Hour), time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertPoints(t, got, tt.want)
+		})
+	}
+
+	if _, err := s.Query("rule-r1", "week", base, time.Now()); err == nil {
+		t.Error("Query with an unsupported resolution succeeded")
+	}
+}
+
+func TestStoreRecover(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := testBase()
+	// 分钟 0、1 关闭后写入文件，分钟 2 仍是开放桶，重启后丢失
+	s.Record("rule-r1", base, rate(10))
+	s.Record("rule-r1", base.Add(time.Minute), rate(20))
+	s.Record("rule-r1", base.Add(2*time.Minute), rate(90))
+
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hour := models.TrafficHistory{Timestamp: base.Unix(), RateIn: 15, MaxRateIn: 20, TotalIn: 20, Samples: 2}
+	for _, resolution := range []string{ResolutionHour, ResolutionDay} {
+		got, err := s.Query("rule-r1", resolution, base.Add(-time.Hour), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := hour
+		want.Timestamp = levels[mustLevel(t, resolution)].truncate(base).Unix()
+		assertPoints(t, got, []models.TrafficHistory{want})
+	}
+
+	// 重建的开放桶继续累加，关闭后只写入一次
+	s.Record("rule-r1", base.Add(3*time.Minute), rate(30))
+	s.Record("rule-r1", base.Add(time.Hour), rate(0))
+	s.Record("rule-r1", base.Add(time.Hour+time.Minute), rate(0))
+
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Query("rule-r1", ResolutionHour, base.Add(-time.Hour), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPoints(t, got, []models.TrafficHistory{
+		{Timestamp: base.Unix(), RateIn: 20, MaxRateIn: 30, TotalIn: 30, Samples: 3},
+		{Timestamp: base.Add(time.Hour).Unix(), Samples: 1},
+	})
+}
+
+func TestLatencyStoreRollup(t *testing.T) {
+	s, err := OpenLatency(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := testBase()
+	key := MeshKey("n1", "t1")
+	for i, latency := range []int64{10, -1, 30, -1} {
+		s.Record(key, base.Add(time.Duration(i)*10*time.Second), latency)
+	}
+
+	got, err := s.Query(key, ResolutionMinute, base, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 平均值和最小/最大值只统计成功的探测
+	want := models.LatencyHistory{Timestamp: base.Unix(), Avg: 20, Min: 10, Max: 30, Loss: 50, Samples: 4, Failures: 2}
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("Query() = %+v, want [%+v]", got, want)
+	}
+
+	if !MeshKeyInvolves(key, "n1") || !MeshKeyInvolves(key, "t1") || MeshKeyInvolves(key, "n") {
+		t.Errorf("MeshKeyInvolves(%s) mismatch", key)
+	}
+	s.DeleteMatching(func(k string) bool { return MeshKeyInvolves(k, "t1") })
+	if got, _ := s.Query(key, ResolutionMinute, base, time.Now()); len(got) != 0 {
+		t.Errorf("Query() after delete = %+v", got)
+	}
+}
+
+func mustLevel(t *testing.T, resolution string) int {
+	t.Helper()
+	l, ok := levelIndex(resolution)
+	if !ok {
+		t.Fatalf("unknown resolution %s", resolution)
+	}
+	return l
+}
+
+func assertPoints(t *testing.T, got, want []models.TrafficHistory) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d points %+v, want %d %+v", len(got), got, len(want), want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("point %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentType 是 Prometheus 文本格式 0.0.4 的 Content-Type
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// 指标类型
+const (
+	Counter   = "counter"
+	Gauge     = "gauge"
+	Histogram = "histogram"
+)
+
+var startTime = time.Now()
+
+// Writer 按 Prometheus 文本格式输出指标。同名指标的样本需连续写入，Header 只写一次
+type Writer struct {
+	buf bytes.Buffer
+}
+
+// Header 写入指标的 HELP 和 TYPE 行
+func (w *Writer) Header(name, typ, help string) {
+	fmt.Fprintf(&w.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// Sample 写入一个样本，labels 为成对的标签名和值
+func (w *Writer) Sample(name string, value float64, labels ...string) {
+	w.buf.WriteString(name)
+	if len(labels) > 0 {
+		w.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.buf.WriteString(labels[i])
+			w.buf.WriteString(`="`)
+			w.buf.WriteString(escapeLabel(labels[i+1]))
+			w.buf.WriteByte('"')
+		}
+		w.buf.WriteByte('}')
+	}
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.buf.WriteByte('\n')
+}
+
+// Single 写入只有一个样本的指标
+func (w *Writer) Single(name, typ, help string, value float64, labels ...string) {
+	w.Header(name, typ, help)
+	w.Sample(name, value, labels...)
+}
+
+// Buckets 写入一个直方图的 _bucket、_sum、_count 样本。counts 为各桶（非累计）的次数，
+// 最后一项对应 +Inf，len(counts) == len(bounds)+1
+func (w *Writer) Buckets(name string, bounds []float64, counts []int64, sum float64, labels ...string) {
+	var cumulative int64
+	for i, c := range counts {
+		cumulative += c
+		le := "+Inf"
+		if i < len(bounds) {
+			le = strconv.FormatFloat(bounds[i], 'g', -1, 64)
+		}
+		w.Sample(name+"_bucket", float64(cumulative), append(labels[:len(labels):len(labels)], "le", le)...)
+	}
+	w.Sample(name+"_sum", sum, labels...)
+	w.Sample(name+"_count", float64(cumulative), labels...)
+}
+
+func (w *Writer) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+// Bool 把布尔值转换为 0/1
+func Bool(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// WriteRuntime 写入 Go 运行时和进程的基础指标
+func WriteRuntime(w *Writer) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	w.Single("go_goroutines", Gauge, "Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	w.Single("go_threads", Gauge, "Number of OS threads created.", float64(threadCount()))
+	w.Single("go_memstats_alloc_bytes", Gauge, "Number of bytes allocated and still in use.", float64(ms.Alloc))
+	w.Single("go_memstats_sys_bytes", Gauge, "Number of bytes obtained from system.", float64(ms.Sys))
+	w.Single("go_memstats_heap_inuse_bytes", Gauge, "Number of heap bytes that are in use.", float64(ms.HeapInuse))
+	w.Single("go_memstats_heap_objects", Gauge, "Number of allocated objects.", float64(ms.HeapObjects))
+	w.Single("go_gc_cycles_total", Counter, "Number of completed GC cycles.", float64(ms.NumGC))
+	w.Single("go_gc_pause_seconds_total", Counter, "Total GC stop-the-world pause time in seconds.", float64(ms.PauseTotalNs)/1e9)
+	w.Single("go_info", Gauge, "Information about the Go environment.", 1, "version", runtime.Version())
+	w.Single("process_start_time_seconds", Gauge, "Start time of the process since unix epoch in seconds.", float64(startTime.Unix()))
+}
+
+func threadCount() int {
+	n, _ := runtime.ThreadCreateProfile(nil)
+	return n
+}
+
+// ParseAllowList 解析 IP / CIDR 列表，单个 IP 视为 /32 或 /128
+func ParseAllowList(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", e)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", e)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
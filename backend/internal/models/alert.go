@@ -0,0 +1,98 @@
+package models
+
+// 告警条件
+const (
+	AlertNodeOffline  = "node_offline"  // 节点离线
+	AlertTunnelDown   = "tunnel_down"   // 已启用的规则隧道未运行
+	AlertLatencyHigh  = "latency_high"  // 目标延迟超过 Threshold 毫秒或不可达
+	AlertTrafficSpike = "traffic_spike" // 规则双向速率之和超过滑动基线的 Threshold 倍
+	AlertCPUHigh      = "cpu_high"      // 节点 CPU 超过 Threshold %
+	AlertMemHigh      = "mem_high"      // 节点内存超过 Threshold %
+)
+
+// 通知渠道类型
+const (
+	ChannelWebhook  = "webhook"
+	ChannelTelegram = "telegram"
+	ChannelEmail    = "email"
+)
+
+// 告警状态
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertRule 是一条告警规则。条件持续 Duration 秒后触发，恢复后发送恢复通知
+type AlertRule struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Enabled bool   `json:"enabled"`
+	// Target 限定节点 ID 或规则 ID，为空时作用于全部节点或规则；规则类条件填节点 ID 时作用于该节点上的规则
+	Target    string   `json:"target,omitempty"`
+	Threshold float64  `json:"threshold"`
+	Duration  int      `json:"duration"`
+	Channels  []string `json:"channels"`
+}
+
+// AlertChannel 是通知渠道，按 Type 使用对应字段
+type AlertChannel struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Enabled bool   `json:"enabled"`
+
+	// webhook：以 JSON POST 告警事件
+	URL string `json:"url,omitempty"`
+
+	// telegram：APIBase 默认为 https://api.telegram.org
+	BotToken string `json:"bot_token,omitempty"`
+	ChatID   string `json:"chat_id,omitempty"`
+	APIBase  string `json:"api_base,omitempty"`
+
+	// email：SMTP 服务器支持 STARTTLS 时自动启用
+	SMTPHost     string   `json:"smtp_host,omitempty"`
+	SMTPPort     int      `json:"smtp_port,omitempty"`
+	SMTPUsername string   `json:"smtp_username,omitempty"`
+	SMTPPassword string   `json:"smtp_password,omitempty"`
+	From         string   `json:"from,omitempty"`
+	To           []string `json:"to,omitempty"`
+}
+
+// AlertSilence 是静默窗口，期间匹配的告警照常记录但不发送通知。RuleID、Target 为空表示匹配全部
+type AlertSilence struct {
+	ID      string `json:"id"`
+	RuleID  string `json:"rule_id,omitempty"`
+	Target  string `json:"target,omitempty"`
+	StartAt int64  `json:"start_at"`
+	EndAt   int64  `json:"end_at"`
+	Comment string `json:"comment,omitempty"`
+	Creator string `json:"creator,omitempty"`
+}
+
+// Alert 是一次告警事件，Subject 为触发告警的节点或规则
+type Alert struct {
+	ID          string  `json:"id"`
+	RuleID      string  `json:"rule_id"`
+	RuleName    string  `json:"rule_name"`
+	Type        string  `json:"type"`
+	Subject     string  `json:"subject"`
+	SubjectName string  `json:"subject_name"`
+	NodeID      string  `json:"node_id,omitempty"`
+	State       string  `json:"state"`
+	Value       float64 `json:"value"`
+	Threshold   float64 `json:"threshold"`
+	Message     string  `json:"message"`
+	StartsAt    int64   `json:"starts_at"`
+	ResolvedAt  int64   `json:"resolved_at,omitempty"`
+	// Notified 表示触发通知已发送（未被静默），只有发送过触发通知的告警才发送恢复通知
+	Notified bool `json:"notified"`
+	Silenced bool `json:"silenced"`
+}
+
+// AlertOverview 是告警列表：当前活动的告警和最近恢复的告警
+type AlertOverview struct {
+	Active  []Alert `json:"active"`
+	History []Alert `json:"history"`
+}
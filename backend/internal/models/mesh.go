@@ -0,0 +1,92 @@
+package models
+
+// 延迟矩阵中探测对象的类型
+const (
+	MeshNode   = "node"
+	MeshTarget = "target"
+)
+
+// MeshProbeTarget 是除节点之外需要探测的关键目标
+type MeshProbeTarget struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+// MeshSettings 是节点间延迟探测的配置。Interval（秒）为 0 时关闭探测，
+// 开启后每个节点探测其余节点的 Agent 端口和全部 Targets
+type MeshSettings struct {
+	Interval int               `json:"interval"`
+	Timeout  int               `json:"timeout,omitempty"` // 毫秒，默认 3000
+	Targets  []MeshProbeTarget `json:"targets"`
+}
+
+// MeshPeer 是下发给 Agent 的一个探测对象，ID 为节点 ID 或目标 ID
+type MeshPeer struct {
+	ID   string `json:"id"`
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+// MeshSchedule 是下发给 Agent 的探测计划。Version 由内容计算，Agent 在状态中回报当前版本，
+// 不一致时主控重新下发；关闭探测时 Version 为空
+type MeshSchedule struct {
+	Version  string     `json:"version"`
+	Interval int        `json:"interval"`
+	Timeout  int        `json:"timeout"`
+	Peers    []MeshPeer `json:"peers"`
+}
+
+// MeshResult 是节点对一个探测对象最近一次 TCP 连接的耗时（毫秒，-1 表示失败）及窗口统计
+type MeshResult struct {
+	Peer      string `json:"peer"`
+	Latency   int64  `json:"latency"`
+	Error     string `json:"error,omitempty"`
+	LastProbe int64  `json:"last_probe"`
+	LatencyStats
+}
+
+// MeshStatus 是 Agent 在状态中上报的探测结果
+type MeshStatus struct {
+	Version string       `json:"version"`
+	Results []MeshResult `json:"results"`
+}
+
+// MeshEndpoint 是延迟矩阵的一行或一列，Online 只对节点有意义
+type MeshEndpoint struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Online bool   `json:"online"`
+}
+
+// MeshMatrix 是节点间延迟矩阵。Sources 为全部节点，Targets 为全部节点加关键目标，
+// Cells[i][j] 是 Sources[i] 到 Targets[j] 的结果，未探测（含节点自身）为 null
+type MeshMatrix struct {
+	Interval int             `json:"interval"`
+	Sources  []MeshEndpoint  `json:"sources"`
+	Targets  []MeshEndpoint  `json:"targets"`
+	Cells    [][]*MeshResult `json:"cells"`
+}
+
+// LatencyHistory 是一个时间桶内的探测汇总，延迟单位毫秒，Avg/Min/Max 只统计成功的探测
+type LatencyHistory struct {
+	Timestamp int64   `json:"timestamp"`
+	Avg       float64 `json:"avg"`
+	Min       int64   `json:"min"`
+	Max       int64   `json:"max"`
+	Loss      float64 `json:"loss"`
+	Samples   int     `json:"samples"`
+	Failures  int     `json:"failures"`
+}
+
+// MeshHistoryResult 是延迟历史查询的返回值
+type MeshHistoryResult struct {
+	Source     string           `json:"source"`
+	Target     string           `json:"target"`
+	Resolution string           `json:"resolution"`
+	From       int64            `json:"from"`
+	To         int64            `json:"to"`
+	Points     []LatencyHistory `json:"points"`
+}
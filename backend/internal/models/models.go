@@ -1,7 +1,9 @@
 package models
 
 import (
-	"sync/atomic"
+	"port-forward-common/conns"
+	"port-forward-common/probe"
+	"port-forward-common/timings"
 )
 
 type Protocol string
@@ -19,26 +21,35 @@ type Rule struct {
 	TargetPort int      `json:"target_port"`
 	Protocol   Protocol `json:"protocol"`
 	Enabled    bool     `json:"enabled"`
+	AccessLog  bool     `json:"access_log"`
 	CreatedAt  int64    `json:"created_at"`
+	// HealthCheck 为空时 TCP 规则探测 TCP 连接耗时，UDP 规则不探测
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
 }
 
+// HealthCheck 是规则的健康检查配置，实现在主控和 Agent 共用的 probe 包中
+type HealthCheck = probe.HealthCheck
+
 type TrafficStats struct {
-	BytesIn      atomic.Int64 `json:"-"`
-	BytesOut     atomic.Int64 `json:"-"`
-	BytesInRate  float64      `json:"bytes_in_rate"`
-	BytesOutRate float64      `json:"bytes_out_rate"`
-	TotalIn      int64        `json:"total_in"`
-	TotalOut     int64        `json:"total_out"`
-	Connections  atomic.Int32 `json:"-"`
-	ConnCount    int32        `json:"connections"`
+	BytesInRate  float64 `json:"bytes_in_rate"`
+	BytesOutRate float64 `json:"bytes_out_rate"`
+	TotalIn      int64   `json:"total_in"`
+	TotalOut     int64   `json:"total_out"`
+	ConnCount    int32   `json:"connections"`
 }
 
 type LatencyInfo struct {
 	Latency   int64  `json:"latency"` // ms
-	Status    string `json:"status"`  // normal, warning, error
+	Status    string `json:"status"`  // normal, warning, error, unknown（未配置探测）
 	LastCheck int64  `json:"last_check"`
+	Check     string `json:"check,omitempty"` // 健康检查类型
+	Error     string `json:"error,omitempty"` // 最近一次检查失败的原因
+	LatencyStats
 }
 
+// LatencyStats 是最近若干次健康检查的统计
+type LatencyStats = probe.Stats
+
 type TunnelStatus struct {
 	Rule     Rule         `json:"rule"`
 	Traffic  TrafficStats `json:"traffic"`
@@ -47,6 +58,20 @@ type TunnelStatus struct {
 	NodeHost string       `json:"node_host,omitempty"`
 }
 
+// ConnTimings 是规则上客户端连接的耗时统计，Histogram 是其中的耗时分布
+type (
+	ConnTimings = timings.ConnTimings
+	Histogram   = timings.Histogram
+)
+
+// ConnectionInfo 是隧道上一条活动连接的快照
+type ConnectionInfo = conns.Info
+
+// ConnectionCloseResult 是强制断开连接的结果
+type ConnectionCloseResult struct {
+	Closed int `json:"closed"`
+}
+
 type SystemStats struct {
 	CPUPercent    float64 `json:"cpu_percent"`
 	MemoryPercent float64 `json:"memory_percent"`
@@ -95,8 +120,22 @@ type DashboardData struct {
 	Timestamp int64          `json:"timestamp"`
 }
 
+// TrafficHistory 是一个时间桶内的流量汇总：速率为桶内平均值，Total 为桶结束时的累计字节数
 type TrafficHistory struct {
-	Timestamp int64   `json:"timestamp"`
-	RateIn    float64 `json:"rate_in"`
-	RateOut   float64 `json:"rate_out"`
+	Timestamp  int64   `json:"timestamp"`
+	RateIn     float64 `json:"rate_in"`
+	RateOut    float64 `json:"rate_out"`
+	MaxRateIn  float64 `json:"max_rate_in"`
+	MaxRateOut float64 `json:"max_rate_out"`
+	TotalIn    int64   `json:"total_in"`
+	TotalOut   int64   `json:"total_out"`
+	Samples    int     `json:"samples"`
+}
+
+// HistoryResult 是历史查询的返回值
+type HistoryResult struct {
+	Resolution string           `json:"resolution"`
+	From       int64            `json:"from"`
+	To         int64            `json:"to"`
+	Points     []TrafficHistory `json:"points"`
 }
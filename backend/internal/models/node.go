@@ -1,5 +1,7 @@
 package models
 
+import "encoding/json"
+
 type Node struct {
 	ID         string  `json:"id"`
 	Name       string  `json:"name"`
@@ -12,8 +14,40 @@ type Node struct {
 	Uptime     int64   `json:"uptime"`
 	LastSeen   int64   `json:"last_seen"`
 	CreatedAt  int64   `json:"created_at"`
+
+	// NodeSystem 是最近一次上报的主机资源状态
+	NodeSystem
+
+	// 密钥轮换：宽限期内旧密钥仍可使用，到期后退役
+	KeyCreatedAt         int64         `json:"key_created_at,omitempty"`
+	PreviousKey          string        `json:"previous_key,omitempty"`
+	PreviousKeyExpiresAt int64         `json:"previous_key_expires_at,omitempty"`
+	KeyHistory           []KeyRotation `json:"key_history,omitempty"`
+	// PendingKey 是已推送但 Agent 尚未确认的新密钥，Agent 用它签名心跳即视为轮换完成
+	PendingKey          string `json:"pending_key,omitempty"`
+	PendingKeyExpiresAt int64  `json:"pending_key_expires_at,omitempty"`
+
+	// 节点证书由主控 CA 签发，签发后控制通道使用 mTLS
+	CertSerial   string `json:"cert_serial,omitempty"`
+	CertNotAfter int64  `json:"cert_not_after,omitempty"`
 }
 
+// KeyRotation 记录一次密钥轮换，只保存密钥指纹
+type KeyRotation struct {
+	RotatedAt    int64  `json:"rotated_at"`
+	OldKeyID     string `json:"old_key_id"`
+	NewKeyID     string `json:"new_key_id"`
+	GraceSeconds int64  `json:"grace_seconds"`
+	Reason       string `json:"reason"`
+	PushedAgent  bool   `json:"pushed_agent"`
+}
+
+// 密钥轮换原因
+const (
+	KeyRotationAPI    = "api"
+	KeyRotationManual = "manual"
+)
+
 type NodeRule struct {
 	ID         string `json:"id"`
 	NodeID     string `json:"node_id"`
@@ -23,34 +57,100 @@ type NodeRule struct {
 	TargetPort int    `json:"target_port"`
 	Protocol   string `json:"protocol"`
 	Enabled    bool   `json:"enabled"`
+	AccessLog  bool   `json:"access_log"`
 	CreatedAt  int64  `json:"created_at"`
+	// HealthCheck 由 Agent 执行，为空时与本地规则相同：TCP 规则探测连接耗时，UDP 规则不探测
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+}
+
+// NodeSystem 是节点上报的主机资源状态。网络速率为所选网卡之和（默认排除回环和容器网桥），
+// 磁盘为 Agent 指定路径所在的文件系统，文件描述符为 Agent 进程的打开数和上限
+type NodeSystem struct {
+	NetRateIn   float64 `json:"net_rate_in"`
+	NetRateOut  float64 `json:"net_rate_out"`
+	DiskPercent float64 `json:"disk_percent"`
+	DiskUsed    uint64  `json:"disk_used"`
+	DiskTotal   uint64  `json:"disk_total"`
+	Load1       float64 `json:"load1"`
+	Load5       float64 `json:"load5"`
+	Load15      float64 `json:"load15"`
+	OpenFDs     int64   `json:"open_fds"`
+	MaxFDs      int64   `json:"max_fds"`
+}
+
+// InterfaceStats 是单个网卡的累计字节数和速率（字节/秒）
+type InterfaceStats struct {
+	Name     string  `json:"name"`
+	BytesIn  uint64  `json:"bytes_in"`
+	BytesOut uint64  `json:"bytes_out"`
+	RateIn   float64 `json:"rate_in"`
+	RateOut  float64 `json:"rate_out"`
 }
 
 type NodeStatus struct {
-	NodeKey     string             `json:"node_key"`
 	NodeName    string             `json:"node_name"`
 	Online      bool               `json:"online"`
 	CPUPercent  float64            `json:"cpu_percent"`
 	MemPercent  float64            `json:"mem_percent"`
-	NetRateIn   float64            `json:"net_rate_in"`
-	NetRateOut  float64            `json:"net_rate_out"`
 	Uptime      int64              `json:"uptime"`
 	TunnelCount int                `json:"tunnel_count"`
 	Tunnels     []NodeTunnelStatus `json:"tunnels"`
+
+	NodeSystem
+	Interfaces []InterfaceStats `json:"interfaces,omitempty"`
+
+	// HeartbeatInterval 是节点上报心跳的间隔（秒），主控据此计算心跳超时
+	HeartbeatInterval int `json:"heartbeat_interval,omitempty"`
+	// StateRevision 是 Agent 本地状态文件的版本号
+	StateRevision int64 `json:"state_revision"`
+
+	Version string             `json:"version"`
+	OS      string             `json:"os"`
+	Arch    string             `json:"arch"`
+	Update  *AgentUpdateStatus `json:"update,omitempty"`
+
+	// Mesh 是节点间延迟探测的结果，未下发探测计划时为空
+	Mesh *MeshStatus `json:"mesh,omitempty"`
 }
 
 type NodeTunnelStatus struct {
-	ID         string  `json:"id"`
-	LocalPort  int     `json:"local_port"`
-	TargetIP   string  `json:"target_ip"`
-	TargetPort int     `json:"target_port"`
-	Protocol   string  `json:"protocol"`
-	Running    bool    `json:"running"`
-	BytesIn    int64   `json:"bytes_in"`
-	BytesOut   int64   `json:"bytes_out"`
-	RateIn     float64 `json:"rate_in"`
-	RateOut    float64 `json:"rate_out"`
-	Latency    int64   `json:"latency"`
+	ID          string  `json:"id"`
+	LocalPort   int     `json:"local_port"`
+	TargetIP    string  `json:"target_ip"`
+	TargetPort  int     `json:"target_port"`
+	Protocol    string  `json:"protocol"`
+	Enabled     bool    `json:"enabled"`
+	Running     bool    `json:"running"`
+	AccessLog   bool    `json:"access_log"`
+	BytesIn     int64   `json:"bytes_in"`
+	BytesOut    int64   `json:"bytes_out"`
+	RateIn      float64 `json:"rate_in"`
+	RateOut     float64 `json:"rate_out"`
+	Latency     int64   `json:"latency"`
+	Connections int     `json:"connections"`
+
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+	// ProbeError 是最近一次健康检查失败的原因，LastProbe 是检查时间（Unix 秒，0 表示尚未检查）
+	ProbeError string `json:"probe_error,omitempty"`
+	LastProbe  int64  `json:"last_probe,omitempty"`
+	LatencyStats
+
+	Timings *ConnTimings `json:"timings,omitempty"`
+}
+
+// TrafficUsage 是一个计费周期内的流量，Period 为本地日期 2006-01-02 或月份 2006-01
+type TrafficUsage struct {
+	Period   string `json:"period"`
+	BytesIn  int64  `json:"bytes_in"`
+	BytesOut int64  `json:"bytes_out"`
+}
+
+// TrafficUsageReport 是规则或节点的累计流量及按日、按月的统计（新的在前）
+type TrafficUsageReport struct {
+	TotalIn  int64          `json:"total_in"`
+	TotalOut int64          `json:"total_out"`
+	Daily    []TrafficUsage `json:"daily"`
+	Monthly  []TrafficUsage `json:"monthly"`
 }
 
 type NodeWithStatus struct {
@@ -60,4 +160,219 @@ type NodeWithStatus struct {
 	TotalIn       int64              `json:"total_in"`
 	TotalOut      int64              `json:"total_out"`
 	Tunnels       []NodeTunnelStatus `json:"tunnels,omitempty"`
+	Interfaces    []InterfaceStats   `json:"interfaces,omitempty"`
+
+	// LastHeartbeatAge 距上次心跳的秒数，从未收到心跳时为 -1
+	LastHeartbeatAge int64 `json:"last_heartbeat_age"`
+	// DetectionMode 当前在线状态的判定来源：heartbeat、poll 或 none
+	DetectionMode string `json:"detection_mode"`
+
+	// StateRevision 是 Agent 上报的状态版本，StateStale 表示它落后于主控已下发的版本
+	StateRevision int64 `json:"state_revision"`
+	StateStale    bool  `json:"state_stale"`
+
+	// KeyAge 当前密钥的使用时长（秒），用于执行轮换策略
+	KeyAge int64 `json:"key_age"`
+	// CertExpiresIn 节点证书剩余有效期（秒），未签发证书时为 -1
+	CertExpiresIn int64 `json:"cert_expires_in"`
+
+	AgentVersion string             `json:"agent_version,omitempty"`
+	AgentOS      string             `json:"agent_os,omitempty"`
+	AgentArch    string             `json:"agent_arch,omitempty"`
+	Update       *AgentUpdateStatus `json:"update,omitempty"`
+	Uninstall    *UninstallStatus   `json:"uninstall,omitempty"`
+}
+
+// 节点在线状态的判定来源
+const (
+	DetectionHeartbeat = "heartbeat"
+	DetectionPoll      = "poll"
+	DetectionNone      = "none"
+)
+
+// HeartbeatAuthStats 汇总心跳认证失败次数，Sources 按来源 IP 记录
+type HeartbeatAuthStats struct {
+	UnknownKey   int64                         `json:"unknown_key"`
+	BadSignature int64                         `json:"bad_signature"`
+	Replayed     int64                         `json:"replayed"`
+	Sources      map[string]*AuthFailureSource `json:"sources"`
+}
+
+type AuthFailureSource struct {
+	Count     int64  `json:"count"`
+	LastSeen  int64  `json:"last_seen"`
+	LastKeyID string `json:"last_key_id"`
+	LastError string `json:"last_error"`
+}
+
+// 规则在节点上的同步状态
+const (
+	SyncSynced  = "synced"
+	SyncPending = "pending"
+	SyncError   = "error"
+)
+
+type RuleSync struct {
+	State     string `json:"state"`
+	Message   string `json:"message,omitempty"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+type NodeRuleWithSync struct {
+	NodeRule
+	Sync RuleSync `json:"sync"`
+}
+
+// TunnelSyncResult 是批量同步中单条隧道的处理结果
+type TunnelSyncResult struct {
+	ID      string `json:"id"`
+	Action  string `json:"action"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+type NodeSyncResult struct {
+	Revision int64              `json:"revision"`
+	Results  []TunnelSyncResult `json:"results"`
+}
+
+// AgentArtifact 描述主控提供下载的某个平台的 Agent 二进制，Signature 是对更新清单（版本、平台、SHA256）的签名
+type AgentArtifact struct {
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	Version   string `json:"version"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature"`
+}
+
+// AgentUpdate 是下发给 Agent 的更新指令，URL 可以是相对主控地址的路径
+type AgentUpdate struct {
+	Version   string `json:"version"`
+	URL       string `json:"url"`
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature"`
+}
+
+// Agent 自更新状态
+const (
+	UpdateRequested  = "requested"
+	UpdateTrial      = "trial"
+	UpdateCompleted  = "completed"
+	UpdateRolledBack = "rolled_back"
+	UpdateFailed     = "failed"
+)
+
+type AgentUpdateStatus struct {
+	State     string `json:"state"`
+	Version   string `json:"version"`
+	Message   string `json:"message,omitempty"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// EnrollToken 是一次性的节点注册令牌，明文 Token 只在创建时返回一次
+type EnrollToken struct {
+	ID        string `json:"id"`
+	Token     string `json:"token,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Port      int    `json:"port,omitempty"`
+	ExpiresAt int64  `json:"expires_at"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// EnrollRequest 是 Agent 使用注册令牌加入时提交的信息
+type EnrollRequest struct {
+	Token string `json:"token"`
+	Name  string `json:"name"`
+	Port  int    `json:"port"`
+	// CSR 是 Agent 本地生成密钥后提交的证书请求，私钥不离开节点
+	CSR string `json:"csr,omitempty"`
+}
+
+// EnrollResult 是主控为新节点签发的身份
+type EnrollResult struct {
+	NodeID string `json:"node_id"`
+	Name   string `json:"name"`
+	Key    string `json:"key"`
+	Cert   string `json:"cert,omitempty"`
+	CACert string `json:"ca_cert,omitempty"`
+}
+
+// SignedCommand 是主控用发布密钥签名的控制指令。Payload 为 base64 编码的指令 JSON，
+// Signature 是对解码后原始字节的 ed25519 签名
+type SignedCommand struct {
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// UninstallCommand 是卸载指令的内容，只对 KeyID 对应的节点在有效期内生效一次
+type UninstallCommand struct {
+	Action    string `json:"action"`
+	NodeID    string `json:"node_id"`
+	KeyID     string `json:"key_id"`
+	Nonce     string `json:"nonce"`
+	IssuedAt  int64  `json:"issued_at"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// CommandUninstall 是卸载指令的 Action
+const CommandUninstall = "uninstall"
+
+// UninstallConfirmation 是卸载第一步返回的确认令牌，需在有效期内提交确认
+type UninstallConfirmation struct {
+	NodeID       string `json:"node_id"`
+	NodeName     string `json:"node_name"`
+	ConfirmToken string `json:"confirm_token"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+// UninstallReport 是 Agent 执行卸载后回报的结果
+type UninstallReport struct {
+	Nonce   string `json:"nonce"`
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
+}
+
+// 远程卸载状态
+const (
+	UninstallSent      = "sent"
+	UninstallCompleted = "completed"
+	UninstallFailed    = "failed"
+)
+
+type UninstallStatus struct {
+	State     string `json:"state"`
+	Message   string `json:"message,omitempty"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// 节点诊断类型，Agent 只执行这些内置检查
+const (
+	DiagnosticTCPConnect  = "tcp_connect"
+	DiagnosticDNS         = "dns"
+	DiagnosticTraceroute  = "traceroute"
+	DiagnosticListenCheck = "listen_check"
+	DiagnosticConnections = "connections"
+)
+
+// DiagnosticRequest 是下发给 Agent 的诊断请求。指定 TunnelID 时，
+// 未填写的目标地址、端口和协议取自该隧道
+type DiagnosticRequest struct {
+	Type      string `json:"type"`
+	Target    string `json:"target,omitempty"`
+	Port      int    `json:"port,omitempty"`
+	Protocol  string `json:"protocol,omitempty"`
+	TunnelID  string `json:"tunnel_id,omitempty"`
+	Count     int    `json:"count,omitempty"`
+	TimeoutMs int    `json:"timeout_ms,omitempty"`
+	MaxHops   int    `json:"max_hops,omitempty"`
+}
+
+// DiagnosticResult 是 Agent 返回的诊断结果，Data 的结构随诊断类型而不同
+type DiagnosticResult struct {
+	Type       string          `json:"type"`
+	Success    bool            `json:"success"`
+	Error      string          `json:"error,omitempty"`
+	DurationMs float64         `json:"duration_ms"`
+	Data       json.RawMessage `json:"data,omitempty"`
 }
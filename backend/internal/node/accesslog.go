@@ -0,0 +1,49 @@
+package node
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"port-forward-common/accesslog"
+)
+
+// ReadAccessLog 从节点 Agent 拉取符合条件的最近访问日志
+func (m *Manager) ReadAccessLog(id string, f accesslog.Filter) ([]accesslog.Entry, error) {
+	m.mu.RLock()
+	info, exists := m.nodes[id]
+	if !exists {
+		m.mu.RUnlock()
+		return nil, fmt.Errorf("node %s not found", id)
+	}
+	node := info.Node
+	m.mu.RUnlock()
+
+	if !node.Online {
+		return nil, fmt.Errorf("node %s is offline", id)
+	}
+
+	query := url.Values{}
+	for key, value := range map[string]string{
+		"rule_id":   f.RuleID,
+		"client_ip": f.ClientIP,
+		"event":     f.Event,
+		"reason":    f.Reason,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if f.Since > 0 {
+		query.Set("since", strconv.FormatInt(f.Since, 10))
+	}
+	if f.Limit > 0 {
+		query.Set("limit", strconv.Itoa(f.Limit))
+	}
+
+	entries := []accesslog.Entry{}
+	if err := m.nodeRequest(node, "GET", "/access-log?"+query.Encode(), nil, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
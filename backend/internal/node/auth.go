@@ -0,0 +1,225 @@
+package node
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"port-forward-common/signing"
+	"port-forward-dashboard/internal/models"
+)
+
+const (
+	// heartbeatClockSkew 心跳时间戳允许的最大偏差
+	heartbeatClockSkew = 5 * time.Minute
+	// maxTrackedProbeIPs 记录未知 Key 来源 IP 的上限，防止被刷爆内存
+	maxTrackedProbeIPs = 1024
+)
+
+var (
+	ErrMissingAuth    = errors.New("heartbeat signature required")
+	ErrUnknownKey     = errors.New("unknown node key")
+	ErrBadSignature   = errors.New("invalid heartbeat signature")
+	ErrStaleTimestamp = errors.New("heartbeat timestamp outside allowed window")
+	ErrReplay         = errors.New("heartbeat nonce already used")
+)
+
+// HeartbeatAuth 是 Agent 心跳请求头中携带的签名信息
+type HeartbeatAuth struct {
+	KeyID      string
+	Timestamp  string
+	Nonce      string
+	Signature  string
+	RemoteAddr string
+}
+
+// nonceCache 记录时间窗口内用过的 nonce，用于拒绝重放。
+// 过期时间都是登记时间加固定窗口，queue 按登记顺序即按过期顺序排列，清理只需从队首弹出
+type nonceCache struct {
+	seen  map[string]time.Time
+	queue []nonceEntry
+	head  int
+	mu    sync.Mutex
+}
+
+type nonceEntry struct {
+	key     string
+	expires time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{seen: make(map[string]time.Time)}
+}
+
+// use 登记一个 nonce，已存在时返回 false
+func (c *nonceCache) use(keyID, nonce string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.prune(now)
+
+	k := keyID + ":" + nonce
+	if _, exists := c.seen[k]; exists {
+		return false
+	}
+	expires := now.Add(2 * heartbeatClockSkew)
+	c.seen[k] = expires
+	c.queue = append(c.queue, nonceEntry{key: k, expires: expires})
+	return true
+}
+
+// prune 从队首移除已过期的 nonce，调用方需持有锁
+func (c *nonceCache) prune(now time.Time) {
+	for c.head < len(c.queue) && now.After(c.queue[c.head].expires) {
+		delete(c.seen, c.queue[c.head].key)
+		c.queue[c.head] = nonceEntry{}
+		c.head++
+	}
+	// 已弹出的部分超过一半时再整体前移，摊还后每次登记为常数开销
+	if c.head > 0 && c.head*2 >= len(c.queue) {
+		c.queue = append(c.queue[:0], c.queue[c.head:]...)
+		c.head = 0
+	}
+}
+
+// authFailures 统计心跳认证失败，便于发现探测行为
+type authFailures struct {
+	stats models.HeartbeatAuthStats
+	mu    sync.Mutex
+}
+
+func newAuthFailures() *authFailures {
+	return &authFailures{
+		stats: models.HeartbeatAuthStats{Sources: make(map[string]*models.AuthFailureSource)},
+	}
+}
+
+func (f *authFailures) record(err error, auth HeartbeatAuth) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case errors.Is(err, ErrUnknownKey):
+		f.stats.UnknownKey++
+	case errors.Is(err, ErrBadSignature), errors.Is(err, ErrMissingAuth):
+		f.stats.BadSignature++
+	case errors.Is(err, ErrReplay), errors.Is(err, ErrStaleTimestamp):
+		f.stats.Replayed++
+	default:
+		return
+	}
+
+	if auth.RemoteAddr == "" {
+		return
+	}
+	src, exists := f.stats.Sources[auth.RemoteAddr]
+	if !exists {
+		if len(f.stats.Sources) >= maxTrackedProbeIPs {
+			return
+		}
+		src = &models.AuthFailureSource{}
+		f.stats.Sources[auth.RemoteAddr] = src
+	}
+	src.Count++
+	src.LastSeen = time.Now().Unix()
+	src.LastKeyID = auth.KeyID
+	src.LastError = err.Error()
+}
+
+func (f *authFailures) snapshot() models.HeartbeatAuthStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := f.stats
+	out.Sources = make(map[string]*models.AuthFailureSource, len(f.stats.Sources))
+	for ip, src := range f.stats.Sources {
+		s := *src
+		out.Sources[ip] = &s
+	}
+	return out
+}
+
+// verifyHeartbeat 校验签名、时间戳和 nonce，返回签名对应的节点。调用方需持有读锁
+func (m *Manager) verifyHeartbeat(auth HeartbeatAuth, body []byte) (*NodeInfo, error) {
+	if auth.KeyID == "" || auth.Timestamp == "" || auth.Nonce == "" || auth.Signature == "" {
+		return nil, ErrMissingAuth
+	}
+
+	// 轮换宽限期内旧密钥仍然有效
+	now := time.Now()
+	var info *NodeInfo
+	var key string
+	for _, n := range m.nodes {
+		for _, k := range acceptedKeys(&n.Node, now) {
+			if signing.KeyID(k) == auth.KeyID {
+				info, key = n, k
+				break
+			}
+		}
+		if info != nil {
+			break
+		}
+	}
+	if info == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, auth.KeyID)
+	}
+
+	expected := signing.SignHeartbeat(key, auth.Timestamp, auth.Nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(auth.Signature)) {
+		return nil, ErrBadSignature
+	}
+
+	ts, err := strconv.ParseInt(auth.Timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrStaleTimestamp
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > heartbeatClockSkew || d < -heartbeatClockSkew {
+		return nil, ErrStaleTimestamp
+	}
+
+	if !m.nonces.use(auth.KeyID, auth.Nonce, now) {
+		return nil, ErrReplay
+	}
+
+	return info, nil
+}
+
+// HandleHeartbeat 校验并处理 Agent 推送的心跳。心跳由待确认的新密钥签名时完成密钥轮换，
+// 返回的 keyRotated 为 true 时调用方需保存节点配置
+func (m *Manager) HandleHeartbeat(auth HeartbeatAuth, body []byte) (keyRotated bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info, err := m.verifyHeartbeat(auth, body)
+	if err != nil {
+		m.authFailures.record(err, auth)
+		return false, err
+	}
+
+	var status models.NodeStatus
+	if err := json.Unmarshal(body, &status); err != nil {
+		return false, fmt.Errorf("invalid heartbeat body: %v", err)
+	}
+
+	if info.Node.PendingKey != "" && auth.KeyID == signing.KeyID(info.Node.PendingKey) {
+		promotePendingKey(&info.Node, time.Now())
+		keyRotated = true
+		log.Printf("Node %s confirmed key rotation by heartbeat", info.Node.ID)
+	}
+
+	m.applyStatus(info, &status)
+	info.LastHeartbeat = time.Now()
+	info.HeartbeatInterval = time.Duration(status.HeartbeatInterval) * time.Second
+	info.DetectionMode = models.DetectionHeartbeat
+	return keyRotated, nil
+}
+
+// GetHeartbeatAuthStats 返回心跳认证失败的统计
+func (m *Manager) GetHeartbeatAuthStats() models.HeartbeatAuthStats {
+	return m.authFailures.snapshot()
+}
@@ -0,0 +1,140 @@
+package node
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"port-forward-common/signing"
+	"port-forward-dashboard/internal/models"
+)
+
+type nonceStep struct {
+	key, nonce string
+	at         time.Duration
+	want       bool
+}
+
+func TestNonceCache(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	window := 2 * heartbeatClockSkew
+
+	tests := []struct {
+		name  string
+		steps []nonceStep
+	}{
+		{"first use accepted", []nonceStep{
+			{"k1", "n1", 0, true},
+		}},
+		{"replay rejected", []nonceStep{
+			{"k1", "n1", 0, true},
+			{"k1", "n1", time.Second, false},
+			{"k1", "n1", window, false},
+		}},
+		{"same nonce under another key", []nonceStep{
+			{"k1", "n1", 0, true},
+			{"k2", "n1", 0, true},
+		}},
+		{"reusable after expiry", []nonceStep{
+			{"k1", "n1", 0, true},
+			{"k1", "n1", window + time.Second, true},
+			{"k1", "n1", window + 2*time.Second, false},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newNonceCache()
+			for i, s := range tt.steps {
+				if got := c.use(s.key, s.nonce, base.Add(s.at)); got != s.want {
+					t.Fatalf("step %d: use(%s, %s) = %v, want %v", i, s.key, s.nonce, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNonceCachePrunesExpired(t *testing.T) {
+	c := newNonceCache()
+	base := time.Unix(1700000000, 0)
+	for i := 0; i < 100; i++ {
+		c.use("k", strconv.Itoa(i), base.Add(time.Duration(i)*time.Second))
+	}
+
+	// 前 50 个已过期，后 50 个仍在窗口内
+	now := base.Add(2*heartbeatClockSkew + 50*time.Second - time.Millisecond)
+	c.use("k", "probe", now)
+	if got, want := len(c.seen), 51; got != want {
+		t.Fatalf("len(seen) = %d, want %d", got, want)
+	}
+	if got := len(c.queue) - c.head; got != len(c.seen) {
+		t.Fatalf("queue holds %d live entries, seen holds %d", got, len(c.seen))
+	}
+	if c.use("k", "60", now) {
+		t.Fatal("nonce still inside the window was accepted twice")
+	}
+}
+
+func TestVerifyHeartbeat(t *testing.T) {
+	const key = "current-key"
+	const oldKey = "previous-key"
+	body := []byte(`{"uptime":1}`)
+	now := time.Now()
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	signed := func(k, ts, nonce string) HeartbeatAuth {
+		return HeartbeatAuth{KeyID: signing.KeyID(k), Timestamp: ts, Nonce: nonce, Signature: signing.SignHeartbeat(k, ts, nonce, body)}
+	}
+
+	tests := []struct {
+		name    string
+		prevExp int64
+		auth    HeartbeatAuth
+		wantErr error
+	}{
+		{"valid", 0, signed(key, ts, "a"), nil},
+		{"missing signature", 0, HeartbeatAuth{KeyID: signing.KeyID(key), Timestamp: ts, Nonce: "a"}, ErrMissingAuth},
+		{"unknown key", 0, signed("other", ts, "a"), ErrUnknownKey},
+		{"bad signature", 0, HeartbeatAuth{KeyID: signing.KeyID(key), Timestamp: ts, Nonce: "a", Signature: signing.SignHeartbeat(key, ts, "b", body)}, ErrBadSignature},
+		{"stale timestamp", 0, signed(key, strconv.FormatInt(now.Add(-heartbeatClockSkew-time.Minute).Unix(), 10), "a"), ErrStaleTimestamp},
+		{"future timestamp", 0, signed(key, strconv.FormatInt(now.Add(heartbeatClockSkew+time.Minute).Unix(), 10), "a"), ErrStaleTimestamp},
+		{"malformed timestamp", 0, signed(key, "yesterday", "a"), ErrStaleTimestamp},
+		{"previous key in grace", now.Add(time.Hour).Unix(), signed(oldKey, ts, "a"), nil},
+		{"previous key expired", now.Add(-time.Second).Unix(), signed(oldKey, ts, "a"), ErrUnknownKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manager{
+				nodes: map[string]*NodeInfo{
+					"n1": {Node: models.Node{ID: "n1", Key: key, PreviousKey: oldKey, PreviousKeyExpiresAt: tt.prevExp}},
+				},
+				nonces: newNonceCache(),
+			}
+			info, err := m.verifyHeartbeat(tt.auth, body)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("verifyHeartbeat() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && info.Node.ID != "n1" {
+				t.Fatalf("verifyHeartbeat() node = %s, want n1", info.Node.ID)
+			}
+		})
+	}
+}
+
+func TestVerifyHeartbeatReplay(t *testing.T) {
+	const key = "current-key"
+	body := []byte(`{}`)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	auth := HeartbeatAuth{KeyID: signing.KeyID(key), Timestamp: ts, Nonce: "n", Signature: signing.SignHeartbeat(key, ts, "n", body)}
+
+	m := &Manager{
+		nodes:  map[string]*NodeInfo{"n1": {Node: models.Node{ID: "n1", Key: key}}},
+		nonces: newNonceCache(),
+	}
+	if _, err := m.verifyHeartbeat(auth, body); err != nil {
+		t.Fatalf("first heartbeat: %v", err)
+	}
+	if _, err := m.verifyHeartbeat(auth, body); !errors.Is(err, ErrReplay) {
+		t.Fatalf("replayed heartbeat error = %v, want %v", err, ErrReplay)
+	}
+}
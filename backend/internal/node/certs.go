@@ -0,0 +1,55 @@
+package node
+
+import (
+	"fmt"
+
+	"port-forward-dashboard/internal/models"
+)
+
+// CACertPEM 返回主控 CA 证书，随节点证书一起下发给 Agent
+func (m *Manager) CACertPEM() string {
+	return m.ca.CertPEM()
+}
+
+// RenewCert 为已启用 mTLS 的节点续签证书：Agent 生成新密钥并提交 CSR，
+// 主控签发后推送回去，Agent 热替换证书，控制通道不中断
+func (m *Manager) RenewCert(id string) (models.Node, error) {
+	m.mu.RLock()
+	info, exists := m.nodes[id]
+	if !exists {
+		m.mu.RUnlock()
+		return models.Node{}, fmt.Errorf("node %s not found", id)
+	}
+	node := info.Node
+	m.mu.RUnlock()
+
+	if node.CertSerial == "" {
+		return models.Node{}, fmt.Errorf("node %s has no certificate, re-enroll it to enable mTLS", id)
+	}
+
+	var csr struct {
+		CSR string `json:"csr"`
+	}
+	if err := m.nodeRequest(node, "POST", "/cert/csr", nil, &csr); err != nil {
+		return models.Node{}, err
+	}
+
+	certPEM, cert, err := m.ca.SignAgentCSR(csr.CSR, node.ID)
+	if err != nil {
+		return models.Node{}, err
+	}
+
+	if err := m.nodeRequest(node, "PUT", "/cert", map[string]string{"cert": certPEM}, nil); err != nil {
+		return models.Node{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cur, ok := m.nodes[id]; !ok || cur != info {
+		return models.Node{}, fmt.Errorf("node %s was removed during certificate renewal", id)
+	}
+	info.Node.CertSerial = cert.SerialNumber.Text(16)
+	info.Node.CertNotAfter = cert.NotAfter.Unix()
+	return info.Node, nil
+}
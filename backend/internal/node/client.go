@@ -0,0 +1,149 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"port-forward-dashboard/internal/models"
+)
+
+// agentError 是 Agent 返回的非 200 响应
+type agentError struct {
+	Status  int
+	Message string
+}
+
+func (e *agentError) Error() string {
+	return fmt.Sprintf("node returned error: %s", e.Message)
+}
+
+// nodeRequest 向节点 Agent 发送控制请求，非 200 响应时返回 Agent 给出的错误信息。
+// out 不为 nil 时解析响应中的 data 字段
+func (m *Manager) nodeRequest(node models.Node, method, path string, payload, out interface{}) error {
+	return m.nodeRequestTimeout(node, method, path, payload, out, requestTimeout)
+}
+
+// nodeRequestTimeout 与 nodeRequest 相同，用于诊断等耗时较长的请求
+func (m *Manager) nodeRequestTimeout(node models.Node, method, path string, payload, out interface{}, timeout time.Duration) error {
+	url := nodeURL(node, path)
+
+	var body io.Reader
+	if payload != nil {
+		data, _ := json.Marshal(payload)
+		body = bytes.NewReader(data)
+	}
+
+	req, _ := http.NewRequest(method, url, body)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-Node-Key", node.Key)
+
+	resp, err := m.httpClient(node, timeout).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to node: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var result models.APIResponse
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, &result) != nil || result.Message == "" {
+			result.Message = string(data)
+		}
+		return &agentError{Status: resp.StatusCode, Message: result.Message}
+	}
+
+	if out != nil {
+		result := models.APIResponse{Data: out}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("invalid node response: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// tunnelOpResult 是 Agent 隧道操作的响应，Revision 为操作后的状态版本
+type tunnelOpResult struct {
+	Revision int64 `json:"revision"`
+}
+
+func (m *Manager) createTunnelOnNode(node models.Node, rule models.NodeRule) error {
+	payload := map[string]interface{}{
+		"id":          rule.ID,
+		"local_port":  rule.LocalPort,
+		"target_ip":   rule.TargetIP,
+		"target_port": rule.TargetPort,
+		"protocol":    rule.Protocol,
+		"auto_start":  rule.Enabled,
+		"access_log":  rule.AccessLog,
+	}
+	if rule.HealthCheck != nil {
+		payload["health_check"] = rule.HealthCheck
+	}
+	return m.tunnelOp(node, "POST", "/tunnels", payload)
+}
+
+// syncTunnelsOnNode 把节点的完整期望隧道集合一次性下发给 Agent
+func (m *Manager) syncTunnelsOnNode(node models.Node, rules []models.NodeRule) (*models.NodeSyncResult, error) {
+	specs := make([]map[string]interface{}, 0, len(rules))
+	for _, rule := range rules {
+		spec := map[string]interface{}{
+			"id":          rule.ID,
+			"local_port":  rule.LocalPort,
+			"target_ip":   rule.TargetIP,
+			"target_port": rule.TargetPort,
+			"protocol":    rule.Protocol,
+			"enabled":     rule.Enabled,
+			"access_log":  rule.AccessLog,
+		}
+		if rule.HealthCheck != nil {
+			spec["health_check"] = rule.HealthCheck
+		}
+		specs = append(specs, spec)
+	}
+
+	var result models.NodeSyncResult
+	payload := map[string]interface{}{"tunnels": specs}
+	if err := m.nodeRequest(node, "PUT", "/tunnels", payload, &result); err != nil {
+		return nil, err
+	}
+	m.recordRevision(node.ID, result.Revision)
+	return &result, nil
+}
+
+func (m *Manager) deleteTunnelOnNode(node models.Node, ruleID string) error {
+	return m.tunnelOp(node, "DELETE", "/tunnels/"+ruleID, nil)
+}
+
+func (m *Manager) startTunnelOnNode(node models.Node, ruleID string) error {
+	return m.tunnelOp(node, "POST", "/tunnels/"+ruleID+"/start", nil)
+}
+
+func (m *Manager) stopTunnelOnNode(node models.Node, ruleID string) error {
+	return m.tunnelOp(node, "POST", "/tunnels/"+ruleID+"/stop", nil)
+}
+
+// tunnelOp 执行隧道操作并记录 Agent 返回的状态版本
+func (m *Manager) tunnelOp(node models.Node, method, path string, payload interface{}) error {
+	var result tunnelOpResult
+	if err := m.nodeRequest(node, method, path, payload, &result); err != nil {
+		return err
+	}
+	m.recordRevision(node.ID, result.Revision)
+	return nil
+}
+
+func (m *Manager) recordRevision(nodeID string, revision int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if info, ok := m.nodes[nodeID]; ok && revision > info.AppliedRevision {
+		info.AppliedRevision = revision
+	}
+}
@@ -0,0 +1,100 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"port-forward-dashboard/internal/models"
+)
+
+var ErrConnectionNotFound = errors.New("connection not found")
+
+// ruleNode 返回规则所在的在线节点
+func (m *Manager) ruleNode(ruleID string) (models.Node, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rule, exists := m.rules[ruleID]
+	if !exists {
+		return models.Node{}, fmt.Errorf("rule %s not found", ruleID)
+	}
+	info, exists := m.nodes[rule.NodeID]
+	if !exists {
+		return models.Node{}, fmt.Errorf("node %s not found", rule.NodeID)
+	}
+	if !info.Node.Online {
+		return models.Node{}, fmt.Errorf("node %s is offline", rule.NodeID)
+	}
+	return info.Node, nil
+}
+
+// GetConnections 查询节点规则当前的活动连接
+func (m *Manager) GetConnections(ruleID string) ([]models.ConnectionInfo, error) {
+	node, err := m.ruleNode(ruleID)
+	if err != nil {
+		return nil, err
+	}
+
+	conns := []models.ConnectionInfo{}
+	if err := m.nodeRequest(node, "GET", "/tunnels/"+url.PathEscape(ruleID)+"/connections", nil, &conns); err != nil {
+		return nil, err
+	}
+	return conns, nil
+}
+
+// CloseConnection 让 Agent 强制断开规则上的一条连接
+func (m *Manager) CloseConnection(ruleID, connID string) error {
+	node, err := m.ruleNode(ruleID)
+	if err != nil {
+		return err
+	}
+
+	path := "/tunnels/" + url.PathEscape(ruleID) + "/connections/" + url.PathEscape(connID)
+	err = m.nodeRequest(node, "DELETE", path, nil, nil)
+	var agentErr *agentError
+	if errors.As(err, &agentErr) && agentErr.Status == http.StatusNotFound {
+		return ErrConnectionNotFound
+	}
+	return err
+}
+
+// CloseConnectionsFrom 让 Agent 断开规则上来自指定源 IP 的所有连接
+func (m *Manager) CloseConnectionsFrom(ruleID string, ip net.IP) (int, error) {
+	node, err := m.ruleNode(ruleID)
+	if err != nil {
+		return 0, err
+	}
+
+	var result models.ConnectionCloseResult
+	path := "/tunnels/" + url.PathEscape(ruleID) + "/connections?source_ip=" + url.QueryEscape(ip.String())
+	if err := m.nodeRequest(node, "DELETE", path, nil, &result); err != nil {
+		return 0, err
+	}
+	return result.Closed, nil
+}
+
+// GetTimings 返回节点规则的连接耗时统计，取自节点最近一次上报的状态
+func (m *Manager) GetTimings(ruleID string) (models.ConnTimings, error) {
+	if _, err := m.ruleNode(ruleID); err != nil {
+		return models.ConnTimings{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rule, exists := m.rules[ruleID]
+	if !exists {
+		return models.ConnTimings{}, fmt.Errorf("rule %s not found", ruleID)
+	}
+	if info := m.nodes[rule.NodeID]; info != nil && info.Status != nil {
+		for _, t := range info.Status.Tunnels {
+			if t.ID == ruleID && t.Timings != nil {
+				return *t.Timings, nil
+			}
+		}
+	}
+	return models.ConnTimings{}, fmt.Errorf("no timing data reported for rule %s", ruleID)
+}
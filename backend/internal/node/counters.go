@@ -0,0 +1,291 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"port-forward-dashboard/internal/models"
+)
+
+const (
+	// maxUsageDays 按日统计保留的天数，按月统计全部保留
+	maxUsageDays = 400
+	// counterSaveInterval 累计流量落盘的间隔
+	counterSaveInterval = time.Minute
+)
+
+// usage 是一个统计周期内累加的字节数
+type usage struct {
+	In  int64 `json:"in"`
+	Out int64 `json:"out"`
+}
+
+// ruleCounter 是一条规则的单调累计流量，LastIn/LastOut 是上一次状态中 Agent 的原始计数
+type ruleCounter struct {
+	LastIn   int64             `json:"last_in"`
+	LastOut  int64             `json:"last_out"`
+	TotalIn  int64             `json:"total_in"`
+	TotalOut int64             `json:"total_out"`
+	Daily    map[string]*usage `json:"daily"`
+	Monthly  map[string]*usage `json:"monthly"`
+}
+
+// trafficCounters 把 Agent 上报的原始计数（Agent 重启或隧道重建后归零）累加成单调递增的总量并持久化
+type trafficCounters struct {
+	path  string
+	mu    sync.Mutex
+	dirty bool
+
+	Rules map[string]*ruleCounter `json:"rules"`
+	// Uptimes 记录各节点上一次上报的 Agent 运行时长，变小说明 Agent 重启过
+	Uptimes map[string]int64 `json:"uptimes"`
+}
+
+func loadCounters(path string) (*trafficCounters, error) {
+	c := &trafficCounters{
+		path:    path,
+		Rules:   make(map[string]*ruleCounter),
+		Uptimes: make(map[string]int64),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	if c.Rules == nil {
+		c.Rules = make(map[string]*ruleCounter)
+	}
+	if c.Uptimes == nil {
+		c.Uptimes = make(map[string]int64)
+	}
+	return c, nil
+}
+
+// observe 计算本次状态与上次原始计数的差值并累加。计数变小或 Agent 重启时视为计数器已归零，
+// 本次原始值即为增量。status 中各隧道的 BytesIn/BytesOut 会被替换为累计值
+func (c *trafficCounters) observe(nodeID string, status *models.NodeStatus, known func(ruleID string) bool, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	restarted := status.Uptime < c.Uptimes[nodeID]
+	c.Uptimes[nodeID] = status.Uptime
+
+	day, month := now.Format("2006-01-02"), now.Format("2006-01")
+	for i := range status.Tunnels {
+		t := &status.Tunnels[i]
+		if !known(t.ID) {
+			continue
+		}
+
+		rc, ok := c.Rules[t.ID]
+		if !ok {
+			rc = &ruleCounter{Daily: make(map[string]*usage), Monthly: make(map[string]*usage)}
+			c.Rules[t.ID] = rc
+		}
+
+		deltaIn, deltaOut := t.BytesIn-rc.LastIn, t.BytesOut-rc.LastOut
+		if restarted || deltaIn < 0 || deltaOut < 0 {
+			deltaIn, deltaOut = t.BytesIn, t.BytesOut
+		}
+		rc.LastIn, rc.LastOut = t.BytesIn, t.BytesOut
+
+		if deltaIn > 0 || deltaOut > 0 {
+			rc.TotalIn += deltaIn
+			rc.TotalOut += deltaOut
+			rc.add(day, month, deltaIn, deltaOut, now)
+			c.dirty = true
+		}
+
+		t.BytesIn, t.BytesOut = rc.TotalIn, rc.TotalOut
+	}
+}
+
+func (rc *ruleCounter) add(day, month string, in, out int64, now time.Time) {
+	d, ok := rc.Daily[day]
+	if !ok {
+		d = &usage{}
+		rc.Daily[day] = d
+		cutoff := now.AddDate(0, 0, -maxUsageDays).Format("2006-01-02")
+		for k := range rc.Daily {
+			if k < cutoff {
+				delete(rc.Daily, k)
+			}
+		}
+	}
+	d.In += in
+	d.Out += out
+
+	m, ok := rc.Monthly[month]
+	if !ok {
+		m = &usage{}
+		rc.Monthly[month] = m
+	}
+	m.In += in
+	m.Out += out
+}
+
+// remove 删除规则的累计流量
+func (c *trafficCounters) remove(ruleIDs ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, id := range ruleIDs {
+		if _, ok := c.Rules[id]; ok {
+			delete(c.Rules, id)
+			c.dirty = true
+		}
+	}
+}
+
+func (c *trafficCounters) removeNode(nodeID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.Uptimes, nodeID)
+	c.dirty = true
+}
+
+// report 汇总若干规则的累计流量，返回最近 days 天和 months 个月的统计
+func (c *trafficCounters) report(ruleIDs []string, days, months int) models.TrafficUsageReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var report models.TrafficUsageReport
+	daily := make(map[string]*usage)
+	monthly := make(map[string]*usage)
+	for _, id := range ruleIDs {
+		rc, ok := c.Rules[id]
+		if !ok {
+			continue
+		}
+		report.TotalIn += rc.TotalIn
+		report.TotalOut += rc.TotalOut
+		sumUsage(daily, rc.Daily)
+		sumUsage(monthly, rc.Monthly)
+	}
+	report.Daily = usageList(daily, days)
+	report.Monthly = usageList(monthly, months)
+	return report
+}
+
+func sumUsage(dst, src map[string]*usage) {
+	for k, u := range src {
+		d, ok := dst[k]
+		if !ok {
+			d = &usage{}
+			dst[k] = d
+		}
+		d.In += u.In
+		d.Out += u.Out
+	}
+}
+
+// usageList 按周期倒序返回最近 limit 个统计
+func usageList(m map[string]*usage, limit int) []models.TrafficUsage {
+	list := make([]models.TrafficUsage, 0, len(m))
+	for k, u := range m {
+		list = append(list, models.TrafficUsage{Period: k, BytesIn: u.In, BytesOut: u.Out})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Period > list[j].Period })
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
+
+// save 有变化时原子地写入文件
+func (c *trafficCounters) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+func (m *Manager) counterSaveLoop() {
+	ticker := time.NewTicker(counterSaveInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.SaveCounters()
+	}
+}
+
+// SaveCounters 把累计流量写入磁盘，退出前调用一次避免丢失最后一个周期的数据
+func (m *Manager) SaveCounters() {
+	if err := m.counters.save(); err != nil {
+		log.Printf("Failed to save traffic counters: %v", err)
+	}
+}
+
+// GetRuleUsage 返回节点规则的累计流量和按日、按月统计
+func (m *Manager) GetRuleUsage(ruleID string, days, months int) (models.TrafficUsageReport, error) {
+	m.mu.RLock()
+	_, exists := m.rules[ruleID]
+	m.mu.RUnlock()
+
+	if !exists {
+		return models.TrafficUsageReport{}, fmt.Errorf("rule %s not found", ruleID)
+	}
+	return m.counters.report([]string{ruleID}, days, months), nil
+}
+
+// GetNodeUsage 返回节点上所有规则的流量之和
+func (m *Manager) GetNodeUsage(nodeID string, days, months int) (models.TrafficUsageReport, error) {
+	m.mu.RLock()
+	_, exists := m.nodes[nodeID]
+	var ruleIDs []string
+	for id, rule := range m.rules {
+		if rule.NodeID == nodeID {
+			ruleIDs = append(ruleIDs, id)
+		}
+	}
+	m.mu.RUnlock()
+
+	if !exists {
+		return models.TrafficUsageReport{}, fmt.Errorf("node %s not found", nodeID)
+	}
+	return m.counters.report(ruleIDs, days, months), nil
+}
+
+// GetRuleTotals 返回各规则的累计字节数，节点离线时也保持不变
+func (m *Manager) GetRuleTotals() map[string]models.TrafficStats {
+	m.counters.mu.Lock()
+	defer m.counters.mu.Unlock()
+
+	totals := make(map[string]models.TrafficStats, len(m.counters.Rules))
+	for id, rc := range m.counters.Rules {
+		totals[id] = models.TrafficStats{TotalIn: rc.TotalIn, TotalOut: rc.TotalOut}
+	}
+	return totals
+}
@@ -0,0 +1,118 @@
+package node
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"port-forward-dashboard/internal/models"
+)
+
+func TestCountersObserve(t *testing.T) {
+	type report struct {
+		uptime  int64
+		in, out int64
+	}
+	tests := []struct {
+		name       string
+		reports    []report
+		wantIn     int64
+		wantOut    int64
+		wantLastIn int64
+	}{
+		{"first report counts fully", []report{{10, 100, 50}}, 100, 50, 100},
+		{"growth adds delta", []report{{10, 100, 50}, {20, 150, 80}}, 150, 80, 150},
+		{"unchanged adds nothing", []report{{10, 100, 50}, {20, 100, 50}}, 100, 50, 100},
+		// 隧道重建后计数归零，本次原始值即为增量
+		{"counter reset", []report{{10, 100, 50}, {20, 30, 10}}, 130, 60, 30},
+		{"one direction reset", []report{{10, 100, 50}, {20, 120, 10}}, 220, 60, 120},
+		// Agent 重启后即使计数已超过上次原始值也不能只累加差值
+		{"agent restarted", []report{{100, 100, 50}, {5, 300, 80}}, 400, 130, 300},
+		{"reset then growth", []report{{10, 100, 50}, {5, 30, 10}, {15, 40, 20}}, 140, 70, 40},
+	}
+	now := time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC)
+	known := func(id string) bool { return id == "r1" }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := loadCounters(filepath.Join(t.TempDir(), "counters.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var status *models.NodeStatus
+			for _, r := range tt.reports {
+				status = &models.NodeStatus{Uptime: r.uptime, Tunnels: []models.NodeTunnelStatus{{ID: "r1", BytesIn: r.in, BytesOut: r.out}}}
+				c.observe("n1", status, known, now)
+			}
+
+			rc := c.Rules["r1"]
+			if rc.TotalIn != tt.wantIn || rc.TotalOut != tt.wantOut {
+				t.Errorf("total = %d/%d, want %d/%d", rc.TotalIn, rc.TotalOut, tt.wantIn, tt.wantOut)
+			}
+			if rc.LastIn != tt.wantLastIn {
+				t.Errorf("LastIn = %d, want %d", rc.LastIn, tt.wantLastIn)
+			}
+			if got := status.Tunnels[0]; got.BytesIn != tt.wantIn || got.BytesOut != tt.wantOut {
+				t.Errorf("status bytes = %d/%d, want the cumulative totals", got.BytesIn, got.BytesOut)
+			}
+			if d := rc.Daily["2026-03-31"]; d == nil || d.In != tt.wantIn || d.Out != tt.wantOut {
+				t.Errorf("daily usage = %+v, want %d/%d", d, tt.wantIn, tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestCountersObserveSkipsUnknownRules(t *testing.T) {
+	c, err := loadCounters(filepath.Join(t.TempDir(), "counters.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := &models.NodeStatus{Uptime: 10, Tunnels: []models.NodeTunnelStatus{{ID: "orphan", BytesIn: 100}}}
+	c.observe("n1", status, func(string) bool { return false }, time.Now())
+
+	if len(c.Rules) != 0 || c.dirty {
+		t.Errorf("unknown rule recorded: %+v", c.Rules)
+	}
+	if status.Tunnels[0].BytesIn != 100 {
+		t.Errorf("BytesIn of unknown rule changed to %d", status.Tunnels[0].BytesIn)
+	}
+}
+
+func TestCountersUsageAcrossPeriods(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counters.json")
+	c, err := loadCounters(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	known := func(string) bool { return true }
+	observe := func(uptime, in int64, now time.Time) {
+		c.observe("n1", &models.NodeStatus{Uptime: uptime, Tunnels: []models.NodeTunnelStatus{{ID: "r1", BytesIn: in}}}, known, now)
+	}
+
+	day1 := time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC)
+	observe(10, 100, day1)
+	observe(20, 250, day1.Add(2*time.Hour))
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新加载后继续从上次的原始计数累加
+	c, err = loadCounters(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	observe(30, 300, day1.Add(3*time.Hour))
+
+	got := c.report([]string{"r1"}, 7, 12)
+	if got.TotalIn != 300 {
+		t.Errorf("TotalIn = %d, want 300", got.TotalIn)
+	}
+	wantDaily := []models.TrafficUsage{{Period: "2026-04-01", BytesIn: 200}, {Period: "2026-03-31", BytesIn: 100}}
+	wantMonthly := []models.TrafficUsage{{Period: "2026-04", BytesIn: 200}, {Period: "2026-03", BytesIn: 100}}
+	if len(got.Daily) != 2 || got.Daily[0] != wantDaily[0] || got.Daily[1] != wantDaily[1] {
+		t.Errorf("Daily = %+v, want %+v", got.Daily, wantDaily)
+	}
+	if len(got.Monthly) != 2 || got.Monthly[0] != wantMonthly[0] || got.Monthly[1] != wantMonthly[1] {
+		t.Errorf("Monthly = %+v, want %+v", got.Monthly, wantMonthly)
+	}
+}
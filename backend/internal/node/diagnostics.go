@@ -0,0 +1,45 @@
+package node
+
+import (
+	"fmt"
+	"time"
+
+	"port-forward-dashboard/internal/models"
+)
+
+// diagnosticsTimeout 需大于 Agent 端单次诊断的总耗时上限（60 秒）
+const diagnosticsTimeout = 75 * time.Second
+
+var diagnosticTypes = map[string]bool{
+	models.DiagnosticTCPConnect:  true,
+	models.DiagnosticDNS:         true,
+	models.DiagnosticTraceroute:  true,
+	models.DiagnosticListenCheck: true,
+	models.DiagnosticConnections: true,
+}
+
+// RunDiagnostic 让节点 Agent 执行一项内置诊断并返回结果
+func (m *Manager) RunDiagnostic(id string, req models.DiagnosticRequest) (*models.DiagnosticResult, error) {
+	if !diagnosticTypes[req.Type] {
+		return nil, fmt.Errorf("unsupported diagnostic %q", req.Type)
+	}
+
+	m.mu.RLock()
+	info, exists := m.nodes[id]
+	if !exists {
+		m.mu.RUnlock()
+		return nil, fmt.Errorf("node %s not found", id)
+	}
+	node := info.Node
+	m.mu.RUnlock()
+
+	if !node.Online {
+		return nil, fmt.Errorf("node %s is offline", id)
+	}
+
+	var result models.DiagnosticResult
+	if err := m.nodeRequestTimeout(node, "POST", "/diagnostics", req, &result, diagnosticsTimeout); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
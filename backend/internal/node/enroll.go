@@ -0,0 +1,189 @@
+package node
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"port-forward-dashboard/internal/models"
+)
+
+const (
+	// DefaultEnrollTokenTTL 注册令牌默认有效期
+	DefaultEnrollTokenTTL = 30 * time.Minute
+	// MaxEnrollTokenTTL 注册令牌最长有效期
+	MaxEnrollTokenTTL = 24 * time.Hour
+)
+
+var ErrInvalidEnrollToken = errors.New("invalid or expired enrollment token")
+
+// enrollTokens 按令牌的 SHA256 存储，内存和配置中都不保留明文
+type enrollTokens map[string]*models.EnrollToken
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// pruneEnrollTokens 删除过期令牌，调用方需持有写锁
+func (m *Manager) pruneEnrollTokens(now time.Time) {
+	for hash, t := range m.enrollTokens {
+		if now.Unix() >= t.ExpiresAt {
+			delete(m.enrollTokens, hash)
+		}
+	}
+}
+
+// RestoreEnrollTokens 从配置恢复尚未使用的令牌，键为令牌的 SHA256
+func (m *Manager) RestoreEnrollTokens(tokens map[string]models.EnrollToken) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, t := range tokens {
+		t := t
+		m.enrollTokens[hash] = &t
+	}
+	m.pruneEnrollTokens(time.Now())
+}
+
+// GetEnrollTokensForSave 返回需要持久化的令牌，键为令牌的 SHA256
+func (m *Manager) GetEnrollTokensForSave() map[string]models.EnrollToken {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pruneEnrollTokens(time.Now())
+	result := make(map[string]models.EnrollToken, len(m.enrollTokens))
+	for hash, t := range m.enrollTokens {
+		result[hash] = *t
+	}
+	return result
+}
+
+// CreateEnrollToken 生成一次性注册令牌。name 和 port 非空时覆盖 Agent 自报的值
+func (m *Manager) CreateEnrollToken(name string, port int, ttl time.Duration) (models.EnrollToken, error) {
+	if ttl <= 0 {
+		ttl = DefaultEnrollTokenTTL
+	}
+	if ttl > MaxEnrollTokenTTL {
+		return models.EnrollToken{}, fmt.Errorf("token ttl exceeds %s", MaxEnrollTokenTTL)
+	}
+
+	token, err := randomHex(24)
+	if err != nil {
+		return models.EnrollToken{}, err
+	}
+	hash := hashToken(token)
+
+	now := time.Now()
+	t := &models.EnrollToken{
+		ID:        hash[:8],
+		Name:      name,
+		Port:      port,
+		ExpiresAt: now.Add(ttl).Unix(),
+		CreatedAt: now.Unix(),
+	}
+
+	m.mu.Lock()
+	m.pruneEnrollTokens(now)
+	m.enrollTokens[hash] = t
+	m.mu.Unlock()
+
+	result := *t
+	result.Token = token
+	return result, nil
+}
+
+// ListEnrollTokens 返回尚未使用且未过期的令牌（不含明文）
+func (m *Manager) ListEnrollTokens() []models.EnrollToken {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pruneEnrollTokens(time.Now())
+	result := make([]models.EnrollToken, 0, len(m.enrollTokens))
+	for _, t := range m.enrollTokens {
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt < result[j].CreatedAt })
+	return result
+}
+
+// RevokeEnrollToken 作废尚未使用的令牌
+func (m *Manager) RevokeEnrollToken(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, t := range m.enrollTokens {
+		if t.ID == id {
+			delete(m.enrollTokens, hash)
+			return nil
+		}
+	}
+	return fmt.Errorf("enrollment token %s not found", id)
+}
+
+// Enroll 消耗注册令牌并登记新节点，为其签发永久密钥；提交了 CSR 时同时签发节点证书。
+// node 需已填好 ID、Host 等信息，返回登记后的节点和 PEM 格式的证书
+func (m *Manager) Enroll(token string, node models.Node, csr string) (models.Node, string, error) {
+	key, err := randomHex(32)
+	if err != nil {
+		return models.Node{}, "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.pruneEnrollTokens(now)
+
+	hash := hashToken(token)
+	t, ok := m.enrollTokens[hash]
+	if !ok {
+		return models.Node{}, "", ErrInvalidEnrollToken
+	}
+	if _, exists := m.nodes[node.ID]; exists {
+		return models.Node{}, "", fmt.Errorf("node %s already exists", node.ID)
+	}
+
+	var certPEM string
+	if csr != "" {
+		pemData, cert, err := m.ca.SignAgentCSR(csr, node.ID)
+		if err != nil {
+			return models.Node{}, "", err
+		}
+		certPEM = pemData
+		node.CertSerial = cert.SerialNumber.Text(16)
+		node.CertNotAfter = cert.NotAfter.Unix()
+	}
+	// 令牌一经使用立即失效
+	delete(m.enrollTokens, hash)
+
+	if t.Name != "" {
+		node.Name = t.Name
+	}
+	if t.Port != 0 {
+		node.Port = t.Port
+	}
+	node.Key = key
+	node.KeyCreatedAt = now.Unix()
+	node.Online = false
+	node.CreatedAt = now.Unix()
+
+	m.nodes[node.ID] = &NodeInfo{
+		Node:          node,
+		LastCheck:     now,
+		DetectionMode: models.DetectionNone,
+	}
+	return node, certPEM, nil
+}
@@ -0,0 +1,67 @@
+package node
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"port-forward-dashboard/internal/models"
+)
+
+func newEnrollTestManager() *Manager {
+	return &Manager{
+		nodes:        make(map[string]*NodeInfo),
+		enrollTokens: make(enrollTokens),
+	}
+}
+
+func TestEnrollTokensSurviveRestore(t *testing.T) {
+	m := newEnrollTestManager()
+	created, err := m.CreateEnrollToken("edge", 9100, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := m.CreateEnrollToken("", 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := m.GetEnrollTokensForSave()
+	for hash, tok := range saved {
+		if tok.Token != "" {
+			t.Fatalf("token %s persisted in plain text", hash)
+		}
+		if hash == hashToken(expired.Token) {
+			tok.ExpiresAt = time.Now().Add(-time.Second).Unix()
+			saved[hash] = tok
+		}
+	}
+
+	restored := newEnrollTestManager()
+	restored.RestoreEnrollTokens(saved)
+	if got := restored.ListEnrollTokens(); len(got) != 1 || got[0].ID != created.ID {
+		t.Fatalf("restored tokens = %+v, want only %s", got, created.ID)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"expired token", expired.Token, ErrInvalidEnrollToken},
+		{"unknown token", "deadbeef", ErrInvalidEnrollToken},
+		{"valid token", created.Token, nil},
+		{"token already used", created.Token, ErrInvalidEnrollToken},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, _, err := restored.Enroll(tt.token, models.Node{ID: string(rune('a' + i)), Name: "self-reported", Port: 9090}, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Enroll() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (node.Name != "edge" || node.Port != 9100 || node.Key == "") {
+				t.Fatalf("Enroll() node = %+v, want name/port from token and a fresh key", node)
+			}
+		})
+	}
+}
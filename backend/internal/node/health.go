@@ -0,0 +1,158 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"port-forward-dashboard/internal/models"
+)
+
+const (
+	// defaultHeartbeatInterval 用于未上报心跳间隔的旧版 Agent
+	defaultHeartbeatInterval = 10 * time.Second
+	// missedHeartbeats 连续错过多少次心跳后判定心跳超时
+	missedHeartbeats = 3
+	// livenessTick 检查心跳截止时间的频率
+	livenessTick = 2 * time.Second
+	// pollInterval 心跳超时后兜底轮询同一节点的最小间隔
+	pollInterval = 10 * time.Second
+	// pollTimeout 兜底轮询的单次请求超时
+	pollTimeout = 5 * time.Second
+	// maxConcurrentPolls 同时进行的兜底轮询数上限
+	maxConcurrentPolls = 16
+)
+
+// heartbeatDeadline 返回节点心跳的截止时间，超过该时间未收到心跳即视为缺失
+func (info *NodeInfo) heartbeatDeadline() time.Time {
+	interval := info.HeartbeatInterval
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+	return info.LastHeartbeat.Add(missedHeartbeats * interval)
+}
+
+func (m *Manager) livenessLoop() {
+	ticker := time.NewTicker(livenessTick)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.checkLiveness()
+	}
+}
+
+// checkLiveness 按每个节点的心跳截止时间判定在线状态，
+// 心跳缺失的节点交给有并发上限的兜底轮询
+func (m *Manager) checkLiveness() {
+	now := time.Now()
+
+	m.mu.Lock()
+	m.retireExpiredKeys(now)
+
+	var toPoll []*NodeInfo
+	for _, info := range m.nodes {
+		if !info.LastHeartbeat.IsZero() && now.Before(info.heartbeatDeadline()) {
+			continue
+		}
+
+		// 心跳已超时：最近一次兜底轮询也过期后才判定离线
+		if info.DetectionMode == models.DetectionHeartbeat ||
+			(info.DetectionMode == models.DetectionPoll && now.Sub(info.LastPoll) > missedHeartbeats*pollInterval) {
+			info.Node.Online = false
+			info.DetectionMode = models.DetectionNone
+		}
+
+		if !info.polling && now.Sub(info.LastPoll) >= pollInterval {
+			info.polling = true
+			toPoll = append(toPoll, info)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, info := range toPoll {
+		go m.pollNode(info)
+	}
+}
+
+func (m *Manager) pollNode(info *NodeInfo) {
+	m.pollSem <- struct{}{}
+	defer func() { <-m.pollSem }()
+
+	m.mu.RLock()
+	node := info.Node
+	m.mu.RUnlock()
+
+	status, err := m.fetchStatus(node)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info.polling = false
+	info.LastPoll = time.Now()
+
+	// 轮询期间收到了心跳，以心跳为准
+	if !info.LastHeartbeat.IsZero() && time.Now().Before(info.heartbeatDeadline()) {
+		return
+	}
+
+	if err != nil {
+		info.Node.Online = false
+		info.DetectionMode = models.DetectionNone
+		return
+	}
+
+	m.applyStatus(info, status)
+	info.DetectionMode = models.DetectionPoll
+}
+
+func (m *Manager) fetchStatus(node models.Node) (*models.NodeStatus, error) {
+	req, _ := http.NewRequest("GET", nodeURL(node, "/status"), nil)
+	req.Header.Set("X-Node-Key", node.Key)
+
+	resp, err := m.httpClient(node, pollTimeout).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("node returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Success bool              `json:"success"`
+		Data    models.NodeStatus `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result.Data, nil
+}
+
+// applyStatus 用节点上报的状态更新缓存，调用方需持有写锁
+func (m *Manager) applyStatus(info *NodeInfo, status *models.NodeStatus) {
+	if !info.Node.Online {
+		info.needsFullSync = true
+	}
+	info.Node.Online = true
+	info.Node.CPUPercent = status.CPUPercent
+	info.Node.MemPercent = status.MemPercent
+	info.Node.Uptime = status.Uptime
+	info.Node.NodeSystem = status.NodeSystem
+	info.Node.LastSeen = time.Now().Unix()
+
+	// 原始计数在 Agent 重启后归零，换成主控维护的累计值
+	m.counters.observe(info.Node.ID, status, func(ruleID string) bool {
+		rule, ok := m.rules[ruleID]
+		return ok && rule.NodeID == info.Node.ID
+	}, time.Now())
+	info.Status = status
+	info.LastCheck = time.Now()
+	info.StateStale = status.StateRevision < info.AppliedRevision
+
+	if m.scheduleReconcile(info) {
+		go m.reconcileNode(info)
+	}
+	m.checkMesh(info, status)
+}
@@ -0,0 +1,36 @@
+package node
+
+import "port-forward-dashboard/internal/models"
+
+// TrafficSnapshot 返回在线节点上各规则及各节点（其隧道之和）的流量，用于写入历史数据
+func (m *Manager) TrafficSnapshot() (rules, nodes map[string]models.TrafficStats) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rules = make(map[string]models.TrafficStats)
+	nodes = make(map[string]models.TrafficStats)
+	for id, info := range m.nodes {
+		if !info.Node.Online || info.Status == nil {
+			continue
+		}
+		var total models.TrafficStats
+		for _, tunnel := range info.Status.Tunnels {
+			if _, ok := m.rules[tunnel.ID]; !ok {
+				continue
+			}
+			stats := models.TrafficStats{
+				TotalIn:      tunnel.BytesIn,
+				TotalOut:     tunnel.BytesOut,
+				BytesInRate:  tunnel.RateIn,
+				BytesOutRate: tunnel.RateOut,
+			}
+			rules[tunnel.ID] = stats
+			total.TotalIn += stats.TotalIn
+			total.TotalOut += stats.TotalOut
+			total.BytesInRate += stats.BytesInRate
+			total.BytesOutRate += stats.BytesOutRate
+		}
+		nodes[id] = total
+	}
+	return rules, nodes
+}
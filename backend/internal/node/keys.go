@@ -0,0 +1,157 @@
+package node
+
+import (
+	"fmt"
+	"time"
+
+	"port-forward-common/signing"
+	"port-forward-dashboard/internal/models"
+)
+
+const (
+	// DefaultKeyGracePeriod 轮换后旧密钥继续有效的默认时长
+	DefaultKeyGracePeriod = 10 * time.Minute
+	// MaxKeyGracePeriod 旧密钥宽限期上限
+	MaxKeyGracePeriod = 24 * time.Hour
+	// maxKeyHistory 每个节点保留的轮换记录条数
+	maxKeyHistory = 20
+)
+
+// keyCreatedAt 返回当前密钥的生成时间，旧配置中没有该字段时以节点创建时间为准
+func keyCreatedAt(node *models.Node) int64 {
+	if node.KeyCreatedAt > 0 {
+		return node.KeyCreatedAt
+	}
+	return node.CreatedAt
+}
+
+// acceptedKeys 返回当前可用于认证的密钥：当前密钥、宽限期内的旧密钥以及待确认的新密钥
+func acceptedKeys(node *models.Node, now time.Time) []string {
+	keys := []string{node.Key}
+	if node.PreviousKey != "" && now.Unix() < node.PreviousKeyExpiresAt {
+		keys = append(keys, node.PreviousKey)
+	}
+	if node.PendingKey != "" && now.Unix() < node.PendingKeyExpiresAt {
+		keys = append(keys, node.PendingKey)
+	}
+	return keys
+}
+
+// retireExpiredKeys 清除宽限期已过的旧密钥和到期仍未确认的新密钥，调用方需持有写锁
+func (m *Manager) retireExpiredKeys(now time.Time) {
+	for _, info := range m.nodes {
+		if info.Node.PreviousKey != "" && now.Unix() >= info.Node.PreviousKeyExpiresAt {
+			info.Node.PreviousKey = ""
+			info.Node.PreviousKeyExpiresAt = 0
+		}
+		if info.Node.PendingKey != "" && now.Unix() >= info.Node.PendingKeyExpiresAt {
+			info.Node.PendingKey = ""
+			info.Node.PendingKeyExpiresAt = 0
+		}
+	}
+}
+
+// promotePendingKey 把待确认的新密钥转为当前密钥，旧密钥保留到 Agent 端同样的宽限期结束。
+// 调用方需持有写锁
+func promotePendingKey(node *models.Node, now time.Time) {
+	oldKey := node.Key
+	grace := time.Unix(node.PendingKeyExpiresAt, 0).Sub(now)
+	if grace < 0 {
+		grace = 0
+	}
+	node.Key = node.PendingKey
+	node.KeyCreatedAt = now.Unix()
+	node.PreviousKey = oldKey
+	node.PreviousKeyExpiresAt = node.PendingKeyExpiresAt
+	node.PendingKey = ""
+	node.PendingKeyExpiresAt = 0
+	recordKeyRotation(node, oldKey, grace, models.KeyRotationAPI, true)
+}
+
+// recordKeyRotation 追加轮换记录，调用方需持有写锁
+func recordKeyRotation(node *models.Node, oldKey string, grace time.Duration, reason string, pushed bool) {
+	node.KeyHistory = append(node.KeyHistory, models.KeyRotation{
+		RotatedAt:    time.Now().Unix(),
+		OldKeyID:     signing.KeyID(oldKey),
+		NewKeyID:     signing.KeyID(node.Key),
+		GraceSeconds: int64(grace.Seconds()),
+		Reason:       reason,
+		PushedAgent:  pushed,
+	})
+	if len(node.KeyHistory) > maxKeyHistory {
+		node.KeyHistory = node.KeyHistory[len(node.KeyHistory)-maxKeyHistory:]
+	}
+}
+
+// RotateKey 为节点生成新密钥并推送给 Agent。推送前先在锁内把新密钥登记为待确认，
+// Agent 确认后主控才切换；推送结果不明（如响应丢失）时，Agent 用新密钥签名的心跳同样会完成切换。
+// 宽限期内新旧密钥同时有效，正在进行中的心跳和请求不会失败
+func (m *Manager) RotateKey(id string, grace time.Duration) (models.Node, error) {
+	if grace <= 0 {
+		grace = DefaultKeyGracePeriod
+	}
+	if grace > MaxKeyGracePeriod {
+		return models.Node{}, fmt.Errorf("grace period exceeds %s", MaxKeyGracePeriod)
+	}
+
+	newKey, err := randomHex(32)
+	if err != nil {
+		return models.Node{}, err
+	}
+
+	m.mu.Lock()
+	info, exists := m.nodes[id]
+	if !exists {
+		m.mu.Unlock()
+		return models.Node{}, fmt.Errorf("node %s not found", id)
+	}
+	now := time.Now()
+	if info.Node.PendingKey != "" && now.Unix() < info.Node.PendingKeyExpiresAt {
+		m.mu.Unlock()
+		return models.Node{}, fmt.Errorf("node %s has a key rotation awaiting confirmation", id)
+	}
+	info.Node.PendingKey = newKey
+	info.Node.PendingKeyExpiresAt = now.Add(grace).Unix()
+	// 推送请求仍用当前密钥认证
+	node := info.Node
+	m.mu.Unlock()
+
+	payload := map[string]interface{}{
+		"key":           newKey,
+		"grace_seconds": int64(grace.Seconds()),
+	}
+	pushErr := m.nodeRequest(node, "POST", "/key", payload, nil)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cur, ok := m.nodes[id]; !ok || cur != info {
+		return models.Node{}, fmt.Errorf("node %s was removed during key rotation", id)
+	}
+	if info.Node.PendingKey != newKey {
+		// 推送期间心跳已确认新密钥，或密钥被手动修改
+		if info.Node.Key == newKey {
+			return info.Node, nil
+		}
+		return models.Node{}, fmt.Errorf("node %s key changed during rotation", id)
+	}
+	if pushErr != nil {
+		// 保留待确认密钥：Agent 若实际已切换，下一次心跳即可完成轮换
+		return models.Node{}, fmt.Errorf("failed to push new key to node: %v", pushErr)
+	}
+
+	promotePendingKey(&info.Node, time.Now())
+	return info.Node, nil
+}
+
+// GetKeyHistory 返回节点的密钥轮换记录
+func (m *Manager) GetKeyHistory(id string) ([]models.KeyRotation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	info, exists := m.nodes[id]
+	if !exists {
+		return nil, fmt.Errorf("node %s not found", id)
+	}
+	return append([]models.KeyRotation(nil), info.Node.KeyHistory...), nil
+}
@@ -0,0 +1,141 @@
+package node
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"port-forward-common/signing"
+	"port-forward-dashboard/internal/models"
+	"port-forward-dashboard/internal/pki"
+)
+
+// fakeAgent 模拟 Agent 的 /key 接口，status 决定推送结果
+func fakeAgent(t *testing.T, status *atomic.Int32) (string, int) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/key" {
+			w.WriteHeader(int(status.Load()))
+		}
+		w.Write([]byte(`{"success":true}`))
+	}))
+	t.Cleanup(srv.Close)
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return host, p
+}
+
+func newKeyTestManager(t *testing.T, host string, port int) *Manager {
+	ca, err := pki.Load("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewManager(ca, t.TempDir()+"/counters.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddNode(models.Node{ID: "n1", Name: "n1", Host: host, Port: port, Key: "old-key"}); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func heartbeatWith(key string) (HeartbeatAuth, []byte) {
+	body := []byte(`{}`)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := strconv.FormatInt(time.Now().UnixNano(), 10)
+	return HeartbeatAuth{KeyID: signing.KeyID(key), Timestamp: ts, Nonce: nonce, Signature: signing.SignHeartbeat(key, ts, nonce, body)}, body
+}
+
+func TestRotateKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		pushStatus  int
+		wantErr     bool
+		wantPending bool
+	}{
+		{"agent accepts", http.StatusOK, false, false},
+		{"agent rejects", http.StatusInternalServerError, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var status atomic.Int32
+			status.Store(int32(tt.pushStatus))
+			host, port := fakeAgent(t, &status)
+			m := newKeyTestManager(t, host, port)
+
+			node, err := m.RotateKey("n1", time.Minute)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RotateKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			info, _ := m.GetNode("n1")
+			if tt.wantPending {
+				if info.Node.Key != "old-key" || info.Node.PendingKey == "" {
+					t.Fatalf("key = %s pending = %q, want old key kept and new key pending", info.Node.Key, info.Node.PendingKey)
+				}
+				return
+			}
+			if node.Key == "old-key" || node.PreviousKey != "old-key" || node.PendingKey != "" {
+				t.Fatalf("after rotation key = %s previous = %s pending = %q", node.Key, node.PreviousKey, node.PendingKey)
+			}
+			if len(node.KeyHistory) != 1 || !node.KeyHistory[0].PushedAgent {
+				t.Fatalf("key history = %+v, want one pushed rotation", node.KeyHistory)
+			}
+		})
+	}
+}
+
+// 推送报错但 Agent 实际已切换时，用新密钥签名的心跳完成轮换
+func TestPendingKeyConfirmedByHeartbeat(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusBadGateway)
+	host, port := fakeAgent(t, &status)
+	m := newKeyTestManager(t, host, port)
+
+	if _, err := m.RotateKey("n1", time.Minute); err == nil {
+		t.Fatal("RotateKey() succeeded although the push failed")
+	}
+	info, _ := m.GetNode("n1")
+	pending := info.Node.PendingKey
+
+	if _, err := m.RotateKey("n1", time.Minute); err == nil {
+		t.Fatal("second rotation started while one is awaiting confirmation")
+	}
+
+	auth, body := heartbeatWith("old-key")
+	rotated, err := m.HandleHeartbeat(auth, body)
+	if err != nil || rotated {
+		t.Fatalf("heartbeat with old key: rotated = %v, err = %v", rotated, err)
+	}
+
+	auth, body = heartbeatWith(pending)
+	rotated, err = m.HandleHeartbeat(auth, body)
+	if err != nil || !rotated {
+		t.Fatalf("heartbeat with pending key: rotated = %v, err = %v", rotated, err)
+	}
+
+	info, _ = m.GetNode("n1")
+	if info.Node.Key != pending || info.Node.PreviousKey != "old-key" || info.Node.PendingKey != "" {
+		t.Fatalf("after confirmation key = %s previous = %s pending = %q", info.Node.Key, info.Node.PreviousKey, info.Node.PendingKey)
+	}
+
+	// 旧密钥在宽限期内仍被接受
+	auth, body = heartbeatWith("old-key")
+	if _, err := m.HandleHeartbeat(auth, body); err != nil {
+		t.Fatalf("old key rejected during grace period: %v", err)
+	}
+}
+
+func TestRetireExpiredPendingKey(t *testing.T) {
+	m := &Manager{nodes: map[string]*NodeInfo{
+		"n1": {Node: models.Node{ID: "n1", Key: "k", PendingKey: "p", PendingKeyExpiresAt: time.Now().Unix()}},
+	}}
+	m.retireExpiredKeys(time.Now())
+	if n := m.nodes["n1"].Node; n.PendingKey != "" || n.Key != "k" {
+		t.Fatalf("expired pending key not retired: %+v", n)
+	}
+}
@@ -1,38 +1,109 @@
 package node
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
+	"log"
 	"sync"
 	"time"
 
+	"port-forward-common/probe"
 	"port-forward-dashboard/internal/models"
+	"port-forward-dashboard/internal/pki"
 )
 
 type Manager struct {
-	nodes  map[string]*NodeInfo
-	rules  map[string]*models.NodeRule
-	mu     sync.RWMutex
-	client *http.Client
+	nodes   map[string]*NodeInfo
+	rules   map[string]*models.NodeRule
+	mu      sync.RWMutex
+	pollSem chan struct{}
+
+	// ca 为节点签发证书，transports 按节点缓存固定了 CA 的连接
+	ca         *pki.CA
+	transports *transports
+
+	nonces       *nonceCache
+	authFailures *authFailures
+
+	// syncStates 记录每条规则在节点上的同步状态
+	syncStates map[string]*models.RuleSync
+
+	// enrollTokens 是尚未使用的一次性注册令牌
+	enrollTokens enrollTokens
+
+	// uninstallConfirms 是等待确认的卸载请求，按节点 ID 索引
+	uninstallConfirms map[string]*pendingUninstall
+
+	// counters 是各规则不受 Agent 重启影响的累计流量
+	counters *trafficCounters
+
+	// mesh 是节点间延迟探测的配置
+	mesh models.MeshSettings
 }
 
 type NodeInfo struct {
 	Node      models.Node
 	Status    *models.NodeStatus
 	LastCheck time.Time
+
+	// 心跳是在线状态的主要依据，轮询仅作为心跳缺失时的兜底
+	LastHeartbeat     time.Time
+	HeartbeatInterval time.Duration
+	LastPoll          time.Time
+	DetectionMode     string
+	polling           bool
+	reconciling       bool
+	reconcileAgain    bool
+
+	// AppliedRevision 是主控下发操作后 Agent 返回的最新状态版本
+	AppliedRevision int64
+	StateStale      bool
+
+	// needsFullSync 节点重新上线后下一次调和需要完整下发一次
+	needsFullSync bool
+
+	// UpdateRequest 记录主控最近一次下发的更新指令
+	UpdateRequest *models.AgentUpdateStatus
+
+	// Uninstall 记录最近一次远程卸载的进度，uninstallNonce 用于匹配 Agent 的回报
+	Uninstall      *models.UninstallStatus
+	uninstallNonce string
+
+	// meshPushing 正在下发探测计划，meshRetryAt 之前不再重试失败的下发
+	meshPushing bool
+	meshRetryAt time.Time
 }
 
-func NewManager() *Manager {
+// NewManager 创建节点管理器，countersPath 是累计流量的持久化文件
+func NewManager(ca *pki.CA, countersPath string) (*Manager, error) {
+	masterCert, err := ca.IssueMasterCert()
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue master certificate: %v", err)
+	}
+
+	counters, err := loadCounters(countersPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load traffic counters: %v", err)
+	}
+
 	m := &Manager{
-		nodes:  make(map[string]*NodeInfo),
-		rules:  make(map[string]*models.NodeRule),
-		client: &http.Client{Timeout: 10 * time.Second},
+		nodes:   make(map[string]*NodeInfo),
+		rules:   make(map[string]*models.NodeRule),
+		pollSem: make(chan struct{}, maxConcurrentPolls),
+
+		ca:         ca,
+		transports: newTransports(ca, masterCert),
+
+		nonces:       newNonceCache(),
+		authFailures: newAuthFailures(),
+		syncStates:   make(map[string]*models.RuleSync),
+		enrollTokens: make(enrollTokens),
+
+		uninstallConfirms: make(map[string]*pendingUninstall),
+		counters:          counters,
 	}
-	go m.healthCheckLoop()
-	return m
+	go m.livenessLoop()
+	go m.counterSaveLoop()
+	return m, nil
 }
 
 func (m *Manager) AddNode(node models.Node) error {
@@ -43,9 +114,14 @@ func (m *Manager) AddNode(node models.Node) error {
 		return fmt.Errorf("node %s already exists", node.ID)
 	}
 
+	if node.KeyCreatedAt == 0 {
+		node.KeyCreatedAt = time.Now().Unix()
+	}
+
 	m.nodes[node.ID] = &NodeInfo{
-		Node:      node,
-		LastCheck: time.Now(),
+		Node:          node,
+		LastCheck:     time.Now(),
+		DetectionMode: models.DetectionNone,
 	}
 
 	return nil
@@ -60,46 +136,67 @@ func (m *Manager) UpdateNode(node models.Node) error {
 		return fmt.Errorf("node %s not found", node.ID)
 	}
 
+	// 在线状态等运行时字段由心跳维护，不接受客户端覆盖
+	node.Online = info.Node.Online
+	node.CPUPercent = info.Node.CPUPercent
+	node.MemPercent = info.Node.MemPercent
+	node.Uptime = info.Node.Uptime
+	node.LastSeen = info.Node.LastSeen
+	node.CreatedAt = info.Node.CreatedAt
+	node.NodeSystem = info.Node.NodeSystem
+
+	// 轮换相关字段只能通过 RotateKey 修改；手动改密钥时旧密钥立即失效
+	node.KeyCreatedAt = info.Node.KeyCreatedAt
+	node.PreviousKey = info.Node.PreviousKey
+	node.PreviousKeyExpiresAt = info.Node.PreviousKeyExpiresAt
+	node.PendingKey = info.Node.PendingKey
+	node.PendingKeyExpiresAt = info.Node.PendingKeyExpiresAt
+	node.KeyHistory = info.Node.KeyHistory
+	node.CertSerial = info.Node.CertSerial
+	node.CertNotAfter = info.Node.CertNotAfter
+	if node.Key == "" {
+		node.Key = info.Node.Key
+	} else if node.Key != info.Node.Key {
+		node.KeyCreatedAt = time.Now().Unix()
+		node.PreviousKey = ""
+		node.PreviousKeyExpiresAt = 0
+		node.PendingKey = ""
+		node.PendingKeyExpiresAt = 0
+		recordKeyRotation(&node, info.Node.Key, 0, models.KeyRotationManual, false)
+	}
+
 	info.Node = node
 	return nil
 }
 
 func (m *Manager) DeleteNode(id string) error {
 	m.mu.Lock()
-	info, exists := m.nodes[id]
-	if !exists {
+	if _, exists := m.nodes[id]; !exists {
 		m.mu.Unlock()
 		return fmt.Errorf("node %s not found", id)
 	}
 
 	// 删除该节点的所有规则
+	var ruleIDs []string
 	for ruleID, rule := range m.rules {
 		if rule.NodeID == id {
+			ruleIDs = append(ruleIDs, ruleID)
 			delete(m.rules, ruleID)
+			delete(m.syncStates, ruleID)
 		}
 	}
 
 	delete(m.nodes, id)
+	delete(m.uninstallConfirms, id)
 	m.mu.Unlock()
 
-	// 发送卸载命令到节点（异步，不阻塞）
-	go m.sendUninstallToNode(info)
-
-	return nil
-}
-
-func (m *Manager) sendUninstallToNode(info *NodeInfo) {
-	url := fmt.Sprintf("http://%s:%d/uninstall", info.Node.Host, info.Node.Port)
+	m.counters.remove(ruleIDs...)
+	m.counters.removeNode(id)
 
-	req, _ := http.NewRequest("POST", url, nil)
-	req.Header.Set("X-Node-Key", info.Node.Key)
+	// 只从面板移除，节点上的 Agent 需通过卸载接口单独确认卸载
+	m.transports.remove(id)
 
-	resp, err := m.client.Do(req)
-	if err != nil {
-		// 节点可能已经离线，忽略错误
-		return
-	}
-	defer resp.Body.Close()
+	return nil
 }
 
 func (m *Manager) GetNode(id string) (*models.NodeWithStatus, error) {
@@ -127,12 +224,32 @@ func (m *Manager) GetAllNodes() []models.NodeWithStatus {
 
 func (m *Manager) buildNodeWithStatus(info *NodeInfo) *models.NodeWithStatus {
 	nws := &models.NodeWithStatus{
-		Node: info.Node,
+		Node:             info.Node,
+		LastHeartbeatAge: -1,
+		DetectionMode:    info.DetectionMode,
+		KeyAge:           time.Now().Unix() - keyCreatedAt(&info.Node),
+		CertExpiresIn:    -1,
 	}
 
+	if info.Node.CertNotAfter > 0 {
+		nws.CertExpiresIn = info.Node.CertNotAfter - time.Now().Unix()
+	}
+
+	if !info.LastHeartbeat.IsZero() {
+		nws.LastHeartbeatAge = int64(time.Since(info.LastHeartbeat).Seconds())
+	}
+
+	nws.StateStale = info.StateStale
+
 	if info.Status != nil {
+		nws.StateRevision = info.Status.StateRevision
+		nws.AgentVersion = info.Status.Version
+		nws.AgentOS = info.Status.OS
+		nws.AgentArch = info.Status.Arch
+		nws.Update = info.Status.Update
 		nws.TunnelCount = info.Status.TunnelCount
 		nws.Tunnels = info.Status.Tunnels
+		nws.Interfaces = info.Status.Interfaces
 
 		for _, t := range info.Status.Tunnels {
 			if t.Running {
@@ -143,24 +260,39 @@ func (m *Manager) buildNodeWithStatus(info *NodeInfo) *models.NodeWithStatus {
 		}
 	}
 
+	// 主控已下发更新但 Agent 尚未上报该版本的更新进度
+	if req := info.UpdateRequest; req != nil && (nws.Update == nil || nws.Update.Version != req.Version) {
+		nws.Update = req
+	}
+	nws.Uninstall = info.Uninstall
+
 	return nws
 }
 
+// AddRule 登记期望规则，实际下发由调和循环完成，节点离线时规则保持 pending
 func (m *Manager) AddRule(rule models.NodeRule) error {
+	if err := probe.Validate(rule.HealthCheck); err != nil {
+		return err
+	}
+
 	m.mu.Lock()
-	info, exists := m.nodes[rule.NodeID]
-	if !exists {
+	if _, exists := m.nodes[rule.NodeID]; !exists {
 		m.mu.Unlock()
 		return fmt.Errorf("node %s not found", rule.NodeID)
 	}
 	m.rules[rule.ID] = &rule
+	m.setSyncState(rule.ID, models.SyncPending, "")
 	m.mu.Unlock()
 
-	// 发送到节点
-	return m.sendRuleToNode(info, &rule, true)
+	m.kickReconcile(rule.NodeID)
+	return nil
 }
 
 func (m *Manager) UpdateRule(rule models.NodeRule) error {
+	if err := probe.Validate(rule.HealthCheck); err != nil {
+		return err
+	}
+
 	m.mu.Lock()
 	oldRule, exists := m.rules[rule.ID]
 	if !exists {
@@ -168,25 +300,22 @@ func (m *Manager) UpdateRule(rule models.NodeRule) error {
 		return fmt.Errorf("rule %s not found", rule.ID)
 	}
 
-	info, nodeExists := m.nodes[rule.NodeID]
-	if !nodeExists {
+	if _, nodeExists := m.nodes[rule.NodeID]; !nodeExists {
 		m.mu.Unlock()
 		return fmt.Errorf("node %s not found", rule.NodeID)
 	}
 
-	// 如果节点变了，先从旧节点删除
-	if oldRule.NodeID != rule.NodeID {
-		if oldInfo, ok := m.nodes[oldRule.NodeID]; ok {
-			m.mu.Unlock()
-			m.deleteRuleFromNode(oldInfo, oldRule.ID)
-			m.mu.Lock()
-		}
-	}
-
+	oldNodeID := oldRule.NodeID
 	m.rules[rule.ID] = &rule
+	m.setSyncState(rule.ID, models.SyncPending, "")
 	m.mu.Unlock()
 
-	return m.sendRuleToNode(info, &rule, rule.Enabled)
+	// 节点变更时，旧节点上的隧道会作为孤儿被调和删除
+	if oldNodeID != rule.NodeID {
+		m.kickReconcile(oldNodeID)
+	}
+	m.kickReconcile(rule.NodeID)
+	return nil
 }
 
 func (m *Manager) DeleteRule(id string) error {
@@ -197,37 +326,35 @@ func (m *Manager) DeleteRule(id string) error {
 		return fmt.Errorf("rule %s not found", id)
 	}
 
-	info, nodeExists := m.nodes[rule.NodeID]
 	delete(m.rules, id)
+	delete(m.syncStates, id)
 	m.mu.Unlock()
 
-	if nodeExists {
-		return m.deleteRuleFromNode(info, id)
-	}
+	m.counters.remove(id)
+	m.kickReconcile(rule.NodeID)
 	return nil
 }
 
 func (m *Manager) ToggleRule(id string, enabled bool) error {
-	m.mu.RLock()
+	m.mu.Lock()
 	rule, exists := m.rules[id]
 	if !exists {
-		m.mu.RUnlock()
+		m.mu.Unlock()
 		return fmt.Errorf("rule %s not found", id)
 	}
 
-	info, nodeExists := m.nodes[rule.NodeID]
-	m.mu.RUnlock()
-
-	if !nodeExists {
+	if _, nodeExists := m.nodes[rule.NodeID]; !nodeExists {
+		m.mu.Unlock()
 		return fmt.Errorf("node %s not found", rule.NodeID)
 	}
 
 	rule.Enabled = enabled
+	m.setSyncState(id, models.SyncPending, "")
+	nodeID := rule.NodeID
+	m.mu.Unlock()
 
-	if enabled {
-		return m.startRuleOnNode(info, id)
-	}
-	return m.stopRuleOnNode(info, id)
+	m.kickReconcile(nodeID)
+	return nil
 }
 
 func (m *Manager) GetAllRules() []models.NodeRule {
@@ -281,6 +408,8 @@ func (m *Manager) GetAllTunnelStatus() []models.TunnelStatus {
 				TargetPort: rule.TargetPort,
 				Protocol:   models.Protocol(rule.Protocol),
 				Enabled:    rule.Enabled,
+
+				HealthCheck: rule.HealthCheck,
 			},
 			Traffic: models.TrafficStats{},
 			Latency: models.LatencyInfo{
@@ -300,11 +429,9 @@ func (m *Manager) GetAllTunnelStatus() []models.TunnelStatus {
 						TotalOut:     tunnel.BytesOut,
 						BytesInRate:  tunnel.RateIn,
 						BytesOutRate: tunnel.RateOut,
+						ConnCount:    int32(tunnel.Connections),
 					}
-					status.Latency = models.LatencyInfo{
-						Latency: tunnel.Latency,
-						Status:  getLatencyStatus(tunnel.Latency),
-					}
+					status.Latency = latencyInfo(rule, tunnel)
 					status.Running = tunnel.Running
 					break
 				}
@@ -354,168 +481,36 @@ func (m *Manager) GetActiveTunnelCount() int {
 	return count
 }
 
-func getLatencyStatus(latency int64) string {
-	if latency < 0 {
-		return "error"
-	}
-	if latency > 200 {
-		return "warning"
-	}
-	return "normal"
-}
-
-func (m *Manager) sendRuleToNode(info *NodeInfo, rule *models.NodeRule, autoStart bool) error {
-	url := fmt.Sprintf("http://%s:%d/tunnels", info.Node.Host, info.Node.Port)
-
-	payload := map[string]interface{}{
-		"id":          rule.ID,
-		"local_port":  rule.LocalPort,
-		"target_ip":   rule.TargetIP,
-		"target_port": rule.TargetPort,
-		"protocol":    rule.Protocol,
-		"auto_start":  autoStart,
-	}
-
-	data, _ := json.Marshal(payload)
-	req, _ := http.NewRequest("POST", url, bytes.NewReader(data))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Node-Key", info.Node.Key)
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to connect to node: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("node returned error: %s", string(body))
-	}
-
-	return nil
-}
-
-func (m *Manager) deleteRuleFromNode(info *NodeInfo, ruleID string) error {
-	url := fmt.Sprintf("http://%s:%d/tunnels/%s", info.Node.Host, info.Node.Port, ruleID)
-
-	req, _ := http.NewRequest("DELETE", url, nil)
-	req.Header.Set("X-Node-Key", info.Node.Key)
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to connect to node: %v", err)
-	}
-	defer resp.Body.Close()
-
-	return nil
-}
-
-func (m *Manager) startRuleOnNode(info *NodeInfo, ruleID string) error {
-	url := fmt.Sprintf("http://%s:%d/tunnels/%s/start", info.Node.Host, info.Node.Port, ruleID)
-
-	req, _ := http.NewRequest("POST", url, nil)
-	req.Header.Set("X-Node-Key", info.Node.Key)
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to connect to node: %v", err)
-	}
-	defer resp.Body.Close()
-
-	return nil
-}
-
-func (m *Manager) stopRuleOnNode(info *NodeInfo, ruleID string) error {
-	url := fmt.Sprintf("http://%s:%d/tunnels/%s/stop", info.Node.Host, info.Node.Port, ruleID)
-
-	req, _ := http.NewRequest("POST", url, nil)
-	req.Header.Set("X-Node-Key", info.Node.Key)
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to connect to node: %v", err)
-	}
-	defer resp.Body.Close()
-
-	return nil
-}
-
-func (m *Manager) healthCheckLoop() {
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		m.checkAllNodes()
-	}
-}
-
-func (m *Manager) checkAllNodes() {
-	m.mu.RLock()
-	nodes := make([]*NodeInfo, 0, len(m.nodes))
-	for _, info := range m.nodes {
-		nodes = append(nodes, info)
-	}
-	m.mu.RUnlock()
-
-	for _, info := range nodes {
-		m.checkNode(info)
-	}
-}
-
-func (m *Manager) checkNode(info *NodeInfo) {
-	url := fmt.Sprintf("http://%s:%d/status", info.Node.Host, info.Node.Port)
-
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("X-Node-Key", info.Node.Key)
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		m.mu.Lock()
-		info.Node.Online = false
-		m.mu.Unlock()
-		return
-	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Success bool              `json:"success"`
-		Data    models.NodeStatus `json:"data"`
+// defaultWarnMs 是未配置健康检查的节点规则的偏高阈值
+const defaultWarnMs = 200
+
+// latencyInfo 按规则的健康检查阈值给 Agent 上报的延迟分级。
+// 未配置健康检查的规则沿用原来的分级：超过 200ms 为偏高，只有探测失败才为异常
+func latencyInfo(rule *models.NodeRule, tunnel models.NodeTunnelStatus) models.LatencyInfo {
+	check := probe.Effective(rule.HealthCheck, rule.Protocol)
+	status := probe.Status(check, tunnel.Latency)
+	if rule.HealthCheck == nil && check != nil {
+		switch {
+		case tunnel.Latency < 0:
+			status = probe.StatusError
+		case tunnel.Latency > defaultWarnMs:
+			status = probe.StatusWarning
+		default:
+			status = probe.StatusNormal
+		}
 	}
+	info := models.LatencyInfo{
+		Latency:   tunnel.Latency,
+		Status:    status,
+		LastCheck: tunnel.LastProbe,
+		Error:     tunnel.ProbeError,
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		m.mu.Lock()
-		info.Node.Online = false
-		m.mu.Unlock()
-		return
+		LatencyStats: tunnel.LatencyStats,
 	}
-
-	m.mu.Lock()
-	info.Node.Online = true
-	info.Node.CPUPercent = result.Data.CPUPercent
-	info.Node.MemPercent = result.Data.MemPercent
-	info.Node.Uptime = result.Data.Uptime
-	info.Node.LastSeen = time.Now().Unix()
-	info.Status = &result.Data
-	info.LastCheck = time.Now()
-	m.mu.Unlock()
-}
-
-func (m *Manager) HandleHeartbeat(status models.NodeStatus) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	for _, info := range m.nodes {
-		if info.Node.Key == status.NodeKey {
-			info.Node.Online = true
-			info.Node.CPUPercent = status.CPUPercent
-			info.Node.MemPercent = status.MemPercent
-			info.Node.Uptime = status.Uptime
-			info.Node.LastSeen = time.Now().Unix()
-			info.Status = &status
-			info.LastCheck = time.Now()
-			return
-		}
+	if check != nil {
+		info.Check = check.Type
 	}
+	return info
 }
 
 func (m *Manager) GetGlobalStats() (totalIn, totalOut int64, activeNodes, activeTunnels int) {
@@ -544,15 +539,29 @@ func (m *Manager) RestoreRules(nodes []models.Node, rules []models.NodeRule) {
 	defer m.mu.Unlock()
 
 	for _, n := range nodes {
+		n.Online = false
 		m.nodes[n.ID] = &NodeInfo{
-			Node:      n,
-			LastCheck: time.Now(),
+			Node:          n,
+			LastCheck:     time.Now(),
+			DetectionMode: models.DetectionNone,
 		}
 	}
 
 	for _, r := range rules {
 		rule := r
 		m.rules[r.ID] = &rule
+		m.setSyncState(r.ID, models.SyncPending, "")
+	}
+
+	// 主控重启后不等心跳，直接尝试把恢复的规则批量下发到各节点
+	for id := range m.nodes {
+		go m.resyncRestored(id)
+	}
+}
+
+func (m *Manager) resyncRestored(id string) {
+	if _, err := m.ResyncNode(id); err != nil {
+		log.Printf("Initial sync of node %s failed, waiting for heartbeat: %v", id, err)
 	}
 }
 
@@ -0,0 +1,37 @@
+package node
+
+import (
+	"testing"
+
+	"port-forward-common/probe"
+	"port-forward-dashboard/internal/models"
+)
+
+func TestLatencyInfo(t *testing.T) {
+	configured := &models.HealthCheck{Type: probe.CheckTCP}
+	tests := []struct {
+		name     string
+		protocol string
+		check    *models.HealthCheck
+		latency  int64
+		want     string
+	}{
+		{"default check fast", "tcp", nil, 150, probe.StatusNormal},
+		{"default check at 200ms", "tcp", nil, 200, probe.StatusNormal},
+		{"default check slow", "tcp", nil, 201, probe.StatusWarning},
+		{"default check never errors on latency", "tcp", nil, 5000, probe.StatusWarning},
+		{"default check failed", "tcp", nil, -1, probe.StatusError},
+		{"udp without check", "udp", nil, 10, probe.StatusUnknown},
+		{"configured check warning", "tcp", configured, 150, probe.StatusWarning},
+		{"configured check error", "tcp", configured, 300, probe.StatusError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := &models.NodeRule{ID: "r1", Protocol: tt.protocol, HealthCheck: tt.check}
+			got := latencyInfo(rule, models.NodeTunnelStatus{ID: "r1", Latency: tt.latency})
+			if got.Status != tt.want {
+				t.Errorf("status = %s, want %s", got.Status, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package node
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"port-forward-dashboard/internal/models"
+)
+
+const (
+	// defaultMeshTimeout 未配置超时时单次探测的超时（毫秒）
+	defaultMeshTimeout = 3000
+	// meshRetryDelay 下发探测计划失败后重试的间隔
+	meshRetryDelay = time.Minute
+)
+
+// SetMeshSettings 更新节点间延迟探测的配置，各节点在下一次上报状态时收到新的探测计划
+func (m *Manager) SetMeshSettings(settings models.MeshSettings) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.mesh = settings
+	for _, info := range m.nodes {
+		info.meshRetryAt = time.Time{}
+	}
+}
+
+func (m *Manager) GetMeshSettings() models.MeshSettings {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.mesh
+}
+
+// sortedNodes 按创建时间返回全部节点，调用方需持有锁
+func (m *Manager) sortedNodes() []*NodeInfo {
+	infos := make([]*NodeInfo, 0, len(m.nodes))
+	for _, info := range m.nodes {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Node.CreatedAt != infos[j].Node.CreatedAt {
+			return infos[i].Node.CreatedAt < infos[j].Node.CreatedAt
+		}
+		return infos[i].Node.ID < infos[j].Node.ID
+	})
+	return infos
+}
+
+// meshSchedule 生成节点的探测计划：其余节点的 Agent 端口和全部关键目标，调用方需持有锁
+func (m *Manager) meshSchedule(nodeID string) models.MeshSchedule {
+	if m.mesh.Interval <= 0 {
+		return models.MeshSchedule{}
+	}
+
+	schedule := models.MeshSchedule{Interval: m.mesh.Interval, Timeout: m.mesh.Timeout, Peers: []models.MeshPeer{}}
+	if schedule.Timeout <= 0 {
+		schedule.Timeout = defaultMeshTimeout
+	}
+	for _, info := range m.sortedNodes() {
+		if info.Node.ID != nodeID {
+			schedule.Peers = append(schedule.Peers, models.MeshPeer{ID: info.Node.ID, Host: info.Node.Host, Port: info.Node.Port})
+		}
+	}
+	for _, target := range m.mesh.Targets {
+		schedule.Peers = append(schedule.Peers, models.MeshPeer{ID: target.ID, Host: target.Host, Port: target.Port})
+	}
+
+	data, _ := json.Marshal(schedule)
+	sum := sha256.Sum256(data)
+	schedule.Version = hex.EncodeToString(sum[:8])
+	return schedule
+}
+
+// checkMesh 在节点上报的探测计划版本与期望不一致时异步下发，调用方需持有写锁
+func (m *Manager) checkMesh(info *NodeInfo, status *models.NodeStatus) {
+	schedule := m.meshSchedule(info.Node.ID)
+
+	reported := ""
+	if status.Mesh != nil {
+		reported = status.Mesh.Version
+	}
+	if reported == schedule.Version || info.meshPushing || time.Now().Before(info.meshRetryAt) {
+		return
+	}
+
+	info.meshPushing = true
+	go m.pushMesh(info, info.Node, schedule)
+}
+
+func (m *Manager) pushMesh(info *NodeInfo, node models.Node, schedule models.MeshSchedule) {
+	err := m.nodeRequest(node, "PUT", "/mesh", schedule, nil)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info.meshPushing = false
+	if err != nil {
+		info.meshRetryAt = time.Now().Add(meshRetryDelay)
+		log.Printf("Failed to push mesh schedule to node %s: %v", node.ID, err)
+	}
+}
+
+// GetMeshMatrix 由各节点最近上报的结果组成延迟矩阵，离线节点的行为空
+func (m *Manager) GetMeshMatrix() models.MeshMatrix {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	infos := m.sortedNodes()
+	matrix := models.MeshMatrix{
+		Interval: m.mesh.Interval,
+		Sources:  make([]models.MeshEndpoint, 0, len(infos)),
+		Targets:  make([]models.MeshEndpoint, 0, len(infos)+len(m.mesh.Targets)),
+		Cells:    make([][]*models.MeshResult, 0, len(infos)),
+	}
+
+	for _, info := range infos {
+		endpoint := models.MeshEndpoint{ID: info.Node.ID, Name: info.Node.Name, Kind: models.MeshNode, Online: info.Node.Online}
+		matrix.Sources = append(matrix.Sources, endpoint)
+		matrix.Targets = append(matrix.Targets, endpoint)
+	}
+	for _, target := range m.mesh.Targets {
+		matrix.Targets = append(matrix.Targets, models.MeshEndpoint{ID: target.ID, Name: target.Name, Kind: models.MeshTarget})
+	}
+
+	for _, info := range infos {
+		results := make(map[string]models.MeshResult)
+		if info.Node.Online && info.Status != nil && info.Status.Mesh != nil {
+			for _, r := range info.Status.Mesh.Results {
+				results[r.Peer] = r
+			}
+		}
+
+		row := make([]*models.MeshResult, len(matrix.Targets))
+		for j, target := range matrix.Targets {
+			if r, ok := results[target.ID]; ok && target.ID != info.Node.ID {
+				row[j] = &r
+			}
+		}
+		matrix.Cells = append(matrix.Cells, row)
+	}
+	return matrix
+}
+
+// MeshResults 返回各在线节点上报的探测结果，按节点 ID 索引，用于写入历史数据。
+// 只保留下发给该节点的探测计划中的对象，Peer 由 Agent 上报，不能直接用作序列名
+func (m *Manager) MeshResults() map[string][]models.MeshResult {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := make(map[string][]models.MeshResult)
+	for id, info := range m.nodes {
+		if !info.Node.Online || info.Status == nil || info.Status.Mesh == nil {
+			continue
+		}
+
+		scheduled := make(map[string]bool)
+		for _, peer := range m.meshSchedule(id).Peers {
+			scheduled[peer.ID] = true
+		}
+		var filtered []models.MeshResult
+		for _, r := range info.Status.Mesh.Results {
+			if scheduled[r.Peer] {
+				filtered = append(filtered, r)
+			}
+		}
+		if len(filtered) > 0 {
+			results[id] = filtered
+		}
+	}
+	return results
+}
@@ -0,0 +1,43 @@
+package node
+
+import (
+	"reflect"
+	"testing"
+
+	"port-forward-dashboard/internal/models"
+)
+
+func TestMeshResultsOnlyScheduledPeers(t *testing.T) {
+	mesh := func(peers ...string) *models.NodeStatus {
+		status := &models.NodeStatus{Mesh: &models.MeshStatus{}}
+		for _, peer := range peers {
+			status.Mesh.Results = append(status.Mesh.Results, models.MeshResult{Peer: peer, LastProbe: 1})
+		}
+		return status
+	}
+	m := &Manager{
+		nodes: map[string]*NodeInfo{
+			"n1": {Node: models.Node{ID: "n1", Online: true}, Status: mesh("n2", "t1", "n1", "../../etc", "gone")},
+			"n2": {Node: models.Node{ID: "n2", Online: true}, Status: mesh("junk")},
+			"n3": {Node: models.Node{ID: "n3"}, Status: mesh("n1")},
+		},
+		mesh: models.MeshSettings{Interval: 10, Targets: []models.MeshProbeTarget{{ID: "t1", Host: "example.com", Port: 443}}},
+	}
+
+	got := make(map[string][]string)
+	for source, results := range m.MeshResults() {
+		for _, r := range results {
+			got[source] = append(got[source], r.Peer)
+		}
+	}
+	// n1 探测自身和未下发的对象被丢弃；n2 没有有效结果；n3 离线
+	want := map[string][]string{"n1": {"n2", "t1"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MeshResults() peers = %v, want %v", got, want)
+	}
+
+	m.mesh.Interval = 0
+	if got := m.MeshResults(); len(got) != 0 {
+		t.Errorf("MeshResults() with mesh disabled = %v, want none", got)
+	}
+}
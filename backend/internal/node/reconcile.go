@@ -0,0 +1,274 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"time"
+
+	"port-forward-dashboard/internal/models"
+)
+
+// setSyncState 更新规则的同步状态，调用方需持有写锁
+func (m *Manager) setSyncState(ruleID, state, message string) {
+	m.syncStates[ruleID] = &models.RuleSync{
+		State:     state,
+		Message:   message,
+		UpdatedAt: time.Now().Unix(),
+	}
+}
+
+// GetRulesWithSync 返回规则及其同步状态，nodeID 为空时返回全部
+func (m *Manager) GetRulesWithSync(nodeID string) []models.NodeRuleWithSync {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]models.NodeRuleWithSync, 0, len(m.rules))
+	for _, rule := range m.rules {
+		if nodeID != "" && rule.NodeID != nodeID {
+			continue
+		}
+		r := models.NodeRuleWithSync{NodeRule: *rule}
+		if state, ok := m.syncStates[rule.ID]; ok {
+			r.Sync = *state
+		} else {
+			r.Sync = models.RuleSync{State: models.SyncPending}
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+// kickReconcile 立即对节点做一次调和（节点离线时什么也不做，等上线后由心跳触发）
+func (m *Manager) kickReconcile(nodeID string) {
+	m.mu.Lock()
+	info, exists := m.nodes[nodeID]
+	start := exists && m.scheduleReconcile(info)
+	m.mu.Unlock()
+
+	if start {
+		go m.reconcileNode(info)
+	}
+}
+
+// scheduleReconcile 标记节点需要调和，返回是否需要启动新的调和协程。调用方需持有写锁
+func (m *Manager) scheduleReconcile(info *NodeInfo) bool {
+	if !info.Node.Online || info.Status == nil {
+		return false
+	}
+	if info.reconciling {
+		info.reconcileAgain = true
+		return false
+	}
+	info.reconciling = true
+	return true
+}
+
+func (m *Manager) reconcileNode(info *NodeInfo) {
+	for {
+		m.reconcileOnce(info)
+
+		m.mu.Lock()
+		if !info.reconcileAgain || !info.Node.Online {
+			info.reconciling = false
+			info.reconcileAgain = false
+			m.mu.Unlock()
+			return
+		}
+		info.reconcileAgain = false
+		m.mu.Unlock()
+	}
+}
+
+// reconcileOnce 对比节点的期望规则与 Agent 上报的隧道，有差异时通过批量同步收敛
+func (m *Manager) reconcileOnce(info *NodeInfo) {
+	m.mu.Lock()
+	if !info.Node.Online || info.Status == nil {
+		m.mu.Unlock()
+		return
+	}
+	node := info.Node
+	actual := make(map[string]models.NodeTunnelStatus, len(info.Status.Tunnels))
+	for _, t := range info.Status.Tunnels {
+		actual[t.ID] = t
+	}
+	desired := m.desiredRules(node.ID)
+	reportedRevision := info.Status.StateRevision
+	fullSync := info.needsFullSync
+	info.needsFullSync = false
+	m.mu.Unlock()
+
+	if !fullSync && !hasDrift(desired, actual) {
+		for _, rule := range desired {
+			m.finishRule(rule, models.SyncSynced, "")
+		}
+
+		// Agent 的状态虽然版本落后，但内容已与期望一致，以它上报的版本为新的基线
+		m.mu.Lock()
+		if info.AppliedRevision > reportedRevision {
+			info.AppliedRevision = reportedRevision
+			info.StateStale = false
+		}
+		m.mu.Unlock()
+		return
+	}
+
+	result, err := m.syncTunnelsOnNode(node, desired)
+	if err == nil {
+		m.applySyncResult(desired, result)
+		return
+	}
+
+	var aerr *agentError
+	if !errors.As(err, &aerr) || (aerr.Status != http.StatusNotFound && aerr.Status != http.StatusMethodNotAllowed) {
+		for _, rule := range desired {
+			m.finishRule(rule, models.SyncError, err.Error())
+		}
+		if fullSync {
+			m.mu.Lock()
+			info.needsFullSync = true
+			m.mu.Unlock()
+		}
+		return
+	}
+
+	// 旧版 Agent 不支持批量同步，逐条收敛
+	m.reconcileEach(node, desired, actual)
+}
+
+// desiredRules 返回节点上的期望规则，调用方需持有锁
+func (m *Manager) desiredRules(nodeID string) []models.NodeRule {
+	var desired []models.NodeRule
+	for _, rule := range m.rules {
+		if rule.NodeID == nodeID {
+			desired = append(desired, *rule)
+		}
+	}
+	return desired
+}
+
+func hasDrift(desired []models.NodeRule, actual map[string]models.NodeTunnelStatus) bool {
+	if len(desired) != len(actual) {
+		return true
+	}
+	for _, rule := range desired {
+		tunnel, exists := actual[rule.ID]
+		if !exists || tunnelDrifted(rule, tunnel) {
+			return true
+		}
+	}
+	return false
+}
+
+// finishRule 记录调和结果。调和期间规则被修改或删除时，以新的期望状态为准
+func (m *Manager) finishRule(rule models.NodeRule, state, message string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cur, ok := m.rules[rule.ID]; ok && *cur == rule {
+		if prev, ok := m.syncStates[rule.ID]; !ok || prev.State != state || prev.Message != message {
+			m.setSyncState(rule.ID, state, message)
+		}
+	}
+}
+
+func (m *Manager) applySyncResult(desired []models.NodeRule, result *models.NodeSyncResult) {
+	byID := make(map[string]models.TunnelSyncResult, len(result.Results))
+	for _, r := range result.Results {
+		byID[r.ID] = r
+	}
+
+	for _, rule := range desired {
+		r, ok := byID[rule.ID]
+		switch {
+		case !ok:
+			m.finishRule(rule, models.SyncError, "missing from node sync result")
+		case r.Success:
+			m.finishRule(rule, models.SyncSynced, "")
+		default:
+			m.finishRule(rule, models.SyncError, r.Error)
+		}
+	}
+}
+
+func (m *Manager) reconcileEach(node models.Node, desired []models.NodeRule, actual map[string]models.NodeTunnelStatus) {
+	for _, rule := range desired {
+		tunnel, exists := actual[rule.ID]
+		delete(actual, rule.ID)
+
+		state, message := models.SyncSynced, ""
+		if err := m.convergeRule(node, rule, tunnel, exists); err != nil {
+			state, message = models.SyncError, err.Error()
+			var aerr *agentError
+			if errors.As(err, &aerr) && aerr.Status == http.StatusConflict {
+				// 上报的状态落后于刚完成的创建，等下一次心跳确认
+				state, message = models.SyncPending, ""
+			}
+		}
+		m.finishRule(rule, state, message)
+	}
+
+	// Agent 上存在但已不在期望状态中的隧道
+	for id := range actual {
+		if err := m.deleteTunnelOnNode(node, id); err != nil {
+			log.Printf("Failed to remove orphan tunnel %s from node %s: %v", id, node.Name, err)
+		}
+	}
+}
+
+// ResyncNode 立即把节点的全部期望规则批量下发，返回每条隧道的处理结果
+func (m *Manager) ResyncNode(id string) (*models.NodeSyncResult, error) {
+	m.mu.RLock()
+	info, exists := m.nodes[id]
+	if !exists {
+		m.mu.RUnlock()
+		return nil, fmt.Errorf("node %s not found", id)
+	}
+	node := info.Node
+	desired := m.desiredRules(id)
+	m.mu.RUnlock()
+
+	result, err := m.syncTunnelsOnNode(node, desired)
+	if err != nil {
+		return nil, err
+	}
+	m.applySyncResult(desired, result)
+	return result, nil
+}
+
+func (m *Manager) convergeRule(node models.Node, rule models.NodeRule, tunnel models.NodeTunnelStatus, exists bool) error {
+	if exists && tunnelSpecDiffers(rule, tunnel) {
+		if err := m.deleteTunnelOnNode(node, rule.ID); err != nil {
+			return err
+		}
+		exists = false
+	}
+
+	switch {
+	case !exists:
+		return m.createTunnelOnNode(node, rule)
+	case rule.Enabled && !(tunnel.Running && tunnel.Enabled):
+		return m.startTunnelOnNode(node, rule.ID)
+	case !rule.Enabled && (tunnel.Running || tunnel.Enabled):
+		// Agent 持久化的 enabled 也要收敛，否则它重启后会把隧道再拉起来
+		return m.stopTunnelOnNode(node, rule.ID)
+	}
+	return nil
+}
+
+func tunnelDrifted(rule models.NodeRule, tunnel models.NodeTunnelStatus) bool {
+	return tunnelSpecDiffers(rule, tunnel) ||
+		rule.Enabled != tunnel.Running ||
+		rule.Enabled != tunnel.Enabled ||
+		rule.AccessLog != tunnel.AccessLog ||
+		!reflect.DeepEqual(rule.HealthCheck, tunnel.HealthCheck)
+}
+
+func tunnelSpecDiffers(rule models.NodeRule, tunnel models.NodeTunnelStatus) bool {
+	return rule.LocalPort != tunnel.LocalPort ||
+		rule.TargetIP != tunnel.TargetIP ||
+		rule.TargetPort != tunnel.TargetPort ||
+		rule.Protocol != tunnel.Protocol
+}
@@ -0,0 +1,353 @@
+package node
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"port-forward-dashboard/internal/models"
+)
+
+// stubAgent 模拟 Agent 的隧道接口，记录收到的请求
+type stubAgent struct {
+	mu       sync.Mutex
+	requests []string
+	// specs 是最近一次批量同步下发的隧道，按 ID 记录 enabled
+	specs map[string]bool
+
+	legacy   bool              // 旧版 Agent，不支持批量同步
+	status   int               // 非 0 时所有请求都返回该状态码
+	failures map[string]string // 批量同步中处理失败的隧道及原因
+	conflict map[string]bool   // 逐条创建时返回 409 的隧道
+}
+
+func (a *stubAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	reply := func(status int, data interface{}, message string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(models.APIResponse{Success: status == http.StatusOK, Message: message, Data: data})
+	}
+
+	var body struct {
+		ID      string                   `json:"id"`
+		Tunnels []map[string]interface{} `json:"tunnels"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	request := r.Method + " " + r.URL.Path
+	if body.ID != "" {
+		request += " " + body.ID
+	}
+	a.requests = append(a.requests, request)
+
+	switch {
+	case a.status != 0:
+		reply(a.status, nil, "agent error")
+	case r.Method == "PUT" && r.URL.Path == "/tunnels" && a.legacy:
+		reply(http.StatusNotFound, nil, "404 page not found")
+	case r.Method == "PUT" && r.URL.Path == "/tunnels":
+		a.specs = make(map[string]bool)
+		result := models.NodeSyncResult{Revision: 7, Results: []models.TunnelSyncResult{}}
+		for _, spec := range body.Tunnels {
+			id := spec["id"].(string)
+			a.specs[id] = spec["enabled"].(bool)
+			msg := a.failures[id]
+			result.Results = append(result.Results, models.TunnelSyncResult{ID: id, Action: "create", Success: msg == "", Error: msg})
+		}
+		reply(http.StatusOK, result, "")
+	case r.Method == "POST" && r.URL.Path == "/tunnels" && a.conflict[body.ID]:
+		reply(http.StatusConflict, nil, "tunnel already exists")
+	default:
+		reply(http.StatusOK, tunnelOpResult{Revision: 3}, "")
+	}
+}
+
+func (a *stubAgent) sortedRequests() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	requests := append([]string{}, a.requests...)
+	sort.Strings(requests)
+	return requests
+}
+
+// newReconcileManager 创建只有一个在线节点的 Manager，节点上报的隧道为 tunnels
+func newReconcileManager(t *testing.T, agent *stubAgent, rules []models.NodeRule, tunnels []models.NodeTunnelStatus) (*Manager, *NodeInfo) {
+	t.Helper()
+	server := httptest.NewServer(agent)
+	t.Cleanup(server.Close)
+
+	host, portStr, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	port, _ := strconv.Atoi(portStr)
+	info := &NodeInfo{
+		Node:   models.Node{ID: "n1", Name: "edge", Host: host, Port: port, Online: true},
+		Status: &models.NodeStatus{Tunnels: tunnels},
+	}
+	m := &Manager{
+		nodes:      map[string]*NodeInfo{"n1": info},
+		rules:      make(map[string]*models.NodeRule),
+		syncStates: make(map[string]*models.RuleSync),
+		transports: &transports{plain: http.DefaultTransport.(*http.Transport).Clone()},
+	}
+	for i := range rules {
+		m.rules[rules[i].ID] = &rules[i]
+	}
+	return m, info
+}
+
+func testRule(id string, port int, enabled bool) models.NodeRule {
+	return models.NodeRule{ID: id, NodeID: "n1", LocalPort: port, TargetIP: "10.0.0.1", TargetPort: 80, Protocol: "tcp", Enabled: enabled}
+}
+
+// tunnelOf 返回与规则一致的隧道状态
+func tunnelOf(rule models.NodeRule) models.NodeTunnelStatus {
+	return models.NodeTunnelStatus{
+		ID: rule.ID, LocalPort: rule.LocalPort, TargetIP: rule.TargetIP, TargetPort: rule.TargetPort,
+		Protocol: rule.Protocol, Enabled: rule.Enabled, Running: rule.Enabled, AccessLog: rule.AccessLog,
+	}
+}
+
+func syncStates(m *Manager) map[string]models.RuleSync {
+	states := make(map[string]models.RuleSync)
+	for _, r := range m.GetRulesWithSync("n1") {
+		states[r.ID] = models.RuleSync{State: r.Sync.State, Message: r.Sync.Message}
+	}
+	return states
+}
+
+func TestReconcileBulk(t *testing.T) {
+	r1, r2 := testRule("r1", 10001, true), testRule("r2", 10002, true)
+	retargeted := r1
+	retargeted.TargetPort = 8080
+	disabled := testRule("r1", 10001, false)
+
+	tests := []struct {
+		name      string
+		rules     []models.NodeRule
+		tunnels   []models.NodeTunnelStatus
+		failures  map[string]string
+		status    int
+		wantReqs  []string
+		wantSpecs map[string]bool
+		want      map[string]models.RuleSync
+	}{
+		{
+			name:     "in sync",
+			rules:    []models.NodeRule{r1},
+			tunnels:  []models.NodeTunnelStatus{tunnelOf(r1)},
+			wantReqs: []string{},
+			want:     map[string]models.RuleSync{"r1": {State: models.SyncSynced}},
+		},
+		{
+			// Agent 重启且状态文件丢失，上报的隧道少了一条
+			name:      "missing tunnel after agent restart",
+			rules:     []models.NodeRule{r1, r2},
+			tunnels:   []models.NodeTunnelStatus{tunnelOf(r1)},
+			wantReqs:  []string{"PUT /tunnels"},
+			wantSpecs: map[string]bool{"r1": true, "r2": true},
+			want:      map[string]models.RuleSync{"r1": {State: models.SyncSynced}, "r2": {State: models.SyncSynced}},
+		},
+		{
+			name:      "changed target",
+			rules:     []models.NodeRule{retargeted},
+			tunnels:   []models.NodeTunnelStatus{tunnelOf(r1)},
+			wantReqs:  []string{"PUT /tunnels"},
+			wantSpecs: map[string]bool{"r1": true},
+			want:      map[string]models.RuleSync{"r1": {State: models.SyncSynced}},
+		},
+		{
+			name:      "disabled rule still running",
+			rules:     []models.NodeRule{disabled},
+			tunnels:   []models.NodeTunnelStatus{tunnelOf(r1)},
+			wantReqs:  []string{"PUT /tunnels"},
+			wantSpecs: map[string]bool{"r1": false},
+			want:      map[string]models.RuleSync{"r1": {State: models.SyncSynced}},
+		},
+		{
+			name:      "orphan tunnel",
+			rules:     []models.NodeRule{r1},
+			tunnels:   []models.NodeTunnelStatus{tunnelOf(r1), tunnelOf(testRule("old", 10009, true))},
+			wantReqs:  []string{"PUT /tunnels"},
+			wantSpecs: map[string]bool{"r1": true},
+			want:      map[string]models.RuleSync{"r1": {State: models.SyncSynced}},
+		},
+		{
+			name:      "agent error surfaced per tunnel",
+			rules:     []models.NodeRule{r1, r2},
+			failures:  map[string]string{"r2": "listen tcp :10002: bind: address already in use"},
+			wantReqs:  []string{"PUT /tunnels"},
+			wantSpecs: map[string]bool{"r1": true, "r2": true},
+			want: map[string]models.RuleSync{
+				"r1": {State: models.SyncSynced},
+				"r2": {State: models.SyncError, Message: "listen tcp :10002: bind: address already in use"},
+			},
+		},
+		{
+			name:     "agent rejects the sync",
+			rules:    []models.NodeRule{r1},
+			status:   http.StatusInternalServerError,
+			wantReqs: []string{"PUT /tunnels"},
+			want:     map[string]models.RuleSync{"r1": {State: models.SyncError, Message: "node returned error: agent error"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := &stubAgent{failures: tt.failures, status: tt.status}
+			m, info := newReconcileManager(t, agent, tt.rules, tt.tunnels)
+			m.reconcileOnce(info)
+
+			if got := agent.sortedRequests(); !reflect.DeepEqual(got, tt.wantReqs) {
+				t.Errorf("requests = %v, want %v", got, tt.wantReqs)
+			}
+			if tt.wantSpecs != nil && !reflect.DeepEqual(agent.specs, tt.wantSpecs) {
+				t.Errorf("synced tunnels = %v, want %v", agent.specs, tt.wantSpecs)
+			}
+			if got := syncStates(m); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sync states = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileFullSyncAfterReconnect(t *testing.T) {
+	r1 := testRule("r1", 10001, true)
+	agent := &stubAgent{status: http.StatusInternalServerError}
+	m, info := newReconcileManager(t, agent, []models.NodeRule{r1}, []models.NodeTunnelStatus{tunnelOf(r1)})
+
+	// 重新上线后即使上报的隧道与期望一致也要完整下发，失败时保留标记等下次重试
+	info.needsFullSync = true
+	m.reconcileOnce(info)
+	if !info.needsFullSync {
+		t.Fatal("needsFullSync cleared after a failed full sync")
+	}
+
+	agent.status = 0
+	m.reconcileOnce(info)
+	if info.needsFullSync {
+		t.Fatal("needsFullSync still set after a successful full sync")
+	}
+	if got := agent.sortedRequests(); !reflect.DeepEqual(got, []string{"PUT /tunnels", "PUT /tunnels"}) {
+		t.Errorf("requests = %v", got)
+	}
+	if info.AppliedRevision != 7 {
+		t.Errorf("AppliedRevision = %d, want 7", info.AppliedRevision)
+	}
+	if got := syncStates(m)["r1"].State; got != models.SyncSynced {
+		t.Errorf("state = %s, want synced", got)
+	}
+}
+
+func TestReconcileLegacyAgent(t *testing.T) {
+	missing := testRule("r1", 10001, true)
+	retargeted := testRule("r2", 10002, true)
+	running := tunnelOf(retargeted)
+	retargeted.TargetIP = "10.0.0.2"
+	disabled := testRule("r3", 10003, false)
+	stopped := testRule("r4", 10004, true)
+	stoppedTunnel := tunnelOf(stopped)
+	stoppedTunnel.Running = false
+	conflicting := testRule("r5", 10005, true)
+
+	agent := &stubAgent{legacy: true, conflict: map[string]bool{"r5": true}}
+	m, info := newReconcileManager(t, agent,
+		[]models.NodeRule{missing, retargeted, disabled, stopped, conflicting},
+		[]models.NodeTunnelStatus{running, tunnelOf(testRule("r3", 10003, true)), stoppedTunnel, tunnelOf(testRule("old", 10009, true))})
+	m.reconcileOnce(info)
+
+	want := []string{
+		"DELETE /tunnels/old",
+		"DELETE /tunnels/r2",
+		"POST /tunnels r1",
+		"POST /tunnels r2",
+		"POST /tunnels r5",
+		"POST /tunnels/r3/stop",
+		"POST /tunnels/r4/start",
+		"PUT /tunnels",
+	}
+	if got := agent.sortedRequests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+
+	wantStates := map[string]models.RuleSync{
+		"r1": {State: models.SyncSynced},
+		"r2": {State: models.SyncSynced},
+		"r3": {State: models.SyncSynced},
+		"r4": {State: models.SyncSynced},
+		// 创建冲突说明上报的状态落后，等下一次心跳确认
+		"r5": {State: models.SyncPending},
+	}
+	if got := syncStates(m); !reflect.DeepEqual(got, wantStates) {
+		t.Errorf("sync states = %+v, want %+v", got, wantStates)
+	}
+	if info.AppliedRevision != 3 {
+		t.Errorf("AppliedRevision = %d, want 3", info.AppliedRevision)
+	}
+}
+
+func TestReconcileKeepsStateOfRuleChangedMeanwhile(t *testing.T) {
+	r1 := testRule("r1", 10001, true)
+	agent := &stubAgent{failures: map[string]string{"r1": "boom"}}
+	m, info := newReconcileManager(t, agent, []models.NodeRule{r1}, nil)
+	m.setSyncState("r1", models.SyncPending, "")
+
+	// 调和期间规则被修改，旧规则的结果不能覆盖新规则的状态
+	m.finishRule(testRule("r1", 10001, false), models.SyncError, "boom")
+	if got := syncStates(m)["r1"].State; got != models.SyncPending {
+		t.Fatalf("state = %s, want pending", got)
+	}
+
+	m.reconcileOnce(info)
+	if got := syncStates(m)["r1"]; got.State != models.SyncError || got.Message != "boom" {
+		t.Fatalf("state = %+v, want error boom", got)
+	}
+}
+
+func TestResyncNode(t *testing.T) {
+	r1, r2 := testRule("r1", 10001, true), testRule("r2", 10002, false)
+	agent := &stubAgent{failures: map[string]string{"r2": "invalid target"}}
+	// 上报的状态与期望一致，手动同步仍然完整下发
+	m, info := newReconcileManager(t, agent, []models.NodeRule{r1, r2}, []models.NodeTunnelStatus{tunnelOf(r1), tunnelOf(r2)})
+
+	if _, err := m.ResyncNode("missing"); err == nil {
+		t.Error("ResyncNode() of an unknown node succeeded")
+	}
+
+	result, err := m.ResyncNode("n1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Revision != 7 || len(result.Results) != 2 {
+		t.Errorf("result = %+v", result)
+	}
+	if !reflect.DeepEqual(agent.specs, map[string]bool{"r1": true, "r2": false}) {
+		t.Errorf("synced tunnels = %v", agent.specs)
+	}
+	want := map[string]models.RuleSync{
+		"r1": {State: models.SyncSynced},
+		"r2": {State: models.SyncError, Message: "invalid target"},
+	}
+	if got := syncStates(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("sync states = %+v, want %+v", got, want)
+	}
+	if info.AppliedRevision != 7 {
+		t.Errorf("AppliedRevision = %d, want 7", info.AppliedRevision)
+	}
+
+	// Agent 拒绝时返回错误，不改动已有的同步状态
+	agent.status = http.StatusInternalServerError
+	if _, err := m.ResyncNode("n1"); err == nil || !strings.Contains(err.Error(), "agent error") {
+		t.Errorf("ResyncNode() error = %v, want the agent's error", err)
+	}
+	if got := syncStates(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("sync states after a failed resync = %+v", got)
+	}
+}
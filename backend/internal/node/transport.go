@@ -0,0 +1,91 @@
+package node
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"port-forward-dashboard/internal/models"
+	"port-forward-dashboard/internal/pki"
+)
+
+// requestTimeout 控制请求的默认超时
+const requestTimeout = 10 * time.Second
+
+// transports 为每个持有证书的节点缓存一个固定了 CA 和节点身份的 Transport，
+// 证书更换后按序列号重建
+type transports struct {
+	plain   *http.Transport
+	byNode  map[string]*nodeTransport
+	tlsConf *tls.Config
+	mu      sync.Mutex
+}
+
+type nodeTransport struct {
+	serial    string
+	transport *http.Transport
+}
+
+func newTransports(ca *pki.CA, masterCert tls.Certificate) *transports {
+	return &transports{
+		plain:  http.DefaultTransport.(*http.Transport).Clone(),
+		byNode: make(map[string]*nodeTransport),
+		tlsConf: &tls.Config{
+			RootCAs:      ca.Pool(),
+			Certificates: []tls.Certificate{masterCert},
+			MinVersion:   tls.VersionTLS12,
+		},
+	}
+}
+
+func (t *transports) get(node models.Node) *http.Transport {
+	if node.CertSerial == "" {
+		return t.plain
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if cached, ok := t.byNode[node.ID]; ok {
+		if cached.serial == node.CertSerial {
+			return cached.transport
+		}
+		cached.transport.CloseIdleConnections()
+	}
+
+	conf := t.tlsConf.Clone()
+	conf.ServerName = pki.AgentServerName(node.ID)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = conf
+	t.byNode[node.ID] = &nodeTransport{serial: node.CertSerial, transport: transport}
+	return transport
+}
+
+func (t *transports) remove(nodeID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if cached, ok := t.byNode[nodeID]; ok {
+		cached.transport.CloseIdleConnections()
+		delete(t.byNode, nodeID)
+	}
+}
+
+// nodeURL 返回节点控制 API 的地址，已签发证书的节点走 mTLS
+func nodeURL(node models.Node, path string) string {
+	scheme := "http"
+	if node.CertSerial != "" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(node.Host, strconv.Itoa(node.Port)), path)
+}
+
+// httpClient 返回访问该节点的 http.Client
+func (m *Manager) httpClient(node models.Node, timeout time.Duration) *http.Client {
+	return &http.Client{Transport: m.transports.get(node), Timeout: timeout}
+}
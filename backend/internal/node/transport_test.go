@@ -0,0 +1,27 @@
+package node
+
+import (
+	"testing"
+
+	"port-forward-dashboard/internal/models"
+)
+
+func TestNodeURL(t *testing.T) {
+	tests := []struct {
+		name string
+		node models.Node
+		want string
+	}{
+		{"ipv4", models.Node{Host: "10.0.0.1", Port: 9090}, "http://10.0.0.1:9090/status"},
+		{"hostname", models.Node{Host: "edge.example.com", Port: 9090}, "http://edge.example.com:9090/status"},
+		{"ipv6", models.Node{Host: "2001:db8::1", Port: 9090}, "http://[2001:db8::1]:9090/status"},
+		{"mtls", models.Node{Host: "2001:db8::1", Port: 9443, CertSerial: "01"}, "https://[2001:db8::1]:9443/status"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nodeURL(tt.node, "/status"); got != tt.want {
+				t.Errorf("nodeURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
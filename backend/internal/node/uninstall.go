@@ -0,0 +1,147 @@
+package node
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"port-forward-common/signing"
+	"port-forward-dashboard/internal/models"
+)
+
+const (
+	// uninstallConfirmTTL 卸载确认令牌的有效期
+	uninstallConfirmTTL = 5 * time.Minute
+	// uninstallCommandTTL 签名卸载指令的有效期，Agent 拒绝过期的指令
+	uninstallCommandTTL = 60 * time.Second
+)
+
+var (
+	ErrInvalidConfirmation = errors.New("invalid or expired uninstall confirmation")
+	ErrUnexpectedReport    = errors.New("no pending uninstall command matches this report")
+)
+
+// SignFunc 用发布密钥签名，返回 base64 编码的签名
+type SignFunc func(data []byte) string
+
+type pendingUninstall struct {
+	tokenHash string
+	expiresAt time.Time
+}
+
+// RequestUninstall 是卸载的第一步，只生成确认令牌，不会向节点发送任何指令
+func (m *Manager) RequestUninstall(id string) (models.UninstallConfirmation, error) {
+	token, err := randomHex(16)
+	if err != nil {
+		return models.UninstallConfirmation{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info, exists := m.nodes[id]
+	if !exists {
+		return models.UninstallConfirmation{}, fmt.Errorf("node %s not found", id)
+	}
+
+	expires := time.Now().Add(uninstallConfirmTTL)
+	m.uninstallConfirms[id] = &pendingUninstall{tokenHash: hashToken(token), expiresAt: expires}
+
+	return models.UninstallConfirmation{
+		NodeID:       id,
+		NodeName:     info.Node.Name,
+		ConfirmToken: token,
+		ExpiresAt:    expires.Unix(),
+	}, nil
+}
+
+// ConfirmUninstall 校验确认令牌后向节点下发签名的卸载指令。
+// 令牌无论校验是否通过都会作废，防止被反复猜测
+func (m *Manager) ConfirmUninstall(id, token string, sign SignFunc) error {
+	nonce, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	info, exists := m.nodes[id]
+	if !exists {
+		m.mu.Unlock()
+		return fmt.Errorf("node %s not found", id)
+	}
+	pending := m.uninstallConfirms[id]
+	delete(m.uninstallConfirms, id)
+	if pending == nil || time.Now().After(pending.expiresAt) ||
+		subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(pending.tokenHash)) != 1 {
+		m.mu.Unlock()
+		return ErrInvalidConfirmation
+	}
+	node := info.Node
+	// 先登记 nonce，Agent 的回报可能早于本次请求返回
+	info.uninstallNonce = nonce
+	m.mu.Unlock()
+
+	now := time.Now()
+	cmd := models.UninstallCommand{
+		Action:    models.CommandUninstall,
+		NodeID:    node.ID,
+		KeyID:     signing.KeyID(node.Key),
+		Nonce:     nonce,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(uninstallCommandTTL).Unix(),
+	}
+	payload, _ := json.Marshal(cmd)
+	signed := models.SignedCommand{
+		Payload:   base64.StdEncoding.EncodeToString(payload),
+		Signature: sign(payload),
+	}
+
+	err = m.nodeRequest(node, "POST", "/uninstall", signed, nil)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err != nil {
+		if info.uninstallNonce == nonce {
+			info.uninstallNonce = ""
+		}
+		info.Uninstall = &models.UninstallStatus{State: models.UninstallFailed, Message: err.Error(), UpdatedAt: now.Unix()}
+		return err
+	}
+	if info.uninstallNonce == nonce {
+		info.Uninstall = &models.UninstallStatus{State: models.UninstallSent, UpdatedAt: now.Unix()}
+	}
+	return nil
+}
+
+// HandleUninstallReport 校验 Agent 签名的卸载回报，返回回报所属的节点
+func (m *Manager) HandleUninstallReport(auth HeartbeatAuth, body []byte) (models.Node, models.UninstallReport, error) {
+	var report models.UninstallReport
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info, err := m.verifyHeartbeat(auth, body)
+	if err != nil {
+		m.authFailures.record(err, auth)
+		return models.Node{}, report, err
+	}
+
+	if err := json.Unmarshal(body, &report); err != nil {
+		return info.Node, report, fmt.Errorf("invalid uninstall report: %v", err)
+	}
+	if info.uninstallNonce == "" || report.Nonce != info.uninstallNonce {
+		return info.Node, report, ErrUnexpectedReport
+	}
+	info.uninstallNonce = ""
+
+	state := models.UninstallCompleted
+	if !report.Success {
+		state = models.UninstallFailed
+	}
+	info.Uninstall = &models.UninstallStatus{State: state, Message: report.Message, UpdatedAt: time.Now().Unix()}
+	return info.Node, report, nil
+}
@@ -0,0 +1,51 @@
+package node
+
+import (
+	"fmt"
+	"time"
+
+	"port-forward-dashboard/internal/models"
+)
+
+// UpdateTarget 返回节点 Agent 上报的平台，用于选择更新包
+func (m *Manager) UpdateTarget(id string) (goos, goarch string, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	info, exists := m.nodes[id]
+	if !exists {
+		return "", "", fmt.Errorf("node %s not found", id)
+	}
+	if !info.Node.Online || info.Status == nil {
+		return "", "", fmt.Errorf("node %s is offline", id)
+	}
+	if info.Status.OS == "" || info.Status.Arch == "" {
+		return "", "", fmt.Errorf("node %s runs an agent without self-update support", id)
+	}
+	return info.Status.OS, info.Status.Arch, nil
+}
+
+// UpdateAgent 向节点下发自更新指令，Agent 下载校验后自行替换并重启
+func (m *Manager) UpdateAgent(id string, update models.AgentUpdate) error {
+	m.mu.RLock()
+	info, exists := m.nodes[id]
+	if !exists {
+		m.mu.RUnlock()
+		return fmt.Errorf("node %s not found", id)
+	}
+	node := info.Node
+	m.mu.RUnlock()
+
+	if err := m.nodeRequest(node, "POST", "/update", update, nil); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	info.UpdateRequest = &models.AgentUpdateStatus{
+		State:     models.UpdateRequested,
+		Version:   update.Version,
+		UpdatedAt: time.Now().Unix(),
+	}
+	m.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,219 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// MasterCommonName 是主控客户端证书的 CN，Agent 只接受该身份的客户端证书
+	MasterCommonName = "port-forward-master"
+	// AgentCertValidity Agent 证书有效期
+	AgentCertValidity = 365 * 24 * time.Hour
+
+	caValidity     = 10 * 365 * 24 * time.Hour
+	masterValidity = 365 * 24 * time.Hour
+)
+
+// CA 是主控内置的证书颁发机构，为 Agent 签发服务端证书、为主控自身签发客户端证书
+type CA struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+	pool    *x509.CertPool
+}
+
+// AgentServerName 返回节点证书中的 DNS 名称，主控连接时以此校验节点身份
+func AgentServerName(nodeID string) string {
+	return nodeID + ".agent.port-forward"
+}
+
+// Load 从 PEM 加载 CA，两者都为空时生成新的 CA
+func Load(certPEM, keyPEM string) (*CA, error) {
+	if certPEM == "" && keyPEM == "" {
+		return generate()
+	}
+
+	certBlock, _ := pem.Decode([]byte(certPEM))
+	keyBlock, _ := pem.Decode([]byte(keyPEM))
+	if certBlock == nil || keyBlock == nil {
+		return nil, errors.New("invalid CA certificate or key")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return newCA(cert, key)
+}
+
+// Open 从文件加载 CA，私钥文件权限为 0600。文件不存在时使用旧配置中的 PEM 迁移，
+// 都没有时生成新的 CA 并写入文件。证书和私钥只存在其一时返回错误，避免重新生成后已签发的节点证书全部失效
+func Open(certPath, keyPath, legacyCert, legacyKey string) (*CA, error) {
+	certPEM, certErr := os.ReadFile(certPath)
+	keyPEM, keyErr := os.ReadFile(keyPath)
+	switch {
+	case certErr == nil && keyErr == nil:
+		return Load(string(certPEM), string(keyPEM))
+	case !os.IsNotExist(certErr) && certErr != nil:
+		return nil, fmt.Errorf("failed to read CA certificate: %v", certErr)
+	case !os.IsNotExist(keyErr) && keyErr != nil:
+		return nil, fmt.Errorf("failed to read CA key: %v", keyErr)
+	case certErr == nil || keyErr == nil:
+		return nil, fmt.Errorf("CA certificate and key must both exist (%s, %s)", certPath, keyPath)
+	}
+
+	if (legacyCert == "") != (legacyKey == "") {
+		return nil, errors.New("incomplete CA in config")
+	}
+	ca, err := Load(legacyCert, legacyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(keyPath, ca.keyPEM, 0600); err != nil {
+		return nil, fmt.Errorf("failed to save CA key: %v", err)
+	}
+	if err := os.WriteFile(certPath, ca.certPEM, 0644); err != nil {
+		os.Remove(keyPath)
+		return nil, fmt.Errorf("failed to save CA certificate: %v", err)
+	}
+	return ca, nil
+}
+
+func generate() (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: "Port Forward Dashboard CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return newCA(cert, key)
+}
+
+func newCA(cert *x509.Certificate, key *ecdsa.PrivateKey) (*CA, error) {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return &CA{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		pool:    pool,
+	}, nil
+}
+
+// CertPEM 返回 CA 证书，Agent 用它校验主控的客户端证书
+func (ca *CA) CertPEM() string {
+	return string(ca.certPEM)
+}
+
+// Pool 返回只包含该 CA 的证书池
+func (ca *CA) Pool() *x509.CertPool {
+	return ca.pool
+}
+
+// SignAgentCSR 校验 Agent 提交的 CSR 并签发服务端证书。
+// 证书身份完全由主控决定，CSR 中只使用公钥
+func (ca *CA) SignAgentCSR(csrPEM, nodeID string) (string, *x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(csrPEM))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return "", nil, errors.New("invalid certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return "", nil, fmt.Errorf("invalid certificate request signature: %v", err)
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: nodeID},
+		DNSNames:     []string{AgentServerName(nodeID)},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(AgentCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, csr.PublicKey, ca.key)
+	if err != nil {
+		return "", nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), cert, nil
+}
+
+// IssueMasterCert 为主控签发客户端证书，每次启动重新生成，私钥不落盘
+func (ca *CA) IssueMasterCert() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: MasterCommonName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(masterValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+func randomSerial() *big.Int {
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	return serial
+}
@@ -0,0 +1,73 @@
+package pki
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	legacy, err := generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		legacyCert string
+		legacyKey  string
+		wantCert   string
+		wantErr    bool
+	}{
+		{"generated", "", "", "", false},
+		{"migrated from config", legacy.CertPEM(), string(legacy.keyPEM), legacy.CertPEM(), false},
+		{"config missing key", legacy.CertPEM(), "", "", true},
+		{"config invalid", "bad", "bad", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "data")
+			certPath, keyPath := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+
+			ca, err := Open(certPath, keyPath, tt.legacyCert, tt.legacyKey)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Open() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if tt.wantCert != "" && ca.CertPEM() != tt.wantCert {
+				t.Fatal("legacy CA was not used")
+			}
+
+			stat, err := os.Stat(keyPath)
+			if err != nil {
+				t.Fatalf("key file not written: %v", err)
+			}
+			if mode := stat.Mode().Perm(); mode != 0600 {
+				t.Fatalf("key file mode = %o, want 600", mode)
+			}
+
+			reopened, err := Open(certPath, keyPath, "", "")
+			if err != nil {
+				t.Fatalf("reopen error = %v", err)
+			}
+			if reopened.CertPEM() != ca.CertPEM() {
+				t.Fatal("reopened CA differs")
+			}
+		})
+	}
+}
+
+func TestOpenRefusesPartialFiles(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	if _, err := Open(certPath, keyPath, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(keyPath)
+
+	if _, err := Open(certPath, keyPath, "", ""); err == nil {
+		t.Fatal("Open() regenerated a CA although the certificate still exists")
+	}
+}
@@ -4,23 +4,38 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 
+	"port-forward-dashboard/internal/agentdist"
+	"port-forward-dashboard/internal/alert"
 	"port-forward-dashboard/internal/api"
+	"port-forward-dashboard/internal/audit"
 	"port-forward-dashboard/internal/config"
 	"port-forward-dashboard/internal/forwarder"
+	"port-forward-dashboard/internal/history"
 	"port-forward-dashboard/internal/node"
+	"port-forward-dashboard/internal/pki"
 )
 
+// agentsDir 存放各平台 Agent 二进制，位于面板工作目录下
+const agentsDir = "agents"
+
+// dataDir 存放运行时产生的数据（审计日志、访问日志、流量历史等），Docker 部署时挂载为数据卷
+const dataDir = "data"
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	log.Println("🚀 Port Forward Dashboard Starting...")
 
 	// 加载配置
-	cfg := config.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
 
 	// 初始化转发管理器（本地转发）
-	fm := forwarder.NewManager()
+	fm := forwarder.NewManager(filepath.Join(dataDir, "access-logs"))
 
 	// 从配置恢复本地规则
 	for _, rule := range cfg.Rules {
@@ -29,14 +44,63 @@ func main() {
 		}
 	}
 
+	// 初始化内置 CA（节点证书与 mTLS 控制通道）
+	ca, err := pki.Open(filepath.Join(dataDir, "ca.crt"), filepath.Join(dataDir, "ca.key"), cfg.CACert, cfg.CAKey)
+	if err != nil {
+		log.Fatalf("Failed to init CA: %v", err)
+	}
+	if cfg.CACert != "" || cfg.CAKey != "" {
+		// 旧版本把 CA 存在配置里，已迁移到单独的文件
+		cfg.CACert = ""
+		cfg.CAKey = ""
+		cfg.Save()
+	}
+
 	// 初始化节点管理器
-	nm := node.NewManager()
+	nm, err := node.NewManager(ca, filepath.Join(dataDir, "traffic-counters.json"))
+	if err != nil {
+		log.Fatalf("Failed to init node manager: %v", err)
+	}
 
 	// 从配置恢复节点和节点规则
 	nm.RestoreRules(cfg.Nodes, cfg.NodeRules)
+	nm.RestoreEnrollTokens(cfg.EnrollTokens)
+
+	// 初始化 Agent 发布目录（二进制下载与自更新签名）
+	agents, err := agentdist.NewStore(agentsDir, filepath.Join(dataDir, "agent-signing.key"), cfg.AgentSigningKey)
+	if err != nil {
+		log.Fatalf("Failed to init agent store: %v", err)
+	}
+	if cfg.AgentSigningKey != "" {
+		// 旧版本把签名密钥存在配置里，已迁移到单独的密钥文件
+		cfg.AgentSigningKey = ""
+		cfg.Save()
+	}
+
+	// 审计日志（远程卸载等敏感操作）
+	auditLog, err := audit.Open(filepath.Join(dataDir, "audit.log"))
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+
+	// 流量历史（分钟 / 小时 / 天汇总）
+	historyStore, err := history.Open(filepath.Join(dataDir, "history"))
+	if err != nil {
+		log.Fatalf("Failed to open history store: %v", err)
+	}
+
+	// 节点间延迟探测的历史
+	meshHistory, err := history.OpenLatency(filepath.Join(dataDir, "mesh-history"))
+	if err != nil {
+		log.Fatalf("Failed to open mesh history store: %v", err)
+	}
+	nm.SetMeshSettings(cfg.Mesh)
+
+	// 告警规则、通知渠道和静默窗口
+	alerts := alert.NewEngine(cfg.AlertRules, cfg.AlertChannels, cfg.AlertSilences)
 
 	// 启动 API 服务器
-	server := api.NewServer(cfg, fm, nm)
+	server := api.NewServer(cfg, fm, nm, agents, auditLog, historyStore, meshHistory, alerts)
 	go func() {
 		if err := server.Run(); err != nil {
 			log.Fatalf("Server failed: %v", err)
@@ -52,6 +116,7 @@ func main() {
 
 	log.Println("Shutting down...")
 	fm.StopAll()
+	nm.SaveCounters()
 	config.Save(cfg, fm.GetAllRules())
 	log.Println("Goodbye!")
 }
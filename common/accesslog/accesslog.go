@@ -0,0 +1,269 @@
+// Package accesslog 按规则记录连接的建立和关闭，写入按大小轮转的 JSON Lines 文件。主控和 Agent 共用
+package accesslog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 连接事件
+const (
+	EventConnect = "connect"
+	EventClose   = "close"
+)
+
+// 连接关闭原因。转发规则没有来源访问控制，连接不会因 ACL 被拒绝，因此没有 acl_reject；
+// Agent 控制 API 的来源白名单拒绝的是 API 请求，计入 portforward_agent_control_rejected_total
+const (
+	ReasonEOF       = "eof"
+	ReasonTimeout   = "timeout"
+	ReasonDialError = "dial_error"
+	ReasonClosed    = "closed"  // 通过 API 强制断开
+	ReasonStopped   = "stopped" // 隧道停止
+	ReasonError     = "error"
+)
+
+const (
+	// DefaultMaxSize 单个日志文件的轮转阈值
+	DefaultMaxSize = 10 << 20
+	// DefaultMaxBackups 保留的历史文件数量
+	DefaultMaxBackups = 3
+	// MaxLimit 单次查询返回的条数上限
+	MaxLimit = 1000
+)
+
+// Entry 是一条访问记录，按 JSON Lines 写入规则各自的日志文件
+type Entry struct {
+	Time       int64  `json:"time"`
+	Event      string `json:"event"`
+	RuleID     string `json:"rule_id"`
+	ConnID     string `json:"conn_id"`
+	Protocol   string `json:"protocol"`
+	ClientIP   string `json:"client_ip"`
+	ClientAddr string `json:"client_addr"`
+	Target     string `json:"target"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	BytesIn    int64  `json:"bytes_in,omitempty"`
+	BytesOut   int64  `json:"bytes_out,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Filter 是查询条件，空字段表示不过滤
+type Filter struct {
+	RuleID   string
+	ClientIP string
+	Event    string
+	Reason   string
+	Since    int64
+	Limit    int
+}
+
+func (f Filter) match(e Entry) bool {
+	return (f.ClientIP == "" || e.ClientIP == f.ClientIP) &&
+		(f.Event == "" || e.Event == f.Event) &&
+		(f.Reason == "" || e.Reason == f.Reason) &&
+		(f.Since == 0 || e.Time >= f.Since)
+}
+
+// Path 返回规则的日志文件路径
+func Path(dir, ruleID string) string {
+	return filepath.Join(dir, ruleID+".log")
+}
+
+// Writer 按大小轮转的日志文件，文件在第一次写入时才打开
+type Writer struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewWriter(path string, maxSize int64, maxBackups int) *Writer {
+	return &Writer{path: path, maxSize: maxSize, maxBackups: maxBackups}
+}
+
+func (w *Writer) Write(e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	if w.size > 0 && w.size+int64(len(data)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.file.Write(data)
+	w.size += int64(n)
+	return err
+}
+
+// Close 关闭当前文件，之后的写入会重新打开
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *Writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+// rotate 把 x.log 依次改名为 x.log.1、x.log.2 …，超出保留数量的最旧文件被覆盖
+func (w *Writer) rotate() error {
+	w.file.Close()
+	w.file = nil
+
+	for i := w.maxBackups - 1; i >= 1; i-- {
+		os.Rename(backupPath(w.path, i), backupPath(w.path, i+1))
+	}
+	if w.maxBackups > 0 {
+		if err := os.Rename(w.path, backupPath(w.path, 1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(w.path); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+func backupPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// Read 返回日志目录中符合条件的最新记录（新的在前）。RuleID 为空时查询全部规则
+func Read(dir string, f Filter) ([]Entry, error) {
+	if f.Limit <= 0 || f.Limit > MaxLimit {
+		f.Limit = MaxLimit
+	}
+
+	var ruleIDs []string
+	if f.RuleID != "" {
+		if filepath.Base(f.RuleID) != f.RuleID || f.RuleID == ".." {
+			return nil, fmt.Errorf("invalid rule id %q", f.RuleID)
+		}
+		ruleIDs = []string{f.RuleID}
+	} else {
+		files, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, file := range files {
+			if name := file.Name(); strings.HasSuffix(name, ".log") {
+				ruleIDs = append(ruleIDs, strings.TrimSuffix(name, ".log"))
+			}
+		}
+	}
+
+	var entries []Entry
+	for _, id := range ruleIDs {
+		ruleEntries, err := readRule(Path(dir, id), f)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, ruleEntries...)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time > entries[j].Time })
+	if len(entries) > f.Limit {
+		entries = entries[:f.Limit]
+	}
+	if entries == nil {
+		entries = []Entry{}
+	}
+	return entries, nil
+}
+
+// readRule 从当前文件开始向更旧的轮转文件读取，凑够 Limit 条后停止
+func readRule(path string, f Filter) ([]Entry, error) {
+	var entries []Entry
+	for i := 0; len(entries) < f.Limit; i++ {
+		p := path
+		if i > 0 {
+			p = backupPath(path, i)
+		}
+		fileEntries, err := readFile(p, f)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fileEntries...)
+	}
+	if len(entries) > f.Limit {
+		entries = entries[:f.Limit]
+	}
+	return entries, nil
+}
+
+// readFile 返回单个文件中最新的 Limit 条匹配记录（新的在前）
+func readFile(path string, f Filter) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var e Entry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil || !f.match(e) {
+			continue
+		}
+		entries = append(entries, e)
+		if len(entries) > f.Limit {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
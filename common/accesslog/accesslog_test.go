@@ -0,0 +1,148 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func entrySize(t *testing.T, e Entry) int64 {
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int64(len(data) + 1)
+}
+
+func TestWriterRotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxBackups  int
+		writes      int
+		perFile     int
+		wantFiles   []string
+		wantMissing []string
+	}{
+		{"no rotation", 3, 2, 2, []string{"r.log"}, []string{"r.log.1"}},
+		{"one backup", 3, 3, 2, []string{"r.log", "r.log.1"}, []string{"r.log.2"}},
+		{"oldest dropped", 2, 9, 2, []string{"r.log", "r.log.1", "r.log.2"}, []string{"r.log.3"}},
+		{"no backups kept", 0, 5, 2, []string{"r.log"}, []string{"r.log.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			sample := Entry{Time: 1, Event: EventConnect, RuleID: "r", ConnID: "c", ClientIP: "192.0.2.1"}
+			// 每个文件恰好容纳 perFile 条记录
+			w := NewWriter(Path(dir, "r"), entrySize(t, sample)*int64(tt.perFile), tt.maxBackups)
+			defer w.Close()
+
+			for i := 0; i < tt.writes; i++ {
+				if err := w.Write(sample); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+			for _, name := range tt.wantFiles {
+				if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+					t.Errorf("%s missing: %v", name, err)
+				}
+			}
+			for _, name := range tt.wantMissing {
+				if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+					t.Errorf("%s should not exist", name)
+				}
+			}
+		})
+	}
+}
+
+func TestWriterReopenKeepsSize(t *testing.T) {
+	dir := t.TempDir()
+	e := Entry{Time: 1, Event: EventConnect, RuleID: "r"}
+	size := entrySize(t, e)
+
+	w := NewWriter(Path(dir, "r"), size*2, 1)
+	w.Write(e)
+	w.Close()
+
+	// 重新打开后应接着原文件大小计算，第三条触发轮转
+	w = NewWriter(Path(dir, "r"), size*2, 1)
+	defer w.Close()
+	w.Write(e)
+	w.Write(e)
+	if _, err := os.Stat(filepath.Join(dir, "r.log.1")); err != nil {
+		t.Fatalf("expected rotation after reopening: %v", err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	dir := t.TempDir()
+	sample := Entry{Time: 100, Event: EventClose, RuleID: "a", ClientIP: "192.0.2.1", Reason: ReasonEOF}
+	// 每个文件放 3 条，a 规则会轮转出两个历史文件
+	w := NewWriter(Path(dir, "a"), entrySize(t, sample)*3, 5)
+	for i := int64(1); i <= 8; i++ {
+		e := Entry{Time: 100 + i, Event: EventClose, RuleID: "a", ClientIP: "192.0.2.1", Reason: ReasonEOF}
+		if i%2 == 0 {
+			e.ClientIP = "192.0.2.2"
+			e.Reason = ReasonTimeout
+		}
+		if err := w.Write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	b := NewWriter(Path(dir, "b"), DefaultMaxSize, DefaultMaxBackups)
+	b.Write(Entry{Time: 200, Event: EventConnect, RuleID: "b", ClientIP: "198.51.100.1"})
+	b.Write(Entry{Time: 50, Event: EventClose, RuleID: "b", ClientIP: "198.51.100.1", Reason: ReasonDialError})
+	b.Close()
+
+	// 不可解析的行被跳过
+	f, _ := os.OpenFile(Path(dir, "b"), os.O_APPEND|os.O_WRONLY, 0600)
+	f.WriteString("not json\n")
+	f.Close()
+
+	tests := []struct {
+		name      string
+		filter    Filter
+		wantTimes []int64
+		wantErr   bool
+	}{
+		{"rule across rotated files", Filter{RuleID: "a"}, []int64{108, 107, 106, 105, 104, 103, 102, 101}, false},
+		{"limit takes newest", Filter{RuleID: "a", Limit: 4}, []int64{108, 107, 106, 105}, false},
+		{"client filter", Filter{RuleID: "a", ClientIP: "192.0.2.2"}, []int64{108, 106, 104, 102}, false},
+		{"reason filter", Filter{RuleID: "a", Reason: ReasonEOF, Limit: 2}, []int64{107, 105}, false},
+		{"since", Filter{RuleID: "a", Since: 106}, []int64{108, 107, 106}, false},
+		{"all rules sorted", Filter{Limit: 3}, []int64{200, 108, 107}, false},
+		{"event filter across rules", Filter{Event: EventConnect}, []int64{200}, false},
+		{"unknown rule", Filter{RuleID: "missing"}, []int64{}, false},
+		{"path traversal", Filter{RuleID: "../a"}, nil, true},
+		{"dot dot", Filter{RuleID: ".."}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := Read(dir, tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Read() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(entries) != len(tt.wantTimes) {
+				t.Fatalf("Read() returned %d entries, want %d: %+v", len(entries), len(tt.wantTimes), entries)
+			}
+			for i, e := range entries {
+				if e.Time != tt.wantTimes[i] {
+					t.Fatalf("entry %d time = %d, want %d", i, e.Time, tt.wantTimes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReadMissingDir(t *testing.T) {
+	entries, err := Read(filepath.Join(t.TempDir(), "none"), Filter{})
+	if err != nil || entries == nil || len(entries) != 0 {
+		t.Fatalf("Read() = %v, %v, want empty slice", entries, err)
+	}
+}
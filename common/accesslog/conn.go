@@ -0,0 +1,62 @@
+package accesslog
+
+import (
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"port-forward-common/conns"
+)
+
+// ConnectEntry 返回连接建立的记录
+func ConnectEntry(ruleID string, c *conns.Conn) Entry {
+	return connEntry(EventConnect, ruleID, c)
+}
+
+// CloseEntry 返回连接关闭的记录，失败原因只在 reason 为 error 或 dial_error 时记录
+func CloseEntry(ruleID string, c *conns.Conn, reason string, cause error) Entry {
+	e := connEntry(EventClose, ruleID, c)
+	e.DurationMs = time.Since(c.StartedAt).Milliseconds()
+	e.BytesIn = c.BytesIn.Load()
+	e.BytesOut = c.BytesOut.Load()
+	e.Reason = reason
+	if cause != nil && (reason == ReasonError || reason == ReasonDialError) {
+		e.Error = cause.Error()
+	}
+	return e
+}
+
+func connEntry(event, ruleID string, c *conns.Conn) Entry {
+	info := c.Info()
+	e := Entry{
+		Time:       time.Now().Unix(),
+		Event:      event,
+		RuleID:     ruleID,
+		ConnID:     info.ID,
+		Protocol:   info.Protocol,
+		ClientAddr: info.ClientAddr,
+		Target:     info.TargetAddr,
+	}
+	if c.SourceIP != nil {
+		e.ClientIP = c.SourceIP.String()
+	}
+	return e
+}
+
+// CloseReason 根据连接结束时的错误判断关闭原因，stopped 表示隧道已停止
+func CloseReason(c *conns.Conn, stopped bool, err error) string {
+	var netErr net.Error
+	switch {
+	case c.Killed():
+		return ReasonClosed
+	case stopped:
+		return ReasonStopped
+	case err == nil || errors.Is(err, io.EOF):
+		return ReasonEOF
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ReasonTimeout
+	default:
+		return ReasonError
+	}
+}
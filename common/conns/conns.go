@@ -0,0 +1,182 @@
+// Package conns 登记隧道上的活动连接，用于查看和强制断开。主控和 Agent 共用
+package conns
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrNotFound = errors.New("connection not found")
+
+// Info 是隧道上一条活动连接的快照，BytesOut 为客户端到目标方向
+type Info struct {
+	ID         string `json:"id"`
+	Protocol   string `json:"protocol"`
+	ClientAddr string `json:"client_addr"`
+	TargetAddr string `json:"target_addr"`
+	StartedAt  int64  `json:"started_at"`
+	BytesIn    int64  `json:"bytes_in"`
+	BytesOut   int64  `json:"bytes_out"`
+}
+
+// Conn 是登记在隧道上的一条活动连接，UDP 以客户端地址为一个会话
+type Conn struct {
+	ID        string
+	Protocol  string
+	Client    string
+	SourceIP  net.IP
+	StartedAt time.Time
+	BytesIn   atomic.Int64
+	BytesOut  atomic.Int64
+
+	seq     uint64
+	mu      sync.Mutex
+	target  string
+	closers []io.Closer
+	killed  bool
+}
+
+// Attach 在连上目标后补充目标地址和需要一并关闭的连接。
+// 连接已被强制断开时返回 false，由调用方自行关闭
+func (c *Conn) Attach(target string, closer io.Closer) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.killed {
+		return false
+	}
+	c.target = target
+	c.closers = append(c.closers, closer)
+	return true
+}
+
+func (c *Conn) Kill() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.killed = true
+	for _, closer := range c.closers {
+		closer.Close()
+	}
+}
+
+func (c *Conn) Killed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.killed
+}
+
+func (c *Conn) Info() Info {
+	c.mu.Lock()
+	target := c.target
+	c.mu.Unlock()
+
+	return Info{
+		ID:         c.ID,
+		Protocol:   c.Protocol,
+		ClientAddr: c.Client,
+		TargetAddr: target,
+		StartedAt:  c.StartedAt.Unix(),
+		BytesIn:    c.BytesIn.Load(),
+		BytesOut:   c.BytesOut.Load(),
+	}
+}
+
+// Registry 记录隧道当前的活动连接
+type Registry struct {
+	mu    sync.Mutex
+	seq   uint64
+	conns map[string]*Conn
+}
+
+func NewRegistry() *Registry {
+	return &Registry{conns: make(map[string]*Conn)}
+}
+
+func (r *Registry) Add(protocol string, client net.Addr, target string, closer io.Closer) *Conn {
+	c := &Conn{
+		Protocol:  protocol,
+		Client:    client.String(),
+		StartedAt: time.Now(),
+		target:    target,
+		closers:   []io.Closer{closer},
+	}
+	if host, _, err := net.SplitHostPort(c.Client); err == nil {
+		c.SourceIP = net.ParseIP(host)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	c.seq = r.seq
+	c.ID = strconv.FormatUint(r.seq, 10)
+	r.conns[c.ID] = c
+	return c
+}
+
+func (r *Registry) Remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.conns, id)
+}
+
+// Counts 返回当前活动连接数和隧道创建以来登记过的连接总数
+func (r *Registry) Counts() (active int, total uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.conns), r.seq
+}
+
+// List 按登记顺序返回活动连接
+func (r *Registry) List() []Info {
+	r.mu.Lock()
+	conns := make([]*Conn, 0, len(r.conns))
+	for _, c := range r.conns {
+		conns = append(conns, c)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(conns, func(i, j int) bool { return conns[i].seq < conns[j].seq })
+
+	result := make([]Info, 0, len(conns))
+	for _, c := range conns {
+		result = append(result, c.Info())
+	}
+	return result
+}
+
+func (r *Registry) Close(id string) error {
+	r.mu.Lock()
+	c, ok := r.conns[id]
+	r.mu.Unlock()
+
+	if !ok {
+		return ErrNotFound
+	}
+	c.Kill()
+	return nil
+}
+
+// CloseFrom 断开来自指定源 IP 的所有连接，返回断开的数量
+func (r *Registry) CloseFrom(ip net.IP) int {
+	r.mu.Lock()
+	var matched []*Conn
+	for _, c := range r.conns {
+		if c.SourceIP != nil && c.SourceIP.Equal(ip) {
+			matched = append(matched, c)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, c := range matched {
+		c.Kill()
+	}
+	return len(matched)
+}
@@ -0,0 +1,3 @@
+module port-forward-common
+
+go 1.21
@@ -0,0 +1,357 @@
+// Package probe 实现规则的健康检查：TCP 连接、TCP 发送/期望响应、HTTP、TLS 握手、UDP 和 DNS，
+// 以及最近若干次检查结果的统计。主控和 Agent 共用
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 健康检查类型
+const (
+	CheckTCP       = "tcp"        // TCP 连接
+	CheckTCPBanner = "tcp_banner" // TCP 连接后发送 Send，等待响应包含 Expect
+	CheckHTTP      = "http"       // HTTP GET，校验状态码和可选的响应内容
+	CheckHTTPS     = "https"      // 同 http，使用 TLS
+	CheckTLS       = "tls"        // TLS 握手
+	CheckUDP       = "udp"        // 发送 Send，等待响应（包含 Expect）
+	CheckDNS       = "dns"        // 向目标发送 DNS 查询
+)
+
+// HealthCheck 是规则的健康检查配置，耗时达到 WarnMs、ErrorMs 时状态分别为 warning、error
+type HealthCheck struct {
+	Type   string `json:"type"`
+	Send   string `json:"send,omitempty"`
+	Expect string `json:"expect,omitempty"`
+	// Path、ExpectStatus 用于 http/https，ExpectStatus 默认 200
+	Path         string `json:"path,omitempty"`
+	ExpectStatus int    `json:"expect_status,omitempty"`
+	// Host 是 HTTP Host 头和 TLS SNI，默认为目标地址；Verify 为 true 时校验证书
+	Host   string `json:"host,omitempty"`
+	Verify bool   `json:"verify,omitempty"`
+	// Query 是 dns 检查查询的域名（A 记录）
+	Query   string `json:"query,omitempty"`
+	Timeout int    `json:"timeout,omitempty"`  // ms，默认 5000
+	WarnMs  int64  `json:"warn_ms,omitempty"`  // 默认 100
+	ErrorMs int64  `json:"error_ms,omitempty"` // 默认 300
+}
+
+const (
+	DefaultTimeout = 5 * time.Second
+	DefaultWarnMs  = 100
+	DefaultErrorMs = 300
+
+	// 延迟状态，unknown 表示规则未配置可用的探测
+	StatusNormal  = "normal"
+	StatusWarning = "warning"
+	StatusError   = "error"
+	StatusUnknown = "unknown"
+
+	// maxRead 读取响应时最多读取的字节数
+	maxRead = 4096
+)
+
+// Effective 返回规则实际使用的健康检查：未配置时 TCP 规则使用 TCP 连接检查，UDP 规则返回 nil（不探测）
+func Effective(check *HealthCheck, protocol string) *HealthCheck {
+	if check != nil {
+		return check
+	}
+	if protocol == "udp" {
+		return nil
+	}
+	return &HealthCheck{Type: CheckTCP}
+}
+
+// Validate 校验健康检查配置，nil 表示使用默认检查
+func Validate(check *HealthCheck) error {
+	if check == nil {
+		return nil
+	}
+	switch check.Type {
+	case CheckTCP, CheckTLS, CheckHTTP, CheckHTTPS:
+	case CheckTCPBanner:
+		if check.Expect == "" {
+			return fmt.Errorf("health check %s requires expect", check.Type)
+		}
+	case CheckUDP:
+		if check.Send == "" {
+			return fmt.Errorf("health check %s requires send", check.Type)
+		}
+	case CheckDNS:
+		if check.Query == "" {
+			return fmt.Errorf("health check %s requires query", check.Type)
+		}
+	default:
+		return fmt.Errorf("unsupported health check type %q", check.Type)
+	}
+	if check.Timeout < 0 || check.WarnMs < 0 || check.ErrorMs < 0 {
+		return fmt.Errorf("health check timeout and thresholds must not be negative")
+	}
+	if check.WarnMs > 0 && check.ErrorMs > 0 && check.WarnMs > check.ErrorMs {
+		return fmt.Errorf("health check warn_ms must not exceed error_ms")
+	}
+	return nil
+}
+
+// Status 按检查的阈值把延迟分级，latency < 0 表示检查失败
+func Status(check *HealthCheck, latency int64) string {
+	if check == nil {
+		return StatusUnknown
+	}
+	if latency < 0 {
+		return StatusError
+	}
+	warn, errMs := check.WarnMs, check.ErrorMs
+	if warn <= 0 {
+		warn = DefaultWarnMs
+	}
+	if errMs <= 0 {
+		errMs = DefaultErrorMs
+	}
+	switch {
+	case latency >= errMs:
+		return StatusError
+	case latency >= warn:
+		return StatusWarning
+	default:
+		return StatusNormal
+	}
+}
+
+// Run 对目标执行一次健康检查，返回检查耗时
+func Run(check *HealthCheck, protocol, host string, port int) (time.Duration, error) {
+	timeout := DefaultTimeout
+	if check.Timeout > 0 {
+		timeout = time.Duration(check.Timeout) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	start := time.Now()
+
+	var err error
+	switch check.Type {
+	case CheckTCP:
+		err = checkTCP(ctx, addr)
+	case CheckTCPBanner:
+		err = checkBanner(ctx, "tcp", addr, check)
+	case CheckHTTP, CheckHTTPS:
+		err = checkHTTP(ctx, addr, check)
+	case CheckTLS:
+		err = checkTLS(ctx, addr, host, check)
+	case CheckUDP:
+		err = checkBanner(ctx, "udp", addr, check)
+	case CheckDNS:
+		err = checkDNS(ctx, protocol, addr, check.Query)
+	default:
+		err = fmt.Errorf("unsupported health check type %q", check.Type)
+	}
+	return time.Since(start), err
+}
+
+func dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+func checkTCP(ctx context.Context, addr string) error {
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// checkBanner 发送 Send（可为空，用于服务端先发送欢迎信息的协议），读取响应直到包含 Expect；
+// Expect 为空时收到任意响应即成功
+func checkBanner(ctx context.Context, network, addr string, check *HealthCheck) error {
+	conn, err := dial(ctx, network, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if check.Send != "" {
+		if _, err := conn.Write([]byte(check.Send)); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, 0, maxRead)
+	chunk := make([]byte, maxRead)
+	for len(buf) < maxRead {
+		n, err := conn.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if n > 0 && (check.Expect == "" || bytes.Contains(buf, []byte(check.Expect))) {
+			return nil
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("connection closed before expected response")
+			}
+			return err
+		}
+	}
+	return fmt.Errorf("response does not contain %q", check.Expect)
+}
+
+func tlsConfig(host string, check *HealthCheck) *tls.Config {
+	serverName := check.Host
+	if serverName == "" {
+		serverName = host
+	}
+	return &tls.Config{ServerName: serverName, InsecureSkipVerify: !check.Verify}
+}
+
+func checkTLS(ctx context.Context, addr, host string, check *HealthCheck) error {
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	tlsConn := tls.Client(conn, tlsConfig(host, check))
+	defer tlsConn.Close()
+	return tlsConn.HandshakeContext(ctx)
+}
+
+// checkHTTP 发送 GET 请求，不跟随重定向，状态码需等于 ExpectStatus（默认 200），
+// 配置了 Expect 时响应内容需包含它
+func checkHTTP(ctx context.Context, addr string, check *HealthCheck) error {
+	scheme := "http"
+	if check.Type == CheckHTTPS {
+		scheme = "https"
+	}
+	path := check.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+"://"+addr+path, nil)
+	if err != nil {
+		return err
+	}
+	if check.Host != "" {
+		req.Host = check.Host
+	}
+
+	host, _, _ := net.SplitHostPort(addr)
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   tlsConfig(host, check),
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	expect := check.ExpectStatus
+	if expect == 0 {
+		expect = http.StatusOK
+	}
+	if resp.StatusCode != expect {
+		return fmt.Errorf("unexpected status %d, want %d", resp.StatusCode, expect)
+	}
+	if check.Expect != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxRead))
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(body, []byte(check.Expect)) {
+			return fmt.Errorf("response does not contain %q", check.Expect)
+		}
+	}
+	return nil
+}
+
+// checkDNS 向目标发送 A 记录查询，TCP 规则使用 TCP 传输。
+// 收到 NOERROR 或 NXDOMAIN 应答都表示服务正常
+func checkDNS(ctx context.Context, protocol, addr, name string) error {
+	query, id, err := dnsQuery(name)
+	if err != nil {
+		return err
+	}
+
+	network := "udp"
+	if protocol != "udp" {
+		network = "tcp"
+	}
+	conn, err := dial(ctx, network, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	resp := make([]byte, 512)
+	var n int
+	if network == "tcp" {
+		msg := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+		if _, err := conn.Write(append(msg, query...)); err != nil {
+			return err
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return err
+		}
+		resp = make([]byte, binary.BigEndian.Uint16(length[:]))
+		n, err = io.ReadFull(conn, resp)
+	} else {
+		if _, err := conn.Write(query); err != nil {
+			return err
+		}
+		n, err = conn.Read(resp)
+	}
+	if err != nil {
+		return err
+	}
+	resp = resp[:n]
+
+	if len(resp) < 12 || binary.BigEndian.Uint16(resp) != id || resp[2]&0x80 == 0 {
+		return fmt.Errorf("invalid DNS response")
+	}
+	if rcode := resp[3] & 0x0f; rcode != 0 && rcode != 3 {
+		return fmt.Errorf("DNS response code %d", rcode)
+	}
+	return nil
+}
+
+// dnsQuery 构造一个请求递归解析的 A 记录查询报文
+func dnsQuery(name string) ([]byte, uint16, error) {
+	id := uint16(rand.Intn(1 << 16))
+	msg := []byte{byte(id >> 8), byte(id), 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, 0, fmt.Errorf("invalid DNS name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0, 0, 1, 0, 1)
+	return msg, id, nil
+}
@@ -0,0 +1,84 @@
+package probe
+
+import (
+	"math"
+	"sort"
+)
+
+// Stats 是最近若干次健康检查的统计。百分位和抖动只统计成功的检查，没有成功的检查时百分位为 -1；
+// Jitter 是相邻两次成功检查延迟之差的平均值（ms），SuccessRate 为成功次数百分比
+type Stats struct {
+	P50         int64   `json:"p50"`
+	P95         int64   `json:"p95"`
+	P99         int64   `json:"p99"`
+	Jitter      float64 `json:"jitter"`
+	SuccessRate float64 `json:"success_rate"`
+	Samples     int     `json:"samples"`
+}
+
+// WindowSize 是统计延迟分布使用的检查次数，按 5 秒间隔约为最近 5 分钟
+const WindowSize = 60
+
+// Window 保存最近 WindowSize 次检查的延迟，-1 表示检查失败。零值可直接使用，非并发安全
+type Window struct {
+	samples []int64
+	next    int
+}
+
+// Add 记录一次检查结果，窗口满后覆盖最早的结果
+func (w *Window) Add(latency int64) {
+	if len(w.samples) < WindowSize {
+		w.samples = append(w.samples, latency)
+		return
+	}
+	w.samples[w.next] = latency
+	w.next = (w.next + 1) % WindowSize
+}
+
+func (w *Window) Reset() {
+	w.samples, w.next = nil, 0
+}
+
+// Stats 计算窗口内的百分位、抖动和成功率
+func (w *Window) Stats() Stats {
+	stats := Stats{P50: -1, P95: -1, P99: -1, Samples: len(w.samples)}
+	if len(w.samples) == 0 {
+		return stats
+	}
+
+	// 按时间顺序遍历，计算相邻成功检查的抖动
+	var ok []int64
+	var jitter float64
+	for i := range w.samples {
+		latency := w.samples[(w.next+i)%len(w.samples)]
+		if latency < 0 {
+			continue
+		}
+		if len(ok) > 0 {
+			jitter += math.Abs(float64(latency - ok[len(ok)-1]))
+		}
+		ok = append(ok, latency)
+	}
+	stats.SuccessRate = float64(len(ok)) * 100 / float64(len(w.samples))
+	if len(ok) == 0 {
+		return stats
+	}
+	if len(ok) > 1 {
+		stats.Jitter = jitter / float64(len(ok)-1)
+	}
+
+	sort.Slice(ok, func(i, j int) bool { return ok[i] < ok[j] })
+	stats.P50 = percentile(ok, 50)
+	stats.P95 = percentile(ok, 95)
+	stats.P99 = percentile(ok, 99)
+	return stats
+}
+
+// percentile 按最近秩法取已排序样本的百分位
+func percentile(sorted []int64, p int) int64 {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
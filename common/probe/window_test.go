@@ -0,0 +1,83 @@
+package probe
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWindowStats(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []int64
+		want    Stats
+	}{
+		{"empty", nil, Stats{P50: -1, P95: -1, P99: -1}},
+		{"all failed", []int64{-1, -1}, Stats{P50: -1, P95: -1, P99: -1, Samples: 2}},
+		{"single", []int64{42}, Stats{P50: 42, P95: 42, P99: 42, SuccessRate: 100, Samples: 1}},
+		{
+			// 抖动按时间顺序统计相邻成功检查：|30-10| 和 |20-30|
+			name:    "jitter skips failures",
+			samples: []int64{10, -1, 30, 20},
+			want:    Stats{P50: 20, P95: 30, P99: 30, Jitter: 15, SuccessRate: 75, Samples: 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w Window
+			for _, s := range tt.samples {
+				w.Add(s)
+			}
+			if got := w.Stats(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Stats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowOverwritesOldest(t *testing.T) {
+	var w Window
+	// 前 10 次失败随后被 WindowSize 次成功覆盖
+	for i := 0; i < 10; i++ {
+		w.Add(-1)
+	}
+	for i := 1; i <= WindowSize; i++ {
+		w.Add(int64(i))
+	}
+	got := w.Stats()
+	if got.Samples != WindowSize || got.SuccessRate != 100 {
+		t.Fatalf("Stats() = %+v, want %d successful samples", got, WindowSize)
+	}
+	// 环形缓冲区按时间顺序遍历，相邻样本相差 1
+	if got.Jitter != 1 {
+		t.Errorf("Jitter = %v, want 1", got.Jitter)
+	}
+
+	w.Reset()
+	if got := w.Stats(); got.Samples != 0 || got.P50 != -1 {
+		t.Errorf("Stats() after Reset = %+v", got)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	tests := []struct {
+		p    int
+		want int64
+	}{
+		{0, 1},
+		{10, 1},
+		{11, 2},
+		{50, 5},
+		{95, 10},
+		{99, 10},
+		{100, 10},
+	}
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%d) = %d, want %d", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile([]int64{7}, 99); got != 7 {
+		t.Errorf("percentile of a single sample = %d, want 7", got)
+	}
+}
@@ -0,0 +1,32 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Agent 请求主控时携带签名信息的请求头，Key 本身不会出现在请求中
+const (
+	HeaderKeyID     = "X-Node-Key-ID"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderNonce     = "X-Nonce"
+	HeaderSignature = "X-Signature"
+)
+
+// KeyID 返回节点 Key 的公开标识，Agent 用它表明身份而无需发送 Key 本身
+func KeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// SignHeartbeat 计算心跳签名：HMAC-SHA256(key, timestamp + "\n" + nonce + "\n" + body)
+func SignHeartbeat(key, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(nonce))
+	mac.Write([]byte("\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
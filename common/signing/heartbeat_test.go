@@ -0,0 +1,17 @@
+package signing
+
+import "testing"
+
+// 主控和 Agent 分别发布，算法变化会让已部署的节点无法上报心跳，这里固定已知的结果
+func TestHeartbeatSignatureVector(t *testing.T) {
+	if got, want := KeyID("node-key"), "8b6b8c51e081e857"; got != want {
+		t.Errorf("KeyID() = %s, want %s", got, want)
+	}
+	got := SignHeartbeat("node-key", "1700000000", "abc", []byte(`{"a":1}`))
+	if want := "869fd1d9c6781948b0b8d8115734a038c174defc7100fc0b626520d83e6e196f"; got != want {
+		t.Errorf("SignHeartbeat() = %s, want %s", got, want)
+	}
+	if SignHeartbeat("other-key", "1700000000", "abc", []byte(`{"a":1}`)) == got {
+		t.Error("signature does not depend on the key")
+	}
+}
@@ -0,0 +1,44 @@
+// Package signing 定义主控和 Agent 之间的签名格式：主控签名、Agent 校验的更新清单和签名指令，
+// 以及 Agent 签名、主控校验的心跳请求
+package signing
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// 签名用途。实际签名的是 "port-forward-agent/<用途>\n" 加原始数据，某一用途的签名不能挪作他用
+const (
+	PurposeUpdate  = "update"
+	PurposeCommand = "command"
+)
+
+// Message 返回某一用途实际签名的内容
+func Message(purpose string, data []byte) []byte {
+	prefix := "port-forward-agent/" + purpose + "\n"
+	msg := make([]byte, 0, len(prefix)+len(data))
+	msg = append(msg, prefix...)
+	return append(msg, data...)
+}
+
+// Sign 按用途签名，返回 base64 编码的签名
+func Sign(key ed25519.PrivateKey, purpose string, data []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, Message(purpose, data)))
+}
+
+// Verify 校验 base64 编码的某一用途的签名
+func Verify(key ed25519.PublicKey, purpose string, data []byte, signature string) bool {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(key, Message(purpose, data), sig)
+}
+
+// UpdateManifest 返回自更新签名覆盖的清单：版本、平台和二进制的 SHA256。
+// Agent 按自身平台重建清单校验，并拒绝比当前版本旧的更新
+func UpdateManifest(version, goos, goarch, checksum string) []byte {
+	return []byte(fmt.Sprintf("version=%s\nos=%s\narch=%s\nsha256=%s\n", version, goos, goarch, strings.ToLower(checksum)))
+}
@@ -0,0 +1,122 @@
+// Package timings 统计隧道上客户端连接的连接目标耗时、首字节耗时和连接失败原因。主控和 Agent 共用
+package timings
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// 连接目标失败的原因分类
+const (
+	DialErrRefused = "refused"
+	DialErrTimeout = "timeout"
+	DialErrNoRoute = "no_route"
+	DialErrDNS     = "dns"
+	DialErrOther   = "other"
+)
+
+// Histogram 是耗时分布（毫秒）。Counts[i] 为耗时在 (Bounds[i-1], Bounds[i]] 内的次数，
+// 最后一项为超过最大上界的次数，因此 len(Counts) == len(Bounds)+1
+type Histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []int64   `json:"counts"`
+	Count  int64     `json:"count"`
+	Sum    float64   `json:"sum"`
+}
+
+// ConnTimings 是规则上客户端连接的耗时统计，自隧道创建起累计。
+// Dial 为 TCP 连接目标的耗时；FirstByte 为连上目标（UDP 为转发首个数据报）到收到目标第一个字节的耗时
+type ConnTimings struct {
+	Dial       Histogram        `json:"dial"`
+	FirstByte  Histogram        `json:"first_byte"`
+	DialErrors map[string]int64 `json:"dial_errors"`
+}
+
+// bounds 是耗时直方图的桶上界（毫秒）
+var bounds = [...]float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+var dialErrorClasses = [...]string{
+	DialErrRefused, DialErrTimeout, DialErrNoRoute, DialErrDNS, DialErrOther,
+}
+
+// Distribution 并发安全地累计耗时分布，零值可直接使用
+type Distribution struct {
+	counts [len(bounds) + 1]atomic.Int64
+	count  atomic.Int64
+	sumUs  atomic.Int64
+}
+
+func (h *Distribution) Observe(d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	i := 0
+	for i < len(bounds) && ms > bounds[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	h.sumUs.Add(d.Microseconds())
+}
+
+func (h *Distribution) Snapshot() Histogram {
+	out := Histogram{
+		Bounds: bounds[:],
+		Counts: make([]int64, len(h.counts)),
+		Count:  h.count.Load(),
+		Sum:    float64(h.sumUs.Load()) / 1000,
+	}
+	for i := range h.counts {
+		out.Counts[i] = h.counts[i].Load()
+	}
+	return out
+}
+
+// Recorder 记录隧道上每个客户端连接的连接目标耗时、首字节耗时和连接失败原因，零值可直接使用
+type Recorder struct {
+	Dial       Distribution
+	FirstByte  Distribution
+	dialErrors [len(dialErrorClasses)]atomic.Int64
+}
+
+func (c *Recorder) DialFailed(err error) {
+	class := ClassifyDialError(err)
+	for i, name := range dialErrorClasses {
+		if name == class {
+			c.dialErrors[i].Add(1)
+			return
+		}
+	}
+}
+
+func (c *Recorder) Snapshot() ConnTimings {
+	out := ConnTimings{
+		Dial:       c.Dial.Snapshot(),
+		FirstByte:  c.FirstByte.Snapshot(),
+		DialErrors: make(map[string]int64, len(dialErrorClasses)),
+	}
+	for i, name := range dialErrorClasses {
+		out.DialErrors[name] = c.dialErrors[i].Load()
+	}
+	return out
+}
+
+// ClassifyDialError 把连接目标的错误归类为 refused、timeout、no_route、dns 或 other
+func ClassifyDialError(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return DialErrDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return DialErrRefused
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return DialErrNoRoute
+	case errors.Is(err, os.ErrDeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return DialErrTimeout
+	default:
+		return DialErrOther
+	}
+}
@@ -0,0 +1,87 @@
+package timings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassifyDialError(t *testing.T) {
+	opErr := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: err}}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"refused", opErr(syscall.ECONNREFUSED), DialErrRefused},
+		{"host unreachable", opErr(syscall.EHOSTUNREACH), DialErrNoRoute},
+		{"network unreachable", opErr(syscall.ENETUNREACH), DialErrNoRoute},
+		{"dns", &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "x.invalid", IsNotFound: true}}, DialErrDNS},
+		{"dns timeout is still dns", &net.DNSError{Err: "timeout", Name: "x.invalid", IsTimeout: true}, DialErrDNS},
+		{"deadline", &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}, DialErrTimeout},
+		{"context deadline", fmt.Errorf("dial: %w", context.DeadlineExceeded), DialErrTimeout},
+		{"other", errors.New("boom"), DialErrOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyDialError(tt.err); got != tt.want {
+				t.Errorf("ClassifyDialError(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyRealDialError(t *testing.T) {
+	// 监听后立即关闭，得到一个本机上无人监听的端口
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	_, err = net.DialTimeout("tcp", addr, time.Second)
+	if err == nil {
+		t.Skip("port was reused")
+	}
+	if got := ClassifyDialError(err); got != DialErrRefused {
+		t.Errorf("ClassifyDialError(%v) = %s, want %s", err, got, DialErrRefused)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	var r Recorder
+	r.Dial.Observe(500 * time.Microsecond)
+	r.Dial.Observe(3 * time.Millisecond)
+	r.Dial.Observe(20 * time.Second)
+	r.DialFailed(errors.New("boom"))
+	r.DialFailed(&net.DNSError{Err: "no such host"})
+
+	got := r.Snapshot()
+	if len(got.Dial.Counts) != len(got.Dial.Bounds)+1 {
+		t.Fatalf("len(Counts) = %d, want len(Bounds)+1 = %d", len(got.Dial.Counts), len(got.Dial.Bounds)+1)
+	}
+	// 0.5ms 落入 ≤1 桶，3ms 落入 ≤5 桶，20s 超过最大上界
+	want := map[int]int64{0: 1, 2: 1, len(got.Dial.Counts) - 1: 1}
+	for i, c := range got.Dial.Counts {
+		if c != want[i] {
+			t.Errorf("Counts[%d] = %d, want %d", i, c, want[i])
+		}
+	}
+	if got.Dial.Count != 3 || got.Dial.Sum != 20003.5 {
+		t.Errorf("Count = %d, Sum = %v, want 3 and 20003.5", got.Dial.Count, got.Dial.Sum)
+	}
+	if got.DialErrors[DialErrOther] != 1 || got.DialErrors[DialErrDNS] != 1 || got.DialErrors[DialErrRefused] != 0 {
+		t.Errorf("DialErrors = %v", got.DialErrors)
+	}
+	if got.FirstByte.Count != 0 {
+		t.Errorf("FirstByte.Count = %d, want 0", got.FirstByte.Count)
+	}
+}
@@ -133,6 +133,25 @@ build_backend() {
     print_success "后端构建完成"
 }
 
+# 交叉编译各平台 Agent，节点安装和自更新都从面板下载
+build_agents() {
+    print_info "正在构建 Agent..."
+    cd /opt/port-forward-dashboard/agent
+    export PATH=$PATH:/usr/local/go/bin
+    AGENTS_DIR=/opt/port-forward-dashboard/backend/agents
+    # 版本号需可比较，Agent 拒绝降级更新
+    VERSION=$(sh version.sh)
+    mkdir -p "$AGENTS_DIR"
+    for p in linux/amd64 linux/arm64 linux/arm; do
+        os=${p%/*}; arch=${p#*/}
+        CGO_ENABLED=0 GOOS=$os GOARCH=$arch GOARM=7 go build -trimpath \
+            -ldflags "-s -w -X main.version=$VERSION" \
+            -o "$AGENTS_DIR/port-forward-agent-$os-$arch" .
+    done
+    echo "$VERSION" > "$AGENTS_DIR/VERSION"
+    print_success "Agent 构建完成"
+}
+
 # 创建 systemd 服务
 create_service() {
     print_info "正在创建系统服务..."
@@ -252,6 +271,7 @@ main() {
     clone_or_update_repo
     build_frontend
     build_backend
+    build_agents
     create_service
     show_completion
 }
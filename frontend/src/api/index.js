@@ -83,6 +83,136 @@ export default {
     return instance.delete(`/nodes/${id}`)
   },
 
+  async resyncNode(id) {
+    return instance.post(`/nodes/${id}/resync`)
+  },
+
+  async getHeartbeatAuthFailures() {
+    return instance.get('/nodes/auth-failures')
+  },
+
+  async updateNodeAgent(id) {
+    return instance.post(`/nodes/${id}/update`)
+  },
+
+  async getAgentReleases() {
+    return instance.get('/agent/releases')
+  },
+
+  async createEnrollToken(data) {
+    return instance.post('/nodes/enroll-tokens', data)
+  },
+
+  async getEnrollTokens() {
+    return instance.get('/nodes/enroll-tokens')
+  },
+
+  async revokeEnrollToken(id) {
+    return instance.delete(`/nodes/enroll-tokens/${id}`)
+  },
+
+  async rotateNodeKey(id, graceSeconds) {
+    return instance.post(`/nodes/${id}/rotate-key`, { grace_seconds: graceSeconds })
+  },
+
+  async getNodeKeyHistory(id) {
+    return instance.get(`/nodes/${id}/key-history`)
+  },
+
+  async renewNodeCert(id) {
+    return instance.post(`/nodes/${id}/renew-cert`)
+  },
+
+  // 卸载分两步：先申请确认令牌，再提交确认
+  async requestUninstall(id) {
+    return instance.post(`/nodes/${id}/uninstall`)
+  },
+
+  async confirmUninstall(id, confirmToken) {
+    return instance.post(`/nodes/${id}/uninstall/confirm`, { confirm_token: confirmToken })
+  },
+
+  async runNodeDiagnostic(id, request) {
+    return instance.post(`/nodes/${id}/diagnostics`, request, { timeout: 90000 })
+  },
+
+  async getNodeAccessLog(id, params) {
+    return instance.get(`/nodes/${id}/access-log`, { params })
+  },
+
+  async getRuleHistory(id, params) {
+    return instance.get(`/rules/${id}/history`, { params })
+  },
+
+  async getNodeHistory(id, params) {
+    return instance.get(`/nodes/${id}/history`, { params })
+  },
+
+  async getNodeRuleUsage(id, params) {
+    return instance.get(`/node-rules/${id}/usage`, { params })
+  },
+
+  async getNodeUsage(id, params) {
+    return instance.get(`/nodes/${id}/usage`, { params })
+  },
+
+  // 告警 API
+  async getAlerts() {
+    return instance.get('/alerts')
+  },
+
+  async getAlertRules() {
+    return instance.get('/alerts/rules')
+  },
+
+  async createAlertRule(rule) {
+    return instance.post('/alerts/rules', rule)
+  },
+
+  async updateAlertRule(id, rule) {
+    return instance.put(`/alerts/rules/${id}`, rule)
+  },
+
+  async deleteAlertRule(id) {
+    return instance.delete(`/alerts/rules/${id}`)
+  },
+
+  async getAlertChannels() {
+    return instance.get('/alerts/channels')
+  },
+
+  async createAlertChannel(channel) {
+    return instance.post('/alerts/channels', channel)
+  },
+
+  async updateAlertChannel(id, channel) {
+    return instance.put(`/alerts/channels/${id}`, channel)
+  },
+
+  async deleteAlertChannel(id) {
+    return instance.delete(`/alerts/channels/${id}`)
+  },
+
+  async testAlertChannel(id) {
+    return instance.post(`/alerts/channels/${id}/test`)
+  },
+
+  async getAlertSilences() {
+    return instance.get('/alerts/silences')
+  },
+
+  async createAlertSilence(silence) {
+    return instance.post('/alerts/silences', silence)
+  },
+
+  async deleteAlertSilence(id) {
+    return instance.delete(`/alerts/silences/${id}`)
+  },
+
+  async getAuditLog(params) {
+    return instance.get('/audit', { params })
+  },
+
   // 节点规则 API
   async getNodeRules(nodeId) {
     const params = nodeId ? { node_id: nodeId } : {}
@@ -105,6 +235,42 @@ export default {
     return instance.post(`/node-rules/${id}/toggle`, { enabled })
   },
 
+  async getNodeRuleConnections(id) {
+    return instance.get(`/node-rules/${id}/connections`)
+  },
+
+  async closeNodeRuleConnection(id, connId) {
+    return instance.delete(`/node-rules/${id}/connections/${connId}`)
+  },
+
+  async closeNodeRuleConnectionsFrom(id, sourceIp) {
+    return instance.delete(`/node-rules/${id}/connections`, { params: { source_ip: sourceIp } })
+  },
+
+  async getRuleTimings(id) {
+    return instance.get(`/rules/${id}/timings`)
+  },
+
+  async getNodeRuleTimings(id) {
+    return instance.get(`/node-rules/${id}/timings`)
+  },
+
+  async getMeshMatrix() {
+    return instance.get('/mesh')
+  },
+
+  async getMeshSettings() {
+    return instance.get('/mesh/settings')
+  },
+
+  async updateMeshSettings(settings) {
+    return instance.put('/mesh/settings', settings)
+  },
+
+  async getMeshHistory(source, target, params) {
+    return instance.get('/mesh/history', { params: { source, target, ...params } })
+  },
+
   async getNodeInstallScript(nodeId) {
     return instance.get(`/nodes/${nodeId}/install`)
   },
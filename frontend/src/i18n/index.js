@@ -23,7 +23,8 @@ const messages = {
       theme: 'Theme',
       light: 'Light',
       dark: 'Dark',
-      auto: 'Auto'
+      auto: 'Auto',
+      refresh: 'Refresh'
     },
     login: {
       title: 'Port Forward Dashboard',
@@ -58,6 +59,8 @@ const messages = {
       protocol: 'Protocol',
       traffic: 'Traffic',
       latency: 'Latency',
+      jitter: 'Jitter',
+      successRate: 'Probe success',
       running: 'Running',
       stopped: 'Stopped',
       noTunnels: 'No tunnels configured.',
@@ -92,7 +95,7 @@ const messages = {
       title: 'Node Management',
       addNode: 'Add Node',
       editNode: 'Edit Node',
-      deleteNode: 'Delete this node?',
+      deleteNode: 'Remove this node from the panel? The agent on the server is not uninstalled.',
       nodeCreated: 'Node created',
       nodeUpdated: 'Node updated',
       nodeDeleted: 'Node deleted',
@@ -102,7 +105,15 @@ const messages = {
       status: 'Status',
       online: 'Online',
       offline: 'Offline',
+      lastHeartbeat: 'Last Heartbeat',
+      never: 'Never',
+      keyAge: 'Key Age',
+      certExpires: 'Cert Expires In',
       memory: 'Memory',
+      network: 'Network',
+      disk: 'Disk',
+      load: 'Load',
+      openFds: 'Open FDs',
       tunnels: 'Tunnels',
       tunnelList: 'Tunnel List',
       addTunnel: 'Add Tunnel',
@@ -120,6 +131,39 @@ const messages = {
       selectNode: 'Node',
       manageNodes: 'Manage Nodes',
       installCommand: 'Install Node',
+      enrollNode: 'Join Token',
+      enrollExpires: 'Single-use, expires at {time}',
+      uninstallAgent: 'Uninstall Agent',
+      uninstallConfirm: 'Uninstall the agent on "{name}"? All tunnels on the node will stop and the agent will be removed from the server. The node stays in the panel.',
+      uninstallSent: 'Uninstall command sent, waiting for the agent to report back',
+      diagnostics: 'Diagnostics',
+      diagType: 'Check',
+      diagTunnel: 'Tunnel',
+      diagTunnelHint: 'Optional, fills target and port from the tunnel',
+      diagTarget: 'Target',
+      diagPort: 'Port',
+      diagRun: 'Run',
+      diagTcpConnect: 'TCP connect',
+      diagDns: 'DNS lookup',
+      diagTraceroute: 'Traceroute',
+      diagListenCheck: 'Listening port',
+      diagConnections: 'Tunnel connections',
+      connections: 'Connections',
+      connCount: '{count} active connections',
+      connClient: 'Client',
+      connTarget: 'Target',
+      connDuration: 'Duration',
+      connClose: 'Close',
+      connCloseIp: 'Close IP',
+      connCloseIpConfirm: 'Close all connections from {ip}?',
+      connClosed: '{count} connection(s) closed',
+      noConnections: 'No active connections',
+      accessLog: 'Access log',
+      accessLogTime: 'Time',
+      accessLogEvent: 'Event',
+      accessLogReason: 'Reason',
+      accessLogClientIp: 'Client IP',
+      noAccessLog: 'No access log entries. Enable the access log on a tunnel to record connections.',
       installTip: 'One-Click Installation',
       installTipDesc: 'Copy the command below and run it on your server to automatically install and configure the node agent.',
       oneLineInstall: 'One-line install command:',
@@ -173,7 +217,8 @@ const messages = {
       theme: '主题',
       light: '浅色',
       dark: '深色',
-      auto: '自动'
+      auto: '自动',
+      refresh: '刷新'
     },
     login: {
       title: '端口转发管理面板',
@@ -208,6 +253,8 @@ const messages = {
       protocol: '协议',
       traffic: '流量',
       latency: '延迟',
+      jitter: '抖动',
+      successRate: '探测成功率',
       running: '运行中',
       stopped: '已停止',
       noTunnels: '暂无隧道配置。',
@@ -242,7 +289,7 @@ const messages = {
       title: '节点管理',
       addNode: '添加节点',
       editNode: '编辑节点',
-      deleteNode: '确定删除此节点？',
+      deleteNode: '确定从面板移除此节点？服务器上的 Agent 不会被卸载。',
       nodeCreated: '节点创建成功',
       nodeUpdated: '节点更新成功',
       nodeDeleted: '节点删除成功',
@@ -252,7 +299,15 @@ const messages = {
       status: '状态',
       online: '在线',
       offline: '离线',
+      lastHeartbeat: '最近心跳',
+      never: '从未',
+      keyAge: '密钥使用时长',
+      certExpires: '证书剩余有效期',
       memory: '内存',
+      network: '网络',
+      disk: '磁盘',
+      load: '负载',
+      openFds: '文件描述符',
       tunnels: '隧道',
       tunnelList: '隧道列表',
       addTunnel: '添加隧道',
@@ -270,6 +325,39 @@ const messages = {
       selectNode: '节点',
       manageNodes: '管理节点',
       installCommand: '安装节点',
+      enrollNode: '注册令牌',
+      enrollExpires: '仅可使用一次，{time} 过期',
+      uninstallAgent: '卸载 Agent',
+      uninstallConfirm: '确定卸载节点「{name}」上的 Agent？节点上的所有隧道将停止，Agent 会从服务器删除，节点仍保留在面板中。',
+      uninstallSent: '卸载指令已下发，等待 Agent 回报结果',
+      diagnostics: '诊断',
+      diagType: '检查项',
+      diagTunnel: '隧道',
+      diagTunnelHint: '可选，使用隧道的目标地址和端口',
+      diagTarget: '目标',
+      diagPort: '端口',
+      diagRun: '执行',
+      diagTcpConnect: 'TCP 连接测试',
+      diagDns: 'DNS 解析',
+      diagTraceroute: '路由追踪',
+      diagListenCheck: '端口监听检查',
+      diagConnections: '隧道当前连接',
+      connections: '连接',
+      connCount: '{count} 个活动连接',
+      connClient: '客户端',
+      connTarget: '目标',
+      connDuration: '时长',
+      connClose: '断开',
+      connCloseIp: '断开该 IP',
+      connCloseIpConfirm: '断开来自 {ip} 的所有连接？',
+      connClosed: '已断开 {count} 个连接',
+      noConnections: '暂无活动连接',
+      accessLog: '访问日志',
+      accessLogTime: '时间',
+      accessLogEvent: '事件',
+      accessLogReason: '关闭原因',
+      accessLogClientIp: '客户端 IP',
+      noAccessLog: '暂无访问记录，在隧道上开启访问日志后会记录连接',
       installTip: '一键安装',
       installTipDesc: '复制下方命令到您的服务器执行，即可自动安装并配置节点 Agent。',
       oneLineInstall: '一键安装命令：',
@@ -314,7 +402,7 @@ export function useI18n() {
     }
   })
 
-  function t(key) {
+  function t(key, params) {
     const keys = key.split('.')
     let value = messages[currentLocale.value]
     for (const k of keys) {
@@ -324,6 +412,9 @@ export function useI18n() {
         return key
       }
     }
+    if (value && params) {
+      return value.replace(/\{(\w+)\}/g, (m, name) => (name in params ? params[name] : m))
+    }
     return value || key
   }
 
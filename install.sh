@@ -50,15 +50,23 @@ print_warning() {
 # 解析参数
 NODE_NAME="Node"
 NODE_KEY=""
+NODE_TOKEN=""
 NODE_PORT=9090
+NODE_BIND=""
+NODE_ALLOW=""
 MASTER_URL=""
+UPDATE_PUBKEY=""
 
 while [[ $# -gt 0 ]]; do
     case $1 in
         --name) NODE_NAME="$2"; shift 2 ;;
         --key) NODE_KEY="$2"; shift 2 ;;
+        --token) NODE_TOKEN="$2"; shift 2 ;;
         --port) NODE_PORT="$2"; shift 2 ;;
+        --bind) NODE_BIND="$2"; shift 2 ;;
+        --allow) NODE_ALLOW="$2"; shift 2 ;;
         --master) MASTER_URL="$2"; shift 2 ;;
+        --update-pubkey) UPDATE_PUBKEY="$2"; shift 2 ;;
         *) shift ;;
     esac
 done
@@ -67,8 +75,8 @@ done
 print_banner
 
 # 参数验证
-if [ -z "$NODE_KEY" ]; then
-    print_error "错误: 必须提供 --key 参数"
+if [ -z "$NODE_KEY" ] && [ -z "$NODE_TOKEN" ]; then
+    print_error "错误: 必须提供 --key 或 --token 参数"
     exit 1
 fi
 
@@ -103,41 +111,55 @@ echo ""
 INSTALL_DIR="/opt/port-forward-agent"
 mkdir -p $INSTALL_DIR
 
-# 检查 Go 环境
-print_step "2/5" "检查 Go 环境"
-if ! command -v go &> /dev/null; then
-    print_warning "未检测到 Go，正在安装..."
-    curl -fsSL "https://go.dev/dl/go1.21.5.linux-$ARCH.tar.gz" 2>/dev/null | tar -C /usr/local -xzf -
-    export PATH=$PATH:/usr/local/go/bin
-    echo 'export PATH=$PATH:/usr/local/go/bin' >> ~/.bashrc
-    print_success "Go 安装完成"
-else
-    GO_VERSION=$(go version | awk '{print $3}')
-    print_success "Go 已安装: ${CYAN}$GO_VERSION${NC}"
-fi
-echo ""
-
-# 下载源码并编译
-print_step "3/5" "下载 Agent 源码"
+# 从主控下载预编译的 Agent
+print_step "2/5" "下载 Agent"
+BINARY="port-forward-agent-$OS-$ARCH"
 TEMP_DIR=$(mktemp -d)
-cd $TEMP_DIR
+trap 'rm -rf "$TEMP_DIR"' EXIT
 
-curl -fsSL "https://raw.githubusercontent.com/jiuwovo-ai/tcp-zz/main/agent/main.go" -o main.go 2>/dev/null
-curl -fsSL "https://raw.githubusercontent.com/jiuwovo-ai/tcp-zz/main/agent/go.mod" -o go.mod 2>/dev/null
-print_success "源码下载完成"
+if ! curl -fsSL "$MASTER_URL/api/agent/download?os=$OS&arch=$ARCH" -o "$TEMP_DIR/$BINARY"; then
+    print_error "下载失败，主控上可能没有 $OS/$ARCH 的 Agent"
+    exit 1
+fi
+print_success "下载完成"
 echo ""
 
-print_step "4/5" "编译 Agent"
-go mod tidy 2>/dev/null
-go build -o $INSTALL_DIR/port-forward-agent . 2>/dev/null
-print_success "编译完成"
+print_step "3/5" "校验 Agent"
+if ! curl -fsSL "$MASTER_URL/api/agent/checksums" -o "$TEMP_DIR/SHA256SUMS"; then
+    print_error "无法获取校验和"
+    exit 1
+fi
+if ! (cd "$TEMP_DIR" && grep " $BINARY\$" SHA256SUMS | sha256sum -c --status -); then
+    print_error "SHA256 校验失败，已中止安装"
+    exit 1
+fi
+print_success "SHA256 校验通过"
+echo ""
 
-cd $INSTALL_DIR
-rm -rf $TEMP_DIR
+print_step "4/5" "安装 Agent"
+systemctl stop port-forward-agent >/dev/null 2>&1 || true
+install -m 0755 "$TEMP_DIR/$BINARY" "$INSTALL_DIR/port-forward-agent"
+# 更新签名公钥需由面板生成的安装命令带入，不从主控在线获取
+if [ -n "$UPDATE_PUBKEY" ]; then
+    echo "$UPDATE_PUBKEY" > "$INSTALL_DIR/update.pub"
+    chmod 600 "$INSTALL_DIR/update.pub"
+else
+    print_warning "未提供 --update-pubkey，Agent 自动更新和签名指令将不可用"
+fi
+print_success "安装完成"
 echo ""
 
 # 创建 systemd 服务
 print_step "5/5" "配置系统服务"
+if [ -n "$NODE_KEY" ]; then
+    AGENT_AUTH="-key \"$NODE_KEY\" -master \"$MASTER_URL\""
+else
+    AGENT_AUTH="-join \"$MASTER_URL\" \"$NODE_TOKEN\""
+fi
+# 控制 API 默认只接受本机和主控地址（由面板地址解析）访问，主控经 NAT 或代理出口时需用 --allow 追加，--allow "*" 不限制来源
+AGENT_OPTS=""
+[ -n "$NODE_BIND" ] && AGENT_OPTS="$AGENT_OPTS -bind \"$NODE_BIND\""
+[ -n "$NODE_ALLOW" ] && AGENT_OPTS="$AGENT_OPTS -allow \"$NODE_ALLOW\""
 cat > /etc/systemd/system/port-forward-agent.service << EOF
 [Unit]
 Description=Port Forward Agent
@@ -145,7 +167,7 @@ After=network.target
 
 [Service]
 Type=simple
-ExecStart=$INSTALL_DIR/port-forward-agent -name "$NODE_NAME" -key "$NODE_KEY" -port $NODE_PORT -master "$MASTER_URL"
+ExecStart=$INSTALL_DIR/port-forward-agent -name "$NODE_NAME" -port $NODE_PORT$AGENT_OPTS $AGENT_AUTH
 Restart=always
 RestartSec=5
 WorkingDirectory=$INSTALL_DIR
@@ -156,7 +178,7 @@ EOF
 
 systemctl daemon-reload >/dev/null 2>&1
 systemctl enable port-forward-agent >/dev/null 2>&1
-systemctl start port-forward-agent >/dev/null 2>&1
+systemctl restart port-forward-agent >/dev/null 2>&1
 print_success "服务配置完成"
 echo ""
 